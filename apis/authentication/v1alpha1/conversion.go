@@ -0,0 +1,133 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+)
+
+// ConversionDataAnnotation holds the spec and status of v1beta1 on the v1alpha1 object, so that
+// the fields absent in v1alpha1 survive a round trip through v1alpha1.
+const ConversionDataAnnotation = "authentication.open-cluster-management.io/conversion-data"
+
+type conversionData struct {
+	Spec   v1beta1.ManagedServiceAccountSpec   `json:"spec"`
+	Status v1beta1.ManagedServiceAccountStatus `json:"status"`
+}
+
+var _ conversion.Convertible = &ManagedServiceAccount{}
+
+// ConvertTo converts the v1alpha1 ManagedServiceAccount to the hub version v1beta1.
+func (src *ManagedServiceAccount) ConvertTo(dstRaw conversion.Hub) error {
+	dst, ok := dstRaw.(*v1beta1.ManagedServiceAccount)
+	if !ok {
+		return fmt.Errorf("unexpected conversion hub %T", dstRaw)
+	}
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Spec = v1beta1.ManagedServiceAccountSpec{}
+	dst.Status = v1beta1.ManagedServiceAccountStatus{}
+	if data, ok := src.Annotations[ConversionDataAnnotation]; ok {
+		restored := &conversionData{}
+		if err := json.Unmarshal([]byte(data), restored); err != nil {
+			return fmt.Errorf("failed to unmarshal the conversion data of %s/%s: %w", src.Namespace, src.Name, err)
+		}
+		dst.Spec = restored.Spec
+		dst.Status = restored.Status
+		delete(dst.Annotations, ConversionDataAnnotation)
+		if len(dst.Annotations) == 0 {
+			dst.Annotations = nil
+		}
+	}
+
+	// the fields served in v1alpha1 take precedence over the restored ones, they may be
+	// changed by the v1alpha1 clients
+	dst.Spec.Rotation.Enabled = src.Spec.Rotation.Enabled
+	dst.Spec.Rotation.Validity = src.Spec.Rotation.Validity
+	dst.Spec.TTLSecondsAfterCreation = src.Spec.TTLSecondsAfterCreation
+	dst.Status.Conditions = src.Status.Conditions
+	dst.Status.ExpirationTimestamp = src.Status.ExpirationTimestamp
+	dst.Status.TokenSecretRef = nil
+	if src.Status.TokenSecretRef != nil {
+		dst.Status.TokenSecretRef = &v1beta1.SecretRef{
+			Name:                 src.Status.TokenSecretRef.Name,
+			LastRefreshTimestamp: src.Status.TokenSecretRef.LastRefreshTimestamp,
+		}
+	}
+	return nil
+}
+
+// ConvertFrom converts the hub version v1beta1 ManagedServiceAccount to v1alpha1.
+func (dst *ManagedServiceAccount) ConvertFrom(srcRaw conversion.Hub) error {
+	src, ok := srcRaw.(*v1beta1.ManagedServiceAccount)
+	if !ok {
+		return fmt.Errorf("unexpected conversion hub %T", srcRaw)
+	}
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Spec = ManagedServiceAccountSpec{
+		Rotation: ManagedServiceAccountRotation{
+			Enabled:  src.Spec.Rotation.Enabled,
+			Validity: src.Spec.Rotation.Validity,
+		},
+		TTLSecondsAfterCreation: src.Spec.TTLSecondsAfterCreation,
+	}
+	dst.Status = ManagedServiceAccountStatus{
+		Conditions:          src.Status.Conditions,
+		ExpirationTimestamp: src.Status.ExpirationTimestamp,
+	}
+	if src.Status.TokenSecretRef != nil {
+		dst.Status.TokenSecretRef = &SecretRef{
+			Name:                 src.Status.TokenSecretRef.Name,
+			LastRefreshTimestamp: src.Status.TokenSecretRef.LastRefreshTimestamp,
+		}
+	}
+
+	// keep the v1beta1 fields only if there is anything lost in v1alpha1
+	converted := &v1beta1.ManagedServiceAccount{}
+	dst.DeepCopy().convertWithoutData(converted)
+	if equality.Semantic.DeepEqual(src.Spec, converted.Spec) &&
+		equality.Semantic.DeepEqual(src.Status, converted.Status) {
+		return nil
+	}
+
+	data, err := json.Marshal(&conversionData{
+		Spec:   src.Spec,
+		Status: src.Status,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal the conversion data of %s/%s: %w", src.Namespace, src.Name, err)
+	}
+	if dst.Annotations == nil {
+		dst.Annotations = map[string]string{}
+	}
+	dst.Annotations[ConversionDataAnnotation] = string(data)
+	return nil
+}
+
+// convertWithoutData converts the v1alpha1 fields to v1beta1 regardless of the conversion data.
+func (src *ManagedServiceAccount) convertWithoutData(dst *v1beta1.ManagedServiceAccount) {
+	delete(src.Annotations, ConversionDataAnnotation)
+	// never fails without the conversion data
+	_ = src.ConvertTo(dst)
+}
@@ -0,0 +1,169 @@
+package v1alpha1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	"open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+)
+
+func TestRoundTripFromHub(t *testing.T) {
+	now := metav1.NewTime(time.Now().Truncate(time.Second))
+	cases := []struct {
+		name               string
+		hub                *v1beta1.ManagedServiceAccount
+		expectedAnnotation bool
+	}{
+		{
+			name: "fields served in both versions",
+			hub: &v1beta1.ManagedServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "cluster1",
+					Name:      "msa1",
+					Labels:    map[string]string{"app": "demo"},
+				},
+				Spec: v1beta1.ManagedServiceAccountSpec{
+					Rotation: v1beta1.ManagedServiceAccountRotation{
+						Enabled:  true,
+						Validity: metav1.Duration{Duration: time.Hour},
+					},
+					TTLSecondsAfterCreation: ptr.To[int32](3600),
+				},
+				Status: v1beta1.ManagedServiceAccountStatus{
+					Conditions: []metav1.Condition{
+						{Type: v1beta1.ConditionTypeTokenReported, Status: metav1.ConditionTrue, Reason: "TokenReported"},
+					},
+					ExpirationTimestamp: &now,
+					TokenSecretRef: &v1beta1.SecretRef{
+						Name:                 "msa1",
+						LastRefreshTimestamp: now,
+					},
+				},
+			},
+		},
+		{
+			name: "fields absent in v1alpha1",
+			hub: &v1beta1.ManagedServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:   "cluster1",
+					Name:        "msa1",
+					Annotations: map[string]string{"foo": "bar"},
+				},
+				Spec: v1beta1.ManagedServiceAccountSpec{
+					Rotation: v1beta1.ManagedServiceAccountRotation{
+						Enabled:       true,
+						Validity:      metav1.Duration{Duration: time.Hour},
+						RefreshBefore: "50%",
+						Window: &v1beta1.RotationWindow{
+							Schedule: "0 2 * * 6",
+							Duration: metav1.Duration{Duration: 4 * time.Hour},
+						},
+					},
+					Permissions: &v1beta1.ManagedServiceAccountPermissions{
+						ClusterRoles: []v1beta1.ManagedClusterRole{
+							{
+								Name: "reader",
+								Rules: []rbacv1.PolicyRule{
+									{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}},
+								},
+							},
+						},
+					},
+					Token: &v1beta1.ManagedServiceAccountToken{
+						Audiences: []string{"vault"},
+					},
+					ServiceAccount: &v1beta1.SpokeServiceAccount{
+						Namespace: "ns1",
+						Name:      "sa1",
+						Mode:      v1beta1.ServiceAccountModeCreate,
+					},
+					Projection: &v1beta1.ManagedServiceAccountProjection{
+						Type: v1beta1.ProjectionTypeSecret,
+						Secret: &v1beta1.SecretProjection{
+							Name:   "custom",
+							Format: v1beta1.SecretFormatKubeconfig,
+						},
+					},
+				},
+				Status: v1beta1.ManagedServiceAccountStatus{
+					TokenAudiences: []string{"vault"},
+				},
+			},
+			expectedAnnotation: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			spoke := &ManagedServiceAccount{}
+			assert.NoError(t, spoke.ConvertFrom(c.hub.DeepCopy()))
+			_, ok := spoke.Annotations[ConversionDataAnnotation]
+			assert.Equal(t, c.expectedAnnotation, ok)
+
+			hub := &v1beta1.ManagedServiceAccount{}
+			assert.NoError(t, spoke.ConvertTo(hub))
+			assert.Equal(t, c.hub, hub)
+		})
+	}
+}
+
+func TestRoundTripFromSpoke(t *testing.T) {
+	spoke := &ManagedServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "cluster1",
+			Name:      "msa1",
+		},
+		Spec: ManagedServiceAccountSpec{
+			Rotation: ManagedServiceAccountRotation{
+				Enabled:  true,
+				Validity: metav1.Duration{Duration: time.Hour},
+			},
+		},
+		Status: ManagedServiceAccountStatus{
+			TokenSecretRef: &SecretRef{Name: "msa1"},
+		},
+	}
+
+	hub := &v1beta1.ManagedServiceAccount{}
+	assert.NoError(t, spoke.DeepCopy().ConvertTo(hub))
+	restored := &ManagedServiceAccount{}
+	assert.NoError(t, restored.ConvertFrom(hub))
+	assert.Equal(t, spoke, restored)
+}
+
+func TestConvertToWithChangedSpokeFields(t *testing.T) {
+	hub := &v1beta1.ManagedServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "cluster1", Name: "msa1"},
+		Spec: v1beta1.ManagedServiceAccountSpec{
+			Rotation: v1beta1.ManagedServiceAccountRotation{
+				Validity: metav1.Duration{Duration: time.Hour},
+			},
+			Token: &v1beta1.ManagedServiceAccountToken{Audiences: []string{"vault"}},
+		},
+	}
+	spoke := &ManagedServiceAccount{}
+	assert.NoError(t, spoke.ConvertFrom(hub))
+
+	// a v1alpha1 client changes the validity, the v1beta1 fields are kept
+	spoke.Spec.Rotation.Validity = metav1.Duration{Duration: 2 * time.Hour}
+	converted := &v1beta1.ManagedServiceAccount{}
+	assert.NoError(t, spoke.ConvertTo(converted))
+	assert.Equal(t, 2*time.Hour, converted.Spec.Rotation.Validity.Duration)
+	assert.Equal(t, []string{"vault"}, converted.Spec.Token.Audiences)
+	assert.NotContains(t, converted.Annotations, ConversionDataAnnotation)
+}
+
+func TestConvertToWithInvalidData(t *testing.T) {
+	spoke := &ManagedServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "cluster1",
+			Name:        "msa1",
+			Annotations: map[string]string{ConversionDataAnnotation: "{"},
+		},
+	}
+	assert.Error(t, spoke.ConvertTo(&v1beta1.ManagedServiceAccount{}))
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func init() {
+	SchemeBuilder.Register(&ClusterManagedServiceAccountTemplate{}, &ClusterManagedServiceAccountTemplateList{})
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:printcolumn:name="Provisioned",type=integer,JSONPath=`.status.provisioned`
+//+kubebuilder:printcolumn:name="Clusters",type=integer,JSONPath=`.status.clusters`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// ClusterManagedServiceAccountTemplate provisions a ManagedServiceAccount in the namespace of each
+// ManagedCluster matching the selector, once the addon is available on the cluster.
+type ClusterManagedServiceAccountTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterManagedServiceAccountTemplateSpec   `json:"spec,omitempty"`
+	Status ClusterManagedServiceAccountTemplateStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ClusterManagedServiceAccountTemplateList contains a list of ClusterManagedServiceAccountTemplate
+type ClusterManagedServiceAccountTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterManagedServiceAccountTemplate `json:"items"`
+}
+
+// ClusterManagedServiceAccountTemplateSpec defines the ManagedServiceAccounts to provision and the
+// ManagedClusters to provision them for.
+type ClusterManagedServiceAccountTemplateSpec struct {
+	// ClusterSelector selects the ManagedClusters by their labels. All the ManagedClusters are
+	// selected if it is unset.
+	// +optional
+	ClusterSelector *metav1.LabelSelector `json:"clusterSelector,omitempty"`
+	// Template is the ManagedServiceAccount provisioned in the namespace of each selected
+	// ManagedCluster, with the name of the ClusterManagedServiceAccountTemplate. The changes to
+	// the template are propagated to the provisioned ManagedServiceAccounts.
+	// +required
+	Template ManagedServiceAccountTemplate `json:"template"`
+}
+
+// ClusterManagedServiceAccountTemplateStatus reports the provisioned ManagedServiceAccounts.
+type ClusterManagedServiceAccountTemplateStatus struct {
+	// ObservedGeneration is the generation of the spec propagated to the ManagedServiceAccounts.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Clusters is the number of the ManagedClusters matching the selector.
+	// +optional
+	Clusters int32 `json:"clusters"`
+	// Provisioned is the number of the ManagedServiceAccounts which are up to date with the
+	// template, the ManagedServiceAccounts are not provisioned until the addon is available.
+	// +optional
+	Provisioned int32 `json:"provisioned"`
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func init() {
+	SchemeBuilder.Register(&CredentialRevocation{}, &CredentialRevocationList{})
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:printcolumn:name="Action",type=string,JSONPath=`.spec.action`
+//+kubebuilder:printcolumn:name="Complete",type=string,JSONPath=`.status.conditions[?(@.type=="Complete")].status`
+//+kubebuilder:printcolumn:name="Clusters",type=integer,JSONPath=`.status.summary.completedClusters`
+//+kubebuilder:printcolumn:name="Total",type=integer,JSONPath=`.status.summary.clusters`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// CredentialRevocation is a request to revoke or re-issue the tokens of the ManagedServiceAccounts
+// across the managed clusters.
+type CredentialRevocation struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CredentialRevocationSpec   `json:"spec,omitempty"`
+	Status CredentialRevocationStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// CredentialRevocationList contains a list of CredentialRevocation
+type CredentialRevocationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CredentialRevocation `json:"items"`
+}
+
+// CredentialRevocationSpec defines the ManagedServiceAccounts to revoke the tokens of.
+// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="spec is immutable"
+type CredentialRevocationSpec struct {
+	// Action is what is done to the tokens. Revoke invalidates all the outstanding tokens by
+	// increasing the spec.revocationGeneration of the ManagedServiceAccounts, and Reissue
+	// rotates the tokens regardless of their expiration.
+	// +optional
+	// +kubebuilder:default=Revoke
+	// +kubebuilder:validation:Enum=Revoke;Reissue
+	Action CredentialRevocationAction `json:"action,omitempty"`
+	// ClusterSelector selects the ManagedClusters by their labels. All the ManagedClusters are
+	// selected if it is unset.
+	// +optional
+	ClusterSelector *metav1.LabelSelector `json:"clusterSelector,omitempty"`
+	// ClusterNames restricts the selected ManagedClusters to the listed ones.
+	// +optional
+	ClusterNames []string `json:"clusterNames,omitempty"`
+	// ServiceAccountSelector selects the ManagedServiceAccounts in the namespaces of the
+	// selected ManagedClusters by their labels. All the ManagedServiceAccounts are selected if
+	// it is unset.
+	// +optional
+	ServiceAccountSelector *metav1.LabelSelector `json:"serviceAccountSelector,omitempty"`
+	// Timeout is how long to wait for the agents to handle the request, the request finishes
+	// with the unhandled ManagedServiceAccounts reported as pending after the timeout. It
+	// waits forever if it is unset.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+type CredentialRevocationAction string
+
+const (
+	CredentialRevocationActionRevoke  CredentialRevocationAction = "Revoke"
+	CredentialRevocationActionReissue CredentialRevocationAction = "Reissue"
+)
+
+// CredentialRevocationStatus reports the progress of the request.
+type CredentialRevocationStatus struct {
+	// StartTimestamp is the time the request is dispatched to the ManagedServiceAccounts. The
+	// ManagedClusters are selected at the start and recorded in the clusters, the ManagedClusters
+	// and the ManagedServiceAccounts created afterwards are not targeted.
+	// +optional
+	StartTimestamp *metav1.Time `json:"startTimestamp,omitempty"`
+	// CompletionTimestamp is the time the request finishes.
+	// +optional
+	CompletionTimestamp *metav1.Time `json:"completionTimestamp,omitempty"`
+	// Clusters is the progress on each selected ManagedCluster.
+	// +optional
+	// +listType=map
+	// +listMapKey=clusterName
+	Clusters []ClusterRevocationStatus `json:"clusters,omitempty"`
+	// Summary is the progress across the selected ManagedClusters.
+	// +optional
+	Summary CredentialRevocationSummary `json:"summary,omitempty"`
+	// Conditions is the condition list.
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// ClusterRevocationStatus is the progress of the request on a ManagedCluster.
+type ClusterRevocationStatus struct {
+	// ClusterName is the name of the ManagedCluster.
+	// +required
+	ClusterName string `json:"clusterName"`
+	// Completed is the number of the ManagedServiceAccounts whose tokens are revoked or
+	// re-issued by the agent.
+	Completed int32 `json:"completed"`
+	// Skipped is the number of the ManagedServiceAccounts the action does not apply to, e.g.
+	// the tokens of an adopted ServiceAccount cannot be revoked.
+	// +optional
+	Skipped int32 `json:"skipped,omitempty"`
+	// Pending is the number of the ManagedServiceAccounts not handled by the agent yet.
+	// +optional
+	Pending int32 `json:"pending,omitempty"`
+	// PendingServiceAccounts are the names of the pending ManagedServiceAccounts, at most 100
+	// of them are listed across the ManagedClusters.
+	// +optional
+	PendingServiceAccounts []string `json:"pendingServiceAccounts,omitempty"`
+}
+
+// CredentialRevocationSummary is the progress of the request across the ManagedClusters.
+type CredentialRevocationSummary struct {
+	// Clusters is the number of the selected ManagedClusters.
+	Clusters int32 `json:"clusters"`
+	// CompletedClusters is the number of the ManagedClusters without pending ManagedServiceAccounts.
+	CompletedClusters int32 `json:"completedClusters"`
+	// ServiceAccounts is the number of the selected ManagedServiceAccounts.
+	ServiceAccounts int32 `json:"serviceAccounts"`
+	// Completed is the number of the ManagedServiceAccounts handled by the agents.
+	Completed int32 `json:"completed"`
+	// Skipped is the number of the ManagedServiceAccounts the action does not apply to.
+	Skipped int32 `json:"skipped"`
+	// Pending is the number of the ManagedServiceAccounts not handled by the agents yet.
+	Pending int32 `json:"pending"`
+}
+
+const (
+	// ConditionTypeComplete is true once all the selected ManagedServiceAccounts are handled, or the
+	// request times out.
+	ConditionTypeComplete string = "Complete"
+)
@@ -17,7 +17,9 @@ limitations under the License.
 package v1beta1
 
 import (
+	rbacv1 "k8s.io/api/rbac/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 )
 
 func init() {
@@ -27,6 +29,11 @@ func init() {
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 //+kubebuilder:storageversion
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Expiration",type=date,JSONPath=`.status.expirationTimestamp`
+//+kubebuilder:printcolumn:name="Validity",type=string,JSONPath=`.status.effectiveValidity`
+//+kubebuilder:printcolumn:name="Rotations",type=integer,JSONPath=`.status.rotationCount`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // +genclient
 // ManagedServiceAccount is the Schema for the managedserviceaccounts API
@@ -48,6 +55,7 @@ type ManagedServiceAccountList struct {
 }
 
 // ManagedServiceAccountSpec defines the desired state of ManagedServiceAccount
+// +kubebuilder:validation:XValidation:rule="has(self.serviceAccount) == has(oldSelf.serviceAccount)",message="serviceAccount is immutable"
 type ManagedServiceAccountSpec struct {
 	// Rotation is the policy for rotation the credentials.
 	Rotation ManagedServiceAccountRotation `json:"rotation"`
@@ -64,6 +72,48 @@ type ManagedServiceAccountSpec struct {
 	//+kubebuilder:validation:ExclusiveMinimum=true
 	//+kubebuilder:validation:Minimum=0
 	TTLSecondsAfterCreation *int32 `json:"ttlSecondsAfterCreation,omitempty"`
+
+	// Permissions prescribes the RBAC permissions granted to the ServiceAccount on the
+	// managed cluster. The agent creates, updates and garbage-collects the corresponding
+	// Roles, ClusterRoles and their bindings.
+	// +optional
+	Permissions *ManagedServiceAccountPermissions `json:"permissions,omitempty"`
+
+	// Token prescribes the options for requesting the ServiceAccount token.
+	// +optional
+	Token *ManagedServiceAccountToken `json:"token,omitempty"`
+
+	// CredentialType is the type of the credential issued for the ServiceAccount. With the
+	// Token type, a ServiceAccount token is requested. With the ClientCertificate type, an X.509
+	// client certificate of the ServiceAccount identity is issued by a CertificateSigningRequest
+	// of the "kubernetes.io/kube-apiserver-client" signer on the managed cluster, and the token
+	// Secret holds the "tls.crt" and "tls.key" keys instead of the "token" key. The client
+	// certificates cannot be revoked before they expire.
+	// +optional
+	// +kubebuilder:default=Token
+	// +kubebuilder:validation:Enum=Token;ClientCertificate
+	CredentialType CredentialType `json:"credentialType,omitempty"`
+
+	// ServiceAccount prescribes the ServiceAccount on the managed cluster. If it is unset,
+	// the ServiceAccount is created in the namespace of the addon agent with the name of
+	// the ManagedServiceAccount.
+	// +optional
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="serviceAccount is immutable"
+	ServiceAccount *SpokeServiceAccount `json:"serviceAccount,omitempty"`
+
+	// Projection prescribes how the token is delivered on the hub cluster. If it is unset,
+	// the token is projected into a Secret named after the ManagedServiceAccount.
+	// +optional
+	Projection *ManagedServiceAccountProjection `json:"projection,omitempty"`
+
+	// RevocationGeneration revokes all the outstanding tokens once it is increased. The agent
+	// recreates the ServiceAccount on the managed cluster, so that the issued tokens fail the
+	// authentication, and then issues a fresh token. The tokens of an adopted ServiceAccount
+	// cannot be revoked, neither can the client certificates.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:XValidation:rule="self >= oldSelf",message="revocationGeneration cannot be decreased"
+	RevocationGeneration int64 `json:"revocationGeneration,omitempty"`
 }
 
 // ManagedServiceAccountStatus defines the observed state of ManagedServiceAccount
@@ -77,8 +127,86 @@ type ManagedServiceAccountStatus struct {
 	// TokenSecretRef is a reference to the corresponding ServiceAccount's Secret, which stores
 	// the CA certficate and token from the managed cluster.
 	TokenSecretRef *SecretRef `json:"tokenSecretRef,omitempty"`
+	// TokenAudiences are the audiences the current token is issued for.
+	// +optional
+	TokenAudiences []string `json:"tokenAudiences,omitempty"`
+	// ObservedGeneration is the generation of the ManagedServiceAccount last reconciled by the agent.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// ServiceAccountUID is the UID of the ServiceAccount on the managed cluster the token is issued for.
+	// +optional
+	ServiceAccountUID types.UID `json:"serviceAccountUID,omitempty"`
+	// TokenIssuer is the issuer of the current token.
+	// +optional
+	TokenIssuer string `json:"tokenIssuer,omitempty"`
+	// EffectiveValidity is the validity of the current token granted by the managed cluster, which
+	// may be shorter than spec.rotation.validity, e.g. on the distributions with a maximum token lifetime.
+	// +optional
+	EffectiveValidity *metav1.Duration `json:"effectiveValidity,omitempty"`
+	// RotationCount is the number of the tokens issued for the ManagedServiceAccount.
+	// +optional
+	RotationCount int64 `json:"rotationCount,omitempty"`
+	// NextRotationTimestamp is the time the current token is scheduled to be rotated.
+	// +optional
+	NextRotationTimestamp *metav1.Time `json:"nextRotationTimestamp,omitempty"`
+	// LastRevocation is the last revocation of the tokens.
+	// +optional
+	LastRevocation *TokenRevocation `json:"lastRevocation,omitempty"`
+	// LastCredentialRevocation is the last CredentialRevocation handled by the agent, echoed from the
+	// annotations set by the manager once the token is revoked or re-issued. The manager tracks the
+	// progress of the CredentialRevocation with it.
+	// +optional
+	LastCredentialRevocation *CredentialRevocationReference `json:"lastCredentialRevocation,omitempty"`
+	// Sink reports the delivery of the current credential to the sink.
+	// +optional
+	Sink *SinkStatus `json:"sink,omitempty"`
 }
 
+// SinkStatus reports the delivery of the credential to a sink.
+type SinkStatus struct {
+	// Name is the name of the sink.
+	// +required
+	Name string `json:"name"`
+	// LastDeliveryTimestamp is the time the current credential is delivered to the sink. With the
+	// None projection type, it is the time the current credential is issued as well.
+	// +optional
+	LastDeliveryTimestamp *metav1.Time `json:"lastDeliveryTimestamp,omitempty"`
+}
+
+// TokenRevocation records a revocation of the tokens.
+type TokenRevocation struct {
+	// Generation is the spec.revocationGeneration handled by the revocation.
+	// +required
+	Generation int64 `json:"generation"`
+	// Timestamp is the time the tokens are revoked.
+	// +required
+	Timestamp metav1.Time `json:"timestamp"`
+	// RevokedTokenIDs are the IDs ("jti" claim) of the tokens in the token Secret at the time
+	// of the revocation.
+	// +optional
+	RevokedTokenIDs []string `json:"revokedTokenIDs,omitempty"`
+}
+
+// CredentialRevocationReference identifies a CredentialRevocation dispatched to the ManagedServiceAccount.
+type CredentialRevocationReference struct {
+	// Name is the name of the CredentialRevocation.
+	// +required
+	Name string `json:"name"`
+	// UID is the UID of the CredentialRevocation, which tells it from a former one of the same name.
+	// +optional
+	UID types.UID `json:"uid,omitempty"`
+	// Generation is the generation of the CredentialRevocation.
+	// +required
+	Generation int64 `json:"generation"`
+}
+
+type CredentialType string
+
+const (
+	CredentialTypeToken             CredentialType = "Token"
+	CredentialTypeClientCertificate CredentialType = "ClientCertificate"
+)
+
 type ProjectionType string
 
 const (
@@ -86,6 +214,85 @@ const (
 	ProjectionTypeSecret ProjectionType = "Secret"
 )
 
+// +kubebuilder:validation:XValidation:rule="self.type == 'Secret' || !has(self.secret)",message="secret is only allowed for the Secret projection type"
+type ManagedServiceAccountProjection struct {
+	// Type is the type of the projection. With the None type, the token is not stored on
+	// the hub cluster and only the status is reported. With the Secret type, the token is
+	// stored in a Secret in the namespace of the ManagedServiceAccount.
+	// +optional
+	// +kubebuilder:default=Secret
+	// +kubebuilder:validation:Enum=None;Secret
+	Type ProjectionType `json:"type,omitempty"`
+	// Secret prescribes the token Secret of the Secret projection type.
+	// +optional
+	Secret *SecretProjection `json:"secret,omitempty"`
+	// Sink selects a sink configured on the managed cluster, which receives every issued or
+	// rotated credential, along with the token Secret of the Secret type, or instead of it with
+	// the None type. The sinks are configured in the "managed-serviceaccount-sinks" ConfigMap in
+	// the namespace of the addon agent.
+	// +optional
+	Sink *SinkReference `json:"sink,omitempty"`
+}
+
+type SinkReference struct {
+	// Name is the name of the sink, which is a key of the sink ConfigMap.
+	// +required
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+}
+
+type SecretProjection struct {
+	// Name is the name of the token Secret. It defaults to the name of the
+	// ManagedServiceAccount.
+	// +optional
+	Name string `json:"name,omitempty"`
+	// Labels are added to the token Secret.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+	// Annotations are added to the token Secret.
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Format is the format of the token Secret. Besides the "ca.crt" and "token" keys, the
+	// Kubeconfig format writes the URL of the managed cluster in the "server" key and a
+	// ready-to-use kubeconfig in the "kubeconfig" key.
+	// +optional
+	// +kubebuilder:default=Token
+	// +kubebuilder:validation:Enum=Token;Kubeconfig
+	Format SecretFormat `json:"format,omitempty"`
+	// Server overrides the URL of the managed cluster in the Kubeconfig format, e.g. the
+	// endpoint of the cluster-proxy. It defaults to the first URL in the
+	// spec.managedClusterClientConfigs of the ManagedCluster.
+	// +optional
+	Server string `json:"server,omitempty"`
+	// CABundle overrides the CA bundle to verify the server in the Kubeconfig format. It
+	// defaults to the CA bundle of the ManagedCluster client config, or the CA of the
+	// managed cluster if the server is overridden.
+	// +optional
+	CABundle []byte `json:"caBundle,omitempty"`
+	// Encryption is how the credentials are stored in the token Secret. With the Envelope
+	// encryption, the "token", "token.previous", "tls.key" and "kubeconfig" keys are encrypted
+	// with a data key, which is encrypted by the KMS v2 plugin of the addon agent and recorded
+	// in the "envelope" key. The consumers decrypt them with the same KMS plugin.
+	// +optional
+	// +kubebuilder:default=None
+	// +kubebuilder:validation:Enum=None;Envelope
+	Encryption SecretEncryption `json:"encryption,omitempty"`
+}
+
+type SecretFormat string
+
+const (
+	SecretFormatToken      SecretFormat = "Token"
+	SecretFormatKubeconfig SecretFormat = "Kubeconfig"
+)
+
+type SecretEncryption string
+
+const (
+	SecretEncryptionNone     SecretEncryption = "None"
+	SecretEncryptionEnvelope SecretEncryption = "Envelope"
+)
+
 type ManagedServiceAccountRotation struct {
 	// Enabled prescribes whether the ServiceAccount token will be rotated before it expires.
 	// Deprecated: All ServiceAccount tokens will be rotated before they expire regardless of this field.
@@ -96,6 +303,150 @@ type ManagedServiceAccountRotation struct {
 	// +optional
 	// +kubebuilder:default="8640h0m0s"
 	Validity metav1.Duration `json:"validity"`
+	// RefreshBefore is how long before the expiration the token is rotated, either a duration,
+	// e.g. "48h", or a percentage of the lifetime of the token, e.g. "50%". It defaults to "20%".
+	// A duration not shorter than the lifetime of the token falls back to the default.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$|^[0-9]{1,2}%$`
+	RefreshBefore string `json:"refreshBefore,omitempty"`
+	// Window restricts the scheduled rotations to a maintenance window. The token is still
+	// rotated out of the window if no window opens at least 10 minutes before it expires, or if
+	// the token has to be re-issued, e.g. on a change of spec.token.
+	// +optional
+	Window *RotationWindow `json:"window,omitempty"`
+	// PreviousTokenGracePeriod enables the overlap mode, in which the token replaced by a rotation
+	// is kept in the "token.previous" key of the token Secret for the grace period, or until it
+	// expires if it is earlier. The expiration of both tokens is recorded in the annotations of the
+	// token Secret.
+	// +optional
+	PreviousTokenGracePeriod *metav1.Duration `json:"previousTokenGracePeriod,omitempty"`
+}
+
+// RotationWindow is a recurring maintenance window.
+type RotationWindow struct {
+	// Schedule is a cron schedule of five fields in UTC, e.g. "0 2 * * 6", opening the window.
+	// +required
+	// +kubebuilder:validation:MinLength=1
+	Schedule string `json:"schedule"`
+	// Duration is how long the window stays open.
+	// +required
+	Duration metav1.Duration `json:"duration"`
+}
+
+type ManagedServiceAccountPermissions struct {
+	// Roles are the namespaced Roles created on the managed cluster and bound to the
+	// ServiceAccount in their own namespace.
+	// +optional
+	Roles []ManagedRole `json:"roles,omitempty"`
+	// ClusterRoles are the ClusterRoles created on the managed cluster and bound to the
+	// ServiceAccount cluster-wide.
+	// +optional
+	ClusterRoles []ManagedClusterRole `json:"clusterRoles,omitempty"`
+	// RoleRefs are the existing Roles or ClusterRoles on the managed cluster bound to the
+	// ServiceAccount.
+	// +optional
+	RoleRefs []ManagedRoleRef `json:"roleRefs,omitempty"`
+}
+
+type ManagedRole struct {
+	// Name is the name of the Role, it is unique among the roles of the ManagedServiceAccount.
+	// +required
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// Namespace is the namespace on the managed cluster where the Role is created.
+	// +required
+	// +kubebuilder:validation:MinLength=1
+	Namespace string `json:"namespace"`
+	// Rules holds all the PolicyRules for the Role.
+	// +optional
+	Rules []rbacv1.PolicyRule `json:"rules,omitempty"`
+}
+
+type ManagedClusterRole struct {
+	// Name is the name of the ClusterRole, it is unique among the cluster roles of the
+	// ManagedServiceAccount.
+	// +required
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// Rules holds all the PolicyRules for the ClusterRole.
+	// +optional
+	Rules []rbacv1.PolicyRule `json:"rules,omitempty"`
+}
+
+type ManagedRoleRef struct {
+	// Kind is the kind of the referenced role, either Role or ClusterRole.
+	// +required
+	// +kubebuilder:validation:Enum=Role;ClusterRole
+	Kind string `json:"kind"`
+	// Name is the name of the referenced role.
+	// +required
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// Namespace is the namespace where the RoleBinding is created. It is required when
+	// the kind is Role. If it is empty for a ClusterRole, a ClusterRoleBinding is created.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
+type SpokeServiceAccount struct {
+	// Namespace is the namespace of the ServiceAccount on the managed cluster. Defaults to
+	// the namespace of the addon agent.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+	// Name is the name of the ServiceAccount on the managed cluster. Defaults to the name
+	// of the ManagedServiceAccount.
+	// +optional
+	Name string `json:"name,omitempty"`
+	// CreateNamespace prescribes whether the namespace is created on the managed cluster
+	// if it does not exist. The namespace is left behind when the ManagedServiceAccount
+	// is deleted.
+	// +optional
+	CreateNamespace bool `json:"createNamespace,omitempty"`
+	// Mode is how the ServiceAccount is provisioned on the managed cluster. In the Create
+	// mode, the ServiceAccount is created by the agent and deleted along with the
+	// ManagedServiceAccount. In the Adopt mode, the tokens are issued for an existing
+	// ServiceAccount, which is never deleted by the agent. The adoption must be permitted
+	// by the adoption allowlist ConfigMap in the namespace of the addon agent.
+	// +optional
+	// +kubebuilder:default=Create
+	// +kubebuilder:validation:Enum=Create;Adopt
+	Mode ServiceAccountMode `json:"mode,omitempty"`
+}
+
+type ServiceAccountMode string
+
+const (
+	ServiceAccountModeCreate ServiceAccountMode = "Create"
+	ServiceAccountModeAdopt  ServiceAccountMode = "Adopt"
+)
+
+type ManagedServiceAccountToken struct {
+	// Audiences are the intended audiences of the token. A recipient of the token must
+	// identify itself with one of the audiences, otherwise the token is rejected. If it is
+	// empty, the token is issued for the audiences of the managed cluster's API server.
+	// The token is re-issued once the audiences are changed.
+	// +optional
+	Audiences []string `json:"audiences,omitempty"`
+	// BoundObjectRef is a reference to an object on the managed cluster, in the namespace
+	// of the ServiceAccount, that the token will be bound to. The token will only be valid
+	// for as long as the bound object exists.
+	// +optional
+	BoundObjectRef *BoundObjectReference `json:"boundObjectRef,omitempty"`
+}
+
+type BoundObjectReference struct {
+	// Kind is the kind of the referent, either Pod or Secret.
+	// +required
+	// +kubebuilder:validation:Enum=Pod;Secret
+	Kind string `json:"kind"`
+	// Name is the name of the referent.
+	// +required
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// UID is the UID of the referent. The token request is rejected if it is set and
+	// does not match the current UID of the referent.
+	// +optional
+	UID types.UID `json:"uid,omitempty"`
 }
 
 type SecretRef struct {
@@ -111,4 +462,16 @@ type SecretRef struct {
 const (
 	ConditionTypeSecretCreated string = "SecretCreated"
 	ConditionTypeTokenReported string = "TokenReported"
+	// ConditionTypeReady aggregates the other conditions, it is true once the token is reported
+	// (unless the token is not projected) and the permissions are applied.
+	ConditionTypeReady string = "Ready"
+	// ConditionTypePermissionsApplied is added once spec.permissions is set and reports
+	// whether the RBAC on the managed cluster is in the desired state.
+	ConditionTypePermissionsApplied string = "PermissionsApplied"
+	// ConditionTypeSinkDelivered is added once spec.projection.sink is set and reports whether the
+	// current credential is delivered to the sink.
+	ConditionTypeSinkDelivered string = "SinkDelivered"
+	// ConditionTypeTokensRevoked is added once spec.revocationGeneration is handled and reports
+	// whether the outstanding tokens are revoked.
+	ConditionTypeTokensRevoked string = "TokensRevoked"
 )
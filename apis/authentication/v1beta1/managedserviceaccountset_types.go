@@ -0,0 +1,125 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func init() {
+	SchemeBuilder.Register(&ManagedServiceAccountSet{}, &ManagedServiceAccountSetList{})
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:shortName=msaset
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Clusters",type=integer,JSONPath=`.status.summary.ready`
+//+kubebuilder:printcolumn:name="Total",type=integer,JSONPath=`.status.summary.clusters`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// ManagedServiceAccountSet fans out a ManagedServiceAccount to the namespaces of the
+// ManagedClusters selected by the Placements.
+type ManagedServiceAccountSet struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ManagedServiceAccountSetSpec   `json:"spec,omitempty"`
+	Status ManagedServiceAccountSetStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ManagedServiceAccountSetList contains a list of ManagedServiceAccountSet
+type ManagedServiceAccountSetList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ManagedServiceAccountSet `json:"items"`
+}
+
+// ManagedServiceAccountSetSpec defines the ManagedServiceAccounts to create and the
+// ManagedClusters to create them for.
+type ManagedServiceAccountSetSpec struct {
+	// PlacementRefs are the Placements in the namespace of the ManagedServiceAccountSet, a
+	// ManagedServiceAccount is created for each ManagedCluster decided by any of them.
+	// +required
+	// +kubebuilder:validation:MinItems=1
+	// +listType=map
+	// +listMapKey=name
+	PlacementRefs []LocalPlacementReference `json:"placementRefs"`
+	// Template is the ManagedServiceAccount created in the namespace of each ManagedCluster, with
+	// the name of the ManagedServiceAccountSet. The changes to the template are propagated to
+	// the created ManagedServiceAccounts.
+	// +required
+	Template ManagedServiceAccountTemplate `json:"template"`
+}
+
+// LocalPlacementReference is a reference to a Placement in the same namespace.
+type LocalPlacementReference struct {
+	// Name is the name of the Placement.
+	// +required
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+}
+
+// ManagedServiceAccountTemplate describes the ManagedServiceAccounts created by the
+// ManagedServiceAccountSet.
+type ManagedServiceAccountTemplate struct {
+	// Standard object's metadata, only the labels and the annotations are honored.
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	// Spec is the spec of the created ManagedServiceAccounts.
+	// +required
+	Spec ManagedServiceAccountSpec `json:"spec"`
+}
+
+// ManagedServiceAccountSetStatus aggregates the status of the created ManagedServiceAccounts.
+type ManagedServiceAccountSetStatus struct {
+	// ObservedGeneration is the generation of the spec propagated to the ManagedServiceAccounts.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Summary counts the ManagedServiceAccounts across the decided ManagedClusters.
+	// +optional
+	Summary ManagedServiceAccountSetSummary `json:"summary,omitempty"`
+	// NotReadyClusters are the names of the ManagedClusters whose ManagedServiceAccounts are not
+	// ready, at most 100 of them are listed.
+	// +optional
+	NotReadyClusters []string `json:"notReadyClusters,omitempty"`
+	// Conditions is the condition list.
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// ManagedServiceAccountSetSummary counts the ManagedServiceAccounts of the ManagedServiceAccountSet.
+type ManagedServiceAccountSetSummary struct {
+	// Clusters is the number of the ManagedClusters decided by the Placements.
+	Clusters int32 `json:"clusters"`
+	// Applied is the number of the ManagedServiceAccounts which are up to date with the template.
+	Applied int32 `json:"applied"`
+	// Ready is the number of the ManagedServiceAccounts whose Ready condition is true.
+	Ready int32 `json:"ready"`
+}
+
+const (
+	// ConditionTypePlacementDecided reports whether the referenced Placements are found and decided.
+	ConditionTypePlacementDecided string = "PlacementDecided"
+	// ConditionTypeConflicted reports whether a ManagedServiceAccount of the same name exists in the
+	// namespace of a decided ManagedCluster and is not created by the ManagedServiceAccountSet, e.g.
+	// by a ManagedServiceAccountSet of the same name in another namespace. The message names the
+	// owners of the conflicting ManagedServiceAccounts, which are left untouched.
+	ConditionTypeConflicted string = "Conflicted"
+)
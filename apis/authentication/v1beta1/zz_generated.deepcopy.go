@@ -21,10 +21,377 @@ limitations under the License.
 package v1beta1
 
 import (
+	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BoundObjectReference) DeepCopyInto(out *BoundObjectReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BoundObjectReference.
+func (in *BoundObjectReference) DeepCopy() *BoundObjectReference {
+	if in == nil {
+		return nil
+	}
+	out := new(BoundObjectReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterManagedServiceAccountTemplate) DeepCopyInto(out *ClusterManagedServiceAccountTemplate) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	out.Status = in.Status
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterManagedServiceAccountTemplate.
+func (in *ClusterManagedServiceAccountTemplate) DeepCopy() *ClusterManagedServiceAccountTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterManagedServiceAccountTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterManagedServiceAccountTemplate) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterManagedServiceAccountTemplateList) DeepCopyInto(out *ClusterManagedServiceAccountTemplateList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterManagedServiceAccountTemplate, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterManagedServiceAccountTemplateList.
+func (in *ClusterManagedServiceAccountTemplateList) DeepCopy() *ClusterManagedServiceAccountTemplateList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterManagedServiceAccountTemplateList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterManagedServiceAccountTemplateList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterManagedServiceAccountTemplateSpec) DeepCopyInto(out *ClusterManagedServiceAccountTemplateSpec) {
+	*out = *in
+	if in.ClusterSelector != nil {
+		in, out := &in.ClusterSelector, &out.ClusterSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	in.Template.DeepCopyInto(&out.Template)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterManagedServiceAccountTemplateSpec.
+func (in *ClusterManagedServiceAccountTemplateSpec) DeepCopy() *ClusterManagedServiceAccountTemplateSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterManagedServiceAccountTemplateSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterManagedServiceAccountTemplateStatus) DeepCopyInto(out *ClusterManagedServiceAccountTemplateStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterManagedServiceAccountTemplateStatus.
+func (in *ClusterManagedServiceAccountTemplateStatus) DeepCopy() *ClusterManagedServiceAccountTemplateStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterManagedServiceAccountTemplateStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterRevocationStatus) DeepCopyInto(out *ClusterRevocationStatus) {
+	*out = *in
+	if in.PendingServiceAccounts != nil {
+		in, out := &in.PendingServiceAccounts, &out.PendingServiceAccounts
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterRevocationStatus.
+func (in *ClusterRevocationStatus) DeepCopy() *ClusterRevocationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterRevocationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CredentialRevocation) DeepCopyInto(out *CredentialRevocation) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CredentialRevocation.
+func (in *CredentialRevocation) DeepCopy() *CredentialRevocation {
+	if in == nil {
+		return nil
+	}
+	out := new(CredentialRevocation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CredentialRevocation) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CredentialRevocationList) DeepCopyInto(out *CredentialRevocationList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]CredentialRevocation, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CredentialRevocationList.
+func (in *CredentialRevocationList) DeepCopy() *CredentialRevocationList {
+	if in == nil {
+		return nil
+	}
+	out := new(CredentialRevocationList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CredentialRevocationList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CredentialRevocationReference) DeepCopyInto(out *CredentialRevocationReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CredentialRevocationReference.
+func (in *CredentialRevocationReference) DeepCopy() *CredentialRevocationReference {
+	if in == nil {
+		return nil
+	}
+	out := new(CredentialRevocationReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CredentialRevocationSpec) DeepCopyInto(out *CredentialRevocationSpec) {
+	*out = *in
+	if in.ClusterSelector != nil {
+		in, out := &in.ClusterSelector, &out.ClusterSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ClusterNames != nil {
+		in, out := &in.ClusterNames, &out.ClusterNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ServiceAccountSelector != nil {
+		in, out := &in.ServiceAccountSelector, &out.ServiceAccountSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Timeout != nil {
+		in, out := &in.Timeout, &out.Timeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CredentialRevocationSpec.
+func (in *CredentialRevocationSpec) DeepCopy() *CredentialRevocationSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CredentialRevocationSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CredentialRevocationStatus) DeepCopyInto(out *CredentialRevocationStatus) {
+	*out = *in
+	if in.StartTimestamp != nil {
+		in, out := &in.StartTimestamp, &out.StartTimestamp
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTimestamp != nil {
+		in, out := &in.CompletionTimestamp, &out.CompletionTimestamp
+		*out = (*in).DeepCopy()
+	}
+	if in.Clusters != nil {
+		in, out := &in.Clusters, &out.Clusters
+		*out = make([]ClusterRevocationStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	out.Summary = in.Summary
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CredentialRevocationStatus.
+func (in *CredentialRevocationStatus) DeepCopy() *CredentialRevocationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CredentialRevocationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CredentialRevocationSummary) DeepCopyInto(out *CredentialRevocationSummary) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CredentialRevocationSummary.
+func (in *CredentialRevocationSummary) DeepCopy() *CredentialRevocationSummary {
+	if in == nil {
+		return nil
+	}
+	out := new(CredentialRevocationSummary)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LocalPlacementReference) DeepCopyInto(out *LocalPlacementReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LocalPlacementReference.
+func (in *LocalPlacementReference) DeepCopy() *LocalPlacementReference {
+	if in == nil {
+		return nil
+	}
+	out := new(LocalPlacementReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ManagedClusterRole) DeepCopyInto(out *ManagedClusterRole) {
+	*out = *in
+	if in.Rules != nil {
+		in, out := &in.Rules, &out.Rules
+		*out = make([]rbacv1.PolicyRule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ManagedClusterRole.
+func (in *ManagedClusterRole) DeepCopy() *ManagedClusterRole {
+	if in == nil {
+		return nil
+	}
+	out := new(ManagedClusterRole)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ManagedRole) DeepCopyInto(out *ManagedRole) {
+	*out = *in
+	if in.Rules != nil {
+		in, out := &in.Rules, &out.Rules
+		*out = make([]rbacv1.PolicyRule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ManagedRole.
+func (in *ManagedRole) DeepCopy() *ManagedRole {
+	if in == nil {
+		return nil
+	}
+	out := new(ManagedRole)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ManagedRoleRef) DeepCopyInto(out *ManagedRoleRef) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ManagedRoleRef.
+func (in *ManagedRoleRef) DeepCopy() *ManagedRoleRef {
+	if in == nil {
+		return nil
+	}
+	out := new(ManagedRoleRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ManagedServiceAccount) DeepCopyInto(out *ManagedServiceAccount) {
 	*out = *in
@@ -84,10 +451,79 @@ func (in *ManagedServiceAccountList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ManagedServiceAccountPermissions) DeepCopyInto(out *ManagedServiceAccountPermissions) {
+	*out = *in
+	if in.Roles != nil {
+		in, out := &in.Roles, &out.Roles
+		*out = make([]ManagedRole, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ClusterRoles != nil {
+		in, out := &in.ClusterRoles, &out.ClusterRoles
+		*out = make([]ManagedClusterRole, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.RoleRefs != nil {
+		in, out := &in.RoleRefs, &out.RoleRefs
+		*out = make([]ManagedRoleRef, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ManagedServiceAccountPermissions.
+func (in *ManagedServiceAccountPermissions) DeepCopy() *ManagedServiceAccountPermissions {
+	if in == nil {
+		return nil
+	}
+	out := new(ManagedServiceAccountPermissions)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ManagedServiceAccountProjection) DeepCopyInto(out *ManagedServiceAccountProjection) {
+	*out = *in
+	if in.Secret != nil {
+		in, out := &in.Secret, &out.Secret
+		*out = new(SecretProjection)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Sink != nil {
+		in, out := &in.Sink, &out.Sink
+		*out = new(SinkReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ManagedServiceAccountProjection.
+func (in *ManagedServiceAccountProjection) DeepCopy() *ManagedServiceAccountProjection {
+	if in == nil {
+		return nil
+	}
+	out := new(ManagedServiceAccountProjection)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ManagedServiceAccountRotation) DeepCopyInto(out *ManagedServiceAccountRotation) {
 	*out = *in
 	out.Validity = in.Validity
+	if in.Window != nil {
+		in, out := &in.Window, &out.Window
+		*out = new(RotationWindow)
+		**out = **in
+	}
+	if in.PreviousTokenGracePeriod != nil {
+		in, out := &in.PreviousTokenGracePeriod, &out.PreviousTokenGracePeriod
+		*out = new(v1.Duration)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ManagedServiceAccountRotation.
@@ -100,15 +536,158 @@ func (in *ManagedServiceAccountRotation) DeepCopy() *ManagedServiceAccountRotati
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ManagedServiceAccountSet) DeepCopyInto(out *ManagedServiceAccountSet) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ManagedServiceAccountSet.
+func (in *ManagedServiceAccountSet) DeepCopy() *ManagedServiceAccountSet {
+	if in == nil {
+		return nil
+	}
+	out := new(ManagedServiceAccountSet)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ManagedServiceAccountSet) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ManagedServiceAccountSetList) DeepCopyInto(out *ManagedServiceAccountSetList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ManagedServiceAccountSet, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ManagedServiceAccountSetList.
+func (in *ManagedServiceAccountSetList) DeepCopy() *ManagedServiceAccountSetList {
+	if in == nil {
+		return nil
+	}
+	out := new(ManagedServiceAccountSetList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ManagedServiceAccountSetList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ManagedServiceAccountSetSpec) DeepCopyInto(out *ManagedServiceAccountSetSpec) {
+	*out = *in
+	if in.PlacementRefs != nil {
+		in, out := &in.PlacementRefs, &out.PlacementRefs
+		*out = make([]LocalPlacementReference, len(*in))
+		copy(*out, *in)
+	}
+	in.Template.DeepCopyInto(&out.Template)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ManagedServiceAccountSetSpec.
+func (in *ManagedServiceAccountSetSpec) DeepCopy() *ManagedServiceAccountSetSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ManagedServiceAccountSetSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ManagedServiceAccountSetStatus) DeepCopyInto(out *ManagedServiceAccountSetStatus) {
+	*out = *in
+	out.Summary = in.Summary
+	if in.NotReadyClusters != nil {
+		in, out := &in.NotReadyClusters, &out.NotReadyClusters
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ManagedServiceAccountSetStatus.
+func (in *ManagedServiceAccountSetStatus) DeepCopy() *ManagedServiceAccountSetStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ManagedServiceAccountSetStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ManagedServiceAccountSetSummary) DeepCopyInto(out *ManagedServiceAccountSetSummary) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ManagedServiceAccountSetSummary.
+func (in *ManagedServiceAccountSetSummary) DeepCopy() *ManagedServiceAccountSetSummary {
+	if in == nil {
+		return nil
+	}
+	out := new(ManagedServiceAccountSetSummary)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ManagedServiceAccountSpec) DeepCopyInto(out *ManagedServiceAccountSpec) {
 	*out = *in
-	out.Rotation = in.Rotation
+	in.Rotation.DeepCopyInto(&out.Rotation)
 	if in.TTLSecondsAfterCreation != nil {
 		in, out := &in.TTLSecondsAfterCreation, &out.TTLSecondsAfterCreation
 		*out = new(int32)
 		**out = **in
 	}
+	if in.Permissions != nil {
+		in, out := &in.Permissions, &out.Permissions
+		*out = new(ManagedServiceAccountPermissions)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Token != nil {
+		in, out := &in.Token, &out.Token
+		*out = new(ManagedServiceAccountToken)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ServiceAccount != nil {
+		in, out := &in.ServiceAccount, &out.ServiceAccount
+		*out = new(SpokeServiceAccount)
+		**out = **in
+	}
+	if in.Projection != nil {
+		in, out := &in.Projection, &out.Projection
+		*out = new(ManagedServiceAccountProjection)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ManagedServiceAccountSpec.
@@ -140,6 +719,35 @@ func (in *ManagedServiceAccountStatus) DeepCopyInto(out *ManagedServiceAccountSt
 		*out = new(SecretRef)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.TokenAudiences != nil {
+		in, out := &in.TokenAudiences, &out.TokenAudiences
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.EffectiveValidity != nil {
+		in, out := &in.EffectiveValidity, &out.EffectiveValidity
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.NextRotationTimestamp != nil {
+		in, out := &in.NextRotationTimestamp, &out.NextRotationTimestamp
+		*out = (*in).DeepCopy()
+	}
+	if in.LastRevocation != nil {
+		in, out := &in.LastRevocation, &out.LastRevocation
+		*out = new(TokenRevocation)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LastCredentialRevocation != nil {
+		in, out := &in.LastCredentialRevocation, &out.LastCredentialRevocation
+		*out = new(CredentialRevocationReference)
+		**out = **in
+	}
+	if in.Sink != nil {
+		in, out := &in.Sink, &out.Sink
+		*out = new(SinkStatus)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ManagedServiceAccountStatus.
@@ -152,6 +760,98 @@ func (in *ManagedServiceAccountStatus) DeepCopy() *ManagedServiceAccountStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ManagedServiceAccountTemplate) DeepCopyInto(out *ManagedServiceAccountTemplate) {
+	*out = *in
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ManagedServiceAccountTemplate.
+func (in *ManagedServiceAccountTemplate) DeepCopy() *ManagedServiceAccountTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(ManagedServiceAccountTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ManagedServiceAccountToken) DeepCopyInto(out *ManagedServiceAccountToken) {
+	*out = *in
+	if in.Audiences != nil {
+		in, out := &in.Audiences, &out.Audiences
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.BoundObjectRef != nil {
+		in, out := &in.BoundObjectRef, &out.BoundObjectRef
+		*out = new(BoundObjectReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ManagedServiceAccountToken.
+func (in *ManagedServiceAccountToken) DeepCopy() *ManagedServiceAccountToken {
+	if in == nil {
+		return nil
+	}
+	out := new(ManagedServiceAccountToken)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RotationWindow) DeepCopyInto(out *RotationWindow) {
+	*out = *in
+	out.Duration = in.Duration
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RotationWindow.
+func (in *RotationWindow) DeepCopy() *RotationWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(RotationWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecretProjection) DeepCopyInto(out *SecretProjection) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.CABundle != nil {
+		in, out := &in.CABundle, &out.CABundle
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretProjection.
+func (in *SecretProjection) DeepCopy() *SecretProjection {
+	if in == nil {
+		return nil
+	}
+	out := new(SecretProjection)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SecretRef) DeepCopyInto(out *SecretRef) {
 	*out = *in
@@ -167,3 +867,73 @@ func (in *SecretRef) DeepCopy() *SecretRef {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SinkReference) DeepCopyInto(out *SinkReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SinkReference.
+func (in *SinkReference) DeepCopy() *SinkReference {
+	if in == nil {
+		return nil
+	}
+	out := new(SinkReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SinkStatus) DeepCopyInto(out *SinkStatus) {
+	*out = *in
+	if in.LastDeliveryTimestamp != nil {
+		in, out := &in.LastDeliveryTimestamp, &out.LastDeliveryTimestamp
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SinkStatus.
+func (in *SinkStatus) DeepCopy() *SinkStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SinkStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SpokeServiceAccount) DeepCopyInto(out *SpokeServiceAccount) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SpokeServiceAccount.
+func (in *SpokeServiceAccount) DeepCopy() *SpokeServiceAccount {
+	if in == nil {
+		return nil
+	}
+	out := new(SpokeServiceAccount)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TokenRevocation) DeepCopyInto(out *TokenRevocation) {
+	*out = *in
+	in.Timestamp.DeepCopyInto(&out.Timestamp)
+	if in.RevokedTokenIDs != nil {
+		in, out := &in.RevokedTokenIDs, &out.RevokedTokenIDs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TokenRevocation.
+func (in *TokenRevocation) DeepCopy() *TokenRevocation {
+	if in == nil {
+		return nil
+	}
+	out := new(TokenRevocation)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -11,7 +11,11 @@ import (
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
+	authorizationv1 "k8s.io/api/authorization/v1"
 	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
@@ -28,11 +32,13 @@ import (
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 
 	addonutils "open-cluster-management.io/addon-framework/pkg/utils"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
 	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
 	"open-cluster-management.io/managed-serviceaccount/pkg/addon/agent/controller"
 	"open-cluster-management.io/managed-serviceaccount/pkg/addon/agent/health"
 	"open-cluster-management.io/managed-serviceaccount/pkg/addon/commoncontroller"
 	"open-cluster-management.io/managed-serviceaccount/pkg/common"
+	"open-cluster-management.io/managed-serviceaccount/pkg/envelope"
 	"open-cluster-management.io/managed-serviceaccount/pkg/features"
 	"open-cluster-management.io/managed-serviceaccount/pkg/util"
 )
@@ -44,6 +50,7 @@ var (
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 	utilruntime.Must(authv1beta1.AddToScheme(scheme))
+	utilruntime.Must(clusterv1.AddToScheme(scheme))
 }
 
 func NewAgent() *cobra.Command {
@@ -80,6 +87,9 @@ func (o *AgentOptions) AddFlags(flags *pflag.FlagSet) {
 		"A set of key=value pairs that describe feature gates for alpha/experimental features. "+
 			"Options are:\n"+strings.Join(features.FeatureGates.KnownFeatures(), "\n"))
 	flags.BoolVar(&o.LeaseHealthCheck, "lease-health-check", false, "Use lease to report health check.")
+	flags.StringVar(&o.KMSEndpoint, "kms-endpoint", "", "The endpoint of the KMS v2 plugin encrypting the token "+
+		"secrets of the envelope encryption, e.g. unix:///var/run/kmsplugin/socket.sock.")
+	flags.DurationVar(&o.KMSTimeout, "kms-timeout", envelope.DefaultKMSTimeout, "The timeout of the calls to the KMS plugin.")
 }
 
 // AgentOptions holds configuration for agent controller
@@ -91,6 +101,8 @@ type AgentOptions struct {
 	ClusterName          string
 	SpokeKubeconfig      string
 	LeaseHealthCheck     bool
+	KMSEndpoint          string
+	KMSTimeout           time.Duration
 }
 
 // NewAgentOptions returns an AgentOptions
@@ -138,6 +150,12 @@ func (o *AgentOptions) Run() error {
 			DefaultNamespaces: map[string]cache.Config{
 				o.ClusterName: {},
 			},
+			ByObject: map[client.Object]cache.ByObject{
+				// Only watch the managed cluster itself for the server URL of the kubeconfig.
+				&clusterv1.ManagedCluster{}: {
+					Field: fields.OneTermEqualSelector("metadata.name", o.ClusterName),
+				},
+			},
 		},
 	})
 	if err != nil {
@@ -178,19 +196,27 @@ func (o *AgentOptions) Run() error {
 		spokeNamespace = inClusterNamespace
 	}
 
+	// the permissions created for the ManagedServiceAccounts reside in any namespace
+	permissionSelector := labels.SelectorFromSet(
+		labels.Set{
+			common.LabelKeyIsManagedServiceAccount:        "true",
+			common.LabelKeyManagedServiceAccountNamespace: o.ClusterName,
+		},
+	)
 	spokeCache, err := cache.New(spokeCfg, cache.Options{
 		ByObject: map[client.Object]cache.ByObject{
+			// the serviceaccounts may be placed in any namespace by spec.serviceAccount
 			&corev1.ServiceAccount{}: {
-				Namespaces: map[string]cache.Config{
-					spokeNamespace: {
-						LabelSelector: labels.SelectorFromSet(
-							labels.Set{
-								common.LabelKeyIsManagedServiceAccount: "true",
-							},
-						),
+				Label: labels.SelectorFromSet(
+					labels.Set{
+						common.LabelKeyIsManagedServiceAccount: "true",
 					},
-				},
+				),
 			},
+			&rbacv1.Role{}:               {Label: permissionSelector},
+			&rbacv1.RoleBinding{}:        {Label: permissionSelector},
+			&rbacv1.ClusterRole{}:        {Label: permissionSelector},
+			&rbacv1.ClusterRoleBinding{}: {Label: permissionSelector},
 		},
 	})
 	if err != nil {
@@ -205,21 +231,44 @@ func (o *AgentOptions) Run() error {
 		if err := (commoncontroller.NewEphemeralIdentityReconciler(
 			mgr.GetCache(),
 			mgr.GetClient(),
+			mgr.GetEventRecorder("managed-serviceaccount-agent"),
 		)).SetupWithManager(mgr); err != nil {
 			klog.Error(err, "unable to register EphemeralIdentityReconciler")
 			os.Exit(1)
 		}
 	}
 
+	var tokenEnvelope *envelope.Envelope
+	if len(o.KMSEndpoint) > 0 {
+		tokenEnvelope, err = envelope.Dial(o.KMSEndpoint, o.KMSTimeout)
+		if err != nil {
+			klog.Fatalf("unable to connect to the KMS plugin: %v", err)
+		}
+	}
+
+	// the addon manager grants the agent to read its own ManagedCluster only, and nothing is granted
+	// in the AddOnTemplate mode
+	readManagedCluster, err := canWatchManagedCluster(context.TODO(), hubNativeClient, o.ClusterName)
+	if err != nil {
+		klog.Fatalf("unable to review the access to the managed cluster: %v", err)
+	}
+	if !readManagedCluster {
+		klog.Warningf("the agent is not permitted to watch managed cluster %s on the hub cluster, "+
+			"the kubeconfig token secrets require spec.projection.secret.server", o.ClusterName)
+	}
+
 	if err = (&controller.TokenReconciler{
-		Cache:             mgr.GetCache(),
-		HubClient:         mgr.GetClient(),
-		HubNativeClient:   hubNativeClient,
-		SpokeNamespace:    spokeNamespace,
-		SpokeClientConfig: spokeCfg,
-		SpokeNativeClient: spokeNativeClient,
-		ClusterName:       o.ClusterName,
-		SpokeCache:        spokeCache,
+		Cache:              mgr.GetCache(),
+		HubClient:          mgr.GetClient(),
+		HubNativeClient:    hubNativeClient,
+		SpokeNamespace:     spokeNamespace,
+		SpokeClientConfig:  spokeCfg,
+		SpokeNativeClient:  spokeNativeClient,
+		ClusterName:        o.ClusterName,
+		SpokeCache:         spokeCache,
+		EventRecorder:      mgr.GetEventRecorder("managed-serviceaccount-agent"),
+		Envelope:           tokenEnvelope,
+		ReadManagedCluster: readManagedCluster,
 	}).SetupWithManager(mgr); err != nil {
 		klog.Fatalf("unable to create controller %v", "ManagedServiceAccount")
 	}
@@ -252,6 +301,26 @@ func (o *AgentOptions) Run() error {
 	return nil
 }
 
+// canWatchManagedCluster checks whether the agent is permitted to watch its own ManagedCluster on the
+// hub cluster.
+func canWatchManagedCluster(ctx context.Context, hubClient kubernetes.Interface, clusterName string) (bool, error) {
+	review, err := hubClient.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx,
+		&authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Group:    clusterv1.GroupName,
+					Resource: "managedclusters",
+					Verb:     "watch",
+					Name:     clusterName,
+				},
+			},
+		}, metav1.CreateOptions{})
+	if err != nil {
+		return false, err
+	}
+	return review.Status.Allowed, nil
+}
+
 // serveHealthProbes serves health probes and configchecker.
 func serveHealthProbes(healthProbeBindAddress string, configCheck healthz.Checker) error {
 	mux := http.NewServeMux()
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	clientauthenticationv1 "k8s.io/client-go/pkg/apis/clientauthentication/v1"
+)
+
+// refreshBefore is how long before the expiration of the token the cached credential is refreshed.
+const refreshBefore = time.Minute
+
+// TokenCache keeps the ExecCredentialStatus on the disk between the invocations of the plugin, so
+// that the short-lived clients do not read the credential secret on every call.
+type TokenCache struct {
+	// Dir is the directory of the cache files.
+	Dir string
+	// MaxAge is how long a credential is served from the cache at most, so that a revoked token is
+	// replaced even if it is not expired.
+	MaxAge time.Duration
+
+	now func() time.Time
+}
+
+// cacheEntry is the content of a cache file.
+type cacheEntry struct {
+	FetchedAt time.Time                                   `json:"fetchedAt"`
+	Status    clientauthenticationv1.ExecCredentialStatus `json:"status"`
+}
+
+func NewTokenCache(dir string, maxAge time.Duration) *TokenCache {
+	return &TokenCache{Dir: dir, MaxAge: maxAge, now: time.Now}
+}
+
+// cacheKeyOf joins the mode, the hash of the hub and the names identifying the credential into a
+// cache key, so that the credentials of the same names on different hubs are cached apart.
+func cacheKeyOf(hub string, mode Mode, names ...string) string {
+	hash := sha256.Sum256([]byte(hub))
+	return strings.Join(append([]string{string(mode), hex.EncodeToString(hash[:8])}, names...), "_")
+}
+
+// path returns the cache file of the key.
+func (c *TokenCache) path(key string) string {
+	return filepath.Join(c.Dir, key+".json")
+}
+
+// Get returns the cached credential unless it is older than MaxAge or about to expire.
+func (c *TokenCache) Get(key string) (*clientauthenticationv1.ExecCredentialStatus, bool) {
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+	entry := &cacheEntry{}
+	if err := json.Unmarshal(data, entry); err != nil {
+		return nil, false
+	}
+
+	now := c.now()
+	if (len(entry.Status.Token) == 0 && len(entry.Status.ClientCertificateData) == 0) || now.Sub(entry.FetchedAt) >= c.MaxAge {
+		return nil, false
+	}
+	if expiration := entry.Status.ExpirationTimestamp; expiration != nil &&
+		!now.Add(refreshBefore).Before(expiration.Time) {
+		return nil, false
+	}
+	return &entry.Status, true
+}
+
+// Set writes the credential to the cache, the file is replaced atomically and only readable by
+// the current user.
+func (c *TokenCache) Set(key string, status clientauthenticationv1.ExecCredentialStatus) error {
+	data, err := json.Marshal(&cacheEntry{FetchedAt: c.now(), Status: status})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.Dir, 0o700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(c.Dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), c.path(key))
+}
@@ -2,10 +2,15 @@ package main
 
 import (
 	"context"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/spf13/pflag"
 	corev1 "k8s.io/api/core/v1"
@@ -14,23 +19,45 @@ import (
 	clientauthenticationv1 "k8s.io/client-go/pkg/apis/clientauthentication/v1"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/homedir"
 	"sigs.k8s.io/cluster-inventory-api/pkg/credentialplugin"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"open-cluster-management.io/managed-serviceaccount/pkg/addon/manager/controller"
+	"open-cluster-management.io/managed-serviceaccount/pkg/envelope"
 )
 
 type Provider struct {
 	// KubeClient is the typed client for core Kubernetes resources (e.g. Secret).
 	KubeClient kubernetes.Interface
+	// HubClient reads the ManagedServiceAccounts, their token secrets and the ClusterProfiles in the
+	// managedserviceaccount and clusterprofile modes.
+	HubClient client.Reader
 	// ManagedServiceAccount is the name of the managedserviceaccount
 	ManagedServiceAccount string
+	// Mode is how the token secret is resolved.
+	Mode Mode
+	// Hub is the server URL of the cluster the token secrets are read from, it keeps the cached
+	// credentials of different hubs apart.
+	Hub string
+	// Cache keeps the credentials between the invocations, it is disabled if nil or if Envelope is set.
+	Cache *TokenCache
+	// Envelope decrypts the token secrets of the envelope encryption, it is nil if no KMS plugin is
+	// configured.
+	Envelope *envelope.Envelope
 }
 
 // NewDefault constructs a Provider with managedserviceaccount name and pre-initialized typed clientsets
-func NewDefault(msaName string) (*Provider, error) {
+func NewDefault(msaName string, mode Mode) (*Provider, error) {
 	if msaName == "" {
 		return nil, fmt.Errorf("managed-serviceaccount name is required")
 	}
+	switch mode {
+	case ModeSynced, ModeManagedServiceAccount, ModeClusterProfile:
+	default:
+		return nil, fmt.Errorf("unknown mode %q, it should be one of %s, %s or %s",
+			mode, ModeSynced, ModeManagedServiceAccount, ModeClusterProfile)
+	}
 
 	// Build Kubernetes rest.Config via in-cluster first, then fallback to kubeconfig
 	cfg, err := rest.InClusterConfig()
@@ -49,26 +76,43 @@ func NewDefault(msaName string) (*Provider, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to create kubernetes clientset: %w", err)
 	}
+	hubClient, err := client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create hub client: %w", err)
+	}
 
 	return &Provider{
 		KubeClient:            kubeClient,
+		HubClient:             hubClient,
 		ManagedServiceAccount: msaName,
+		Mode:                  mode,
+		Hub:                   cfg.Host,
 	}, nil
 }
 
 func (Provider) Name() string { return controller.ClusterProfileManagerName }
 
+// execClusterConfig is the config in the client.authentication.k8s.io/exec extension of the cluster.
+type execClusterConfig struct {
+	// ClusterName is the name of the managed cluster, required in the synced and the
+	// managedserviceaccount modes.
+	ClusterName string `json:"clusterName"`
+	// ClusterProfile is the reference of the ClusterProfile, required in the clusterprofile mode.
+	ClusterProfile *clusterProfileRef `json:"clusterProfile,omitempty"`
+}
+
+type clusterProfileRef struct {
+	// Namespace defaults to the namespace the plugin runs in.
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
 func (p Provider) GetToken(ctx context.Context, info clientauthenticationv1.ExecCredential) (clientauthenticationv1.ExecCredentialStatus, error) {
 	// Require pre-initialized typed clients
-	if p.KubeClient == nil {
+	if p.KubeClient == nil || (p.Mode != ModeSynced && p.HubClient == nil) {
 		return clientauthenticationv1.ExecCredentialStatus{}, fmt.Errorf("provider clients are not initialized")
 	}
 
-	// Extract clusterName from ExecCredential extensions config
-	type execClusterConfig struct {
-		ClusterName string `json:"clusterName"`
-	}
-
 	// Validate presence of cluster config
 	if info.Spec.Cluster == nil || len(info.Spec.Cluster.Config.Raw) == 0 {
 		return clientauthenticationv1.ExecCredentialStatus{}, fmt.Errorf("missing ExecCredential.Spec.Cluster.Config")
@@ -78,26 +122,142 @@ func (p Provider) GetToken(ctx context.Context, info clientauthenticationv1.Exec
 	if err := json.Unmarshal(info.Spec.Cluster.Config.Raw, &cfg); err != nil {
 		return clientauthenticationv1.ExecCredentialStatus{}, fmt.Errorf("invalid ExecCredential.Spec.Cluster.Config: %w", err)
 	}
-	if cfg.ClusterName == "" {
-		return clientauthenticationv1.ExecCredentialStatus{}, fmt.Errorf("missing clusterName in ExecCredential.Spec.Cluster.Config")
+
+	// Resolve the cache key first, so that a cached credential does not hit the hub cluster
+	var cacheKey, target string
+	switch p.Mode {
+	case ModeClusterProfile:
+		if cfg.ClusterProfile == nil || cfg.ClusterProfile.Name == "" {
+			return clientauthenticationv1.ExecCredentialStatus{}, fmt.Errorf("missing clusterProfile in ExecCredential.Spec.Cluster.Config")
+		}
+		if cfg.ClusterProfile.Namespace == "" {
+			cfg.ClusterProfile.Namespace = inferNamespace()
+		}
+		cacheKey = cacheKeyOf(p.Hub, p.Mode, cfg.ClusterProfile.Namespace, cfg.ClusterProfile.Name, p.ManagedServiceAccount)
+		target = fmt.Sprintf("clusterprofile %s/%s", cfg.ClusterProfile.Namespace, cfg.ClusterProfile.Name)
+	default:
+		if cfg.ClusterName == "" {
+			return clientauthenticationv1.ExecCredentialStatus{}, fmt.Errorf("missing clusterName in ExecCredential.Spec.Cluster.Config")
+		}
+		target = fmt.Sprintf("cluster %s", cfg.ClusterName)
+		if p.Mode == ModeManagedServiceAccount {
+			cacheKey = cacheKeyOf(p.Hub, p.Mode, cfg.ClusterName, p.ManagedServiceAccount)
+		} else {
+			cacheKey = cacheKeyOf(p.Hub, p.Mode, inferNamespace(), cfg.ClusterName, p.ManagedServiceAccount)
+		}
+	}
+	// the cache holds the credentials in plaintext, so the ones of the envelope encryption are not
+	// written to the disk at the cost of reading and decrypting the secret on every invocation
+	cache := p.Cache
+	if p.Envelope != nil {
+		cache = nil
+	}
+	if cache != nil {
+		if status, ok := cache.Get(cacheKey); ok {
+			return *status, nil
+		}
+	}
+
+	var secret *corev1.Secret
+	var err error
+	switch p.Mode {
+	case ModeManagedServiceAccount:
+		secret, err = p.credentialOfManagedServiceAccount(ctx, cfg.ClusterName)
+	case ModeClusterProfile:
+		secret, err = p.credentialOfClusterProfile(ctx, cfg.ClusterProfile)
+	default:
+		secret, err = p.credentialOfSyncedSecret(ctx, cfg.ClusterName)
+	}
+	if err != nil {
+		return clientauthenticationv1.ExecCredentialStatus{}, err
 	}
 
-	// Retrieve the synced token secret from clusterprofile namespace
+	status, err := credentialStatusOf(secret)
+	if err != nil {
+		return clientauthenticationv1.ExecCredentialStatus{}, err
+	}
+	if expiration := status.ExpirationTimestamp; expiration != nil && !expiration.After(time.Now()) {
+		kind := "token"
+		if len(status.Token) == 0 {
+			kind = "client certificate"
+		}
+		return clientauthenticationv1.ExecCredentialStatus{}, fmt.Errorf("the %s of managed serviceaccount %s on %s expired at %s",
+			kind, p.ManagedServiceAccount, target, expiration.UTC().Format(time.RFC3339))
+	}
+	if cache != nil {
+		if err := cache.Set(cacheKey, status); err != nil {
+			// the credential is still returned, the next invocation reads the secret again
+			fmt.Fprintf(os.Stderr, "Warning: failed to cache the credential: %v\n", err)
+		}
+	}
+	return status, nil
+}
+
+// credentialOfSyncedSecret retrieves the synced token secret from clusterprofile namespace.
+func (p Provider) credentialOfSyncedSecret(ctx context.Context, clusterName string) (*corev1.Secret, error) {
 	// Secret naming format matches the controller's sync pattern: <clusterName>-<managedServiceAccountName>
 	namespace := inferNamespace()
-	tokenSecretName := fmt.Sprintf("%s-%s", cfg.ClusterName, p.ManagedServiceAccount)
+	tokenSecretName := fmt.Sprintf("%s-%s", clusterName, p.ManagedServiceAccount)
 	secret, err := p.KubeClient.CoreV1().Secrets(namespace).Get(ctx, tokenSecretName, metav1.GetOptions{})
 	if err != nil {
-		return clientauthenticationv1.ExecCredentialStatus{}, fmt.Errorf("failed to get synced credential secret %s/%s: %w", namespace, tokenSecretName, err)
+		return nil, fmt.Errorf("failed to get synced credential secret %s/%s: %w", namespace, tokenSecretName, err)
 	}
+	return p.Envelope.DecryptSecret(ctx, secret)
+}
 
-	// Extract the token from the secret data
-	tokenData, ok := secret.Data[corev1.ServiceAccountTokenKey]
-	if !ok || len(tokenData) == 0 {
-		return clientauthenticationv1.ExecCredentialStatus{}, fmt.Errorf("secret %s/%s missing or empty %q key", namespace, tokenSecretName, corev1.ServiceAccountTokenKey)
+// credentialStatusOf returns the token in the secret, or the client certificate and key of the
+// ManagedServiceAccounts of the ClientCertificate credential type.
+func credentialStatusOf(secret *corev1.Secret) (clientauthenticationv1.ExecCredentialStatus, error) {
+	if tokenData := secret.Data[corev1.ServiceAccountTokenKey]; len(tokenData) > 0 {
+		return clientauthenticationv1.ExecCredentialStatus{
+			Token:               string(tokenData),
+			ExpirationTimestamp: tokenExpiration(string(tokenData)),
+		}, nil
 	}
+	certData, keyData := secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey]
+	if len(certData) > 0 && len(keyData) > 0 {
+		return clientauthenticationv1.ExecCredentialStatus{
+			ClientCertificateData: string(certData),
+			ClientKeyData:         string(keyData),
+			ExpirationTimestamp:   certificateExpiration(certData),
+		}, nil
+	}
+	return clientauthenticationv1.ExecCredentialStatus{}, fmt.Errorf("secret %s/%s missing or empty %q key, or %q and %q keys",
+		secret.Namespace, secret.Name, corev1.ServiceAccountTokenKey, corev1.TLSCertKey, corev1.TLSPrivateKeyKey)
+}
 
-	return clientauthenticationv1.ExecCredentialStatus{Token: string(tokenData)}, nil
+// tokenExpiration returns the time in the `exp` claim of the JWT token, or nil if the token
+// cannot be decoded, so that client-go re-runs the plugin before the token expires.
+func tokenExpiration(token string) *metav1.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil
+	}
+	claims := struct {
+		Expiry int64 `json:"exp"`
+	}{}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Expiry == 0 {
+		return nil
+	}
+	return &metav1.Time{Time: time.Unix(claims.Expiry, 0)}
+}
+
+// certificateExpiration returns the NotAfter of the client certificate, or nil if it cannot be
+// parsed.
+func certificateExpiration(certData []byte) *metav1.Time {
+	block, _ := pem.Decode(certData)
+	if block == nil {
+		return nil
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil
+	}
+	return &metav1.Time{Time: cert.NotAfter}
 }
 
 func inferNamespace() string {
@@ -128,6 +288,17 @@ func inferNamespace() string {
 
 func main() {
 	msaName := pflag.String("managed-serviceaccount", "", "Name of the ManagedServiceAccount to access spoke cluster (required)")
+	mode := pflag.String("mode", string(ModeSynced),
+		"How the token is resolved: synced (the secret synced to the ClusterProfile namespace), "+
+			"managedserviceaccount (the token secret of the ManagedServiceAccount in the cluster namespace) "+
+			"or clusterprofile (the ManagedServiceAccount of the cluster of the ClusterProfile in the exec config)")
+	cacheDir := pflag.String("cache-dir", filepath.Join(homedir.HomeDir(), ".kube", "cache", "cp-creds"),
+		"Directory caching the credentials between the invocations, empty to disable the cache")
+	cacheMaxAge := pflag.Duration("cache-max-age", 5*time.Minute,
+		"How long a credential is served from the cache at most before the secret is read again")
+	kmsEndpoint := pflag.String("kms-endpoint", "",
+		"Endpoint of the KMS v2 plugin decrypting the token secrets of the envelope encryption, e.g. unix:///var/run/kmsplugin/socket.sock")
+	kmsTimeout := pflag.Duration("kms-timeout", envelope.DefaultKMSTimeout, "Timeout of the calls to the KMS plugin")
 	pflag.Parse()
 
 	if *msaName == "" {
@@ -136,11 +307,23 @@ func main() {
 		os.Exit(1)
 	}
 
-	p, err := NewDefault(*msaName)
+	p, err := NewDefault(*msaName, Mode(*mode))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error initializing provider: %v\n", err)
 		os.Exit(1)
 	}
 
+	if len(*cacheDir) > 0 && *cacheMaxAge > 0 {
+		p.Cache = NewTokenCache(*cacheDir, *cacheMaxAge)
+	}
+
+	if len(*kmsEndpoint) > 0 {
+		p.Envelope, err = envelope.Dial(*kmsEndpoint, *kmsTimeout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error connecting to the KMS plugin: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	credentialplugin.Run(*p)
 }
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	clientauthenticationv1 "k8s.io/client-go/pkg/apis/clientauthentication/v1"
+	kmsservice "k8s.io/kms/pkg/service"
+	cpv1alpha1 "sigs.k8s.io/cluster-inventory-api/apis/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+	"open-cluster-management.io/managed-serviceaccount/pkg/addon/manager/controller"
+	"open-cluster-management.io/managed-serviceaccount/pkg/envelope"
+)
+
+func newTestToken(expiry time.Time) string {
+	payload := fmt.Sprintf(`{"exp":%d,"sub":"system:serviceaccount:open-cluster-management-agent-addon:admin"}`,
+		expiry.Unix())
+	return "eyJhbGciOiJSUzI1NiJ9." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".signature"
+}
+
+// newTestCertificate returns a self-signed client certificate expiring at the expiry and its key.
+func newTestCertificate(t *testing.T, expiry time.Time) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "system:serviceaccount:open-cluster-management-agent-addon:admin"},
+		NotBefore:    expiry.Add(-2 * time.Hour),
+		NotAfter:     expiry,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestGetToken(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	expiry := now.Add(time.Hour)
+
+	cases := []struct {
+		name            string
+		cachedHub       string
+		cachedAt        time.Time
+		cachedExpiry    time.Time
+		expectedToken   string
+		expectedExpiry  *metav1.Time
+		expectedFetched bool
+	}{
+		{
+			name:            "no cache",
+			expectedToken:   newTestToken(expiry),
+			expectedExpiry:  &metav1.Time{Time: expiry},
+			expectedFetched: true,
+		},
+		{
+			name:           "cached",
+			cachedAt:       now.Add(-time.Minute),
+			cachedExpiry:   now.Add(30 * time.Minute),
+			expectedToken:  newTestToken(now.Add(30 * time.Minute)),
+			expectedExpiry: &metav1.Time{Time: now.Add(30 * time.Minute)},
+		},
+		{
+			name:            "cached too long",
+			cachedAt:        now.Add(-10 * time.Minute),
+			cachedExpiry:    now.Add(30 * time.Minute),
+			expectedToken:   newTestToken(expiry),
+			expectedExpiry:  &metav1.Time{Time: expiry},
+			expectedFetched: true,
+		},
+		{
+			name:            "cached for another hub",
+			cachedHub:       "https://hub2.example.com",
+			cachedAt:        now.Add(-time.Minute),
+			cachedExpiry:    now.Add(30 * time.Minute),
+			expectedToken:   newTestToken(expiry),
+			expectedExpiry:  &metav1.Time{Time: expiry},
+			expectedFetched: true,
+		},
+		{
+			name:            "cached token expiring",
+			cachedAt:        now.Add(-time.Minute),
+			cachedExpiry:    now.Add(30 * time.Second),
+			expectedToken:   newTestToken(expiry),
+			expectedExpiry:  &metav1.Time{Time: expiry},
+			expectedFetched: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Setenv("NAMESPACE", "cp-ns")
+			kubeClient := kubefake.NewSimpleClientset(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "cp-ns", Name: "cluster1-admin"},
+				Data:       map[string][]byte{corev1.ServiceAccountTokenKey: []byte(newTestToken(expiry))},
+			})
+
+			hub := "https://hub1.example.com"
+			cachedHub := hub
+			if len(c.cachedHub) > 0 {
+				cachedHub = c.cachedHub
+			}
+			cache := NewTokenCache(t.TempDir(), 5*time.Minute)
+			if !c.cachedAt.IsZero() {
+				cache.now = func() time.Time { return c.cachedAt }
+				err := cache.Set(cacheKeyOf(cachedHub, ModeSynced, "cp-ns", "cluster1", "admin"), clientauthenticationv1.ExecCredentialStatus{
+					Token:               newTestToken(c.cachedExpiry),
+					ExpirationTimestamp: &metav1.Time{Time: c.cachedExpiry},
+				})
+				assert.NoError(t, err)
+			}
+			cache.now = func() time.Time { return now }
+
+			p := Provider{KubeClient: kubeClient, ManagedServiceAccount: "admin", Mode: ModeSynced, Hub: hub, Cache: cache}
+			status, err := p.GetToken(context.TODO(), clientauthenticationv1.ExecCredential{
+				Spec: clientauthenticationv1.ExecCredentialSpec{
+					Cluster: &clientauthenticationv1.Cluster{
+						Config: runtime.RawExtension{Raw: []byte(`{"clusterName":"cluster1"}`)},
+					},
+				},
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, c.expectedToken, status.Token)
+			assert.True(t, c.expectedExpiry.Equal(status.ExpirationTimestamp))
+			assert.Equal(t, c.expectedFetched, len(kubeClient.Actions()) > 0)
+
+			cached, ok := cache.Get(cacheKeyOf(hub, ModeSynced, "cp-ns", "cluster1", "admin"))
+			assert.True(t, ok)
+			assert.Equal(t, c.expectedToken, cached.Token)
+		})
+	}
+}
+
+func TestGetTokenModes(t *testing.T) {
+	validToken := newTestToken(time.Now().Add(time.Hour))
+	newMSA := func(modifiers ...func(*authv1beta1.ManagedServiceAccount)) *authv1beta1.ManagedServiceAccount {
+		msa := &authv1beta1.ManagedServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "cluster1", Name: "admin"},
+			Status: authv1beta1.ManagedServiceAccountStatus{
+				Conditions: []metav1.Condition{
+					{Type: authv1beta1.ConditionTypeReady, Status: metav1.ConditionTrue, Reason: "TokenReported"},
+				},
+				TokenSecretRef: &authv1beta1.SecretRef{Name: "admin-token"},
+			},
+		}
+		for _, modifier := range modifiers {
+			modifier(msa)
+		}
+		return msa
+	}
+	newCP := func(manager string) *cpv1alpha1.ClusterProfile {
+		return &cpv1alpha1.ClusterProfile{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "cp-ns",
+				Name:      "profile1",
+				Labels: map[string]string{
+					cpv1alpha1.LabelClusterManagerKey: manager,
+					clusterv1.ClusterNameLabelKey:     "cluster1",
+				},
+			},
+		}
+	}
+	tokenSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "cluster1", Name: "admin-token"},
+		Data:       map[string][]byte{corev1.ServiceAccountTokenKey: []byte(validToken)},
+	}
+	certExpiry := time.Now().Add(time.Hour).Truncate(time.Second)
+	certData, keyData := newTestCertificate(t, certExpiry)
+	expiredCertData, expiredKeyData := newTestCertificate(t, time.Now().Add(-time.Minute))
+	newCertSecret := func(certData, keyData []byte) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "cluster1", Name: "admin-token"},
+			Data: map[string][]byte{
+				corev1.TLSCertKey:       certData,
+				corev1.TLSPrivateKeyKey: keyData,
+			},
+		}
+	}
+
+	cases := []struct {
+		name           string
+		mode           Mode
+		config         string
+		objects        []client.Object
+		syncedToken    string
+		expectedToken  string
+		expectedCert   []byte
+		expectedKey    []byte
+		expectedExpiry *metav1.Time
+		expectedErr    string
+	}{
+		{
+			name:          "managedserviceaccount",
+			mode:          ModeManagedServiceAccount,
+			config:        `{"clusterName":"cluster1"}`,
+			objects:       []client.Object{newMSA(), tokenSecret},
+			expectedToken: validToken,
+		},
+		{
+			name:        "managedserviceaccount not found",
+			mode:        ModeManagedServiceAccount,
+			config:      `{"clusterName":"cluster1"}`,
+			expectedErr: "managed serviceaccount cluster1/admin is not found",
+		},
+		{
+			name:   "managedserviceaccount not ready",
+			mode:   ModeManagedServiceAccount,
+			config: `{"clusterName":"cluster1"}`,
+			objects: []client.Object{newMSA(func(msa *authv1beta1.ManagedServiceAccount) {
+				msa.Status.Conditions[0].Status = metav1.ConditionFalse
+				msa.Status.Conditions[0].Reason = "TokenNotReported"
+				msa.Status.Conditions[0].Message = "the token is not reported yet"
+			}), tokenSecret},
+			expectedErr: "managed serviceaccount cluster1/admin is not ready: TokenNotReported: the token is not reported yet",
+		},
+		{
+			name:   "managedserviceaccount token expired",
+			mode:   ModeManagedServiceAccount,
+			config: `{"clusterName":"cluster1"}`,
+			objects: []client.Object{newMSA(func(msa *authv1beta1.ManagedServiceAccount) {
+				msa.Status.ExpirationTimestamp = &metav1.Time{Time: time.Now().Add(-time.Minute)}
+			}), tokenSecret},
+			expectedErr: "the token of managed serviceaccount cluster1/admin expired at",
+		},
+		{
+			name:           "managedserviceaccount client certificate",
+			mode:           ModeManagedServiceAccount,
+			config:         `{"clusterName":"cluster1"}`,
+			objects:        []client.Object{newMSA(), newCertSecret(certData, keyData)},
+			expectedCert:   certData,
+			expectedKey:    keyData,
+			expectedExpiry: &metav1.Time{Time: certExpiry},
+		},
+		{
+			name:        "managedserviceaccount client certificate expired",
+			mode:        ModeManagedServiceAccount,
+			config:      `{"clusterName":"cluster1"}`,
+			objects:     []client.Object{newMSA(), newCertSecret(expiredCertData, expiredKeyData)},
+			expectedErr: "the client certificate of managed serviceaccount admin on cluster cluster1 expired at",
+		},
+		{
+			name:        "managedserviceaccount client certificate without the key",
+			mode:        ModeManagedServiceAccount,
+			config:      `{"clusterName":"cluster1"}`,
+			objects:     []client.Object{newMSA(), newCertSecret(certData, nil)},
+			expectedErr: `secret cluster1/admin-token missing or empty "token" key, or "tls.crt" and "tls.key" keys`,
+		},
+		{
+			name:          "clusterprofile",
+			mode:          ModeClusterProfile,
+			config:        `{"clusterProfile":{"namespace":"cp-ns","name":"profile1"}}`,
+			objects:       []client.Object{newCP(controller.ClusterProfileManagerName), newMSA(), tokenSecret},
+			expectedToken: validToken,
+		},
+		{
+			name:        "clusterprofile of another manager",
+			mode:        ModeClusterProfile,
+			config:      `{"clusterProfile":{"namespace":"cp-ns","name":"profile1"}}`,
+			objects:     []client.Object{newCP("other"), newMSA(), tokenSecret},
+			expectedErr: "clusterprofile cp-ns/profile1 is not managed by open-cluster-management",
+		},
+		{
+			name:   "clusterprofile without the cluster name",
+			mode:   ModeClusterProfile,
+			config: `{"clusterProfile":{"namespace":"cp-ns","name":"profile1"}}`,
+			objects: []client.Object{func() *cpv1alpha1.ClusterProfile {
+				cp := newCP(controller.ClusterProfileManagerName)
+				delete(cp.Labels, clusterv1.ClusterNameLabelKey)
+				return cp
+			}(), newMSA(), tokenSecret},
+			expectedErr: "clusterprofile cp-ns/profile1 has no open-cluster-management.io/cluster-name label",
+		},
+		{
+			name:        "clusterprofile missing in the config",
+			mode:        ModeClusterProfile,
+			config:      `{"clusterName":"cluster1"}`,
+			expectedErr: "missing clusterProfile in ExecCredential.Spec.Cluster.Config",
+		},
+		{
+			name:        "synced token expired",
+			mode:        ModeSynced,
+			config:      `{"clusterName":"cluster1"}`,
+			syncedToken: newTestToken(time.Now().Add(-time.Minute)),
+			expectedErr: "the token of managed serviceaccount admin on cluster cluster1 expired at",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Setenv("NAMESPACE", "cp-ns")
+			kubeClient := kubefake.NewSimpleClientset(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "cp-ns", Name: "cluster1-admin"},
+				Data:       map[string][]byte{corev1.ServiceAccountTokenKey: []byte(c.syncedToken)},
+			})
+			hubClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(c.objects...).Build()
+
+			p := Provider{KubeClient: kubeClient, HubClient: hubClient, ManagedServiceAccount: "admin", Mode: c.mode}
+			status, err := p.GetToken(context.TODO(), clientauthenticationv1.ExecCredential{
+				Spec: clientauthenticationv1.ExecCredentialSpec{
+					Cluster: &clientauthenticationv1.Cluster{
+						Config: runtime.RawExtension{Raw: []byte(c.config)},
+					},
+				},
+			})
+			if len(c.expectedErr) > 0 {
+				assert.ErrorContains(t, err, c.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, c.expectedToken, status.Token)
+			assert.Equal(t, string(c.expectedCert), status.ClientCertificateData)
+			assert.Equal(t, string(c.expectedKey), status.ClientKeyData)
+			if c.expectedExpiry != nil {
+				assert.True(t, c.expectedExpiry.Equal(status.ExpirationTimestamp))
+			}
+		})
+	}
+}
+
+// fakeKMS wraps the data keys by prefixing them.
+type fakeKMS struct{}
+
+func (fakeKMS) Encrypt(_ context.Context, _ string, data []byte) (*kmsservice.EncryptResponse, error) {
+	return &kmsservice.EncryptResponse{Ciphertext: append([]byte("wrapped:"), data...), KeyID: "key1"}, nil
+}
+
+func (fakeKMS) Decrypt(_ context.Context, _ string, req *kmsservice.DecryptRequest) ([]byte, error) {
+	return bytes.TrimPrefix(req.Ciphertext, []byte("wrapped:")), nil
+}
+
+func (fakeKMS) Status(_ context.Context) (*kmsservice.StatusResponse, error) {
+	return &kmsservice.StatusResponse{Version: "v2", Healthz: "ok", KeyID: "key1"}, nil
+}
+
+func TestGetTokenEncrypted(t *testing.T) {
+	t.Setenv("NAMESPACE", "cp-ns")
+	token := newTestToken(time.Now().Add(time.Hour))
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "cp-ns", Name: "cluster1-admin"},
+		Data:       map[string][]byte{corev1.ServiceAccountTokenKey: []byte(token)},
+	}
+	assert.NoError(t, envelope.New(fakeKMS{}).EncryptSecret(context.TODO(), secret))
+	info := clientauthenticationv1.ExecCredential{
+		Spec: clientauthenticationv1.ExecCredentialSpec{
+			Cluster: &clientauthenticationv1.Cluster{
+				Config: runtime.RawExtension{Raw: []byte(`{"clusterName":"cluster1"}`)},
+			},
+		},
+	}
+
+	p := Provider{KubeClient: kubefake.NewSimpleClientset(secret), ManagedServiceAccount: "admin", Mode: ModeSynced}
+	_, err := p.GetToken(context.TODO(), info)
+	assert.EqualError(t, err, "secret cp-ns/cluster1-admin is envelope encrypted, a KMS plugin is required to decrypt it")
+
+	// the decrypted token is not cached
+	cacheDir := t.TempDir()
+	p.Envelope = envelope.New(fakeKMS{})
+	p.Cache = NewTokenCache(cacheDir, 5*time.Minute)
+	status, err := p.GetToken(context.TODO(), info)
+	assert.NoError(t, err)
+	assert.Equal(t, token, status.Token)
+	entries, err := os.ReadDir(cacheDir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	cpv1alpha1 "sigs.k8s.io/cluster-inventory-api/apis/v1alpha1"
+
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+	"open-cluster-management.io/managed-serviceaccount/pkg/addon/manager/controller"
+)
+
+// Mode is how the plugin resolves the token secret.
+type Mode string
+
+const (
+	// ModeSynced reads the secret synced to the ClusterProfile namespace by the ClusterProfileCredSyncer,
+	// named "<clusterName>-<managedServiceAccount>" in the namespace the plugin runs in.
+	ModeSynced Mode = "synced"
+	// ModeManagedServiceAccount reads the status.tokenSecretRef of the ManagedServiceAccount in the
+	// cluster namespace directly.
+	ModeManagedServiceAccount Mode = "managedserviceaccount"
+	// ModeClusterProfile resolves the cluster from the ClusterProfile referenced in the exec config,
+	// and reads the token secret of the ManagedServiceAccount of the cluster.
+	ModeClusterProfile Mode = "clusterprofile"
+)
+
+var (
+	scheme = runtime.NewScheme()
+)
+
+func init() {
+	utilruntime.Must(corev1.AddToScheme(scheme))
+	utilruntime.Must(authv1beta1.AddToScheme(scheme))
+	utilruntime.Must(cpv1alpha1.AddToScheme(scheme))
+}
+
+// credentialOfClusterProfile reads the credential of the ManagedServiceAccount of the cluster the
+// ClusterProfile is managed for.
+func (p Provider) credentialOfClusterProfile(ctx context.Context, ref *clusterProfileRef) (*corev1.Secret, error) {
+	cp := &cpv1alpha1.ClusterProfile{}
+	if err := p.HubClient.Get(ctx, types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}, cp); err != nil {
+		return nil, fmt.Errorf("failed to get clusterprofile %s/%s: %w", ref.Namespace, ref.Name, err)
+	}
+	if cp.Labels[cpv1alpha1.LabelClusterManagerKey] != controller.ClusterProfileManagerName {
+		return nil, fmt.Errorf("clusterprofile %s/%s is not managed by %s", ref.Namespace, ref.Name,
+			controller.ClusterProfileManagerName)
+	}
+	clusterName := cp.Labels[clusterv1.ClusterNameLabelKey]
+	if clusterName == "" {
+		return nil, fmt.Errorf("clusterprofile %s/%s has no %s label", ref.Namespace, ref.Name,
+			clusterv1.ClusterNameLabelKey)
+	}
+	return p.credentialOfManagedServiceAccount(ctx, clusterName)
+}
+
+// credentialOfManagedServiceAccount reads the token secret reported by the ManagedServiceAccount in
+// the cluster namespace, the ManagedServiceAccount is required to be ready with an unexpired token.
+func (p Provider) credentialOfManagedServiceAccount(ctx context.Context, clusterName string) (*corev1.Secret, error) {
+	key := types.NamespacedName{Namespace: clusterName, Name: p.ManagedServiceAccount}
+	msa := &authv1beta1.ManagedServiceAccount{}
+	if err := p.HubClient.Get(ctx, key, msa); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("managed serviceaccount %s is not found", key)
+		}
+		return nil, fmt.Errorf("failed to get managed serviceaccount %s: %w", key, err)
+	}
+
+	ready := meta.FindStatusCondition(msa.Status.Conditions, authv1beta1.ConditionTypeReady)
+	if ready == nil {
+		return nil, fmt.Errorf("managed serviceaccount %s is not ready: no %s condition reported by the agent yet",
+			key, authv1beta1.ConditionTypeReady)
+	}
+	if ready.Status != metav1.ConditionTrue {
+		return nil, fmt.Errorf("managed serviceaccount %s is not ready: %s: %s", key, ready.Reason, ready.Message)
+	}
+	if expiration := msa.Status.ExpirationTimestamp; expiration != nil && !expiration.After(time.Now()) {
+		return nil, fmt.Errorf("the token of managed serviceaccount %s expired at %s", key,
+			expiration.UTC().Format(time.RFC3339))
+	}
+	if msa.Status.TokenSecretRef == nil {
+		return nil, fmt.Errorf("the token of managed serviceaccount %s is not reported yet", key)
+	}
+
+	secret := &corev1.Secret{}
+	secretKey := types.NamespacedName{Namespace: clusterName, Name: msa.Status.TokenSecretRef.Name}
+	if err := p.HubClient.Get(ctx, secretKey, secret); err != nil {
+		return nil, fmt.Errorf("failed to get token secret %s of managed serviceaccount %s: %w", secretKey, key, err)
+	}
+	return p.Envelope.DecryptSecret(ctx, secret)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+)
+
+// CreateOptions holds the spec of the ManagedServiceAccounts to create.
+type CreateOptions struct {
+	*Options
+
+	Validity     time.Duration
+	ClusterRoles []string
+	Roles        []string
+}
+
+func newCreateCommand(parent *Options) *cobra.Command {
+	o := &CreateOptions{Options: parent}
+	cmd := &cobra.Command{
+		Use:   "create NAME",
+		Short: "Create a ManagedServiceAccount on the managed clusters",
+		Example: `  # Create a ManagedServiceAccount viewing cluster1 and cluster2 with tokens valid for a day
+  kubectl msa create viewer -c cluster1,cluster2 --cluster-role view --validity 24h`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.Run(cmd, args[0])
+		},
+	}
+	o.AddClusterFlags(cmd.Flags())
+	cmd.Flags().DurationVar(&o.Validity, "validity", 8640*time.Hour, "Validity of the tokens.")
+	cmd.Flags().StringSliceVar(&o.ClusterRoles, "cluster-role", nil,
+		"Existing ClusterRoles on the managed clusters bound to the service account cluster-wide.")
+	cmd.Flags().StringSliceVar(&o.Roles, "role", nil,
+		"Existing Roles on the managed clusters bound to the service account, in the form of <namespace>/<name>.")
+	return cmd
+}
+
+func (o *CreateOptions) Run(cmd *cobra.Command, name string) error {
+	msa, err := o.managedServiceAccount(name)
+	if err != nil {
+		return err
+	}
+	clusters, err := o.clusterNames(cmd)
+	if err != nil {
+		return err
+	}
+	c, err := o.hubClient()
+	if err != nil {
+		return err
+	}
+
+	for _, cluster := range clusters {
+		created := msa.DeepCopy()
+		created.Namespace = cluster
+		if err := c.Create(cmd.Context(), created); err != nil {
+			if apierrors.IsAlreadyExists(err) {
+				fmt.Fprintf(cmd.OutOrStdout(), "managedserviceaccount %s/%s already exists\n", cluster, name)
+				continue
+			}
+			return errors.Wrapf(err, "failed to create managed serviceaccount %s/%s", cluster, name)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "managedserviceaccount %s/%s created\n", cluster, name)
+	}
+	return nil
+}
+
+// managedServiceAccount returns the ManagedServiceAccount prescribed by the flags.
+func (o *CreateOptions) managedServiceAccount(name string) (*authv1beta1.ManagedServiceAccount, error) {
+	msa := &authv1beta1.ManagedServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: authv1beta1.ManagedServiceAccountSpec{
+			Rotation: authv1beta1.ManagedServiceAccountRotation{
+				Enabled:  true,
+				Validity: metav1.Duration{Duration: o.Validity},
+			},
+		},
+	}
+
+	var roleRefs []authv1beta1.ManagedRoleRef
+	for _, clusterRole := range o.ClusterRoles {
+		roleRefs = append(roleRefs, authv1beta1.ManagedRoleRef{Kind: "ClusterRole", Name: clusterRole})
+	}
+	for _, role := range o.Roles {
+		namespace, roleName, ok := strings.Cut(role, "/")
+		if !ok || len(namespace) == 0 || len(roleName) == 0 {
+			return nil, fmt.Errorf("invalid role %q, it should be in the form of <namespace>/<name>", role)
+		}
+		roleRefs = append(roleRefs, authv1beta1.ManagedRoleRef{Kind: "Role", Namespace: namespace, Name: roleName})
+	}
+	if len(roleRefs) > 0 {
+		msa.Spec.Permissions = &authv1beta1.ManagedServiceAccountPermissions{RoleRefs: roleRefs}
+	}
+	return msa, nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apiserver/pkg/authentication/serviceaccount"
+
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+	"open-cluster-management.io/managed-serviceaccount/pkg/common"
+)
+
+// DecodeOptions holds the token to decode.
+type DecodeOptions struct {
+	*Options
+
+	// TokenFile is the file of the token, "-" for the standard input.
+	TokenFile string
+	// Previous decodes the previous token kept in the token secret in the overlap mode.
+	Previous bool
+}
+
+// tokenClaims are the claims of the ServiceAccount tokens.
+type tokenClaims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Audiences []string `json:"aud"`
+	ID        string   `json:"jti"`
+	IssuedAt  int64    `json:"iat"`
+	NotBefore int64    `json:"nbf"`
+	Expiry    int64    `json:"exp"`
+
+	Kubernetes struct {
+		Namespace      string `json:"namespace"`
+		ServiceAccount struct {
+			Name string    `json:"name"`
+			UID  types.UID `json:"uid"`
+		} `json:"serviceaccount"`
+	} `json:"kubernetes.io"`
+}
+
+func newDecodeCommand(parent *Options) *cobra.Command {
+	o := &DecodeOptions{Options: parent}
+	cmd := &cobra.Command{
+		Use:   "decode [NAME]",
+		Short: "Show the claims of the token of the ManagedServiceAccount",
+		Example: `  # Show the claims of the token on cluster1
+  kubectl msa decode viewer -c cluster1
+
+  # Show the claims of a token from the standard input
+  kubectl -n cluster1 get secret viewer -o jsonpath='{.data.token}' | base64 -d | kubectl msa decode --token-file -`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := ""
+			if len(args) > 0 {
+				name = args[0]
+			}
+			return o.Run(cmd, name)
+		},
+	}
+	cmd.Flags().StringSliceVarP(&o.Clusters, "cluster", "c", nil, "Name of the managed cluster.")
+	cmd.Flags().StringVar(&o.TokenFile, "token-file", "", "Decode the token in the file instead, \"-\" for the standard input.")
+	cmd.Flags().BoolVar(&o.Previous, "previous", false, "Decode the previous token kept in the token secret.")
+	return cmd
+}
+
+func (o *DecodeOptions) Run(cmd *cobra.Command, name string) error {
+	if len(o.TokenFile) > 0 {
+		var data []byte
+		var err error
+		if o.TokenFile == "-" {
+			data, err = io.ReadAll(cmd.InOrStdin())
+		} else {
+			data, err = os.ReadFile(o.TokenFile)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to read the token")
+		}
+		claims, err := decodeClaims(strings.TrimSpace(string(data)))
+		if err != nil {
+			return err
+		}
+		return printClaims(cmd.OutOrStdout(), claims, nil, time.Now())
+	}
+
+	if len(name) == 0 || len(o.Clusters) != 1 {
+		return errors.New("either a name and a single --cluster, or --token-file is required")
+	}
+	c, err := o.hubClient()
+	if err != nil {
+		return err
+	}
+	key := types.NamespacedName{Namespace: o.Clusters[0], Name: name}
+	secret, err := o.tokenSecretOf(cmd.Context(), c, key)
+	if err != nil {
+		return err
+	}
+	tokenKey := corev1.ServiceAccountTokenKey
+	if o.Previous {
+		tokenKey = common.SecretKeyPreviousToken
+	}
+	token := string(secret.Data[tokenKey])
+	if len(token) == 0 {
+		return fmt.Errorf("no %s found in the token secret of managed serviceaccount %s", tokenKey, key)
+	}
+	claims, err := decodeClaims(token)
+	if err != nil {
+		return err
+	}
+
+	msa := &authv1beta1.ManagedServiceAccount{}
+	if err := c.Get(cmd.Context(), key, msa); err != nil {
+		return errors.Wrapf(err, "failed to get managed serviceaccount %s", key)
+	}
+	return printClaims(cmd.OutOrStdout(), claims, msa, time.Now())
+}
+
+// decodeClaims decodes the payload of the JWT token without verifying the signature.
+func decodeClaims(token string) (*tokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("invalid JWT token format")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decode payload")
+	}
+	claims := &tokenClaims{}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return nil, errors.Wrapf(err, "failed to unmarshal claims")
+	}
+	return claims, nil
+}
+
+// printClaims prints the claims, and whether the token is issued for the service account of the
+// ManagedServiceAccount if it is given.
+func printClaims(out io.Writer, claims *tokenClaims, msa *authv1beta1.ManagedServiceAccount, now time.Time) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Subject:\t%s\n", claims.Subject)
+	if namespace, name, err := serviceaccount.SplitUsername(claims.Subject); err == nil {
+		fmt.Fprintf(w, "Service Account:\t%s/%s\n", namespace, name)
+	}
+	if len(claims.Kubernetes.ServiceAccount.UID) > 0 {
+		fmt.Fprintf(w, "Service Account UID:\t%s\n", claims.Kubernetes.ServiceAccount.UID)
+	}
+	fmt.Fprintf(w, "Issuer:\t%s\n", claims.Issuer)
+	fmt.Fprintf(w, "Audiences:\t%s\n", strings.Join(claims.Audiences, ","))
+	fmt.Fprintf(w, "Token ID:\t%s\n", claims.ID)
+	fmt.Fprintf(w, "Issued At:\t%s\n", formatUnix(claims.IssuedAt))
+	fmt.Fprintf(w, "Not Before:\t%s\n", formatUnix(claims.NotBefore))
+	expiry := "<none>"
+	if claims.Expiry > 0 {
+		expiresAt := time.Unix(claims.Expiry, 0)
+		expiry = fmt.Sprintf("%s (%s)", formatUnix(claims.Expiry),
+			timeUntil(&metav1.Time{Time: expiresAt}, now, "expired"))
+	}
+	fmt.Fprintf(w, "Expires:\t%s\n", expiry)
+	if msa != nil {
+		fmt.Fprintf(w, "Matches Service Account:\t%t\n", matchesServiceAccount(claims, msa))
+	}
+	return w.Flush()
+}
+
+// matchesServiceAccount checks the `sub` and the ServiceAccount UID claims against the service
+// account of the ManagedServiceAccount.
+func matchesServiceAccount(claims *tokenClaims, msa *authv1beta1.ManagedServiceAccount) bool {
+	namespace, name, err := serviceaccount.SplitUsername(claims.Subject)
+	if err != nil {
+		return false
+	}
+	expectedName := msa.Name
+	if sa := msa.Spec.ServiceAccount; sa != nil {
+		if len(sa.Namespace) > 0 && sa.Namespace != namespace {
+			return false
+		}
+		if len(sa.Name) > 0 {
+			expectedName = sa.Name
+		}
+	}
+	if name != expectedName {
+		return false
+	}
+	uid := msa.Status.ServiceAccountUID
+	return len(uid) == 0 || uid == claims.Kubernetes.ServiceAccount.UID
+}
+
+func formatUnix(seconds int64) string {
+	if seconds == 0 {
+		return "<none>"
+	}
+	return time.Unix(seconds, 0).UTC().Format(time.RFC3339)
+}
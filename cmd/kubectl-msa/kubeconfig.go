@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+	"open-cluster-management.io/managed-serviceaccount/pkg/common"
+	"open-cluster-management.io/managed-serviceaccount/pkg/envelope"
+)
+
+// KubeconfigOptions holds how the kubeconfig is delivered.
+type KubeconfigOptions struct {
+	*Options
+
+	// Merge merges the kubeconfig into the kubeconfig file instead of printing it.
+	Merge bool
+}
+
+func newKubeconfigCommand(parent *Options) *cobra.Command {
+	o := &KubeconfigOptions{Options: parent}
+	cmd := &cobra.Command{
+		Use:   "kubeconfig NAME",
+		Short: "Print or merge a kubeconfig authenticating with the token of the ManagedServiceAccount",
+		Example: `  # Print a kubeconfig of cluster1
+  kubectl msa kubeconfig viewer -c cluster1 > cluster1.kubeconfig
+
+  # Add a context "<cluster>-viewer" per production cluster to the kubeconfig file
+  kubectl msa kubeconfig viewer -l env=prod --merge`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.Run(cmd, args[0])
+		},
+	}
+	o.AddClusterFlags(cmd.Flags())
+	cmd.Flags().BoolVar(&o.Merge, "merge", false, "Merge the contexts into the kubeconfig file instead of printing them.")
+	return cmd
+}
+
+func (o *KubeconfigOptions) Run(cmd *cobra.Command, name string) error {
+	clusters, err := o.clusterNames(cmd)
+	if err != nil {
+		return err
+	}
+	c, err := o.hubClient()
+	if err != nil {
+		return err
+	}
+
+	config := clientcmdapi.NewConfig()
+	for _, cluster := range clusters {
+		server, caData, token, err := o.resolveCredential(cmd.Context(), c, types.NamespacedName{Namespace: cluster, Name: name})
+		if err != nil {
+			return err
+		}
+		contextName := fmt.Sprintf("%s-%s", cluster, name)
+		config.Clusters[cluster] = &clientcmdapi.Cluster{Server: server, CertificateAuthorityData: caData}
+		config.AuthInfos[contextName] = &clientcmdapi.AuthInfo{Token: token}
+		config.Contexts[contextName] = &clientcmdapi.Context{Cluster: cluster, AuthInfo: contextName}
+		if len(config.CurrentContext) == 0 {
+			config.CurrentContext = contextName
+		}
+	}
+
+	if !o.Merge {
+		data, err := clientcmd.Write(*config)
+		if err != nil {
+			return errors.Wrapf(err, "failed to build kubeconfig")
+		}
+		_, err = cmd.OutOrStdout().Write(data)
+		return err
+	}
+
+	path := o.loadingRules.GetDefaultFilename()
+	existing, err := clientcmd.LoadFromFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return errors.Wrapf(err, "failed to load kubeconfig %s", path)
+		}
+		existing = clientcmdapi.NewConfig()
+	}
+	mergeKubeconfig(existing, config)
+	if err := clientcmd.WriteToFile(*existing, path); err != nil {
+		return errors.Wrapf(err, "failed to write kubeconfig %s", path)
+	}
+	for contextName := range config.Contexts {
+		fmt.Fprintf(cmd.OutOrStdout(), "context %q merged into %s\n", contextName, path)
+	}
+	return nil
+}
+
+// mergeKubeconfig adds or replaces the clusters, users and contexts of the kubeconfig, the current
+// context is kept.
+func mergeKubeconfig(existing, config *clientcmdapi.Config) {
+	for name, cluster := range config.Clusters {
+		existing.Clusters[name] = cluster
+	}
+	for name, authInfo := range config.AuthInfos {
+		existing.AuthInfos[name] = authInfo
+	}
+	for name, context := range config.Contexts {
+		existing.Contexts[name] = context
+	}
+	if len(existing.CurrentContext) == 0 {
+		existing.CurrentContext = config.CurrentContext
+	}
+}
+
+// resolveCredential returns the URL and the CA bundle of the managed cluster, and the current token
+// of the ManagedServiceAccount. The kubeconfig in the token secret of the Kubeconfig format takes
+// precedence over the client config of the ManagedCluster.
+func (o *Options) resolveCredential(ctx context.Context, c client.Client,
+	key types.NamespacedName) (string, []byte, string, error) {
+	secret, err := o.tokenSecretOf(ctx, c, key)
+	if err != nil {
+		return "", nil, "", err
+	}
+	token := string(secret.Data[corev1.ServiceAccountTokenKey])
+	if len(token) == 0 {
+		return "", nil, "", fmt.Errorf("no token found in the token secret of managed serviceaccount %s", key)
+	}
+
+	if data := secret.Data[common.SecretKeyKubeconfig]; len(data) > 0 {
+		config, err := clientcmd.Load(data)
+		if err != nil {
+			return "", nil, "", errors.Wrapf(err, "invalid kubeconfig in the token secret of managed serviceaccount %s", key)
+		}
+		if kubeContext, ok := config.Contexts[config.CurrentContext]; ok {
+			if cluster, ok := config.Clusters[kubeContext.Cluster]; ok {
+				return cluster.Server, cluster.CertificateAuthorityData, token, nil
+			}
+		}
+	}
+
+	cluster := &clusterv1.ManagedCluster{}
+	if err := c.Get(ctx, types.NamespacedName{Name: key.Namespace}, cluster); err != nil {
+		return "", nil, "", errors.Wrapf(err, "failed to get managed cluster %s", key.Namespace)
+	}
+	for _, config := range cluster.Spec.ManagedClusterClientConfigs {
+		if len(config.URL) == 0 {
+			continue
+		}
+		caData := config.CABundle
+		if len(caData) == 0 {
+			caData = secret.Data[corev1.ServiceAccountRootCAKey]
+		}
+		return config.URL, caData, token, nil
+	}
+	return "", nil, "", fmt.Errorf("no server URL found in the client configs of managed cluster %s", key.Namespace)
+}
+
+// tokenSecretOf returns the token secret reported by the ManagedServiceAccount, the credentials of
+// the envelope encryption are decrypted.
+func (o *Options) tokenSecretOf(ctx context.Context, c client.Client, key types.NamespacedName) (*corev1.Secret, error) {
+	msa := &authv1beta1.ManagedServiceAccount{}
+	if err := c.Get(ctx, key, msa); err != nil {
+		return nil, errors.Wrapf(err, "failed to get managed serviceaccount %s", key)
+	}
+	if msa.Status.TokenSecretRef == nil {
+		return nil, fmt.Errorf("the token of managed serviceaccount %s is not reported yet", key)
+	}
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{
+		Namespace: key.Namespace,
+		Name:      msa.Status.TokenSecretRef.Name,
+	}, secret); err != nil {
+		return nil, errors.Wrapf(err, "failed to get the token secret of managed serviceaccount %s", key)
+	}
+	if !envelope.IsEncrypted(secret) {
+		return secret, nil
+	}
+	e, err := o.envelope()
+	if err != nil {
+		return nil, err
+	}
+	return e.DecryptSecret(ctx, secret)
+}
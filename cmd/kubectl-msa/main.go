@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+	"open-cluster-management.io/managed-serviceaccount/pkg/envelope"
+)
+
+var (
+	scheme = runtime.NewScheme()
+)
+
+func init() {
+	utilruntime.Must(corev1.AddToScheme(scheme))
+	utilruntime.Must(authv1beta1.AddToScheme(scheme))
+	utilruntime.Must(clusterv1.AddToScheme(scheme))
+}
+
+// Options holds the connection to the hub cluster and the ManagedClusters the subcommands act on.
+type Options struct {
+	loadingRules *clientcmd.ClientConfigLoadingRules
+	overrides    *clientcmd.ConfigOverrides
+
+	// Clusters are the names of the ManagedClusters.
+	Clusters []string
+	// Selector is a label selector of the ManagedClusters, it is used if no cluster is named.
+	Selector string
+
+	// Client is the client of the hub cluster, it is built from the kubeconfig flags if unset.
+	Client client.Client
+
+	// KMSEndpoint is the endpoint of the KMS v2 plugin decrypting the token secrets of the envelope
+	// encryption.
+	KMSEndpoint string
+	KMSTimeout  time.Duration
+	// Envelope decrypts the token secrets, it is built from the KMS flags if unset.
+	Envelope *envelope.Envelope
+}
+
+func NewOptions() *Options {
+	return &Options{
+		loadingRules: clientcmd.NewDefaultClientConfigLoadingRules(),
+		overrides:    &clientcmd.ConfigOverrides{},
+	}
+}
+
+func (o *Options) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&o.loadingRules.ExplicitPath, "kubeconfig", "", "Path to the kubeconfig file of the hub cluster.")
+	// --cluster and --namespace of kubectl are left out, they select the managed clusters here
+	flags.StringVar(&o.overrides.CurrentContext, "context", "", "The name of the kubeconfig context of the hub cluster.")
+	flags.StringVar(&o.KMSEndpoint, "kms-endpoint", "", "The endpoint of the KMS v2 plugin decrypting the token "+
+		"secrets of the envelope encryption, e.g. unix:///var/run/kmsplugin/socket.sock.")
+	flags.DurationVar(&o.KMSTimeout, "kms-timeout", envelope.DefaultKMSTimeout, "The timeout of the calls to the KMS plugin.")
+}
+
+// AddClusterFlags adds the flags selecting the ManagedClusters.
+func (o *Options) AddClusterFlags(flags *pflag.FlagSet) {
+	flags.StringSliceVarP(&o.Clusters, "cluster", "c", nil, "Names of the managed clusters.")
+	flags.StringVarP(&o.Selector, "selector", "l", "", "Label selector of the managed clusters, used if no cluster is named.")
+}
+
+// hubClient returns the client of the hub cluster.
+func (o *Options) hubClient() (client.Client, error) {
+	if o.Client != nil {
+		return o.Client, nil
+	}
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(o.loadingRules, o.overrides).ClientConfig()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load the kubeconfig of the hub cluster")
+	}
+	c, err := client.New(config, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create the client of the hub cluster")
+	}
+	o.Client = c
+	return c, nil
+}
+
+// envelope returns the Envelope decrypting the token secrets, or nil if no KMS plugin is configured.
+func (o *Options) envelope() (*envelope.Envelope, error) {
+	if o.Envelope != nil || len(o.KMSEndpoint) == 0 {
+		return o.Envelope, nil
+	}
+	e, err := envelope.Dial(o.KMSEndpoint, o.KMSTimeout)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to connect to the KMS plugin")
+	}
+	o.Envelope = e
+	return e, nil
+}
+
+// clusterNames returns the named ManagedClusters, or the ManagedClusters matching the selector.
+func (o *Options) clusterNames(cmd *cobra.Command) ([]string, error) {
+	if len(o.Clusters) > 0 {
+		return o.Clusters, nil
+	}
+	if len(o.Selector) == 0 {
+		return nil, errors.New("either --cluster or --selector is required")
+	}
+	selector, err := labels.Parse(o.Selector)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid selector %q", o.Selector)
+	}
+	c, err := o.hubClient()
+	if err != nil {
+		return nil, err
+	}
+	clusters := &clusterv1.ManagedClusterList{}
+	if err := c.List(cmd.Context(), clusters, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, errors.Wrapf(err, "failed to list managed clusters")
+	}
+	names := []string{}
+	for _, cluster := range clusters.Items {
+		names = append(names, cluster.Name)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no managed cluster matches %q", o.Selector)
+	}
+	return names, nil
+}
+
+func newCommand(o *Options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "kubectl-msa",
+		Short:        "Manage the ManagedServiceAccounts of the managed clusters",
+		SilenceUsage: true,
+	}
+	o.AddFlags(cmd.PersistentFlags())
+
+	cmd.AddCommand(newCreateCommand(o))
+	cmd.AddCommand(newStatusCommand(o))
+	cmd.AddCommand(newKubeconfigCommand(o))
+	cmd.AddCommand(newRotateCommand(o))
+	cmd.AddCommand(newDecodeCommand(o))
+	cmd.AddCommand(newWaitCommand(o))
+	return cmd
+}
+
+func main() {
+	if err := newCommand(NewOptions()).Execute(); err != nil {
+		os.Exit(1)
+	}
+}
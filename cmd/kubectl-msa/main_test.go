@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+	"open-cluster-management.io/managed-serviceaccount/pkg/common"
+)
+
+var testToken = "eyJhbGciOiJSUzI1NiJ9." + base64.RawURLEncoding.EncodeToString([]byte(
+	`{"aud":["https://kubernetes.default.svc"],"exp":4102444800,"iat":1747614980,`+
+		`"iss":"https://kubernetes.default.svc","jti":"token-1","kubernetes.io":{"namespace":`+
+		`"open-cluster-management-agent-addon","serviceaccount":{"name":"viewer","uid":"sa-uid"}},`+
+		`"sub":"system:serviceaccount:open-cluster-management-agent-addon:viewer"}`)) + ".signature"
+
+func TestCommands(t *testing.T) {
+	cases := []struct {
+		name           string
+		args           []string
+		objects        []client.Object
+		expectedErr    string
+		expectedOutput []string
+		validateFunc   func(t *testing.T, hubClient client.Client)
+	}{
+		{
+			name: "create on the selected clusters",
+			args: []string{"create", "viewer", "-l", "env=prod", "--cluster-role", "view", "--role", "default/edit",
+				"--validity", "24h"},
+			expectedOutput: []string{"cluster1/viewer created", "cluster2/viewer created"},
+			validateFunc: func(t *testing.T, hubClient client.Client) {
+				msa := getMSA(t, hubClient, "cluster2", "viewer")
+				assert.Equal(t, 24*time.Hour, msa.Spec.Rotation.Validity.Duration)
+				assert.Equal(t, []authv1beta1.ManagedRoleRef{
+					{Kind: "ClusterRole", Name: "view"},
+					{Kind: "Role", Namespace: "default", Name: "edit"},
+				}, msa.Spec.Permissions.RoleRefs)
+			},
+		},
+		{
+			name:        "create with an invalid role",
+			args:        []string{"create", "viewer", "-c", "cluster1", "--role", "edit"},
+			expectedErr: `invalid role "edit"`,
+		},
+		{
+			name:        "create without clusters",
+			args:        []string{"create", "viewer"},
+			expectedErr: "either --cluster or --selector is required",
+		},
+		{
+			name:           "status of the fleet",
+			args:           []string{"status"},
+			objects:        []client.Object{newTestMSA("cluster2", true), newTestMSA("cluster1", false)},
+			expectedOutput: []string{"cluster1   viewer   False", "cluster2   viewer   True"},
+		},
+		{
+			name:           "kubeconfig of the clusters",
+			args:           []string{"kubeconfig", "viewer", "-c", "cluster1"},
+			objects:        []client.Object{newTestMSA("cluster1", true), newTestSecret("cluster1")},
+			expectedOutput: []string{"server: https://cluster1:6443", "token: " + testToken, "current-context: cluster1-viewer"},
+		},
+		{
+			name:        "kubeconfig before the token is reported",
+			args:        []string{"kubeconfig", "viewer", "-c", "cluster1"},
+			objects:     []client.Object{newTestMSA("cluster1", false)},
+			expectedErr: "the token of managed serviceaccount cluster1/viewer is not reported yet",
+		},
+		{
+			name:           "rotate",
+			args:           []string{"rotate", "viewer", "-c", "cluster1"},
+			objects:        []client.Object{newTestMSA("cluster1", true)},
+			expectedOutput: []string{"cluster1/viewer rotated"},
+			validateFunc: func(t *testing.T, hubClient client.Client) {
+				msa := getMSA(t, hubClient, "cluster1", "viewer")
+				assert.NotEmpty(t, msa.Annotations[common.AnnotationKeyReissueAfter])
+				assert.Equal(t, int64(0), msa.Spec.RevocationGeneration)
+			},
+		},
+		{
+			name:    "rotate with revocation",
+			args:    []string{"rotate", "viewer", "-c", "cluster1", "--revoke"},
+			objects: []client.Object{newTestMSA("cluster1", true)},
+			validateFunc: func(t *testing.T, hubClient client.Client) {
+				msa := getMSA(t, hubClient, "cluster1", "viewer")
+				assert.Empty(t, msa.Annotations[common.AnnotationKeyReissueAfter])
+				assert.Equal(t, int64(1), msa.Spec.RevocationGeneration)
+			},
+		},
+		{
+			name:    "decode",
+			args:    []string{"decode", "viewer", "-c", "cluster1"},
+			objects: []client.Object{newTestMSA("cluster1", true), newTestSecret("cluster1")},
+			expectedOutput: []string{
+				"Service Account:          open-cluster-management-agent-addon/viewer",
+				"Token ID:                 token-1",
+				"Expires:                  2100-01-01T00:00:00Z",
+				"Matches Service Account:  true",
+			},
+		},
+		{
+			name:        "wait with an invalid condition",
+			args:        []string{"wait", "viewer", "-c", "cluster1", "--for", "delete"},
+			expectedErr: `invalid --for "delete"`,
+		},
+		{
+			name:           "wait for ready",
+			args:           []string{"wait", "viewer", "-c", "cluster1", "--for", "ready", "--timeout", "1s"},
+			objects:        []client.Object{newTestMSA("cluster1", true)},
+			expectedOutput: []string{"cluster1/viewer condition met"},
+		},
+		{
+			name:        "wait timeout",
+			args:        []string{"wait", "viewer", "-c", "cluster1", "--timeout", "100ms", "--interval", "10ms"},
+			objects:     []client.Object{newTestMSA("cluster1", false)},
+			expectedErr: "managedserviceaccount cluster1/viewer is not ready",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			objects := append(c.objects,
+				newTestCluster("cluster1", "prod"),
+				newTestCluster("cluster2", "prod"),
+				newTestCluster("cluster3", "dev"),
+			)
+			hubClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+
+			o := NewOptions()
+			o.Client = hubClient
+			cmd := newCommand(o)
+			cmd.SilenceErrors = true
+			out := &bytes.Buffer{}
+			cmd.SetOut(out)
+			cmd.SetArgs(c.args)
+			err := cmd.Execute()
+			if len(c.expectedErr) > 0 {
+				assert.ErrorContains(t, err, c.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			for _, expected := range c.expectedOutput {
+				assert.Contains(t, out.String(), expected)
+			}
+			if c.validateFunc != nil {
+				c.validateFunc(t, hubClient)
+			}
+		})
+	}
+}
+
+func TestMergeKubeconfig(t *testing.T) {
+	existing, err := clientcmd.Load([]byte(`
+apiVersion: v1
+kind: Config
+clusters:
+- name: hub
+  cluster:
+    server: https://hub:6443
+contexts:
+- name: hub
+  context:
+    cluster: hub
+    user: admin
+current-context: hub
+users:
+- name: admin
+  user:
+    token: admin-token
+`))
+	assert.NoError(t, err)
+
+	config, err := clientcmd.Load([]byte(`
+apiVersion: v1
+kind: Config
+clusters:
+- name: cluster1
+  cluster:
+    server: https://cluster1:6443
+contexts:
+- name: cluster1-viewer
+  context:
+    cluster: cluster1
+    user: cluster1-viewer
+current-context: cluster1-viewer
+users:
+- name: cluster1-viewer
+  user:
+    token: viewer-token
+`))
+	assert.NoError(t, err)
+
+	mergeKubeconfig(existing, config)
+	assert.Equal(t, "hub", existing.CurrentContext)
+	assert.Len(t, existing.Contexts, 2)
+	assert.Equal(t, "https://cluster1:6443", existing.Clusters["cluster1"].Server)
+	assert.Equal(t, "viewer-token", existing.AuthInfos["cluster1-viewer"].Token)
+}
+
+func TestMatchesServiceAccount(t *testing.T) {
+	claims, err := decodeClaims(testToken)
+	assert.NoError(t, err)
+
+	cases := []struct {
+		name     string
+		msa      *authv1beta1.ManagedServiceAccount
+		expected bool
+	}{
+		{
+			name:     "named after the managed serviceaccount",
+			msa:      newTestMSA("cluster1", true),
+			expected: true,
+		},
+		{
+			name: "other service account",
+			msa: newTestMSA("cluster1", true, func(msa *authv1beta1.ManagedServiceAccount) {
+				msa.Spec.ServiceAccount = &authv1beta1.SpokeServiceAccount{Namespace: "team-a", Name: "viewer"}
+			}),
+		},
+		{
+			name: "recreated service account",
+			msa: newTestMSA("cluster1", true, func(msa *authv1beta1.ManagedServiceAccount) {
+				msa.Status.ServiceAccountUID = "other-uid"
+			}),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.expected, matchesServiceAccount(claims, c.msa))
+		})
+	}
+}
+
+func getMSA(t *testing.T, c client.Client, namespace, name string) *authv1beta1.ManagedServiceAccount {
+	msa := &authv1beta1.ManagedServiceAccount{}
+	err := c.Get(context.TODO(), types.NamespacedName{Namespace: namespace, Name: name}, msa)
+	assert.NoError(t, err)
+	return msa
+}
+
+func newTestMSA(namespace string, ready bool,
+	modifiers ...func(*authv1beta1.ManagedServiceAccount)) *authv1beta1.ManagedServiceAccount {
+	status := metav1.ConditionFalse
+	if ready {
+		status = metav1.ConditionTrue
+	}
+	msa := &authv1beta1.ManagedServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "viewer"},
+		Status: authv1beta1.ManagedServiceAccountStatus{
+			Conditions: []metav1.Condition{{Type: authv1beta1.ConditionTypeReady, Status: status}},
+		},
+	}
+	if ready {
+		msa.Status.TokenSecretRef = &authv1beta1.SecretRef{Name: "viewer"}
+		msa.Status.ServiceAccountUID = "sa-uid"
+	}
+	for _, modifier := range modifiers {
+		modifier(msa)
+	}
+	return msa
+}
+
+func newTestSecret(namespace string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "viewer"},
+		Data: map[string][]byte{
+			corev1.ServiceAccountTokenKey:  []byte(testToken),
+			corev1.ServiceAccountRootCAKey: []byte("ca"),
+		},
+	}
+}
+
+func newTestCluster(name, env string) *clusterv1.ManagedCluster {
+	return &clusterv1.ManagedCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"env": env}},
+		Spec: clusterv1.ManagedClusterSpec{
+			ManagedClusterClientConfigs: []clusterv1.ClientConfig{{URL: "https://" + name + ":6443"}},
+		},
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+	"open-cluster-management.io/managed-serviceaccount/pkg/common"
+)
+
+// RotateOptions holds how the tokens are replaced.
+type RotateOptions struct {
+	*Options
+
+	// Revoke invalidates the outstanding tokens instead of only re-issuing the token.
+	Revoke bool
+}
+
+func newRotateCommand(parent *Options) *cobra.Command {
+	o := &RotateOptions{Options: parent}
+	cmd := &cobra.Command{
+		Use:   "rotate NAME",
+		Short: "Re-issue the token of the ManagedServiceAccount now",
+		Example: `  # Re-issue the token on cluster1, the previous token stays valid until it expires
+  kubectl msa rotate viewer -c cluster1
+
+  # Invalidate the outstanding tokens on all the production clusters
+  kubectl msa rotate viewer -l env=prod --revoke`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.Run(cmd, args[0])
+		},
+	}
+	o.AddClusterFlags(cmd.Flags())
+	cmd.Flags().BoolVar(&o.Revoke, "revoke", false,
+		"Revoke the outstanding tokens by increasing spec.revocationGeneration.")
+	return cmd
+}
+
+func (o *RotateOptions) Run(cmd *cobra.Command, name string) error {
+	clusters, err := o.clusterNames(cmd)
+	if err != nil {
+		return err
+	}
+	c, err := o.hubClient()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, cluster := range clusters {
+		msa := &authv1beta1.ManagedServiceAccount{}
+		if err := c.Get(cmd.Context(), types.NamespacedName{Namespace: cluster, Name: name}, msa); err != nil {
+			return errors.Wrapf(err, "failed to get managed serviceaccount %s/%s", cluster, name)
+		}
+		patch := client.MergeFrom(msa.DeepCopy())
+		requestRotation(msa, o.Revoke, now)
+		if err := c.Patch(cmd.Context(), msa, patch); err != nil {
+			return errors.Wrapf(err, "failed to rotate managed serviceaccount %s/%s", cluster, name)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "managedserviceaccount %s/%s rotated\n", cluster, name)
+	}
+	return nil
+}
+
+// requestRotation requests the agent to re-issue the token issued before now, or to revoke the
+// outstanding tokens.
+func requestRotation(msa *authv1beta1.ManagedServiceAccount, revoke bool, now time.Time) {
+	if revoke {
+		generation := msa.Spec.RevocationGeneration
+		if last := msa.Status.LastRevocation; last != nil && last.Generation > generation {
+			generation = last.Generation
+		}
+		msa.Spec.RevocationGeneration = generation + 1
+		return
+	}
+	if msa.Annotations == nil {
+		msa.Annotations = map[string]string{}
+	}
+	// the refresh timestamp is in seconds, round up so that a token issued in this second is re-issued
+	reissueAfter := now.Truncate(time.Second).Add(time.Second)
+	msa.Annotations[common.AnnotationKeyReissueAfter] = reissueAfter.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+)
+
+func newStatusCommand(parent *Options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "status [NAME]",
+		Short: "Show the tokens of the ManagedServiceAccounts across the managed clusters",
+		Example: `  # Show all the ManagedServiceAccounts of the fleet
+  kubectl msa status
+
+  # Show the ManagedServiceAccount viewer on the production clusters
+  kubectl msa status viewer -l env=prod`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := ""
+			if len(args) > 0 {
+				name = args[0]
+			}
+			return runStatus(cmd, parent, name)
+		},
+	}
+	parent.AddClusterFlags(cmd.Flags())
+	return cmd
+}
+
+func runStatus(cmd *cobra.Command, o *Options, name string) error {
+	c, err := o.hubClient()
+	if err != nil {
+		return err
+	}
+	var clusters sets.Set[string]
+	if len(o.Clusters) > 0 || len(o.Selector) > 0 {
+		names, err := o.clusterNames(cmd)
+		if err != nil {
+			return err
+		}
+		clusters = sets.New(names...)
+	}
+
+	msas := &authv1beta1.ManagedServiceAccountList{}
+	if err := c.List(cmd.Context(), msas); err != nil {
+		return errors.Wrapf(err, "failed to list managed serviceaccounts")
+	}
+	var items []authv1beta1.ManagedServiceAccount
+	for _, msa := range msas.Items {
+		if len(name) > 0 && msa.Name != name {
+			continue
+		}
+		if clusters != nil && !clusters.Has(msa.Namespace) {
+			continue
+		}
+		items = append(items, msa)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Namespace != items[j].Namespace {
+			return items[i].Namespace < items[j].Namespace
+		}
+		return items[i].Name < items[j].Name
+	})
+	return printStatus(cmd.OutOrStdout(), items, time.Now())
+}
+
+// printStatus prints a row of the expiry and the conditions per ManagedServiceAccount.
+func printStatus(out io.Writer, msas []authv1beta1.ManagedServiceAccount, now time.Time) error {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "CLUSTER\tNAME\tREADY\tEXPIRES\tNEXT ROTATION\tROTATIONS\tMESSAGE")
+	for _, msa := range msas {
+		ready, message := "Unknown", ""
+		if cond := meta.FindStatusCondition(msa.Status.Conditions, authv1beta1.ConditionTypeReady); cond != nil {
+			ready = string(cond.Status)
+			if cond.Status != metav1.ConditionTrue {
+				message = cond.Message
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n", msa.Namespace, msa.Name, ready,
+			timeUntil(msa.Status.ExpirationTimestamp, now, "expired"),
+			timeUntil(msa.Status.NextRotationTimestamp, now, "due"),
+			msa.Status.RotationCount, message)
+	}
+	return w.Flush()
+}
+
+// timeUntil prints the time left until t in the largest unit, or past if t is not in the future.
+func timeUntil(t *metav1.Time, now time.Time, past string) string {
+	if t == nil || t.IsZero() {
+		return "<none>"
+	}
+	d := t.Sub(now)
+	switch {
+	case d <= 0:
+		return past
+	case d >= 48*time.Hour:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	case d >= 2*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	case d >= 2*time.Minute:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	default:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+}
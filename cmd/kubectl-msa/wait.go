@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+)
+
+// WaitOptions holds the condition to wait for.
+type WaitOptions struct {
+	*Options
+
+	// For is "ready" or "condition=<type>".
+	For      string
+	Timeout  time.Duration
+	Interval time.Duration
+}
+
+func newWaitCommand(parent *Options) *cobra.Command {
+	o := &WaitOptions{Options: parent}
+	cmd := &cobra.Command{
+		Use:   "wait NAME",
+		Short: "Wait for the ManagedServiceAccount to be ready on the managed clusters",
+		Example: `  # Wait for the tokens of cluster1 and cluster2 to be reported
+  kubectl msa wait viewer -c cluster1,cluster2 --for=ready --timeout=5m
+
+  # Wait for the permissions to be applied on the production clusters
+  kubectl msa wait viewer -l env=prod --for=condition=PermissionsApplied`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.Run(cmd, args[0])
+		},
+	}
+	o.AddClusterFlags(cmd.Flags())
+	cmd.Flags().StringVar(&o.For, "for", "ready", "The condition to wait for, either \"ready\" or \"condition=<type>\".")
+	cmd.Flags().DurationVar(&o.Timeout, "timeout", 5*time.Minute, "How long to wait before giving up.")
+	cmd.Flags().DurationVar(&o.Interval, "interval", 2*time.Second, "How often the ManagedServiceAccounts are checked.")
+	return cmd
+}
+
+func (o *WaitOptions) Run(cmd *cobra.Command, name string) error {
+	conditionType, err := conditionTypeOf(o.For)
+	if err != nil {
+		return err
+	}
+	clusters, err := o.clusterNames(cmd)
+	if err != nil {
+		return err
+	}
+	c, err := o.hubClient()
+	if err != nil {
+		return err
+	}
+
+	for _, cluster := range clusters {
+		key := types.NamespacedName{Namespace: cluster, Name: name}
+		err := wait.PollUntilContextTimeout(cmd.Context(), o.Interval, o.Timeout, true,
+			func(ctx context.Context) (bool, error) {
+				msa := &authv1beta1.ManagedServiceAccount{}
+				if err := c.Get(ctx, key, msa); err != nil {
+					if apierrors.IsNotFound(err) {
+						return false, nil
+					}
+					return false, errors.Wrapf(err, "failed to get managed serviceaccount %s", key)
+				}
+				return isConditionMet(msa, conditionType), nil
+			})
+		if err != nil {
+			return errors.Wrapf(err, "managedserviceaccount %s is not %s", key, o.For)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "managedserviceaccount %s condition met\n", key)
+	}
+	return nil
+}
+
+// conditionTypeOf returns the condition type of the --for flag.
+func conditionTypeOf(waitFor string) (string, error) {
+	if strings.EqualFold(waitFor, "ready") {
+		return authv1beta1.ConditionTypeReady, nil
+	}
+	if conditionType, ok := strings.CutPrefix(waitFor, "condition="); ok && len(conditionType) > 0 {
+		return conditionType, nil
+	}
+	return "", fmt.Errorf("invalid --for %q, it should be \"ready\" or \"condition=<type>\"", waitFor)
+}
+
+// isConditionMet checks whether the condition is true for the current generation of the
+// ManagedServiceAccount.
+func isConditionMet(msa *authv1beta1.ManagedServiceAccount, conditionType string) bool {
+	if msa.Status.ObservedGeneration > 0 && msa.Status.ObservedGeneration < msa.Generation {
+		return false
+	}
+	return meta.IsStatusConditionTrue(msa.Status.Conditions, conditionType)
+}
@@ -11,6 +11,7 @@ import (
 
 	"open-cluster-management.io/managed-serviceaccount/cmd/agent"
 	hub "open-cluster-management.io/managed-serviceaccount/cmd/manager"
+	"open-cluster-management.io/managed-serviceaccount/cmd/proxy"
 )
 
 func main() {
@@ -35,7 +36,9 @@ func newCommand() *cobra.Command {
 	}
 
 	cmd.AddCommand(hub.NewManager())
+	cmd.AddCommand(hub.NewMigrateStorage())
 	cmd.AddCommand(agent.NewAgent())
+	cmd.AddCommand(proxy.NewProxy())
 
 	return cmd
 }
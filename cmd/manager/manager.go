@@ -28,9 +28,11 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
@@ -39,16 +41,23 @@ import (
 	"k8s.io/klog/v2"
 	cpv1alpha1 "sigs.k8s.io/cluster-inventory-api/apis/v1alpha1"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	ctrlwebhook "sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	"open-cluster-management.io/addon-framework/pkg/addonfactory"
 	"open-cluster-management.io/addon-framework/pkg/addonmanager"
 	"open-cluster-management.io/addon-framework/pkg/utils"
+	addonv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
 	addonclient "open-cluster-management.io/api/client/addon/clientset/versioned"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	clusterv1beta1 "open-cluster-management.io/api/cluster/v1beta1"
+	authv1alpha1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1alpha1"
 	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
 	"open-cluster-management.io/managed-serviceaccount/pkg/addon/commoncontroller"
 	"open-cluster-management.io/managed-serviceaccount/pkg/addon/manager"
 	"open-cluster-management.io/managed-serviceaccount/pkg/addon/manager/controller"
+	"open-cluster-management.io/managed-serviceaccount/pkg/addon/manager/webhook"
 	"open-cluster-management.io/managed-serviceaccount/pkg/common"
 	"open-cluster-management.io/managed-serviceaccount/pkg/features"
 	"open-cluster-management.io/managed-serviceaccount/pkg/util"
@@ -62,8 +71,13 @@ var (
 
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(apiextensionsv1.AddToScheme(scheme))
+	utilruntime.Must(authv1alpha1.AddToScheme(scheme))
 	utilruntime.Must(authv1beta1.AddToScheme(scheme))
 	utilruntime.Must(cpv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(clusterv1.AddToScheme(scheme))
+	utilruntime.Must(clusterv1beta1.Install(scheme))
+	utilruntime.Must(addonv1alpha1.Install(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
@@ -96,7 +110,7 @@ func (o *HubManagerOptions) AddFlags(flags *pflag.FlagSet) {
 			"Enabling this will ensure there is only one active controller manager.")
 	flags.StringVar(&o.DeployMode, "deploy-mode", "Deployment",
 		"Deployment mode for the manager. Valid values: 'Deployment' (default - runs addon manager and optional controllers), "+
-			"'AddOnTemplate' (runs only ClusterProfileCredSyncer controller without addon manager).")
+			"'AddOnTemplate' (runs only the optional controllers and the webhooks without addon manager).")
 	flags.Var(
 		cliflag.NewMapStringBool(&o.FeatureGatesFlags),
 		"feature-gates",
@@ -106,6 +120,14 @@ func (o *HubManagerOptions) AddFlags(flags *pflag.FlagSet) {
 		"The image pull secret that addon agent will use. "+
 			"When specified, the content of image pull secret in the manager namespace on hub will be copied to the agent namespace on the managed cluster."+
 			"This can also be configured with environment variable AGENT_IMAGE_PULL_SECRET.")
+	flags.BoolVar(&o.EnableWebhook, "enable-webhook", false,
+		"Serve the defaulting, validating and conversion webhooks of ManagedServiceAccount, "+
+			"and point the conversion of the ManagedServiceAccount CRD to the webhook.")
+	flags.IntVar(&o.WebhookPort, "webhook-port", 9443, "The port the webhook server binds to.")
+	flags.StringVar(&o.WebhookCertDir, "webhook-cert-dir", "/tmp/k8s-webhook-server/serving-certs",
+		"The directory containing the serving certificate (tls.crt, tls.key) and the CA bundle (ca.crt) of the webhook server.")
+	flags.StringVar(&o.WebhookServiceName, "webhook-service-name", "managed-serviceaccount-webhook",
+		"The name of the service in front of the webhook server, in the namespace of the manager.")
 }
 
 // HubManagerOptions holds configuration for hub manager controller
@@ -117,6 +139,10 @@ type HubManagerOptions struct {
 	ImagePullSecretName  string
 	DeployMode           string
 	FeatureGatesFlags    map[string]bool
+	EnableWebhook        bool
+	WebhookPort          int
+	WebhookCertDir       string
+	WebhookServiceName   string
 }
 
 // NewHubManagerOptions returns a HubManagerOptions
@@ -136,13 +162,20 @@ func (o *HubManagerOptions) Run() error {
 		os.Exit(1)
 	}
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	mgrOpts := ctrl.Options{
 		Scheme:                 scheme,
 		Metrics:                metricsserver.Options{BindAddress: o.MetricsAddr},
 		HealthProbeBindAddress: o.ProbeAddr,
 		LeaderElection:         o.EnableLeaderElection,
 		LeaderElectionID:       "managed-serviceaccount-addon-manager",
-	})
+	}
+	if o.EnableWebhook {
+		mgrOpts.WebhookServer = ctrlwebhook.NewServer(ctrlwebhook.Options{
+			Port:    o.WebhookPort,
+			CertDir: o.WebhookCertDir,
+		})
+	}
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), mgrOpts)
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
@@ -158,9 +191,25 @@ func (o *HubManagerOptions) Run() error {
 		os.Exit(1)
 	}
 
+	hubNamespace := os.Getenv("NAMESPACE")
+	if len(hubNamespace) == 0 {
+		inClusterNamespace, err := util.GetInClusterNamespace()
+		if err != nil {
+			setupLog.Error(err, "the manager should be either running in a container or specify NAMESPACE environment")
+		}
+		hubNamespace = inClusterNamespace
+	}
+
+	if o.EnableWebhook {
+		if err := o.setupWebhook(mgr, hubNamespace); err != nil {
+			setupLog.Error(err, "unable to set up webhook")
+			os.Exit(1)
+		}
+	}
+
 	// Setup controllers based on deploy mode:
 	// - Deployment mode (deploy-mode=Deployment): Setup addon manager + optional controllers
-	// - AddOnTemplate mode (deploy-mode=AddOnTemplate): Setup only ClusterProfileCredSyncer controller if feature gate enabled
+	// - AddOnTemplate mode (deploy-mode=AddOnTemplate): Setup only the optional controllers enabled by the feature gates
 	var addonManager addonmanager.AddonManager
 	if o.DeployMode != "AddOnTemplate" {
 		addonManager, err = addonmanager.New(mgr.GetConfig())
@@ -181,15 +230,6 @@ func (o *HubManagerOptions) Run() error {
 			os.Exit(1)
 		}
 
-		hubNamespace := os.Getenv("NAMESPACE")
-		if len(hubNamespace) == 0 {
-			inClusterNamespace, err := util.GetInClusterNamespace()
-			if err != nil {
-				setupLog.Error(err, "the manager should be either running in a container or specify NAMESPACE environment")
-			}
-			hubNamespace = inClusterNamespace
-		}
-
 		if len(o.ImagePullSecretName) == 0 {
 			o.ImagePullSecretName = os.Getenv("AGENT_IMAGE_PULL_SECRET")
 		}
@@ -243,6 +283,7 @@ func (o *HubManagerOptions) Run() error {
 			if err := (commoncontroller.NewEphemeralIdentityReconciler(
 				mgr.GetCache(),
 				mgr.GetClient(),
+				mgr.GetEventRecorder("managed-serviceaccount-addon-manager"),
 			)).SetupWithManager(mgr); err != nil {
 				setupLog.Error(err, "unable to register EphemeralIdentityReconciler")
 				os.Exit(1)
@@ -255,12 +296,45 @@ func (o *HubManagerOptions) Run() error {
 		if err := (controller.NewClusterProfileCredSyncer(
 			mgr.GetCache(),
 			mgr.GetClient(),
+			mgr.GetEventRecorder("managed-serviceaccount-addon-manager"),
 		)).SetupWithManager(mgr); err != nil {
 			setupLog.Error(err, "unable to register ClusterProfileCredSyncer")
 			os.Exit(1)
 		}
 	}
 
+	if features.FeatureGates.Enabled(features.CredentialRevocation) {
+		if err := (controller.NewCredentialRevocationReconciler(
+			mgr.GetCache(),
+			mgr.GetClient(),
+		)).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to register CredentialRevocationReconciler")
+			os.Exit(1)
+		}
+	}
+
+	if features.FeatureGates.Enabled(features.ManagedServiceAccountSet) {
+		if err := (controller.NewManagedServiceAccountSetReconciler(
+			mgr.GetCache(),
+			mgr.GetClient(),
+		)).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to register ManagedServiceAccountSetReconciler")
+			os.Exit(1)
+		}
+	}
+
+	// the ManagedServiceAccounts are provisioned once the addon is available, whether it is
+	// registered above or by the AddOnTemplate
+	if features.FeatureGates.Enabled(features.ClusterManagedServiceAccountTemplate) {
+		if err := (controller.NewClusterManagedServiceAccountTemplateReconciler(
+			mgr.GetCache(),
+			mgr.GetClient(),
+		)).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to register ClusterManagedServiceAccountTemplateReconciler")
+			os.Exit(1)
+		}
+	}
+
 	setupLog.Info("starting manager")
 
 	ctx, cancel := context.WithCancel(ctrl.SetupSignalHandler())
@@ -280,3 +354,25 @@ func (o *HubManagerOptions) Run() error {
 	}
 	return nil
 }
+
+// setupWebhook registers the webhooks to the manager, and points the conversion of the
+// ManagedServiceAccount CRD to the webhook service.
+func (o *HubManagerOptions) setupWebhook(mgr ctrl.Manager, hubNamespace string) error {
+	if err := webhook.SetupWithManager(mgr); err != nil {
+		return err
+	}
+
+	caBundle, err := webhook.LoadCABundle(o.WebhookCertDir)
+	if err != nil {
+		return err
+	}
+	// the cache of the manager is not started yet
+	hubClient, err := client.New(mgr.GetConfig(), client.Options{Scheme: mgr.GetScheme()})
+	if err != nil {
+		return errors.Wrapf(err, "failed to create hub client")
+	}
+	return webhook.EnsureCRDConversion(context.TODO(), hubClient, types.NamespacedName{
+		Namespace: hubNamespace,
+		Name:      o.WebhookServiceName,
+	}, caBundle)
+}
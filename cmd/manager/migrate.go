@@ -0,0 +1,30 @@
+package manager
+
+import (
+	"context"
+
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"open-cluster-management.io/managed-serviceaccount/pkg/addon/manager/migration"
+)
+
+// NewMigrateStorage returns the command rewriting the stored ManagedServiceAccounts in the storage
+// version, run it before removing a version from the ManagedServiceAccount CRD.
+func NewMigrateStorage() *cobra.Command {
+	return &cobra.Command{
+		Use:   "migrate-storage",
+		Short: "Migrate the stored managed service accounts to the storage version",
+		Run: func(cmd *cobra.Command, args []string) {
+			hubClient, err := client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: scheme})
+			if err != nil {
+				klog.Fatal(err)
+			}
+			if err := migration.MigrateStorageVersion(context.TODO(), hubClient); err != nil {
+				klog.Fatal(err)
+			}
+		},
+	}
+}
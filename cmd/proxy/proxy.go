@@ -0,0 +1,155 @@
+package proxy
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/klog/v2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+	"open-cluster-management.io/managed-serviceaccount/pkg/common"
+	"open-cluster-management.io/managed-serviceaccount/pkg/envelope"
+	"open-cluster-management.io/managed-serviceaccount/pkg/proxy"
+)
+
+var (
+	scheme = runtime.NewScheme()
+)
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(authv1beta1.AddToScheme(scheme))
+	utilruntime.Must(clusterv1.AddToScheme(scheme))
+}
+
+func NewProxy() *cobra.Command {
+	proxyOpts := NewProxyOptions()
+
+	cmd := &cobra.Command{
+		Use:   "proxy",
+		Short: "Start the proxy forwarding the requests of the hub callers to the managed clusters with the managed service account tokens",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := proxyOpts.Run(); err != nil {
+				klog.Fatal(err)
+			}
+		},
+	}
+
+	flags := cmd.Flags()
+	proxyOpts.AddFlags(flags)
+
+	return cmd
+}
+
+func (o *ProxyOptions) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&o.MetricsAddr, "metrics-bind-address", ":38080", "The address the metric endpoint binds to.")
+	flags.StringVar(&o.ProbeAddr, "health-probe-bind-address", ":38081", "The address the probe endpoint binds to.")
+	flags.StringVar(&o.BindAddress, "bind-address", ":8443", "The address the proxy binds to.")
+	flags.StringVar(&o.TLSCertFile, "tls-cert-file", "", "The serving certificate of the proxy.")
+	flags.StringVar(&o.TLSKeyFile, "tls-private-key-file", "", "The private key of the serving certificate of the proxy.")
+	flags.StringVar(&o.KMSEndpoint, "kms-endpoint", "", "The endpoint of the KMS v2 plugin decrypting the token "+
+		"secrets of the envelope encryption, e.g. unix:///var/run/kmsplugin/socket.sock.")
+	flags.DurationVar(&o.KMSTimeout, "kms-timeout", envelope.DefaultKMSTimeout, "The timeout of the calls to the KMS plugin.")
+}
+
+// ProxyOptions holds configuration for the proxy
+type ProxyOptions struct {
+	MetricsAddr string
+	ProbeAddr   string
+	BindAddress string
+	TLSCertFile string
+	TLSKeyFile  string
+	KMSEndpoint string
+	KMSTimeout  time.Duration
+}
+
+// NewProxyOptions returns a ProxyOptions
+func NewProxyOptions() *ProxyOptions {
+	return &ProxyOptions{}
+}
+
+func (o *ProxyOptions) Run() error {
+	logger := klog.Background()
+	klog.SetOutput(os.Stdout)
+	klog.InitFlags(flag.CommandLine)
+	ctrl.SetLogger(logger)
+
+	if len(o.TLSCertFile) == 0 || len(o.TLSKeyFile) == 0 {
+		// the bearer tokens of the callers are never accepted in plain text
+		return errors.New("missing --tls-cert-file or --tls-private-key-file")
+	}
+
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+		Scheme:                 scheme,
+		Metrics:                metricsserver.Options{BindAddress: o.MetricsAddr},
+		HealthProbeBindAddress: o.ProbeAddr,
+		Cache: cache.Options{
+			ByObject: map[client.Object]cache.ByObject{
+				// Only watch the token secrets, the rotated tokens are picked up from the cache.
+				&corev1.Secret{}: {
+					Label: labels.SelectorFromSet(labels.Set{common.LabelKeyIsManagedServiceAccount: "true"}),
+				},
+			},
+		},
+	})
+	if err != nil {
+		return errors.Wrapf(err, "unable to start manager")
+	}
+
+	hubNativeClient, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return errors.Wrapf(err, "unable to instantiate a kubernetes native client")
+	}
+
+	handler := proxy.NewHandler(mgr.GetClient(), hubNativeClient)
+	if len(o.KMSEndpoint) > 0 {
+		handler.Envelope, err = envelope.Dial(o.KMSEndpoint, o.KMSTimeout)
+		if err != nil {
+			return errors.Wrapf(err, "unable to connect to the KMS plugin")
+		}
+	}
+
+	server := &http.Server{
+		Addr:              o.BindAddress,
+		Handler:           handler,
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+	if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		go func() {
+			<-ctx.Done()
+			_ = server.Shutdown(context.Background())
+		}()
+		klog.Infof("Serving the proxy on %s", o.BindAddress)
+		if err := server.ListenAndServeTLS(o.TLSCertFile, o.TLSKeyFile); err != nil && err != http.ErrServerClosed {
+			return err
+		}
+		return nil
+	})); err != nil {
+		return errors.Wrapf(err, "unable to add the proxy server")
+	}
+
+	if err := mgr.AddHealthzCheck("healthz-ping", healthz.Ping); err != nil {
+		return errors.Wrapf(err, "unable to add health check")
+	}
+
+	return mgr.Start(ctrl.SetupSignalHandler())
+}
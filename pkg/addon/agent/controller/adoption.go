@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+	"open-cluster-management.io/managed-serviceaccount/pkg/common"
+)
+
+func isAdoptionMode(managed *authv1beta1.ManagedServiceAccount) bool {
+	return managed.Spec.ServiceAccount != nil &&
+		managed.Spec.ServiceAccount.Mode == authv1beta1.ServiceAccountModeAdopt
+}
+
+// adoptServiceAccount marks the existing ServiceAccount as adopted by the ManagedServiceAccount,
+// after checking the adoption is permitted by the allowlist on the managed cluster.
+func (r *TokenReconciler) adoptServiceAccount(ctx context.Context, managed *authv1beta1.ManagedServiceAccount) error {
+	saNamespace, saName := r.serviceAccountOf(managed)
+	saclient := r.SpokeNativeClient.CoreV1().ServiceAccounts(saNamespace)
+	sa, err := saclient.Get(ctx, saName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return fmt.Errorf("service account %s/%s to adopt is not found", saNamespace, saName)
+		}
+		return errors.Wrapf(err, "failed to get service account")
+	}
+
+	// check the allowlist every time, so that revoking the permission stops issuing tokens
+	allowed, err := r.isAllowlisted(ctx, common.AdoptionAllowlistConfigMapName, common.AdoptionAllowlistKey,
+		saNamespace, saName)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return fmt.Errorf("adoption of service account %s/%s is not permitted by the allowlist configmap %s/%s",
+			saNamespace, saName, r.SpokeNamespace, common.AdoptionAllowlistConfigMapName)
+	}
+
+	adoptedBy := managed.Namespace + "/" + managed.Name
+	if isServiceAccountOwnedBy(sa, managed.Namespace, managed.Name) &&
+		sa.Annotations[common.AnnotationKeyAdoptedBy] == adoptedBy {
+		return nil
+	}
+	if sa.Labels[common.LabelKeyIsManagedServiceAccount] == "true" {
+		return fmt.Errorf("service account %s/%s is already managed by another ManagedServiceAccount",
+			saNamespace, saName)
+	}
+
+	adopted := sa.DeepCopy()
+	adopted.Labels = mergeLabels(adopted.Labels, ownerLabels(managed.Namespace, managed.Name))
+	adopted.Annotations = mergeLabels(adopted.Annotations, ownerAnnotations(managed.Name))
+	adopted.Annotations[common.AnnotationKeyAdoptedBy] = adoptedBy
+	if _, err := saclient.Update(ctx, adopted, metav1.UpdateOptions{}); err != nil {
+		return errors.Wrapf(err, "failed to adopt service account")
+	}
+	return nil
+}
+
+// releaseServiceAccount removes the marks of the adoption from the ServiceAccount, the ServiceAccount
+// itself is left intact.
+func (r *TokenReconciler) releaseServiceAccount(ctx context.Context, sa *corev1.ServiceAccount) error {
+	released := sa.DeepCopy()
+	delete(released.Labels, common.LabelKeyIsManagedServiceAccount)
+	delete(released.Labels, common.LabelKeyManagedServiceAccountNamespace)
+	delete(released.Labels, common.LabelKeyManagedServiceAccountName)
+	delete(released.Annotations, common.AnnotationKeyManagedServiceAccountName)
+	delete(released.Annotations, common.AnnotationKeyAdoptedBy)
+	if _, err := r.SpokeNativeClient.CoreV1().ServiceAccounts(sa.Namespace).
+		Update(ctx, released, metav1.UpdateOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "fail to release adopted serviceaccount")
+	}
+	return nil
+}
+
+// isAllowlisted checks whether the ServiceAccount matches any pattern in the key of the allowlist
+// ConfigMap in the agent namespace, e.g. the adoption allowlist. Nothing is allowed if the ConfigMap
+// does not exist.
+func (r *TokenReconciler) isAllowlisted(ctx context.Context, configMapName, key, saNamespace, saName string) (bool, error) {
+	allowlist, err := r.getAllowlist(ctx, configMapName)
+	if err != nil {
+		return false, err
+	}
+	return matchAllowlist(allowlist[key], saNamespace+"/"+saName), nil
+}
+
+// getAllowlist returns the data of the allowlist ConfigMap in the agent namespace, or nil if the
+// ConfigMap does not exist.
+func (r *TokenReconciler) getAllowlist(ctx context.Context, configMapName string) (map[string]string, error) {
+	cm, err := r.SpokeNativeClient.CoreV1().ConfigMaps(r.SpokeNamespace).Get(ctx, configMapName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "failed to get the allowlist configmap %s", configMapName)
+	}
+	return cm.Data, nil
+}
+
+// matchAllowlist matches the value, e.g. the "<namespace>/<name>" of a ServiceAccount, against the
+// allowlist, one shell pattern per line. Empty lines and lines starting with "#" are ignored.
+func matchAllowlist(allowlist, value string) bool {
+	for _, line := range strings.Split(allowlist, "\n") {
+		pattern := strings.TrimSpace(line)
+		if len(pattern) == 0 || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		if matched, err := path.Match(pattern, value); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchAllowlist(t *testing.T) {
+	cases := []struct {
+		name           string
+		allowlist      string
+		serviceAccount string
+		expected       bool
+	}{
+		{
+			name:           "empty allowlist",
+			serviceAccount: "ns1/sa1",
+		},
+		{
+			name:           "exact match",
+			allowlist:      "ns1/sa1",
+			serviceAccount: "ns1/sa1",
+			expected:       true,
+		},
+		{
+			name:           "wildcard in namespace",
+			allowlist:      "ns2/sa1\n  ns1/*  \n",
+			serviceAccount: "ns1/sa2",
+			expected:       true,
+		},
+		{
+			name:           "wildcard does not cross namespaces",
+			allowlist:      "ns*",
+			serviceAccount: "ns1/sa1",
+		},
+		{
+			name:           "comments are ignored",
+			allowlist:      "# ns1/sa1",
+			serviceAccount: "ns1/sa1",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.expected, matchAllowlist(c.allowlist, c.serviceAccount))
+		})
+	}
+}
@@ -0,0 +1,304 @@
+package controller
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/authentication/serviceaccount"
+	certutil "k8s.io/client-go/util/cert"
+	"k8s.io/client-go/util/keyutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+)
+
+const (
+	// minCertificateExpirationSeconds is the shortest expiration accepted by the
+	// CertificateSigningRequest API.
+	minCertificateExpirationSeconds = 600
+	// certificateIssueTimeout is how long the agent waits for the signer to issue the certificate
+	// of an approved CertificateSigningRequest before it requests another one.
+	certificateIssueTimeout = 5 * time.Minute
+	// certificateIssueInterval is the interval to check whether the certificate is issued.
+	certificateIssueInterval = 2 * time.Second
+)
+
+// errCertificatePending is returned while the approved CertificateSigningRequest waits for the
+// signer, the ManagedServiceAccount is requeued to collect the certificate.
+var errCertificatePending = errors.New("the client certificate is not issued yet")
+
+// pendingCertificate is an approved CertificateSigningRequest waiting for the signer. The private key
+// is only kept in memory, a request pending when the agent restarts is abandoned and garbage-collected
+// by the kube-controller-manager.
+type pendingCertificate struct {
+	csrName string
+	keyData []byte
+	created time.Time
+}
+
+// pendingCertificates tracks the pending certificates of the ManagedServiceAccounts.
+type pendingCertificates struct {
+	lock     sync.Mutex
+	requests map[types.NamespacedName]pendingCertificate
+}
+
+func (p *pendingCertificates) get(key types.NamespacedName) (pendingCertificate, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	pending, ok := p.requests[key]
+	return pending, ok
+}
+
+func (p *pendingCertificates) set(key types.NamespacedName, pending pendingCertificate) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.requests == nil {
+		p.requests = map[types.NamespacedName]pendingCertificate{}
+	}
+	p.requests[key] = pending
+}
+
+func (p *pendingCertificates) delete(key types.NamespacedName) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	delete(p.requests, key)
+}
+
+// allowedCertificateUsages are the key usages approved for the client certificates.
+var allowedCertificateUsages = []certificatesv1.KeyUsage{
+	certificatesv1.UsageDigitalSignature,
+	certificatesv1.UsageKeyEncipherment,
+	certificatesv1.UsageClientAuth,
+}
+
+// isClientCertificate checks whether an X.509 client certificate is issued for the ManagedServiceAccount
+// instead of a token.
+func isClientCertificate(managed *authv1beta1.ManagedServiceAccount) bool {
+	return managed.Spec.CredentialType == authv1beta1.CredentialTypeClientCertificate
+}
+
+// certificateSubject returns the subject of the client certificate authenticated as the ServiceAccount,
+// so that the RBAC bound to the ServiceAccount applies to the certificate as well.
+func certificateSubject(saNamespace, saName string) pkix.Name {
+	return pkix.Name{
+		CommonName:   serviceaccount.MakeUsername(saNamespace, saName),
+		Organization: serviceaccount.MakeGroupNames(saNamespace),
+	}
+}
+
+// issueCertificate issues a client certificate for the ServiceAccount by a CertificateSigningRequest of
+// the kube-apiserver-client signer, which is approved by the agent itself. The request is created and
+// approved on the first call, which returns errCertificatePending, and the certificate is collected
+// once the signer issues it. It returns the PEM encoded certificate and private key, and the expiration
+// time of the certificate.
+func (r *TokenReconciler) issueCertificate(ctx context.Context,
+	managed *authv1beta1.ManagedServiceAccount) ([]byte, []byte, metav1.Time, error) {
+	key := types.NamespacedName{Namespace: managed.Namespace, Name: managed.Name}
+	pending, ok := r.pendingCertificates.get(key)
+	if !ok {
+		pending, err := r.requestCertificate(ctx, managed)
+		if err != nil {
+			return nil, nil, metav1.Time{}, err
+		}
+		r.pendingCertificates.set(key, pending)
+		return nil, nil, metav1.Time{}, errCertificatePending
+	}
+
+	csrClient := r.SpokeNativeClient.CertificatesV1().CertificateSigningRequests()
+	issued, err := csrClient.Get(ctx, pending.csrName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		// the request is deleted by others, request another one
+		r.pendingCertificates.delete(key)
+		return r.issueCertificate(ctx, managed)
+	}
+	if err != nil {
+		return nil, nil, metav1.Time{}, errors.Wrapf(err, "failed to get certificate signing request %s", pending.csrName)
+	}
+
+	var failure error
+	for _, condition := range issued.Status.Conditions {
+		if condition.Type == certificatesv1.CertificateDenied || condition.Type == certificatesv1.CertificateFailed {
+			failure = fmt.Errorf("certificate signing request %s is %s: %s",
+				pending.csrName, condition.Type, condition.Message)
+		}
+	}
+	certData := issued.Status.Certificate
+	if failure == nil && len(certData) == 0 {
+		if time.Since(pending.created) < certificateIssueTimeout {
+			return nil, nil, metav1.Time{}, errCertificatePending
+		}
+		failure = fmt.Errorf("certificate signing request %s is not issued in %s", pending.csrName,
+			certificateIssueTimeout)
+	}
+
+	// the certificate is copied to the token secret, the request is useless afterwards
+	r.pendingCertificates.delete(key)
+	if err := csrClient.Delete(ctx, pending.csrName, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		log.FromContext(ctx).Error(err, "failed to delete certificate signing request", "name", pending.csrName)
+	}
+	if failure != nil {
+		return nil, nil, metav1.Time{}, failure
+	}
+
+	cert, err := parseClientCertificate(certData)
+	if err != nil {
+		return nil, nil, metav1.Time{}, err
+	}
+	saNamespace, saName := r.serviceAccountOf(managed)
+	if !isCertificateOf(cert, saNamespace, saName) {
+		return nil, nil, metav1.Time{}, fmt.Errorf("certificate of %s is not issued for service account %s/%s",
+			pending.csrName, saNamespace, saName)
+	}
+	return certData, pending.keyData, metav1.NewTime(cert.NotAfter), nil
+}
+
+// requestCertificate creates and approves a CertificateSigningRequest for the client certificate of
+// the ServiceAccount. A request left behind by a failure is garbage-collected by the
+// kube-controller-manager.
+func (r *TokenReconciler) requestCertificate(ctx context.Context,
+	managed *authv1beta1.ManagedServiceAccount) (pendingCertificate, error) {
+	saNamespace, saName := r.serviceAccountOf(managed)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return pendingCertificate{}, errors.Wrapf(err, "failed to generate private key")
+	}
+	keyData, err := keyutil.MarshalPrivateKeyToPEM(key)
+	if err != nil {
+		return pendingCertificate{}, errors.Wrapf(err, "failed to encode private key")
+	}
+	subject := certificateSubject(saNamespace, saName)
+	request, err := certutil.MakeCSR(key, &subject, nil, nil)
+	if err != nil {
+		return pendingCertificate{}, errors.Wrapf(err, "failed to build certificate request")
+	}
+
+	expirationSeconds := int32(max(managed.Spec.Rotation.Validity.Seconds(), minCertificateExpirationSeconds))
+	csr := &certificatesv1.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        fmt.Sprintf("%s-%s-%s", managed.Namespace, managed.Name, utilrand.String(5)),
+			Labels:      ownerLabels(managed.Namespace, managed.Name),
+			Annotations: ownerAnnotations(managed.Name),
+		},
+		Spec: certificatesv1.CertificateSigningRequestSpec{
+			Request:           request,
+			SignerName:        certificatesv1.KubeAPIServerClientSignerName,
+			ExpirationSeconds: &expirationSeconds,
+			Usages:            []certificatesv1.KeyUsage{certificatesv1.UsageDigitalSignature, certificatesv1.UsageClientAuth},
+		},
+	}
+	if err := isCertificateRequestAllowed(csr, saNamespace, saName); err != nil {
+		// never happens, the request is built by the agent
+		return pendingCertificate{}, err
+	}
+
+	csrClient := r.SpokeNativeClient.CertificatesV1().CertificateSigningRequests()
+	created, err := csrClient.Create(ctx, csr, metav1.CreateOptions{})
+	if err != nil {
+		return pendingCertificate{}, errors.Wrapf(err, "failed to create certificate signing request")
+	}
+	created.Status.Conditions = append(created.Status.Conditions, certificatesv1.CertificateSigningRequestCondition{
+		Type:    certificatesv1.CertificateApproved,
+		Status:  corev1.ConditionTrue,
+		Reason:  "ManagedServiceAccountApproved",
+		Message: fmt.Sprintf("Approved by the agent for ManagedServiceAccount %s/%s", managed.Namespace, managed.Name),
+	})
+	if _, err := csrClient.UpdateApproval(ctx, created.Name, created, metav1.UpdateOptions{}); err != nil {
+		return pendingCertificate{}, errors.Wrapf(err, "failed to approve certificate signing request %s", created.Name)
+	}
+	return pendingCertificate{csrName: created.Name, keyData: keyData, created: time.Now()}, nil
+}
+
+// isCertificateRequestAllowed checks the CertificateSigningRequest against the policy of the agent before
+// it is approved: only a client certificate of the ServiceAccount identity, without any subject
+// alternative names, is approved.
+func isCertificateRequestAllowed(csr *certificatesv1.CertificateSigningRequest, saNamespace, saName string) error {
+	if csr.Spec.SignerName != certificatesv1.KubeAPIServerClientSignerName {
+		return fmt.Errorf("unexpected signer %q", csr.Spec.SignerName)
+	}
+	if !slices.Contains(csr.Spec.Usages, certificatesv1.UsageClientAuth) {
+		return fmt.Errorf("missing usage %q", certificatesv1.UsageClientAuth)
+	}
+	for _, usage := range csr.Spec.Usages {
+		if !slices.Contains(allowedCertificateUsages, usage) {
+			return fmt.Errorf("unexpected usage %q", usage)
+		}
+	}
+
+	block, _ := pem.Decode(csr.Spec.Request)
+	if block == nil || block.Type != certutil.CertificateRequestBlockType {
+		return errors.New("invalid PEM encoded certificate request")
+	}
+	request, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse certificate request")
+	}
+	if err := request.CheckSignature(); err != nil {
+		return errors.Wrapf(err, "invalid signature of certificate request")
+	}
+	if len(request.DNSNames) > 0 || len(request.IPAddresses) > 0 || len(request.EmailAddresses) > 0 ||
+		len(request.URIs) > 0 {
+		return errors.New("subject alternative names are not allowed")
+	}
+	expected := certificateSubject(saNamespace, saName)
+	if request.Subject.CommonName != expected.CommonName ||
+		!sets.New(request.Subject.Organization...).Equal(sets.New(expected.Organization...)) {
+		return fmt.Errorf("subject %q is not the identity of service account %s/%s",
+			request.Subject.String(), saNamespace, saName)
+	}
+	return nil
+}
+
+// parseClientCertificate parses the first certificate of the PEM encoded certificates.
+func parseClientCertificate(data []byte) (*x509.Certificate, error) {
+	certs, err := certutil.ParseCertsPEM(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse client certificate")
+	}
+	return certs[0], nil
+}
+
+// isCertificateOf checks whether the client certificate authenticates as the ServiceAccount.
+func isCertificateOf(cert *x509.Certificate, saNamespace, saName string) bool {
+	expected := certificateSubject(saNamespace, saName)
+	return cert.Subject.CommonName == expected.CommonName &&
+		sets.New(cert.Subject.Organization...).Equal(sets.New(expected.Organization...))
+}
+
+// isCertificateDataOf checks whether the PEM encoded client certificate authenticates as the
+// ServiceAccount, it is false if the certificate cannot be parsed.
+func isCertificateDataOf(data []byte, saNamespace, saName string) bool {
+	if len(data) == 0 {
+		return false
+	}
+	cert, err := parseClientCertificate(data)
+	return err == nil && isCertificateOf(cert, saNamespace, saName)
+}
+
+// setCertificateStatus reports the issuer of the client certificate in the status, it is left
+// unchanged if the certificate cannot be parsed.
+func setCertificateStatus(managed *authv1beta1.ManagedServiceAccount, data []byte) {
+	cert, err := parseClientCertificate(data)
+	if err != nil {
+		return
+	}
+	managed.Status.TokenIssuer = cert.Issuer.CommonName
+	managed.Status.TokenAudiences = nil
+}
@@ -0,0 +1,458 @@
+package controller
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	fakekube "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/events"
+	certutil "k8s.io/client-go/util/cert"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+	"open-cluster-management.io/managed-serviceaccount/pkg/common"
+)
+
+// testSigner signs the certificate requests like the kube-apiserver-client signer.
+type testSigner struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestSigner(t *testing.T) *testSigner {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kube-apiserver-client"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return &testSigner{cert: cert, key: key}
+}
+
+func (s *testSigner) sign(t *testing.T, subject pkix.Name, publicKey any, notAfter time.Time) []byte {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, s.cert, publicKey, s.key)
+	assert.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: certutil.CertificateBlockType, Bytes: der})
+}
+
+// signRequest signs the PEM encoded certificate request for the duration of its expiration seconds.
+func (s *testSigner) signRequest(t *testing.T, csr *certificatesv1.CertificateSigningRequest) []byte {
+	block, _ := pem.Decode(csr.Spec.Request)
+	request, err := x509.ParseCertificateRequest(block.Bytes)
+	assert.NoError(t, err)
+	validity := time.Duration(*csr.Spec.ExpirationSeconds) * time.Second
+	return s.sign(t, request.Subject, request.PublicKey, time.Now().Add(validity))
+}
+
+func newCertificateRequest(t *testing.T, subject pkix.Name, dnsNames []string,
+	modifiers ...func(*certificatesv1.CertificateSigningRequest)) *certificatesv1.CertificateSigningRequest {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	request, err := certutil.MakeCSR(key, &subject, dnsNames, nil)
+	assert.NoError(t, err)
+	csr := &certificatesv1.CertificateSigningRequest{
+		Spec: certificatesv1.CertificateSigningRequestSpec{
+			Request:    request,
+			SignerName: certificatesv1.KubeAPIServerClientSignerName,
+			Usages:     []certificatesv1.KeyUsage{certificatesv1.UsageDigitalSignature, certificatesv1.UsageClientAuth},
+		},
+	}
+	for _, modifier := range modifiers {
+		modifier(csr)
+	}
+	return csr
+}
+
+func TestIsCertificateRequestAllowed(t *testing.T) {
+	subject := certificateSubject("ns1", "sa1")
+	cases := []struct {
+		name        string
+		csr         *certificatesv1.CertificateSigningRequest
+		expectedErr string
+	}{
+		{
+			name: "allowed",
+			csr:  newCertificateRequest(t, subject, nil),
+		},
+		{
+			name: "unexpected signer",
+			csr: newCertificateRequest(t, subject, nil, func(csr *certificatesv1.CertificateSigningRequest) {
+				csr.Spec.SignerName = certificatesv1.KubeletServingSignerName
+			}),
+			expectedErr: `unexpected signer "kubernetes.io/kubelet-serving"`,
+		},
+		{
+			name: "server auth usage",
+			csr: newCertificateRequest(t, subject, nil, func(csr *certificatesv1.CertificateSigningRequest) {
+				csr.Spec.Usages = append(csr.Spec.Usages, certificatesv1.UsageServerAuth)
+			}),
+			expectedErr: `unexpected usage "server auth"`,
+		},
+		{
+			name: "missing client auth usage",
+			csr: newCertificateRequest(t, subject, nil, func(csr *certificatesv1.CertificateSigningRequest) {
+				csr.Spec.Usages = []certificatesv1.KeyUsage{certificatesv1.UsageDigitalSignature}
+			}),
+			expectedErr: `missing usage "client auth"`,
+		},
+		{
+			name:        "subject alternative names",
+			csr:         newCertificateRequest(t, subject, []string{"example.com"}),
+			expectedErr: "subject alternative names are not allowed",
+		},
+		{
+			name: "another identity",
+			csr: newCertificateRequest(t, pkix.Name{
+				CommonName:   "admin",
+				Organization: []string{"system:masters"},
+			}, nil),
+			expectedErr: "is not the identity of service account ns1/sa1",
+		},
+		{
+			name: "extra group",
+			csr: newCertificateRequest(t, pkix.Name{
+				CommonName:   subject.CommonName,
+				Organization: append([]string{"system:masters"}, subject.Organization...),
+			}, nil),
+			expectedErr: "is not the identity of service account ns1/sa1",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := isCertificateRequestAllowed(c.csr, "ns1", "sa1")
+			if len(c.expectedErr) > 0 {
+				assert.ErrorContains(t, err, c.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestReconcileClientCertificate(t *testing.T) {
+	clusterName := "cluster1"
+	msaName := "msa1"
+	spokeNamespace := "open-cluster-management-agent-addon"
+	signer := newTestSigner(t)
+	certKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	now := time.Now()
+
+	newMSA := func() *authv1beta1.ManagedServiceAccount {
+		msa := newManagedServiceAccount(clusterName, msaName).
+			withRotationValidity(time.Hour).
+			withTokenSecretRef(msaName, now.Add(50*time.Minute), now.Add(-10*time.Minute)).
+			build()
+		msa.Spec.CredentialType = authv1beta1.CredentialTypeClientCertificate
+		return msa
+	}
+	certSecret := func(subject pkix.Name) *corev1.Secret {
+		return newSecret(clusterName, msaName, "", "ca1", func(secret *corev1.Secret) {
+			secret.Data[corev1.TLSCertKey] = signer.sign(t, subject, certKey.Public(), now.Add(50*time.Minute))
+			secret.Data[corev1.TLSPrivateKeyKey] = []byte("key")
+		})
+	}
+
+	cases := []struct {
+		name           string
+		msa            *authv1beta1.ManagedServiceAccount
+		secret         *corev1.Secret
+		expectedError  string
+		expectedIssued bool
+		// expectedNotRevoked is true if the revocation is recorded without revoking the certificate
+		expectedNotRevoked bool
+		expectedEvents     []string
+	}{
+		{
+			name: "issue client certificate",
+			msa: func() *authv1beta1.ManagedServiceAccount {
+				msa := newMSA()
+				msa.Status = authv1beta1.ManagedServiceAccountStatus{}
+				return msa
+			}(),
+			expectedIssued: true,
+			expectedEvents: []string{
+				"Normal " + common.EventReasonServiceAccountCreated,
+				"Normal " + common.EventReasonTokenIssued + " Issued the client certificate",
+			},
+		},
+		{
+			name:   "keep client certificate",
+			msa:    newMSA(),
+			secret: certSecret(certificateSubject(spokeNamespace, msaName)),
+			expectedEvents: []string{
+				"Normal " + common.EventReasonServiceAccountCreated,
+			},
+		},
+		{
+			name:           "client certificate of another identity",
+			msa:            newMSA(),
+			secret:         certSecret(certificateSubject(spokeNamespace, "another")),
+			expectedIssued: true,
+			expectedEvents: []string{
+				"Normal " + common.EventReasonServiceAccountCreated,
+				"Normal " + common.EventReasonTokenRotated + " Rotated the client certificate",
+			},
+		},
+		{
+			name: "client certificate exceeding threshold",
+			msa: func() *authv1beta1.ManagedServiceAccount {
+				msa := newMSA()
+				msa.Status.TokenSecretRef.LastRefreshTimestamp = metav1.NewTime(now.Add(-55 * time.Minute))
+				msa.Status.ExpirationTimestamp = &metav1.Time{Time: now.Add(5 * time.Minute)}
+				return msa
+			}(),
+			secret:         certSecret(certificateSubject(spokeNamespace, msaName)),
+			expectedIssued: true,
+			expectedEvents: []string{
+				"Normal " + common.EventReasonServiceAccountCreated,
+				"Normal " + common.EventReasonTokenRotated + " Rotated the client certificate",
+			},
+		},
+		{
+			name:           "switch from token",
+			msa:            newMSA(),
+			secret:         newSecret(clusterName, msaName, newFakeToken(spokeNamespace, msaName), "ca1"),
+			expectedIssued: true,
+			expectedEvents: []string{
+				"Normal " + common.EventReasonServiceAccountCreated,
+				"Normal " + common.EventReasonTokenIssued + " Issued the client certificate",
+			},
+		},
+		{
+			name: "revocation refused",
+			msa: func() *authv1beta1.ManagedServiceAccount {
+				msa := newMSA()
+				msa.Spec.RevocationGeneration = 1
+				return msa
+			}(),
+			secret:             certSecret(certificateSubject(spokeNamespace, msaName)),
+			expectedNotRevoked: true,
+			expectedEvents: []string{
+				"Normal " + common.EventReasonServiceAccountCreated,
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fakeKubeClient := fakekube.NewSimpleClientset()
+			fakeKubeClient.PrependReactor(
+				"update",
+				"certificatesigningrequests",
+				func(action clienttesting.Action) (bool, runtime.Object, error) {
+					if action.GetSubresource() != "approval" {
+						return false, nil, nil
+					}
+					// the signer issues the certificate once the request is approved
+					csr := action.(clienttesting.UpdateAction).GetObject().(*certificatesv1.CertificateSigningRequest)
+					if err := isCertificateRequestAllowed(csr, spokeNamespace, msaName); err != nil {
+						return true, nil, err
+					}
+					csr.Status.Certificate = signer.signRequest(t, csr)
+					return false, nil, nil
+				},
+			)
+
+			objects := []client.Object{c.msa}
+			if c.secret != nil {
+				objects = append(objects, c.secret)
+			}
+			testscheme := runtime.NewScheme()
+			authv1beta1.AddToScheme(testscheme)
+			corev1.AddToScheme(testscheme)
+			hubClient := fake.NewClientBuilder().WithScheme(testscheme).WithObjects(objects...).
+				WithStatusSubresource(objects...).Build()
+			recorder := events.NewFakeRecorder(10)
+			cache := &fakeCache{msa: c.msa}
+			reconciler := TokenReconciler{
+				Cache:             cache,
+				SpokeNativeClient: fakeKubeClient,
+				SpokeCache:        newFakeSpokeCache(fakeKubeClient),
+				HubClient:         hubClient,
+				SpokeClientConfig: &rest.Config{
+					TLSClientConfig: rest.TLSClientConfig{CAData: []byte("ca1")},
+				},
+				SpokeNamespace: spokeNamespace,
+				EventRecorder:  recorder,
+			}
+
+			request := reconcile.Request{NamespacedName: types.NamespacedName{
+				Namespace: clusterName,
+				Name:      msaName,
+			}}
+			result, err := reconciler.Reconcile(context.Background(), request)
+			if len(c.expectedError) > 0 {
+				assert.EqualError(t, err, c.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			if c.expectedIssued {
+				// the certificate is collected by the next reconcile once it is issued
+				assert.Equal(t, certificateIssueInterval, result.RequeueAfter)
+				cache.msa = &authv1beta1.ManagedServiceAccount{}
+				assert.NoError(t, hubClient.Get(context.TODO(), request.NamespacedName, cache.msa))
+				_, err = reconciler.Reconcile(context.Background(), request)
+				assert.NoError(t, err)
+			}
+			assertEvents(t, recorder, c.expectedEvents...)
+
+			csrActions := []string{}
+			for _, action := range fakeKubeClient.Actions() {
+				if action.GetResource().Resource == "certificatesigningrequests" {
+					csrActions = append(csrActions, action.GetVerb())
+				}
+			}
+			secret := &corev1.Secret{}
+			assert.NoError(t, hubClient.Get(context.TODO(), types.NamespacedName{
+				Namespace: clusterName,
+				Name:      msaName,
+			}, secret))
+			msa := &authv1beta1.ManagedServiceAccount{}
+			assert.NoError(t, hubClient.Get(context.TODO(), types.NamespacedName{
+				Namespace: clusterName,
+				Name:      msaName,
+			}, msa))
+			if c.expectedNotRevoked {
+				assert.Equal(t, int64(1), msa.Status.LastRevocation.Generation)
+				assert.False(t, meta.IsStatusConditionTrue(msa.Status.Conditions, authv1beta1.ConditionTypeTokensRevoked))
+			}
+			if !c.expectedIssued {
+				assert.Empty(t, csrActions)
+				assert.Equal(t, c.secret.Data, secret.Data)
+				return
+			}
+
+			assert.Equal(t, []string{"create", "update", "get", "delete"}, csrActions)
+			_, pending := reconciler.pendingCertificates.get(request.NamespacedName)
+			assert.False(t, pending)
+			assert.NotContains(t, secret.Data, corev1.ServiceAccountTokenKey)
+			assert.Equal(t, "ca1", string(secret.Data[corev1.ServiceAccountRootCAKey]))
+			cert, err := parseClientCertificate(secret.Data[corev1.TLSCertKey])
+			assert.NoError(t, err)
+			assert.True(t, isCertificateOf(cert, spokeNamespace, msaName))
+			_, err = tls.X509KeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+			assert.NoError(t, err)
+
+			assert.Equal(t, cert.NotAfter.Unix(), msa.Status.ExpirationTimestamp.Unix())
+			assert.Equal(t, "kube-apiserver-client", msa.Status.TokenIssuer)
+			assert.Empty(t, msa.Status.TokenAudiences)
+		})
+	}
+}
+
+func TestIssueCertificateNotIssued(t *testing.T) {
+	msa := newManagedServiceAccount("cluster1", "msa1").withRotationValidity(time.Hour).build()
+	msa.Spec.CredentialType = authv1beta1.CredentialTypeClientCertificate
+	key := types.NamespacedName{Namespace: msa.Namespace, Name: msa.Name}
+
+	cases := []struct {
+		name          string
+		modify        func(csr *certificatesv1.CertificateSigningRequest, pending *pendingCertificate)
+		expectedError string
+	}{
+		{
+			name:          "waiting for the signer",
+			modify:        func(_ *certificatesv1.CertificateSigningRequest, _ *pendingCertificate) {},
+			expectedError: errCertificatePending.Error(),
+		},
+		{
+			name: "timed out",
+			modify: func(_ *certificatesv1.CertificateSigningRequest, pending *pendingCertificate) {
+				pending.created = time.Now().Add(-certificateIssueTimeout)
+			},
+			expectedError: "is not issued in 5m0s",
+		},
+		{
+			name: "denied",
+			modify: func(csr *certificatesv1.CertificateSigningRequest, _ *pendingCertificate) {
+				csr.Status.Conditions = append(csr.Status.Conditions, certificatesv1.CertificateSigningRequestCondition{
+					Type:    certificatesv1.CertificateDenied,
+					Message: "denied by policy",
+				})
+			},
+			expectedError: "is Denied: denied by policy",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fakeKubeClient := fakekube.NewSimpleClientset()
+			reconciler := &TokenReconciler{
+				SpokeNativeClient: fakeKubeClient,
+				SpokeCache:        newFakeSpokeCache(fakeKubeClient),
+				SpokeNamespace:    "open-cluster-management-agent-addon",
+			}
+
+			_, _, _, err := reconciler.issueCertificate(context.TODO(), msa)
+			assert.ErrorIs(t, err, errCertificatePending)
+			pending, ok := reconciler.pendingCertificates.get(key)
+			assert.True(t, ok)
+
+			csrClient := fakeKubeClient.CertificatesV1().CertificateSigningRequests()
+			csr, err := csrClient.Get(context.TODO(), pending.csrName, metav1.GetOptions{})
+			assert.NoError(t, err)
+			assert.True(t, isCertificateRequestApproved(csr))
+			c.modify(csr, &pending)
+			_, err = csrClient.UpdateStatus(context.TODO(), csr, metav1.UpdateOptions{})
+			assert.NoError(t, err)
+			reconciler.pendingCertificates.set(key, pending)
+
+			_, _, _, err = reconciler.issueCertificate(context.TODO(), msa)
+			assert.ErrorContains(t, err, c.expectedError)
+			if errors.Is(err, errCertificatePending) {
+				return
+			}
+			_, ok = reconciler.pendingCertificates.get(key)
+			assert.False(t, ok)
+			_, err = csrClient.Get(context.TODO(), pending.csrName, metav1.GetOptions{})
+			assert.True(t, apierrors.IsNotFound(err))
+		})
+	}
+}
+
+func isCertificateRequestApproved(csr *certificatesv1.CertificateSigningRequest) bool {
+	for _, condition := range csr.Status.Conditions {
+		if condition.Type == certificatesv1.CertificateApproved {
+			return true
+		}
+	}
+	return false
+}
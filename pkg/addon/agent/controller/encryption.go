@@ -0,0 +1,41 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+)
+
+// isEnvelopeEncryption checks whether the credentials in the token secret of the ManagedServiceAccount
+// are encrypted with a data key wrapped by the KMS plugin.
+func isEnvelopeEncryption(managed *authv1beta1.ManagedServiceAccount) bool {
+	projection := managed.Spec.Projection
+	return projection != nil && projection.Secret != nil &&
+		projection.Secret.Encryption == authv1beta1.SecretEncryptionEnvelope
+}
+
+// checkEncryption refuses the envelope encryption before a credential is issued if no KMS plugin is
+// configured for the agent.
+func (r *TokenReconciler) checkEncryption(managed *authv1beta1.ManagedServiceAccount) error {
+	if isEnvelopeEncryption(managed) && r.Envelope == nil {
+		return errors.New("the envelope encryption is requested, but no KMS plugin is configured for the agent " +
+			"by --kms-endpoint")
+	}
+	return nil
+}
+
+// sealTokenSecret encrypts the credentials in the token secret in place if the envelope encryption is
+// requested, the secret is written in plaintext otherwise.
+func (r *TokenReconciler) sealTokenSecret(ctx context.Context, managed *authv1beta1.ManagedServiceAccount,
+	secret *corev1.Secret) error {
+	if !isEnvelopeEncryption(managed) {
+		return nil
+	}
+	if err := r.checkEncryption(managed); err != nil {
+		return err
+	}
+	return r.Envelope.EncryptSecret(ctx, secret)
+}
@@ -0,0 +1,214 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	authv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	fakekube "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/events"
+	kmsservice "k8s.io/kms/pkg/service"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+	"open-cluster-management.io/managed-serviceaccount/pkg/envelope"
+)
+
+// fakeKMS wraps the data keys by prefixing them, which is enough to exercise the agent.
+type fakeKMS struct{}
+
+var wrapPrefix = []byte("wrapped:")
+
+func (fakeKMS) Encrypt(_ context.Context, _ string, data []byte) (*kmsservice.EncryptResponse, error) {
+	return &kmsservice.EncryptResponse{Ciphertext: append(append([]byte{}, wrapPrefix...), data...), KeyID: "key1"}, nil
+}
+
+func (fakeKMS) Decrypt(_ context.Context, _ string, req *kmsservice.DecryptRequest) ([]byte, error) {
+	if !bytes.HasPrefix(req.Ciphertext, wrapPrefix) {
+		return nil, errors.New("unknown data key")
+	}
+	return req.Ciphertext[len(wrapPrefix):], nil
+}
+
+func (fakeKMS) Status(_ context.Context) (*kmsservice.StatusResponse, error) {
+	return &kmsservice.StatusResponse{Version: "v2", Healthz: "ok", KeyID: "key1"}, nil
+}
+
+func TestReconcileEnvelopeEncryption(t *testing.T) {
+	clusterName := "cluster1"
+	msaName := "msa1"
+	spokeNamespace := "open-cluster-management-agent-addon"
+	now := time.Now()
+	existingToken := newFakeToken(spokeNamespace, msaName)
+
+	withEncryption := func(encryption authv1beta1.SecretEncryption) *authv1beta1.ManagedServiceAccount {
+		msa := newManagedServiceAccount(clusterName, msaName).withRotationValidity(time.Hour).
+			withTokenSecretRef(msaName, now.Add(50*time.Minute), now.Add(-10*time.Minute)).build()
+		msa.Spec.Projection = &authv1beta1.ManagedServiceAccountProjection{
+			Type:   authv1beta1.ProjectionTypeSecret,
+			Secret: &authv1beta1.SecretProjection{Encryption: encryption},
+		}
+		return msa
+	}
+	encryptedSecret := func() *corev1.Secret {
+		secret := newSecret(clusterName, msaName, existingToken, "ca1")
+		assert.NoError(t, envelope.New(fakeKMS{}).EncryptSecret(context.TODO(), secret))
+		return secret
+	}()
+
+	cases := []struct {
+		name            string
+		msa             *authv1beta1.ManagedServiceAccount
+		secret          *corev1.Secret
+		noKMS           bool
+		expectedError   string
+		expectedIssued  bool
+		expectedToken   string
+		expectEncrypted bool
+	}{
+		{
+			name: "issue encrypted",
+			msa: func() *authv1beta1.ManagedServiceAccount {
+				msa := withEncryption(authv1beta1.SecretEncryptionEnvelope)
+				msa.Status = authv1beta1.ManagedServiceAccountStatus{}
+				return msa
+			}(),
+			expectedIssued:  true,
+			expectedToken:   existingToken,
+			expectEncrypted: true,
+		},
+		{
+			name:            "encrypt existing token",
+			msa:             withEncryption(authv1beta1.SecretEncryptionEnvelope),
+			secret:          newSecret(clusterName, msaName, existingToken, "ca1"),
+			expectedToken:   existingToken,
+			expectEncrypted: true,
+		},
+		{
+			name:            "keep encrypted token",
+			msa:             withEncryption(authv1beta1.SecretEncryptionEnvelope),
+			secret:          encryptedSecret,
+			expectedToken:   existingToken,
+			expectEncrypted: true,
+		},
+		{
+			name:          "decrypt existing token",
+			msa:           withEncryption(authv1beta1.SecretEncryptionNone),
+			secret:        encryptedSecret,
+			expectedToken: existingToken,
+		},
+		{
+			name:          "no kms plugin",
+			msa:           withEncryption(authv1beta1.SecretEncryptionEnvelope),
+			secret:        newSecret(clusterName, msaName, existingToken, "ca1"),
+			noKMS:         true,
+			expectedError: "no KMS plugin is configured for the agent",
+			expectedToken: existingToken,
+		},
+		{
+			name:          "encrypted secret without kms plugin",
+			msa:           withEncryption(authv1beta1.SecretEncryptionNone),
+			secret:        encryptedSecret,
+			noKMS:         true,
+			expectedError: "is envelope encrypted, a KMS plugin is required to decrypt it",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fakeKubeClient := fakekube.NewSimpleClientset()
+			fakeKubeClient.PrependReactor("create", "serviceaccounts",
+				func(action clienttesting.Action) (bool, runtime.Object, error) {
+					if action.GetSubresource() != "token" {
+						return false, nil, nil
+					}
+					return true, &authv1.TokenRequest{
+						Status: authv1.TokenRequestStatus{
+							Token:               existingToken,
+							ExpirationTimestamp: metav1.NewTime(time.Now().Add(time.Hour)),
+						},
+					}, nil
+				})
+			fakeKubeClient.PrependReactor("create", "tokenreviews",
+				func(action clienttesting.Action) (bool, runtime.Object, error) {
+					return true, &authv1.TokenReview{Status: authv1.TokenReviewStatus{Authenticated: true}}, nil
+				})
+
+			testscheme := runtime.NewScheme()
+			authv1beta1.AddToScheme(testscheme)
+			corev1.AddToScheme(testscheme)
+			objects := []client.Object{c.msa}
+			if c.secret != nil {
+				objects = append(objects, c.secret.DeepCopy())
+			}
+			hubClient := fake.NewClientBuilder().WithScheme(testscheme).WithObjects(objects...).
+				WithStatusSubresource(objects...).Build()
+			reconciler := TokenReconciler{
+				Cache:             &fakeCache{msa: c.msa},
+				SpokeNativeClient: fakeKubeClient,
+				SpokeCache:        newFakeSpokeCache(fakeKubeClient),
+				HubClient:         hubClient,
+				SpokeClientConfig: &rest.Config{
+					TLSClientConfig: rest.TLSClientConfig{CAData: []byte("ca1")},
+				},
+				SpokeNamespace: spokeNamespace,
+				EventRecorder:  events.NewFakeRecorder(10),
+			}
+			if !c.noKMS {
+				reconciler.Envelope = envelope.New(fakeKMS{})
+			}
+			request := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: clusterName, Name: msaName}}
+
+			_, err := reconciler.Reconcile(context.Background(), request)
+			if len(c.expectedError) > 0 {
+				assert.ErrorContains(t, err, c.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			issued := false
+			for _, action := range fakeKubeClient.Actions() {
+				if action.GetVerb() == "create" && action.GetSubresource() == "token" {
+					issued = true
+				}
+			}
+			assert.Equal(t, c.expectedIssued, issued)
+			if len(c.expectedToken) == 0 {
+				return
+			}
+
+			secret := &corev1.Secret{}
+			assert.NoError(t, hubClient.Get(context.TODO(), request.NamespacedName, secret))
+			assert.Equal(t, c.expectEncrypted, envelope.IsEncrypted(secret))
+			assert.Equal(t, !c.expectEncrypted, string(secret.Data[corev1.ServiceAccountTokenKey]) == c.expectedToken)
+			assert.Equal(t, []byte("ca1"), secret.Data[corev1.ServiceAccountRootCAKey])
+			decrypted, err := envelope.New(fakeKMS{}).DecryptSecret(context.TODO(), secret)
+			assert.NoError(t, err)
+			assert.Equal(t, c.expectedToken, string(decrypted.Data[corev1.ServiceAccountTokenKey]))
+			if len(c.expectedError) > 0 {
+				return
+			}
+
+			// the secret is not encrypted again while the credentials are unchanged
+			msa := &authv1beta1.ManagedServiceAccount{}
+			assert.NoError(t, hubClient.Get(context.TODO(), request.NamespacedName, msa))
+			reconciler.Cache = &fakeCache{msa: msa}
+			_, err = reconciler.Reconcile(context.Background(), request)
+			assert.NoError(t, err)
+			resynced := &corev1.Secret{}
+			assert.NoError(t, hubClient.Get(context.TODO(), request.NamespacedName, resynced))
+			assert.Equal(t, secret.ResourceVersion, resynced.ResourceVersion)
+		})
+	}
+}
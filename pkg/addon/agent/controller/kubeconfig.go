@@ -0,0 +1,142 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+	"open-cluster-management.io/managed-serviceaccount/pkg/common"
+)
+
+// isKubeconfigFormat checks whether the token secret of the ManagedServiceAccount is in the Kubeconfig format.
+func isKubeconfigFormat(managed *authv1beta1.ManagedServiceAccount) bool {
+	projection := managed.Spec.Projection
+	return projection != nil && projection.Secret != nil &&
+		projection.Secret.Format == authv1beta1.SecretFormatKubeconfig
+}
+
+// secretData returns the data of the token secret in the format prescribed by the projection, the
+// credential is either the token or the client certificate and key.
+func (r *TokenReconciler) secretData(ctx context.Context, managed *authv1beta1.ManagedServiceAccount,
+	caData []byte, credential map[string][]byte) (map[string][]byte, error) {
+	data := map[string][]byte{
+		corev1.ServiceAccountRootCAKey: caData,
+	}
+	for key, value := range credential {
+		data[key] = value
+	}
+	if !isKubeconfigFormat(managed) {
+		return data, nil
+	}
+
+	server, serverCAData, err := r.resolveServer(ctx, managed)
+	if err != nil {
+		return nil, err
+	}
+	if len(serverCAData) == 0 {
+		serverCAData = caData
+	}
+	kubeconfig, err := buildKubeconfig(managed.Namespace, managed.Name, server, serverCAData, credential)
+	if err != nil {
+		return nil, err
+	}
+	data[common.SecretKeyServer] = []byte(server)
+	data[common.SecretKeyKubeconfig] = kubeconfig
+	return data, nil
+}
+
+// resolveServer returns the URL and the CA bundle of the managed cluster written in the kubeconfig, the
+// override in the projection takes precedence over the client config of the ManagedCluster.
+func (r *TokenReconciler) resolveServer(ctx context.Context,
+	managed *authv1beta1.ManagedServiceAccount) (string, []byte, error) {
+	projection := managed.Spec.Projection.Secret
+	if len(projection.Server) > 0 {
+		return projection.Server, projection.CABundle, nil
+	}
+
+	if !r.ReadManagedCluster {
+		return "", nil, fmt.Errorf("the agent is not permitted to read managed cluster %s on the hub cluster, "+
+			"set spec.projection.secret.server instead", managed.Namespace)
+	}
+	cluster := &clusterv1.ManagedCluster{}
+	if err := r.HubClient.Get(ctx, types.NamespacedName{Name: managed.Namespace}, cluster); err != nil {
+		return "", nil, errors.Wrapf(err, "failed to get managed cluster %s", managed.Namespace)
+	}
+	for _, config := range cluster.Spec.ManagedClusterClientConfigs {
+		if len(config.URL) == 0 {
+			continue
+		}
+		caData := config.CABundle
+		if len(projection.CABundle) > 0 {
+			caData = projection.CABundle
+		}
+		return config.URL, caData, nil
+	}
+	return "", nil, fmt.Errorf("no server URL found in the client configs of managed cluster %s", managed.Namespace)
+}
+
+// buildKubeconfig builds a kubeconfig authenticating with the token or the client certificate of the
+// ManagedServiceAccount.
+func buildKubeconfig(clusterName, msaName, server string, caData []byte, credential map[string][]byte) ([]byte, error) {
+	config := clientcmdapi.Config{
+		Clusters: map[string]*clientcmdapi.Cluster{
+			clusterName: {
+				Server:                   server,
+				CertificateAuthorityData: caData,
+			},
+		},
+		AuthInfos: map[string]*clientcmdapi.AuthInfo{
+			msaName: {
+				Token:                 string(credential[corev1.ServiceAccountTokenKey]),
+				ClientCertificateData: credential[corev1.TLSCertKey],
+				ClientKeyData:         credential[corev1.TLSPrivateKeyKey],
+			},
+		},
+		Contexts: map[string]*clientcmdapi.Context{
+			clusterName: {
+				Cluster:  clusterName,
+				AuthInfo: msaName,
+			},
+		},
+		CurrentContext: clusterName,
+	}
+	data, err := clientcmd.Write(config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to build kubeconfig")
+	}
+	return data, nil
+}
+
+// managedClusterToRequests maps the ManagedCluster to the ManagedServiceAccounts whose token secret
+// is in the Kubeconfig format, so that the kubeconfig follows the changes of the client configs.
+func (r *TokenReconciler) managedClusterToRequests(ctx context.Context, obj client.Object) []reconcile.Request {
+	msas := &authv1beta1.ManagedServiceAccountList{}
+	if err := r.HubClient.List(ctx, msas, client.InNamespace(obj.GetName())); err != nil {
+		log.FromContext(ctx).Error(err, "failed to list managed serviceaccounts", "cluster", obj.GetName())
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+	for _, msa := range msas.Items {
+		if !isKubeconfigFormat(&msa) {
+			continue
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Namespace: msa.Namespace,
+				Name:      msa.Name,
+			},
+		})
+	}
+	return requests
+}
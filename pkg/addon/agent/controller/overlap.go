@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+	"open-cluster-management.io/managed-serviceaccount/pkg/common"
+)
+
+// isOverlapMode checks whether the previous token is kept in the token secret after a rotation, the
+// previous client certificate is never kept.
+func isOverlapMode(managed *authv1beta1.ManagedServiceAccount) bool {
+	gracePeriod := managed.Spec.Rotation.PreviousTokenGracePeriod
+	return gracePeriod != nil && gracePeriod.Duration > 0 && !isClientCertificate(managed)
+}
+
+// previousTokenRetireTime returns the time the previous token is removed from the token secret,
+// which is the end of the grace period after the last rotation, or the expiration of the previous
+// token if it is earlier.
+func previousTokenRetireTime(managed *authv1beta1.ManagedServiceAccount, secret *corev1.Secret) time.Time {
+	if managed.Status.TokenSecretRef == nil || !isOverlapMode(managed) {
+		return time.Time{}
+	}
+	retire := managed.Status.TokenSecretRef.LastRefreshTimestamp.Add(managed.Spec.Rotation.PreviousTokenGracePeriod.Duration)
+	if secret != nil {
+		if expiring, err := time.Parse(time.RFC3339, secret.Annotations[common.AnnotationKeyPreviousTokenExpiration]); err == nil &&
+			expiring.Before(retire) {
+			return expiring
+		}
+	}
+	return retire
+}
+
+// setRotatedTokens keeps the token of the current secret as the previous token in the rotated
+// secret, and records the expiration of both tokens in the annotations.
+func setRotatedTokens(managed *authv1beta1.ManagedServiceAccount, current, rotated *corev1.Secret,
+	expiring metav1.Time, now metav1.Time) {
+	if !isOverlapMode(managed) {
+		clearOverlapTokens(rotated)
+		return
+	}
+	rotated.Annotations[common.AnnotationKeyTokenExpiration] = expiring.UTC().Format(time.RFC3339)
+	delete(rotated.Annotations, common.AnnotationKeyPreviousTokenExpiration)
+	delete(rotated.Data, common.SecretKeyPreviousToken)
+	if current == nil || len(current.Data[corev1.ServiceAccountTokenKey]) == 0 {
+		return
+	}
+
+	previousExpiring := current.Annotations[common.AnnotationKeyTokenExpiration]
+	if len(previousExpiring) == 0 && managed.Status.ExpirationTimestamp != nil {
+		previousExpiring = managed.Status.ExpirationTimestamp.UTC().Format(time.RFC3339)
+	}
+	// an expired token is useless to the consumers
+	if t, err := time.Parse(time.RFC3339, previousExpiring); err != nil || !t.After(now.Time) {
+		return
+	}
+	rotated.Data[common.SecretKeyPreviousToken] = current.Data[corev1.ServiceAccountTokenKey]
+	rotated.Annotations[common.AnnotationKeyPreviousTokenExpiration] = previousExpiring
+}
+
+// retainPreviousToken keeps the previous token in the desired secret until it is retired, while
+// the token is not rotated.
+func retainPreviousToken(managed *authv1beta1.ManagedServiceAccount, current, desired *corev1.Secret, now metav1.Time) {
+	if !isOverlapMode(managed) {
+		clearOverlapTokens(desired)
+		return
+	}
+	if _, ok := desired.Annotations[common.AnnotationKeyTokenExpiration]; !ok && managed.Status.ExpirationTimestamp != nil {
+		desired.Annotations[common.AnnotationKeyTokenExpiration] = managed.Status.ExpirationTimestamp.UTC().Format(time.RFC3339)
+	}
+
+	previous := current.Data[common.SecretKeyPreviousToken]
+	if len(previous) > 0 && now.Time.Before(previousTokenRetireTime(managed, current)) {
+		desired.Data[common.SecretKeyPreviousToken] = previous
+		return
+	}
+	delete(desired.Data, common.SecretKeyPreviousToken)
+	delete(desired.Annotations, common.AnnotationKeyPreviousTokenExpiration)
+}
+
+func clearOverlapTokens(secret *corev1.Secret) {
+	delete(secret.Data, common.SecretKeyPreviousToken)
+	delete(secret.Annotations, common.AnnotationKeyTokenExpiration)
+	delete(secret.Annotations, common.AnnotationKeyPreviousTokenExpiration)
+}
@@ -0,0 +1,582 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+	"open-cluster-management.io/managed-serviceaccount/pkg/common"
+)
+
+const permissionNamePrefix = "open-cluster-management:managed-serviceaccount:"
+
+// errPermissionConflict is returned if an RBAC object of the same name exists on the managed cluster,
+// but it is not created for the ManagedServiceAccount. The object is left intact.
+var errPermissionConflict = errors.New("the object exists, but it is not created for the ManagedServiceAccount")
+
+// errPermissionNotAllowed is returned if the spec.permissions is not permitted by the permission
+// allowlist ConfigMap on the managed cluster.
+var errPermissionNotAllowed = errors.New("not permitted by the permission allowlist")
+
+// permissionObjects is the set of RBAC objects on the managed cluster prescribed by
+// the spec.permissions of a ManagedServiceAccount.
+type permissionObjects struct {
+	roles               []*rbacv1.Role
+	clusterRoles        []*rbacv1.ClusterRole
+	roleBindings        []*rbacv1.RoleBinding
+	clusterRoleBindings []*rbacv1.ClusterRoleBinding
+}
+
+// syncPermissions reconciles the RBAC objects on the managed cluster against the
+// spec.permissions and records the result in the PermissionsApplied condition.
+func (r *TokenReconciler) syncPermissions(ctx context.Context, msa *authv1beta1.ManagedServiceAccount) error {
+	if msa.Spec.Permissions == nil &&
+		meta.FindStatusCondition(msa.Status.Conditions, authv1beta1.ConditionTypePermissionsApplied) == nil {
+		// permissions are never set, nothing to apply or clean up
+		return nil
+	}
+
+	if msa.Spec.Permissions != nil {
+		// check the allowlist every time, so that revoking the permission prunes the RBAC objects
+		if err := r.checkPermissionAllowlist(ctx, msa); err != nil {
+			reason := "PermissionsNotAllowed"
+			if !errors.Is(err, errPermissionNotAllowed) {
+				reason = "PermissionsApplyFailed"
+			} else if cleanupErr := r.cleanupPermissions(ctx, msa.Namespace, msa.Name); cleanupErr != nil {
+				err = utilerrors.NewAggregate([]error{err, cleanupErr})
+			}
+			setPermissionsFailedCondition(msa, reason, err)
+			return err
+		}
+	}
+
+	err := r.applyPermissions(ctx, msa)
+	if err != nil {
+		reason := "PermissionsApplyFailed"
+		if errors.Is(err, errPermissionConflict) {
+			reason = "PermissionsConflict"
+		}
+		setPermissionsFailedCondition(msa, reason, err)
+		return err
+	}
+
+	if msa.Spec.Permissions == nil {
+		// permissions are removed from the spec and the RBAC objects are cleaned up
+		meta.RemoveStatusCondition(&msa.Status.Conditions, authv1beta1.ConditionTypePermissionsApplied)
+		return nil
+	}
+
+	meta.SetStatusCondition(&msa.Status.Conditions, metav1.Condition{
+		Type:   authv1beta1.ConditionTypePermissionsApplied,
+		Status: metav1.ConditionTrue,
+		Reason: "PermissionsApplied",
+	})
+	return nil
+}
+
+// checkPermissionAllowlist checks the spec.permissions against the permission allowlist ConfigMap:
+// the ServiceAccount must be listed, every referenced role must be listed, and every verb granted by
+// the inline rules must be listed.
+func (r *TokenReconciler) checkPermissionAllowlist(ctx context.Context,
+	msa *authv1beta1.ManagedServiceAccount) error {
+	allowlist, err := r.getAllowlist(ctx, common.PermissionAllowlistConfigMapName)
+	if err != nil {
+		return err
+	}
+
+	saNamespace, saName := r.serviceAccountOf(msa)
+	if !matchAllowlist(allowlist[common.PermissionAllowlistKey], saNamespace+"/"+saName) {
+		return errors.Wrapf(errPermissionNotAllowed, "granting permissions to service account %s/%s is "+
+			"not permitted by the allowlist configmap %s/%s", saNamespace, saName, r.SpokeNamespace,
+			common.PermissionAllowlistConfigMapName)
+	}
+
+	denied := sets.New[string]()
+	for _, ref := range msa.Spec.Permissions.RoleRefs {
+		switch ref.Kind {
+		case "Role":
+			if !matchAllowlist(allowlist[common.PermissionAllowlistRolesKey], ref.Namespace+"/"+ref.Name) {
+				denied.Insert(fmt.Sprintf("role %s/%s", ref.Namespace, ref.Name))
+			}
+		case "ClusterRole":
+			if !matchAllowlist(allowlist[common.PermissionAllowlistClusterRolesKey], ref.Name) {
+				denied.Insert(fmt.Sprintf("clusterrole %s", ref.Name))
+			}
+		}
+	}
+	for _, role := range msa.Spec.Permissions.Roles {
+		denied.Insert(deniedRules(allowlist[common.PermissionAllowlistRulesKey], role.Rules)...)
+	}
+	for _, cr := range msa.Spec.Permissions.ClusterRoles {
+		denied.Insert(deniedRules(allowlist[common.PermissionAllowlistRulesKey], cr.Rules)...)
+	}
+	if denied.Len() > 0 {
+		return errors.Wrapf(errPermissionNotAllowed, "granting %s is not permitted by the allowlist configmap %s/%s",
+			strings.Join(sets.List(denied), ", "), r.SpokeNamespace, common.PermissionAllowlistConfigMapName)
+	}
+	return nil
+}
+
+// deniedRules returns the "<verb>:<resource>.<group>" and "<verb>:<url>" grants of the rules not
+// matching any pattern of the allowlist. Wildcards in the rules are matched literally, so granting
+// "*" requires a pattern matching "*".
+func deniedRules(allowlist string, rules []rbacv1.PolicyRule) []string {
+	var denied []string
+	for _, rule := range rules {
+		for _, verb := range rule.Verbs {
+			for _, group := range rule.APIGroups {
+				for _, resource := range rule.Resources {
+					grant := verb + ":" + resource
+					if len(group) > 0 {
+						grant += "." + group
+					}
+					if !matchAllowlist(allowlist, grant) {
+						denied = append(denied, grant)
+					}
+				}
+			}
+			for _, url := range rule.NonResourceURLs {
+				grant := verb + ":" + url
+				if !matchAllowlist(allowlist, grant) {
+					denied = append(denied, grant)
+				}
+			}
+		}
+	}
+	return denied
+}
+
+func setPermissionsFailedCondition(msa *authv1beta1.ManagedServiceAccount, reason string, err error) {
+	meta.SetStatusCondition(&msa.Status.Conditions, metav1.Condition{
+		Type:    authv1beta1.ConditionTypePermissionsApplied,
+		Status:  metav1.ConditionFalse,
+		Reason:  reason,
+		Message: err.Error(),
+	})
+}
+
+func (r *TokenReconciler) applyPermissions(ctx context.Context, msa *authv1beta1.ManagedServiceAccount) error {
+	saNamespace, saName := r.serviceAccountOf(msa)
+	desired, err := buildPermissionObjects(msa, saNamespace, saName)
+	if err != nil {
+		return err
+	}
+
+	// apply the roles before the bindings referencing them, and prune the bindings
+	// before the roles they reference
+	var errs []error
+	errs = append(errs, r.applyRoles(ctx, desired.roles)...)
+	errs = append(errs, r.applyClusterRoles(ctx, desired.clusterRoles)...)
+	errs = append(errs, r.applyRoleBindings(ctx, desired.roleBindings)...)
+	errs = append(errs, r.applyClusterRoleBindings(ctx, desired.clusterRoleBindings)...)
+	if len(errs) > 0 {
+		return utilerrors.NewAggregate(errs)
+	}
+
+	return r.prunePermissions(ctx, msa.Namespace, msa.Name, desired)
+}
+
+// cleanupPermissions deletes all the RBAC objects created for the ManagedServiceAccount
+// on the managed cluster.
+func (r *TokenReconciler) cleanupPermissions(ctx context.Context, msaNamespace, msaName string) error {
+	return r.prunePermissions(ctx, msaNamespace, msaName, &permissionObjects{})
+}
+
+// prunePermissions deletes the RBAC objects created for the ManagedServiceAccount but not desired.
+// The objects are listed from the spoke cache, which only holds the objects labeled for the
+// ManagedServiceAccounts of the cluster, an object missed by a stale cache is pruned on the
+// reconcile triggered by its event.
+func (r *TokenReconciler) prunePermissions(ctx context.Context, msaNamespace, msaName string,
+	desired *permissionObjects) error {
+	logger := log.FromContext(ctx)
+	matchingLabels := client.MatchingLabels(ownerLabels(msaNamespace, msaName))
+	rbacClient := r.SpokeNativeClient.RbacV1()
+
+	var errs []error
+	roleBindings := &rbacv1.RoleBindingList{}
+	if err := r.SpokeCache.List(ctx, roleBindings, matchingLabels); err != nil {
+		return errors.Wrapf(err, "failed to list rolebindings")
+	}
+	for _, rb := range roleBindings.Items {
+		if containsObject(desired.roleBindings, rb.Namespace, rb.Name) {
+			continue
+		}
+		logger.Info("Delete RoleBinding", "namespace", rb.Namespace, "name", rb.Name)
+		if err := rbacClient.RoleBindings(rb.Namespace).Delete(ctx, rb.Name, metav1.DeleteOptions{}); err != nil &&
+			!apierrors.IsNotFound(err) {
+			errs = append(errs, errors.Wrapf(err, "failed to delete rolebinding %s/%s", rb.Namespace, rb.Name))
+		}
+	}
+
+	clusterRoleBindings := &rbacv1.ClusterRoleBindingList{}
+	if err := r.SpokeCache.List(ctx, clusterRoleBindings, matchingLabels); err != nil {
+		return errors.Wrapf(err, "failed to list clusterrolebindings")
+	}
+	for _, crb := range clusterRoleBindings.Items {
+		if containsObject(desired.clusterRoleBindings, "", crb.Name) {
+			continue
+		}
+		logger.Info("Delete ClusterRoleBinding", "name", crb.Name)
+		if err := rbacClient.ClusterRoleBindings().Delete(ctx, crb.Name, metav1.DeleteOptions{}); err != nil &&
+			!apierrors.IsNotFound(err) {
+			errs = append(errs, errors.Wrapf(err, "failed to delete clusterrolebinding %s", crb.Name))
+		}
+	}
+
+	roles := &rbacv1.RoleList{}
+	if err := r.SpokeCache.List(ctx, roles, matchingLabels); err != nil {
+		return errors.Wrapf(err, "failed to list roles")
+	}
+	for _, role := range roles.Items {
+		if containsObject(desired.roles, role.Namespace, role.Name) {
+			continue
+		}
+		logger.Info("Delete Role", "namespace", role.Namespace, "name", role.Name)
+		if err := rbacClient.Roles(role.Namespace).Delete(ctx, role.Name, metav1.DeleteOptions{}); err != nil &&
+			!apierrors.IsNotFound(err) {
+			errs = append(errs, errors.Wrapf(err, "failed to delete role %s/%s", role.Namespace, role.Name))
+		}
+	}
+
+	clusterRoles := &rbacv1.ClusterRoleList{}
+	if err := r.SpokeCache.List(ctx, clusterRoles, matchingLabels); err != nil {
+		return errors.Wrapf(err, "failed to list clusterroles")
+	}
+	for _, cr := range clusterRoles.Items {
+		if containsObject(desired.clusterRoles, "", cr.Name) {
+			continue
+		}
+		logger.Info("Delete ClusterRole", "name", cr.Name)
+		if err := rbacClient.ClusterRoles().Delete(ctx, cr.Name, metav1.DeleteOptions{}); err != nil &&
+			!apierrors.IsNotFound(err) {
+			errs = append(errs, errors.Wrapf(err, "failed to delete clusterrole %s", cr.Name))
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+func (r *TokenReconciler) applyRoles(ctx context.Context, roles []*rbacv1.Role) []error {
+	var errs []error
+	for _, role := range roles {
+		client := r.SpokeNativeClient.RbacV1().Roles(role.Namespace)
+		current, err := client.Get(ctx, role.Name, metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+			_, err = client.Create(ctx, role, metav1.CreateOptions{})
+		case err == nil && !hasLabels(current.Labels, role.Labels):
+			// never take over an object not created for the ManagedServiceAccount
+			err = errPermissionConflict
+		case err == nil:
+			if equality.Semantic.DeepEqual(current.Rules, role.Rules) && hasLabels(current.Labels, role.Labels) &&
+				hasLabels(current.Annotations, role.Annotations) {
+				continue
+			}
+			updated := current.DeepCopy()
+			updated.Labels = mergeLabels(updated.Labels, role.Labels)
+			updated.Annotations = mergeLabels(updated.Annotations, role.Annotations)
+			updated.Rules = role.Rules
+			_, err = client.Update(ctx, updated, metav1.UpdateOptions{})
+		}
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "failed to apply role %s/%s", role.Namespace, role.Name))
+		}
+	}
+	return errs
+}
+
+func (r *TokenReconciler) applyClusterRoles(ctx context.Context, clusterRoles []*rbacv1.ClusterRole) []error {
+	var errs []error
+	for _, cr := range clusterRoles {
+		client := r.SpokeNativeClient.RbacV1().ClusterRoles()
+		current, err := client.Get(ctx, cr.Name, metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+			_, err = client.Create(ctx, cr, metav1.CreateOptions{})
+		case err == nil && !hasLabels(current.Labels, cr.Labels):
+			// never take over an object not created for the ManagedServiceAccount
+			err = errPermissionConflict
+		case err == nil:
+			if equality.Semantic.DeepEqual(current.Rules, cr.Rules) && hasLabels(current.Labels, cr.Labels) &&
+				hasLabels(current.Annotations, cr.Annotations) {
+				continue
+			}
+			updated := current.DeepCopy()
+			updated.Labels = mergeLabels(updated.Labels, cr.Labels)
+			updated.Annotations = mergeLabels(updated.Annotations, cr.Annotations)
+			updated.Rules = cr.Rules
+			_, err = client.Update(ctx, updated, metav1.UpdateOptions{})
+		}
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "failed to apply clusterrole %s", cr.Name))
+		}
+	}
+	return errs
+}
+
+func (r *TokenReconciler) applyRoleBindings(ctx context.Context, roleBindings []*rbacv1.RoleBinding) []error {
+	var errs []error
+	for _, rb := range roleBindings {
+		client := r.SpokeNativeClient.RbacV1().RoleBindings(rb.Namespace)
+		current, err := client.Get(ctx, rb.Name, metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+			_, err = client.Create(ctx, rb, metav1.CreateOptions{})
+		case err == nil && !hasLabels(current.Labels, rb.Labels):
+			// never take over an object not created for the ManagedServiceAccount
+			err = errPermissionConflict
+		case err == nil && current.RoleRef != rb.RoleRef:
+			// the roleRef of a binding is immutable, recreate it
+			if err = client.Delete(ctx, rb.Name, metav1.DeleteOptions{}); err == nil {
+				_, err = client.Create(ctx, rb, metav1.CreateOptions{})
+			}
+		case err == nil:
+			if equality.Semantic.DeepEqual(current.Subjects, rb.Subjects) && hasLabels(current.Labels, rb.Labels) &&
+				hasLabels(current.Annotations, rb.Annotations) {
+				continue
+			}
+			updated := current.DeepCopy()
+			updated.Labels = mergeLabels(updated.Labels, rb.Labels)
+			updated.Annotations = mergeLabels(updated.Annotations, rb.Annotations)
+			updated.Subjects = rb.Subjects
+			_, err = client.Update(ctx, updated, metav1.UpdateOptions{})
+		}
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "failed to apply rolebinding %s/%s", rb.Namespace, rb.Name))
+		}
+	}
+	return errs
+}
+
+func (r *TokenReconciler) applyClusterRoleBindings(ctx context.Context,
+	clusterRoleBindings []*rbacv1.ClusterRoleBinding) []error {
+	var errs []error
+	for _, crb := range clusterRoleBindings {
+		client := r.SpokeNativeClient.RbacV1().ClusterRoleBindings()
+		current, err := client.Get(ctx, crb.Name, metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+			_, err = client.Create(ctx, crb, metav1.CreateOptions{})
+		case err == nil && !hasLabels(current.Labels, crb.Labels):
+			// never take over an object not created for the ManagedServiceAccount
+			err = errPermissionConflict
+		case err == nil && current.RoleRef != crb.RoleRef:
+			// the roleRef of a binding is immutable, recreate it
+			if err = client.Delete(ctx, crb.Name, metav1.DeleteOptions{}); err == nil {
+				_, err = client.Create(ctx, crb, metav1.CreateOptions{})
+			}
+		case err == nil:
+			if equality.Semantic.DeepEqual(current.Subjects, crb.Subjects) && hasLabels(current.Labels, crb.Labels) &&
+				hasLabels(current.Annotations, crb.Annotations) {
+				continue
+			}
+			updated := current.DeepCopy()
+			updated.Labels = mergeLabels(updated.Labels, crb.Labels)
+			updated.Annotations = mergeLabels(updated.Annotations, crb.Annotations)
+			updated.Subjects = crb.Subjects
+			_, err = client.Update(ctx, updated, metav1.UpdateOptions{})
+		}
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "failed to apply clusterrolebinding %s", crb.Name))
+		}
+	}
+	return errs
+}
+
+// buildPermissionObjects builds the RBAC objects on the managed cluster for the spec.permissions
+// of the ManagedServiceAccount, granting them to the ServiceAccount saNamespace/saName.
+func buildPermissionObjects(msa *authv1beta1.ManagedServiceAccount,
+	saNamespace, saName string) (*permissionObjects, error) {
+	objects := &permissionObjects{}
+	if msa.Spec.Permissions == nil {
+		return objects, nil
+	}
+
+	objectLabels := ownerLabels(msa.Namespace, msa.Name)
+	objectAnnotations := ownerAnnotations(msa.Name)
+	subjects := []rbacv1.Subject{
+		{
+			Kind:      rbacv1.ServiceAccountKind,
+			Namespace: saNamespace,
+			Name:      saName,
+		},
+	}
+	roleBindingNames := map[string]bool{}
+	clusterRoleBindingNames := map[string]bool{}
+
+	for _, role := range msa.Spec.Permissions.Roles {
+		name := permissionObjectName(msa.Name, role.Name)
+		key := role.Namespace + "/" + name
+		if roleBindingNames[key] {
+			return nil, fmt.Errorf("duplicated role %q in namespace %q", role.Name, role.Namespace)
+		}
+		roleBindingNames[key] = true
+
+		objects.roles = append(objects.roles, &rbacv1.Role{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   role.Namespace,
+				Name:        name,
+				Labels:      objectLabels,
+				Annotations: objectAnnotations,
+			},
+			Rules: role.Rules,
+		})
+		objects.roleBindings = append(objects.roleBindings, &rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   role.Namespace,
+				Name:        name,
+				Labels:      objectLabels,
+				Annotations: objectAnnotations,
+			},
+			RoleRef: rbacv1.RoleRef{
+				APIGroup: rbacv1.GroupName,
+				Kind:     "Role",
+				Name:     name,
+			},
+			Subjects: subjects,
+		})
+	}
+
+	for _, cr := range msa.Spec.Permissions.ClusterRoles {
+		name := permissionObjectName(msa.Name, cr.Name)
+		if clusterRoleBindingNames[name] {
+			return nil, fmt.Errorf("duplicated cluster role %q", cr.Name)
+		}
+		clusterRoleBindingNames[name] = true
+
+		objects.clusterRoles = append(objects.clusterRoles, &rbacv1.ClusterRole{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Labels:      objectLabels,
+				Annotations: objectAnnotations,
+			},
+			Rules: cr.Rules,
+		})
+		objects.clusterRoleBindings = append(objects.clusterRoleBindings, &rbacv1.ClusterRoleBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Labels:      objectLabels,
+				Annotations: objectAnnotations,
+			},
+			RoleRef: rbacv1.RoleRef{
+				APIGroup: rbacv1.GroupName,
+				Kind:     "ClusterRole",
+				Name:     name,
+			},
+			Subjects: subjects,
+		})
+	}
+
+	for _, ref := range msa.Spec.Permissions.RoleRefs {
+		name := permissionObjectName(msa.Name, strings.ToLower(ref.Kind)+":"+ref.Name)
+		roleRef := rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     ref.Kind,
+			Name:     ref.Name,
+		}
+
+		switch {
+		case ref.Kind == "Role" && len(ref.Namespace) == 0:
+			return nil, fmt.Errorf("namespace is required for the referenced role %q", ref.Name)
+		case ref.Kind != "Role" && ref.Kind != "ClusterRole":
+			return nil, fmt.Errorf("unsupported kind %q of the referenced role %q", ref.Kind, ref.Name)
+		case len(ref.Namespace) > 0:
+			key := ref.Namespace + "/" + name
+			if roleBindingNames[key] {
+				return nil, fmt.Errorf("duplicated role ref %s %q in namespace %q", ref.Kind, ref.Name, ref.Namespace)
+			}
+			roleBindingNames[key] = true
+
+			objects.roleBindings = append(objects.roleBindings, &rbacv1.RoleBinding{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:   ref.Namespace,
+					Name:        name,
+					Labels:      objectLabels,
+					Annotations: objectAnnotations,
+				},
+				RoleRef:  roleRef,
+				Subjects: subjects,
+			})
+		default:
+			if clusterRoleBindingNames[name] {
+				return nil, fmt.Errorf("duplicated role ref %s %q", ref.Kind, ref.Name)
+			}
+			clusterRoleBindingNames[name] = true
+
+			objects.clusterRoleBindings = append(objects.clusterRoleBindings, &rbacv1.ClusterRoleBinding{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        name,
+					Labels:      objectLabels,
+					Annotations: objectAnnotations,
+				},
+				RoleRef:  roleRef,
+				Subjects: subjects,
+			})
+		}
+	}
+
+	return objects, nil
+}
+
+func permissionObjectName(msaName, name string) string {
+	return permissionNamePrefix + msaName + ":" + name
+}
+
+// ownerLabels are the labels set on the objects created on the managed cluster for the
+// ManagedServiceAccount.
+func ownerLabels(msaNamespace, msaName string) map[string]string {
+	return map[string]string{
+		common.LabelKeyIsManagedServiceAccount:        "true",
+		common.LabelKeyManagedServiceAccountNamespace: msaNamespace,
+		common.LabelKeyManagedServiceAccountName:      common.ManagedServiceAccountNameLabelValue(msaName),
+	}
+}
+
+// ownerAnnotations are the annotations set on the objects created on the managed cluster for the
+// ManagedServiceAccount, they record the name which may be hashed in the labels.
+func ownerAnnotations(msaName string) map[string]string {
+	return map[string]string{
+		common.AnnotationKeyManagedServiceAccountName: msaName,
+	}
+}
+
+func containsObject[T metav1.Object](objects []T, namespace, name string) bool {
+	for _, obj := range objects {
+		if obj.GetNamespace() == namespace && obj.GetName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+func hasLabels(current, expected map[string]string) bool {
+	for k, v := range expected {
+		if current[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func mergeLabels(current, expected map[string]string) map[string]string {
+	merged := make(map[string]string, len(current)+len(expected))
+	for k, v := range current {
+		merged[k] = v
+	}
+	for k, v := range expected {
+		merged[k] = v
+	}
+	return merged
+}
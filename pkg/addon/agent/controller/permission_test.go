@@ -0,0 +1,440 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	fakekube "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/ptr"
+
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+	"open-cluster-management.io/managed-serviceaccount/pkg/common"
+)
+
+func TestBuildPermissionObjects(t *testing.T) {
+	rules := []rbacv1.PolicyRule{
+		{
+			APIGroups: []string{""},
+			Resources: []string{"pods"},
+			Verbs:     []string{"get"},
+		},
+	}
+
+	cases := []struct {
+		name                        string
+		permissions                 *authv1beta1.ManagedServiceAccountPermissions
+		expectedRoles               []string
+		expectedClusterRoles        []string
+		expectedRoleBindings        []string
+		expectedClusterRoleBindings []string
+		expectedError               string
+	}{
+		{
+			name: "no permissions",
+		},
+		{
+			name: "roles, cluster roles and role refs",
+			permissions: &authv1beta1.ManagedServiceAccountPermissions{
+				Roles: []authv1beta1.ManagedRole{
+					{Name: "reader", Namespace: "ns1", Rules: rules},
+				},
+				ClusterRoles: []authv1beta1.ManagedClusterRole{
+					{Name: "reader", Rules: rules},
+				},
+				RoleRefs: []authv1beta1.ManagedRoleRef{
+					{Kind: "Role", Name: "admin", Namespace: "ns2"},
+					{Kind: "ClusterRole", Name: "view", Namespace: "ns2"},
+					{Kind: "ClusterRole", Name: "view"},
+				},
+			},
+			expectedRoles: []string{
+				"ns1/open-cluster-management:managed-serviceaccount:msa1:reader",
+			},
+			expectedClusterRoles: []string{
+				"/open-cluster-management:managed-serviceaccount:msa1:reader",
+			},
+			expectedRoleBindings: []string{
+				"ns1/open-cluster-management:managed-serviceaccount:msa1:reader",
+				"ns2/open-cluster-management:managed-serviceaccount:msa1:role:admin",
+				"ns2/open-cluster-management:managed-serviceaccount:msa1:clusterrole:view",
+			},
+			expectedClusterRoleBindings: []string{
+				"/open-cluster-management:managed-serviceaccount:msa1:reader",
+				"/open-cluster-management:managed-serviceaccount:msa1:clusterrole:view",
+			},
+		},
+		{
+			name: "role ref without namespace",
+			permissions: &authv1beta1.ManagedServiceAccountPermissions{
+				RoleRefs: []authv1beta1.ManagedRoleRef{
+					{Kind: "Role", Name: "admin"},
+				},
+			},
+			expectedError: `namespace is required for the referenced role "admin"`,
+		},
+		{
+			name: "duplicated roles",
+			permissions: &authv1beta1.ManagedServiceAccountPermissions{
+				Roles: []authv1beta1.ManagedRole{
+					{Name: "reader", Namespace: "ns1", Rules: rules},
+					{Name: "reader", Namespace: "ns1"},
+				},
+			},
+			expectedError: `duplicated role "reader" in namespace "ns1"`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			msa := newManagedServiceAccount("cluster1", "msa1").build()
+			msa.Spec.Permissions = c.permissions
+
+			objects, err := buildPermissionObjects(msa, "sa-ns", "msa1")
+			if len(c.expectedError) > 0 {
+				assert.EqualError(t, err, c.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, c.expectedRoles, objectKeys(objects.roles))
+			assert.ElementsMatch(t, c.expectedClusterRoles, objectKeys(objects.clusterRoles))
+			assert.ElementsMatch(t, c.expectedRoleBindings, objectKeys(objects.roleBindings))
+			assert.ElementsMatch(t, c.expectedClusterRoleBindings, objectKeys(objects.clusterRoleBindings))
+
+			for _, rb := range objects.roleBindings {
+				assert.Equal(t, []rbacv1.Subject{
+					{Kind: rbacv1.ServiceAccountKind, Namespace: "sa-ns", Name: "msa1"},
+				}, rb.Subjects)
+			}
+		})
+	}
+}
+
+func TestSyncPermissions(t *testing.T) {
+	rules := []rbacv1.PolicyRule{
+		{
+			APIGroups: []string{""},
+			Resources: []string{"pods"},
+			Verbs:     []string{"get"},
+		},
+	}
+	roleName := "open-cluster-management:managed-serviceaccount:msa1:reader"
+	refName := "open-cluster-management:managed-serviceaccount:msa1:clusterrole:view"
+
+	cases := []struct {
+		name              string
+		permissions       *authv1beta1.ManagedServiceAccountPermissions
+		existingCondition bool
+		existing          []runtime.Object
+		notAllowed        bool
+		expectedCondition *metav1.ConditionStatus
+		expectedReason    string
+		validateFunc      func(t *testing.T, client kubernetes.Interface)
+	}{
+		{
+			name: "permissions not set",
+			validateFunc: func(t *testing.T, client kubernetes.Interface) {
+				assert.Empty(t, client.(*fakekube.Clientset).Actions())
+			},
+		},
+		{
+			name: "create permissions",
+			permissions: &authv1beta1.ManagedServiceAccountPermissions{
+				Roles: []authv1beta1.ManagedRole{
+					{Name: "reader", Namespace: "ns1", Rules: rules},
+				},
+				RoleRefs: []authv1beta1.ManagedRoleRef{
+					{Kind: "ClusterRole", Name: "view"},
+				},
+			},
+			expectedCondition: ptr.To(metav1.ConditionTrue),
+			validateFunc: func(t *testing.T, client kubernetes.Interface) {
+				role, err := client.RbacV1().Roles("ns1").Get(context.TODO(), roleName, metav1.GetOptions{})
+				assert.NoError(t, err)
+				assert.Equal(t, rules, role.Rules)
+				_, err = client.RbacV1().RoleBindings("ns1").Get(context.TODO(), roleName, metav1.GetOptions{})
+				assert.NoError(t, err)
+				crb, err := client.RbacV1().ClusterRoleBindings().Get(context.TODO(), refName, metav1.GetOptions{})
+				assert.NoError(t, err)
+				assert.Equal(t, "view", crb.RoleRef.Name)
+			},
+		},
+		{
+			name: "repair drifted rules and prune stale objects",
+			permissions: &authv1beta1.ManagedServiceAccountPermissions{
+				Roles: []authv1beta1.ManagedRole{
+					{Name: "reader", Namespace: "ns1", Rules: rules},
+				},
+			},
+			existingCondition: true,
+			existing: []runtime.Object{
+				&rbacv1.Role{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "ns1",
+						Name:      roleName,
+						Labels:    ownerLabels("cluster1", "msa1"),
+					},
+				},
+				&rbacv1.ClusterRoleBinding{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:   refName,
+						Labels: ownerLabels("cluster1", "msa1"),
+					},
+				},
+				&rbacv1.ClusterRoleBinding{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:   "open-cluster-management:managed-serviceaccount:msa2:clusterrole:view",
+						Labels: ownerLabels("cluster1", "msa2"),
+					},
+				},
+			},
+			expectedCondition: ptr.To(metav1.ConditionTrue),
+			validateFunc: func(t *testing.T, client kubernetes.Interface) {
+				role, err := client.RbacV1().Roles("ns1").Get(context.TODO(), roleName, metav1.GetOptions{})
+				assert.NoError(t, err)
+				assert.Equal(t, rules, role.Rules)
+				crbs, err := client.RbacV1().ClusterRoleBindings().List(context.TODO(), metav1.ListOptions{})
+				assert.NoError(t, err)
+				assert.Len(t, crbs.Items, 1, "only the binding of the other msa remains")
+				assert.Equal(t, "open-cluster-management:managed-serviceaccount:msa2:clusterrole:view", crbs.Items[0].Name)
+			},
+		},
+		{
+			name: "recreate binding with changed role ref",
+			permissions: &authv1beta1.ManagedServiceAccountPermissions{
+				RoleRefs: []authv1beta1.ManagedRoleRef{
+					{Kind: "ClusterRole", Name: "view"},
+				},
+			},
+			existing: []runtime.Object{
+				&rbacv1.ClusterRoleBinding{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:   refName,
+						Labels: ownerLabels("cluster1", "msa1"),
+					},
+					RoleRef: rbacv1.RoleRef{
+						APIGroup: rbacv1.GroupName,
+						Kind:     "ClusterRole",
+						Name:     "edit",
+					},
+				},
+			},
+			expectedCondition: ptr.To(metav1.ConditionTrue),
+			validateFunc: func(t *testing.T, client kubernetes.Interface) {
+				crb, err := client.RbacV1().ClusterRoleBindings().Get(context.TODO(), refName, metav1.GetOptions{})
+				assert.NoError(t, err)
+				assert.Equal(t, "view", crb.RoleRef.Name)
+			},
+		},
+		{
+			name: "refuse to take over objects not created for the msa",
+			permissions: &authv1beta1.ManagedServiceAccountPermissions{
+				Roles: []authv1beta1.ManagedRole{
+					{Name: "reader", Namespace: "ns1", Rules: rules},
+				},
+				RoleRefs: []authv1beta1.ManagedRoleRef{
+					{Kind: "ClusterRole", Name: "view"},
+				},
+			},
+			existing: []runtime.Object{
+				&rbacv1.Role{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: roleName},
+				},
+				&rbacv1.ClusterRoleBinding{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:   refName,
+						Labels: ownerLabels("cluster1", "msa2"),
+					},
+					RoleRef: rbacv1.RoleRef{
+						APIGroup: rbacv1.GroupName,
+						Kind:     "ClusterRole",
+						Name:     "cluster-admin",
+					},
+				},
+			},
+			expectedCondition: ptr.To(metav1.ConditionFalse),
+			expectedReason:    "PermissionsConflict",
+			validateFunc: func(t *testing.T, client kubernetes.Interface) {
+				role, err := client.RbacV1().Roles("ns1").Get(context.TODO(), roleName, metav1.GetOptions{})
+				assert.NoError(t, err)
+				assert.Empty(t, role.Rules)
+				assert.Empty(t, role.Labels)
+				crb, err := client.RbacV1().ClusterRoleBindings().Get(context.TODO(), refName, metav1.GetOptions{})
+				assert.NoError(t, err)
+				assert.Equal(t, "cluster-admin", crb.RoleRef.Name)
+				assert.Equal(t, ownerLabels("cluster1", "msa2"), crb.Labels)
+			},
+		},
+		{
+			name: "not permitted by the allowlist",
+			permissions: &authv1beta1.ManagedServiceAccountPermissions{
+				RoleRefs: []authv1beta1.ManagedRoleRef{
+					{Kind: "ClusterRole", Name: "view"},
+				},
+			},
+			existingCondition: true,
+			existing: []runtime.Object{
+				&rbacv1.ClusterRoleBinding{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:   refName,
+						Labels: ownerLabels("cluster1", "msa1"),
+					},
+				},
+			},
+			notAllowed:        true,
+			expectedCondition: ptr.To(metav1.ConditionFalse),
+			expectedReason:    "PermissionsNotAllowed",
+			validateFunc: func(t *testing.T, client kubernetes.Interface) {
+				crbs, err := client.RbacV1().ClusterRoleBindings().List(context.TODO(), metav1.ListOptions{})
+				assert.NoError(t, err)
+				assert.Empty(t, crbs.Items, "the granted permissions are pruned")
+			},
+		},
+		{
+			name: "role ref not permitted by the allowlist",
+			permissions: &authv1beta1.ManagedServiceAccountPermissions{
+				RoleRefs: []authv1beta1.ManagedRoleRef{
+					{Kind: "ClusterRole", Name: "view"},
+					{Kind: "ClusterRole", Name: "cluster-admin"},
+				},
+			},
+			expectedCondition: ptr.To(metav1.ConditionFalse),
+			expectedReason:    "PermissionsNotAllowed",
+			validateFunc: func(t *testing.T, client kubernetes.Interface) {
+				crbs, err := client.RbacV1().ClusterRoleBindings().List(context.TODO(), metav1.ListOptions{})
+				assert.NoError(t, err)
+				assert.Empty(t, crbs.Items)
+			},
+		},
+		{
+			name: "inline rules not permitted by the allowlist",
+			permissions: &authv1beta1.ManagedServiceAccountPermissions{
+				ClusterRoles: []authv1beta1.ManagedClusterRole{
+					{
+						Name: "admin",
+						Rules: []rbacv1.PolicyRule{
+							{APIGroups: []string{"*"}, Resources: []string{"*"}, Verbs: []string{"*"}},
+						},
+					},
+				},
+			},
+			expectedCondition: ptr.To(metav1.ConditionFalse),
+			expectedReason:    "PermissionsNotAllowed",
+			validateFunc: func(t *testing.T, client kubernetes.Interface) {
+				crs, err := client.RbacV1().ClusterRoles().List(context.TODO(), metav1.ListOptions{})
+				assert.NoError(t, err)
+				assert.Empty(t, crs.Items)
+			},
+		},
+		{
+			name:              "permissions removed",
+			existingCondition: true,
+			existing: []runtime.Object{
+				&rbacv1.ClusterRoleBinding{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:   refName,
+						Labels: ownerLabels("cluster1", "msa1"),
+					},
+				},
+			},
+			validateFunc: func(t *testing.T, client kubernetes.Interface) {
+				crbs, err := client.RbacV1().ClusterRoleBindings().List(context.TODO(), metav1.ListOptions{})
+				assert.NoError(t, err)
+				assert.Empty(t, crbs.Items)
+			},
+		},
+		{
+			name: "invalid permissions",
+			permissions: &authv1beta1.ManagedServiceAccountPermissions{
+				RoleRefs: []authv1beta1.ManagedRoleRef{
+					{Kind: "Role", Name: "admin"},
+				},
+			},
+			expectedCondition: ptr.To(metav1.ConditionFalse),
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			msa := newManagedServiceAccount("cluster1", "msa1").build()
+			msa.Spec.Permissions = c.permissions
+			if c.existingCondition {
+				meta.SetStatusCondition(&msa.Status.Conditions, metav1.Condition{
+					Type:   authv1beta1.ConditionTypePermissionsApplied,
+					Status: metav1.ConditionTrue,
+					Reason: "PermissionsApplied",
+				})
+			}
+
+			existing := c.existing
+			if !c.notAllowed {
+				existing = append(existing, &corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "sa-ns",
+						Name:      common.PermissionAllowlistConfigMapName,
+					},
+					Data: map[string]string{
+						common.PermissionAllowlistKey:             "sa-ns/msa1",
+						common.PermissionAllowlistClusterRolesKey: "view",
+						common.PermissionAllowlistRulesKey:        "get:pods",
+					},
+				})
+			}
+			fakeKubeClient := fakekube.NewSimpleClientset(existing...)
+			reconciler := TokenReconciler{
+				SpokeNativeClient: fakeKubeClient,
+				SpokeCache:        newFakeSpokeCache(fakeKubeClient),
+				SpokeNamespace:    "sa-ns",
+			}
+
+			err := reconciler.syncPermissions(context.TODO(), msa)
+			if c.expectedCondition != nil && *c.expectedCondition == metav1.ConditionFalse {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			condition := meta.FindStatusCondition(msa.Status.Conditions, authv1beta1.ConditionTypePermissionsApplied)
+			if c.expectedCondition == nil {
+				assert.Nil(t, condition)
+			} else if assert.NotNil(t, condition) {
+				assert.Equal(t, *c.expectedCondition, condition.Status)
+				if len(c.expectedReason) > 0 {
+					assert.Equal(t, c.expectedReason, condition.Reason)
+				}
+			}
+
+			if c.validateFunc != nil {
+				c.validateFunc(t, fakeKubeClient)
+			}
+		})
+	}
+}
+
+func TestDeniedRules(t *testing.T) {
+	rules := []rbacv1.PolicyRule{
+		{APIGroups: []string{"", "apps"}, Resources: []string{"pods", "deployments"}, Verbs: []string{"get"}},
+		{NonResourceURLs: []string{"/healthz"}, Verbs: []string{"get"}},
+		{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"*"}},
+	}
+	allowlist := "get:pods\nget:deployments.apps\nget:/healthz\nget:secrets"
+
+	assert.Equal(t, []string{"get:deployments", "get:pods.apps", "*:secrets"}, deniedRules(allowlist, rules))
+	assert.Empty(t, deniedRules("*:*\n*:*.*\n*:/*", rules))
+}
+
+func objectKeys[T metav1.Object](objects []T) []string {
+	keys := []string{}
+	for _, obj := range objects {
+		keys = append(keys, obj.GetNamespace()+"/"+obj.GetName())
+	}
+	return keys
+}
+
+func ptrTo[T any](v T) *T {
+	return &v
+}
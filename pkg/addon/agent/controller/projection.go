@@ -0,0 +1,155 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+	"open-cluster-management.io/managed-serviceaccount/pkg/common"
+)
+
+// isProjectionNone checks whether the token of the ManagedServiceAccount is kept out of the hub cluster.
+func isProjectionNone(managed *authv1beta1.ManagedServiceAccount) bool {
+	return managed.Spec.Projection != nil && managed.Spec.Projection.Type == authv1beta1.ProjectionTypeNone
+}
+
+// tokenSecretName returns the name of the token secret on the hub cluster, it defaults to the name
+// of the ManagedServiceAccount.
+func tokenSecretName(managed *authv1beta1.ManagedServiceAccount) string {
+	if projection := managed.Spec.Projection; projection != nil && projection.Secret != nil &&
+		len(projection.Secret.Name) > 0 {
+		return projection.Secret.Name
+	}
+	return managed.Name
+}
+
+// setSecretMetadata sets the labels, annotations and owner of the token secret. The labels and
+// annotations prescribed in the projection never override the ones reserved by the agent.
+func setSecretMetadata(managed *authv1beta1.ManagedServiceAccount, secret *corev1.Secret) {
+	if secret.Labels == nil {
+		secret.Labels = map[string]string{}
+	}
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	if projection := managed.Spec.Projection; projection != nil && projection.Secret != nil {
+		for k, v := range projection.Secret.Labels {
+			secret.Labels[k] = v
+		}
+		for k, v := range projection.Secret.Annotations {
+			secret.Annotations[k] = v
+		}
+	}
+
+	secret.Labels[common.LabelKeyIsManagedServiceAccount] = "true"
+	secret.Labels[common.LabelKeyManagedServiceAccountName] = common.ManagedServiceAccountNameLabelValue(managed.Name)
+	secret.Annotations[common.AnnotationKeyManagedServiceAccountName] = managed.Name
+
+	if tokenSpec := tokenSpecAnnotation(managed); len(tokenSpec) > 0 {
+		secret.Annotations[common.AnnotationKeyTokenSpec] = tokenSpec
+	} else {
+		delete(secret.Annotations, common.AnnotationKeyTokenSpec)
+	}
+
+	secret.OwnerReferences = []metav1.OwnerReference{
+		{
+			APIVersion: authv1beta1.GroupVersion.String(),
+			Kind:       "ManagedServiceAccount",
+			Name:       managed.Name,
+			UID:        managed.UID,
+		},
+	}
+}
+
+// syncTokenSecret updates the metadata and the data of the token secret if they drift from the
+// projection. The secret is decrypted, and encrypted tells whether it is stored encrypted.
+func (r *TokenReconciler) syncTokenSecret(ctx context.Context, managed *authv1beta1.ManagedServiceAccount,
+	secret *corev1.Secret, encrypted bool, data map[string][]byte) error {
+	desired := secret.DeepCopy()
+	setSecretMetadata(managed, desired)
+	desired.Data = data
+	retainPreviousToken(managed, secret, desired, metav1.Now())
+	if equality.Semantic.DeepEqual(secret.ObjectMeta, desired.ObjectMeta) &&
+		equality.Semantic.DeepEqual(secret.Data, desired.Data) && encrypted == isEnvelopeEncryption(managed) {
+		return nil
+	}
+	if err := r.sealTokenSecret(ctx, managed, desired); err != nil {
+		return errors.Wrapf(err, "failed to encrypt the token secret")
+	}
+	if err := r.HubClient.Update(ctx, desired); err != nil {
+		return errors.Wrapf(err, "failed to update the token secret")
+	}
+	return nil
+}
+
+// deleteStaleTokenSecret deletes the token secret reported in the status if it is not the desired one
+// any more, e.g. the secret is renamed or the token is not projected.
+func (r *TokenReconciler) deleteStaleTokenSecret(ctx context.Context,
+	managed *authv1beta1.ManagedServiceAccount, desired string) error {
+	if managed.Status.TokenSecretRef == nil || managed.Status.TokenSecretRef.Name == desired {
+		return nil
+	}
+	secret := &corev1.Secret{}
+	if err := r.HubClient.Get(ctx, types.NamespacedName{
+		Namespace: managed.Namespace,
+		Name:      managed.Status.TokenSecretRef.Name,
+	}, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "failed to get the stale token secret")
+	}
+	// the status may be stale or tampered with, keep the secrets not created for the ManagedServiceAccount
+	if !isTokenSecretOwnedBy(secret, managed) {
+		return nil
+	}
+	// the precondition keeps a secret recreated by others in the meantime
+	if err := r.HubClient.Delete(ctx, secret, client.Preconditions{UID: &secret.UID}); err != nil &&
+		!apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "failed to delete the stale token secret")
+	}
+	return nil
+}
+
+// isTokenSecretOwnedBy checks whether the secret is labeled as a token secret and owned by the
+// ManagedServiceAccount.
+func isTokenSecretOwnedBy(secret *corev1.Secret, managed *authv1beta1.ManagedServiceAccount) bool {
+	if secret.Labels[common.LabelKeyIsManagedServiceAccount] != "true" {
+		return false
+	}
+	for _, ref := range secret.OwnerReferences {
+		if ref.Kind == "ManagedServiceAccount" && ref.Name == managed.Name && ref.UID == managed.UID {
+			return true
+		}
+	}
+	return false
+}
+
+// setManagedServiceAccountNoProjectionStatus resets the token status of the ManagedServiceAccount
+// whose token is not projected on the hub cluster.
+func setManagedServiceAccountNoProjectionStatus(msaCopy *authv1beta1.ManagedServiceAccount) {
+	meta.RemoveStatusCondition(&msaCopy.Status.Conditions, authv1beta1.ConditionTypeSecretCreated)
+	meta.SetStatusCondition(&msaCopy.Status.Conditions, metav1.Condition{
+		Type:    authv1beta1.ConditionTypeTokenReported,
+		Status:  metav1.ConditionFalse,
+		Reason:  "TokenNotProjected",
+		Message: "The token is not projected on the hub cluster",
+	})
+	msaCopy.Status.ExpirationTimestamp = nil
+	msaCopy.Status.TokenSecretRef = nil
+	msaCopy.Status.TokenAudiences = nil
+	msaCopy.Status.TokenIssuer = ""
+	msaCopy.Status.ServiceAccountUID = ""
+	msaCopy.Status.EffectiveValidity = nil
+	msaCopy.Status.NextRotationTimestamp = nil
+	clearSinkStatus(msaCopy)
+	setManagedServiceAccountReadyCondition(msaCopy)
+}
@@ -0,0 +1,227 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+	"open-cluster-management.io/managed-serviceaccount/pkg/common"
+)
+
+// isRevocationRequested checks whether the spec.revocationGeneration is not handled yet.
+func isRevocationRequested(managed *authv1beta1.ManagedServiceAccount) bool {
+	var revoked int64
+	if managed.Status.LastRevocation != nil {
+		revoked = managed.Status.LastRevocation.Generation
+	}
+	return managed.Spec.RevocationGeneration > revoked
+}
+
+// revokeTokens invalidates all the outstanding tokens of the ManagedServiceAccount by deleting the
+// ServiceAccount on the managed cluster, which is recreated by the reconciler afterwards. The revoked tokens are
+// removed from the token secret and the revocation is recorded in the status, so that a fresh
+// token is issued.
+func (r *TokenReconciler) revokeTokens(ctx context.Context, managed *authv1beta1.ManagedServiceAccount) error {
+	logger := log.FromContext(ctx)
+	saNamespace, saName := r.serviceAccountOf(managed)
+	if isAdoptionMode(managed) {
+		return r.refuseRevocation(ctx, managed,
+			fmt.Sprintf("tokens of the adopted service account %s/%s cannot be revoked", saNamespace, saName))
+	}
+	if isClientCertificate(managed) {
+		return r.refuseRevocation(ctx, managed,
+			fmt.Sprintf("client certificates of the service account %s/%s cannot be revoked", saNamespace, saName))
+	}
+
+	// only the service account created for this ManagedServiceAccount is deleted, a foreign service
+	// account placed by spec.serviceAccount or colliding with the default one is left untouched
+	saclient := r.SpokeNativeClient.CoreV1().ServiceAccounts(saNamespace)
+	sa, err := saclient.Get(ctx, saName, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		sa = nil
+	case err != nil:
+		return errors.Wrapf(err, "failed to get service account to revoke tokens")
+	case !isServiceAccountRevocable(sa, managed):
+		return r.refuseRevocation(ctx, managed,
+			fmt.Sprintf("service account %s/%s is not managed by the ManagedServiceAccount", saNamespace, saName))
+	}
+
+	secret := &corev1.Secret{}
+	if err := r.HubClient.Get(ctx, types.NamespacedName{
+		Namespace: managed.Namespace,
+		Name:      tokenSecretName(managed),
+	}, secret); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return errors.Wrapf(err, "failed to read current token secret from hub cluster")
+		}
+		secret = nil
+	}
+	secret, err = r.Envelope.DecryptSecret(ctx, secret)
+	if err != nil {
+		return errors.Wrapf(err, "failed to decrypt the token secret")
+	}
+
+	if sa != nil {
+		// the precondition keeps a service account recreated by others in the meantime
+		if err := saclient.Delete(ctx, saName, metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{UID: &sa.UID},
+		}); err != nil && !apierrors.IsNotFound(err) {
+			return errors.Wrapf(err, "failed to delete service account to revoke tokens")
+		}
+	}
+
+	revokedTokenIDs := []string{}
+	if secret != nil {
+		for _, key := range []string{corev1.ServiceAccountTokenKey, common.SecretKeyPreviousToken} {
+			if id := tokenID(secret.Data[key]); len(id) > 0 {
+				revokedTokenIDs = append(revokedTokenIDs, id)
+			}
+		}
+
+		// the revoked tokens are useless to the consumers, and must not be kept as the previous token
+		revoked := secret.DeepCopy()
+		delete(revoked.Data, corev1.ServiceAccountTokenKey)
+		delete(revoked.Data, common.SecretKeyPreviousToken)
+		delete(revoked.Data, common.SecretKeyKubeconfig)
+		delete(revoked.Annotations, common.AnnotationKeyPreviousTokenExpiration)
+		if err := r.sealTokenSecret(ctx, managed, revoked); err != nil {
+			return errors.Wrapf(err, "failed to encrypt the token secret")
+		}
+		if err := r.HubClient.Update(ctx, revoked); err != nil {
+			return errors.Wrapf(err, "failed to remove the revoked tokens from the token secret")
+		}
+	}
+
+	managed.Status.LastRevocation = &authv1beta1.TokenRevocation{
+		Generation:      managed.Spec.RevocationGeneration,
+		Timestamp:       metav1.Now(),
+		RevokedTokenIDs: revokedTokenIDs,
+	}
+	meta.SetStatusCondition(&managed.Status.Conditions, metav1.Condition{
+		Type:    authv1beta1.ConditionTypeTokensRevoked,
+		Status:  metav1.ConditionTrue,
+		Reason:  "TokensRevoked",
+		Message: fmt.Sprintf("Revoked the tokens at generation %d", managed.Spec.RevocationGeneration),
+	})
+	// force to issue a fresh token
+	managed.Status.ExpirationTimestamp = nil
+	if err := r.updateStatus(ctx, managed); err != nil {
+		return err
+	}
+	r.EventRecorder.Eventf(managed, nil, corev1.EventTypeNormal, common.EventReasonTokensRevoked, "Revoke",
+		"Revoked the tokens of the service account %s/%s at generation %d",
+		saNamespace, saName, managed.Spec.RevocationGeneration)
+	logger.Info("Tokens revoked", "generation", managed.Spec.RevocationGeneration, "tokenIDs", revokedTokenIDs)
+	return nil
+}
+
+// isServiceAccountRevocable checks whether the ServiceAccount is created for the
+// ManagedServiceAccount, including the default ServiceAccount created by the former agents which is
+// only labeled with LabelKeyIsManagedServiceAccount.
+func isServiceAccountRevocable(sa *corev1.ServiceAccount, managed *authv1beta1.ManagedServiceAccount) bool {
+	if isServiceAccountOwnedBy(sa, managed.Namespace, managed.Name) {
+		return true
+	}
+	return managed.Spec.ServiceAccount == nil &&
+		sa.Labels[common.LabelKeyIsManagedServiceAccount] == "true" &&
+		len(sa.Labels[common.LabelKeyManagedServiceAccountName]) == 0
+}
+
+// refuseRevocation records the revocation as handled without revoking anything, so that the
+// tokens keep being issued, and reports the reason in the TokensRevoked condition.
+func (r *TokenReconciler) refuseRevocation(ctx context.Context, managed *authv1beta1.ManagedServiceAccount,
+	message string) error {
+	managed.Status.LastRevocation = &authv1beta1.TokenRevocation{
+		Generation: managed.Spec.RevocationGeneration,
+		Timestamp:  metav1.Now(),
+	}
+	meta.SetStatusCondition(&managed.Status.Conditions, metav1.Condition{
+		Type:    authv1beta1.ConditionTypeTokensRevoked,
+		Status:  metav1.ConditionFalse,
+		Reason:  "RevocationNotSupported",
+		Message: message,
+	})
+	if err := r.updateStatus(ctx, managed); err != nil {
+		return err
+	}
+	log.FromContext(ctx).Info("Revocation refused", "generation", managed.Spec.RevocationGeneration, "reason", message)
+	return nil
+}
+
+// tokenID returns the "jti" claim of the token, or an empty string if the token cannot be decoded.
+func tokenID(token []byte) string {
+	payload, err := decodeTokenPayload(string(token))
+	if err != nil {
+		return ""
+	}
+	claims := &tokenClaims{}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return ""
+	}
+	return claims.ID
+}
+
+// requestedCredentialRevocation returns the CredentialRevocation dispatched to the ManagedServiceAccount
+// by the annotations set by the manager, or nil if none is dispatched.
+func requestedCredentialRevocation(managed *authv1beta1.ManagedServiceAccount) *authv1beta1.CredentialRevocationReference {
+	name, ok := managed.Annotations[common.AnnotationKeyCredentialRevocation]
+	if !ok {
+		return nil
+	}
+	generation, err := strconv.ParseInt(managed.Annotations[common.AnnotationKeyCredentialRevocationGeneration], 10, 64)
+	if err != nil {
+		return nil
+	}
+	return &authv1beta1.CredentialRevocationReference{
+		Name:       name,
+		UID:        types.UID(managed.Annotations[common.AnnotationKeyCredentialRevocationUID]),
+		Generation: generation,
+	}
+}
+
+// isCredentialRevocationPending checks whether the CredentialRevocation dispatched to the
+// ManagedServiceAccount is not echoed in the status yet.
+func isCredentialRevocationPending(managed *authv1beta1.ManagedServiceAccount) bool {
+	requested := requestedCredentialRevocation(managed)
+	last := managed.Status.LastCredentialRevocation
+	return requested != nil && (last == nil || *last != *requested)
+}
+
+// observeCredentialRevocation echoes the CredentialRevocation dispatched to the ManagedServiceAccount in
+// the status, it is called once the token is revoked or re-issued so that the manager counts the
+// ManagedServiceAccount as handled.
+func observeCredentialRevocation(managed *authv1beta1.ManagedServiceAccount) {
+	if requested := requestedCredentialRevocation(managed); requested != nil {
+		managed.Status.LastCredentialRevocation = requested
+	}
+}
+
+// isReissueRequested checks whether a CredentialRevocation dispatched to the ManagedServiceAccount is
+// not handled yet, or the token is issued before the time requested by the reissue-after annotation.
+func isReissueRequested(managed *authv1beta1.ManagedServiceAccount) bool {
+	if isCredentialRevocationPending(managed) {
+		return true
+	}
+	value, ok := managed.Annotations[common.AnnotationKeyReissueAfter]
+	if !ok {
+		return false
+	}
+	reissueAfter, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return false
+	}
+	lastRefresh := lastRefreshTimestamp(managed)
+	return lastRefresh == nil || lastRefresh.Time.Before(reissueAfter)
+}
@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"time"
+
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+	"open-cluster-management.io/managed-serviceaccount/pkg/util"
+)
+
+// minRemainingLifetime is the shortest remaining lifetime of the token at which the rotation may
+// be postponed to a rotation window.
+const minRemainingLifetime = 10 * time.Minute
+
+// nextRotationTime returns the time to rotate the token issued at lastRefresh and expiring at
+// expiring. The rotation is postponed to the next rotation window if the threshold prescribed by
+// the refreshBefore is out of the windows, unless no window opens early enough before the token
+// expires.
+func nextRotationTime(rotation authv1beta1.ManagedServiceAccountRotation, lastRefresh, expiring time.Time) time.Time {
+	// the refreshBefore is validated on admission, fall back to the default if it is invalid anyway
+	refreshBefore, err := util.ParseRefreshBefore(rotation.RefreshBefore)
+	if err != nil {
+		refreshBefore, _ = util.ParseRefreshBefore(util.DefaultRefreshBefore)
+	}
+	threshold := refreshBefore.Threshold(lastRefresh, expiring)
+
+	window := rotation.Window
+	if window == nil {
+		return threshold
+	}
+	schedule, err := util.ParseSchedule(window.Schedule)
+	if err != nil {
+		return threshold
+	}
+	threshold = threshold.UTC()
+
+	// the threshold is in the window opened at the last schedule time within the duration before it
+	if opened := schedule.Next(threshold.Add(-window.Duration.Duration)); !opened.IsZero() && !opened.After(threshold) {
+		return threshold
+	}
+	if opened := schedule.Next(threshold); !opened.IsZero() && opened.Before(expiring.Add(-minRemainingLifetime)) {
+		return opened
+	}
+	return threshold
+}
@@ -0,0 +1,274 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+	"open-cluster-management.io/managed-serviceaccount/pkg/common"
+	"open-cluster-management.io/managed-serviceaccount/pkg/metrics"
+	"open-cluster-management.io/managed-serviceaccount/pkg/sink"
+)
+
+// hasSink checks whether the credentials of the ManagedServiceAccount are delivered to a sink.
+func hasSink(managed *authv1beta1.ManagedServiceAccount) bool {
+	return managed.Spec.Projection != nil && managed.Spec.Projection.Sink != nil
+}
+
+// lastRefreshTimestamp returns the time the current credential is issued, which is recorded in the
+// token secret reference, or in the sink status if the credential is only delivered to the sink.
+func lastRefreshTimestamp(managed *authv1beta1.ManagedServiceAccount) *metav1.Time {
+	if managed.Status.TokenSecretRef != nil {
+		return &managed.Status.TokenSecretRef.LastRefreshTimestamp
+	}
+	if isProjectionNone(managed) && managed.Status.Sink != nil {
+		return managed.Status.Sink.LastDeliveryTimestamp
+	}
+	return nil
+}
+
+// clearSinkStatus removes the sink status of the ManagedServiceAccount without a sink.
+func clearSinkStatus(managed *authv1beta1.ManagedServiceAccount) {
+	managed.Status.Sink = nil
+	meta.RemoveStatusCondition(&managed.Status.Conditions, authv1beta1.ConditionTypeSinkDelivered)
+}
+
+// sinkOf builds the sink configured with the name in the sink ConfigMap in the agent namespace.
+func (r *TokenReconciler) sinkOf(ctx context.Context, name string) (sink.Sink, error) {
+	cm, err := r.SpokeNativeClient.CoreV1().ConfigMaps(r.SpokeNamespace).Get(
+		ctx, common.SinkConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("sink configmap %s/%s is not found", r.SpokeNamespace, common.SinkConfigMapName)
+		}
+		return nil, errors.Wrapf(err, "failed to get the sink configmap")
+	}
+	data, ok := cm.Data[name]
+	if !ok {
+		return nil, fmt.Errorf("sink %q is not configured in the configmap %s/%s",
+			name, r.SpokeNamespace, common.SinkConfigMapName)
+	}
+	config, err := sink.Parse(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "sink %q", name)
+	}
+
+	var token string
+	if len(config.TokenSecretName) > 0 {
+		secret, err := r.SpokeNativeClient.CoreV1().Secrets(r.SpokeNamespace).Get(
+			ctx, config.TokenSecretName, metav1.GetOptions{})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get the token secret of sink %q", name)
+		}
+		token = string(secret.Data[common.SinkTokenSecretKey])
+	}
+	return sink.New(config, token)
+}
+
+// deliverCredential delivers the credential to the sink of the ManagedServiceAccount, the result is
+// recorded in the SinkDelivered condition and the sink status.
+func (r *TokenReconciler) deliverCredential(ctx context.Context, managed *authv1beta1.ManagedServiceAccount,
+	data map[string][]byte, expiring metav1.Time, now metav1.Time) error {
+	name := managed.Spec.Projection.Sink.Name
+	err := func() error {
+		s, err := r.sinkOf(ctx, name)
+		if err != nil {
+			return err
+		}
+		return s.Deliver(ctx, &sink.Credential{
+			ClusterName:         managed.Namespace,
+			Name:                managed.Name,
+			ExpirationTimestamp: expiring.Time,
+			Data:                data,
+		})
+	}()
+	if err != nil {
+		metrics.SinkDeliveryFailures.WithLabelValues(managed.Namespace, managed.Name, name).Inc()
+		r.EventRecorder.Eventf(managed, nil, corev1.EventTypeWarning, common.EventReasonSinkDeliveryFailed, "Deliver",
+			"Failed to deliver the %s to the sink %s: %v", credentialKind(managed), name, err)
+		meta.SetStatusCondition(&managed.Status.Conditions, metav1.Condition{
+			Type:    authv1beta1.ConditionTypeSinkDelivered,
+			Status:  metav1.ConditionFalse,
+			Reason:  "SinkDeliveryFailed",
+			Message: err.Error(),
+		})
+		return errors.Wrapf(err, "failed to deliver the credential to the sink %s", name)
+	}
+
+	meta.SetStatusCondition(&managed.Status.Conditions, metav1.Condition{
+		Type:    authv1beta1.ConditionTypeSinkDelivered,
+		Status:  metav1.ConditionTrue,
+		Reason:  "SinkDelivered",
+		Message: fmt.Sprintf("The %s is delivered to the sink %s", credentialKind(managed), name),
+	})
+	managed.Status.Sink = &authv1beta1.SinkStatus{
+		Name:                  name,
+		LastDeliveryTimestamp: &now,
+	}
+	return nil
+}
+
+// syncSink delivers the credential in the token secret to the sink, unless it is delivered already.
+func (r *TokenReconciler) syncSink(ctx context.Context, managed *authv1beta1.ManagedServiceAccount,
+	now metav1.Time) error {
+	if !hasSink(managed) {
+		clearSinkStatus(managed)
+		return nil
+	}
+	status := managed.Status.Sink
+	if status != nil && status.Name == managed.Spec.Projection.Sink.Name && status.LastDeliveryTimestamp != nil &&
+		!status.LastDeliveryTimestamp.Before(&managed.Status.TokenSecretRef.LastRefreshTimestamp) &&
+		meta.IsStatusConditionTrue(managed.Status.Conditions, authv1beta1.ConditionTypeSinkDelivered) {
+		return nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := r.HubClient.Get(ctx, types.NamespacedName{
+		Namespace: managed.Namespace,
+		Name:      managed.Status.TokenSecretRef.Name,
+	}, secret); err != nil {
+		return errors.Wrapf(err, "failed to read current token secret from hub cluster")
+	}
+	secret, err := r.Envelope.DecryptSecret(ctx, secret)
+	if err != nil {
+		return errors.Wrapf(err, "failed to decrypt the token secret")
+	}
+	data := map[string][]byte{}
+	for key, value := range secret.Data {
+		// the previous token is never delivered, it is replaced in the sink
+		if key != common.SecretKeyPreviousToken {
+			data[key] = value
+		}
+	}
+	return r.deliverCredential(ctx, managed, data, *managed.Status.ExpirationTimestamp, now)
+}
+
+// isSinkIssueDue checks whether a credential has to be issued for the ManagedServiceAccount whose
+// credentials are only delivered to the sink. Without a token secret to compare with, any change of
+// the spec re-issues the credential.
+func isSinkIssueDue(managed *authv1beta1.ManagedServiceAccount, now metav1.Time) bool {
+	status := managed.Status.Sink
+	if status == nil || status.Name != managed.Spec.Projection.Sink.Name || status.LastDeliveryTimestamp == nil ||
+		managed.Status.ExpirationTimestamp == nil ||
+		!meta.IsStatusConditionTrue(managed.Status.Conditions, authv1beta1.ConditionTypeSinkDelivered) {
+		return true
+	}
+	if managed.Status.ObservedGeneration != managed.Generation || isReissueRequested(managed) {
+		return true
+	}
+	exceed, _ := exceedThreshold(now, managed.Spec.Rotation, *managed.Status.ExpirationTimestamp,
+		*status.LastDeliveryTimestamp)
+	return exceed
+}
+
+// reconcileSinkOnly issues the credentials of the ManagedServiceAccount which are only delivered to
+// the sink, without a token secret on the hub cluster. The rotation is tracked by the sink status
+// instead of the token secret reference.
+func (r *TokenReconciler) reconcileSinkOnly(ctx context.Context, msa, msaCopy *authv1beta1.ManagedServiceAccount,
+	permissionErr error) (reconcile.Result, error) {
+	if err := r.deleteStaleTokenSecret(ctx, msa, ""); err != nil {
+		return reconcile.Result{}, err
+	}
+	meta.RemoveStatusCondition(&msaCopy.Status.Conditions, authv1beta1.ConditionTypeSecretCreated)
+	meta.SetStatusCondition(&msaCopy.Status.Conditions, metav1.Condition{
+		Type:    authv1beta1.ConditionTypeTokenReported,
+		Status:  metav1.ConditionFalse,
+		Reason:  "TokenNotProjected",
+		Message: "The token is not projected on the hub cluster",
+	})
+	msaCopy.Status.TokenSecretRef = nil
+
+	now := metav1.Now()
+	var syncErr error
+	if isSinkIssueDue(msa, now) {
+		syncErr = r.issueToSink(ctx, msaCopy, now)
+	}
+	if syncErr == nil {
+		observeCredentialRevocation(msaCopy)
+	}
+	setManagedServiceAccountReadyCondition(msaCopy)
+
+	if !equality.Semantic.DeepEqual(msa.Status, msaCopy.Status) {
+		if err := r.updateStatus(ctx, msaCopy); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+	if errors.Is(syncErr, errCertificatePending) {
+		// the certificate is delivered once it is collected
+		if permissionErr != nil {
+			return reconcile.Result{}, errors.Wrapf(permissionErr, "failed to sync permissions")
+		}
+		return reconcile.Result{RequeueAfter: certificateIssueInterval}, nil
+	}
+	if syncErr != nil {
+		return reconcile.Result{}, syncErr
+	}
+
+	lastDelivery := msaCopy.Status.Sink.LastDeliveryTimestamp
+	metrics.Tokens.Set(msaCopy.Namespace, msaCopy.Name, lastDelivery.Time, msaCopy.Status.ExpirationTimestamp.Time)
+	if permissionErr != nil {
+		return reconcile.Result{}, errors.Wrapf(permissionErr, "failed to sync permissions")
+	}
+	return reconcile.Result{RequeueAfter: checkTokenRefreshAfter(now, msaCopy.Spec.Rotation,
+		*msaCopy.Status.ExpirationTimestamp, *lastDelivery)}, nil
+}
+
+// issueToSink issues a fresh credential and delivers it to the sink.
+func (r *TokenReconciler) issueToSink(ctx context.Context, managed *authv1beta1.ManagedServiceAccount,
+	now metav1.Time) error {
+	logger := log.FromContext(ctx)
+	credential, expiring, err := r.issueCredential(ctx, managed)
+	if errors.Is(err, errCertificatePending) {
+		return err
+	}
+	if err != nil {
+		meta.SetStatusCondition(&managed.Status.Conditions, metav1.Condition{
+			Type:    authv1beta1.ConditionTypeSinkDelivered,
+			Status:  metav1.ConditionFalse,
+			Reason:  "CredentialIssueFailed",
+			Message: err.Error(),
+		})
+		return errors.Wrapf(err, "failed to sync token")
+	}
+	caData, err := r.spokeCAData()
+	if err != nil {
+		return err
+	}
+	data, err := r.secretData(ctx, managed, caData, credential)
+	if err != nil {
+		return err
+	}
+	if err := r.deliverCredential(ctx, managed, data, expiring, now); err != nil {
+		return err
+	}
+
+	rotated := managed.Status.ExpirationTimestamp != nil
+	managed.Status.RotationCount++
+	setCredentialStatus(managed, credential)
+	setRotationStatus(managed, &expiring, now)
+
+	metrics.TokenRotations.WithLabelValues(managed.Namespace, managed.Name).Inc()
+	kind := credentialKind(managed)
+	if rotated {
+		r.EventRecorder.Eventf(managed, nil, corev1.EventTypeNormal, common.EventReasonTokenRotated, "RotateToken",
+			"Rotated the %s in the sink %s, the new %s expires at %s", kind, managed.Status.Sink.Name, kind,
+			expiring.UTC().Format(time.RFC3339))
+	} else {
+		r.EventRecorder.Eventf(managed, nil, corev1.EventTypeNormal, common.EventReasonTokenIssued, "IssueToken",
+			"Issued the %s to the sink %s, it expires at %s", kind, managed.Status.Sink.Name,
+			expiring.UTC().Format(time.RFC3339))
+	}
+	logger.Info("Token delivered to the sink", "sink", managed.Status.Sink.Name, "expirationTimestamp", expiring)
+	return nil
+}
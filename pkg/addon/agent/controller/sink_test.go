@@ -0,0 +1,244 @@
+package controller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	authv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	fakekube "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/events"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+	"open-cluster-management.io/managed-serviceaccount/pkg/common"
+)
+
+func TestReconcileSink(t *testing.T) {
+	clusterName := "cluster1"
+	msaName := "msa1"
+	spokeNamespace := "open-cluster-management-agent-addon"
+	now := time.Now()
+	existingToken := newFakeToken(spokeNamespace, msaName)
+
+	withSink := func(projectionType authv1beta1.ProjectionType) func(*authv1beta1.ManagedServiceAccount) {
+		return func(msa *authv1beta1.ManagedServiceAccount) {
+			msa.Spec.Projection = &authv1beta1.ManagedServiceAccountProjection{
+				Type: projectionType,
+				Sink: &authv1beta1.SinkReference{Name: "local"},
+			}
+		}
+	}
+	delivered := func(msa *authv1beta1.ManagedServiceAccount) {
+		msa.Status.Sink = &authv1beta1.SinkStatus{
+			Name:                  "local",
+			LastDeliveryTimestamp: &metav1.Time{Time: now.Add(-10 * time.Minute)},
+		}
+		msa.Status.ExpirationTimestamp = &metav1.Time{Time: now.Add(50 * time.Minute)}
+		msa.Status.Conditions = []metav1.Condition{
+			{Type: authv1beta1.ConditionTypeSinkDelivered, Status: metav1.ConditionTrue, Reason: "SinkDelivered"},
+		}
+	}
+	newMSA := func(modifiers ...func(*authv1beta1.ManagedServiceAccount)) *authv1beta1.ManagedServiceAccount {
+		msa := newManagedServiceAccount(clusterName, msaName).withRotationValidity(time.Hour).build()
+		for _, modifier := range modifiers {
+			modifier(msa)
+		}
+		return msa
+	}
+
+	cases := []struct {
+		name              string
+		msa               *authv1beta1.ManagedServiceAccount
+		secret            *corev1.Secret
+		noSinkConfig      bool
+		expectedError     string
+		expectedIssued    bool
+		expectedDelivered string
+		expectedSecret    bool
+		expectedReady     metav1.Condition
+	}{
+		{
+			name:              "secret projection",
+			msa:               newMSA(withSink(authv1beta1.ProjectionTypeSecret)),
+			expectedIssued:    true,
+			expectedDelivered: "new-token",
+			expectedSecret:    true,
+			expectedReady:     metav1.Condition{Status: metav1.ConditionTrue, Reason: "Ready"},
+		},
+		{
+			name: "secret projection pending delivery",
+			msa: func() *authv1beta1.ManagedServiceAccount {
+				msa := newMSA(withSink(authv1beta1.ProjectionTypeSecret))
+				return (&managedServiceAccountBuilder{msa: msa}).
+					withTokenSecretRef(msaName, now.Add(50*time.Minute), now.Add(-10*time.Minute)).build()
+			}(),
+			secret:            newSecret(clusterName, msaName, existingToken, "ca1"),
+			expectedDelivered: existingToken,
+			expectedSecret:    true,
+			expectedReady:     metav1.Condition{Status: metav1.ConditionTrue, Reason: "Ready"},
+		},
+		{
+			name:          "secret projection sink not configured",
+			msa:           newMSA(withSink(authv1beta1.ProjectionTypeSecret)),
+			noSinkConfig:  true,
+			expectedError: "failed to deliver the credential to the sink local: sink configmap",
+			// the token is still projected in the secret
+			expectedIssued: true,
+			expectedSecret: true,
+			expectedReady:  metav1.Condition{Status: metav1.ConditionFalse, Reason: "SinkNotDelivered"},
+		},
+		{
+			name: "sink only",
+			// the token secret projected before is removed
+			msa: func() *authv1beta1.ManagedServiceAccount {
+				msa := newMSA(withSink(authv1beta1.ProjectionTypeNone))
+				return (&managedServiceAccountBuilder{msa: msa}).
+					withTokenSecretRef(msaName, now.Add(50*time.Minute), now.Add(-10*time.Minute)).build()
+			}(),
+			secret: newSecret(clusterName, msaName, existingToken, "ca1",
+				withTokenSecretOwner(newMSA(withSink(authv1beta1.ProjectionTypeNone)))),
+			expectedIssued:    true,
+			expectedDelivered: "new-token",
+			expectedReady:     metav1.Condition{Status: metav1.ConditionTrue, Reason: "Ready"},
+		},
+		{
+			name:          "sink only not delivered",
+			msa:           newMSA(withSink(authv1beta1.ProjectionTypeNone)),
+			noSinkConfig:  true,
+			expectedError: "failed to deliver the credential to the sink local",
+			// the token is issued and dropped
+			expectedIssued: true,
+			expectedReady:  metav1.Condition{Status: metav1.ConditionFalse, Reason: "SinkNotDelivered"},
+		},
+		{
+			name:          "sink only delivered",
+			msa:           newMSA(withSink(authv1beta1.ProjectionTypeNone), delivered),
+			expectedReady: metav1.Condition{Status: metav1.ConditionTrue, Reason: "Ready"},
+		},
+		{
+			name: "sink only spec changed",
+			msa: newMSA(withSink(authv1beta1.ProjectionTypeNone), delivered, func(msa *authv1beta1.ManagedServiceAccount) {
+				msa.Generation = 2
+				msa.Status.ObservedGeneration = 1
+			}),
+			expectedIssued:    true,
+			expectedDelivered: "new-token",
+			expectedReady:     metav1.Condition{Status: metav1.ConditionTrue, Reason: "Ready"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			sinkDir := t.TempDir()
+			objs := []runtime.Object{}
+			if !c.noSinkConfig {
+				objs = append(objs, &corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Namespace: spokeNamespace, Name: common.SinkConfigMapName},
+					Data: map[string]string{
+						"local": "type: Directory\ndirectory:\n  path: " + sinkDir,
+					},
+				})
+			}
+			fakeKubeClient := fakekube.NewSimpleClientset(objs...)
+			fakeKubeClient.PrependReactor("create", "serviceaccounts",
+				func(action clienttesting.Action) (bool, runtime.Object, error) {
+					if action.GetSubresource() != "token" {
+						return false, nil, nil
+					}
+					return true, &authv1.TokenRequest{
+						Status: authv1.TokenRequestStatus{
+							Token:               "new-token",
+							ExpirationTimestamp: metav1.NewTime(time.Now().Add(time.Hour)),
+						},
+					}, nil
+				})
+			fakeKubeClient.PrependReactor("create", "tokenreviews",
+				func(action clienttesting.Action) (bool, runtime.Object, error) {
+					return true, &authv1.TokenReview{Status: authv1.TokenReviewStatus{Authenticated: true}}, nil
+				})
+
+			testscheme := runtime.NewScheme()
+			authv1beta1.AddToScheme(testscheme)
+			corev1.AddToScheme(testscheme)
+			objects := []client.Object{c.msa}
+			if c.secret != nil {
+				objects = append(objects, c.secret)
+			}
+			hubClient := fake.NewClientBuilder().WithScheme(testscheme).WithObjects(objects...).
+				WithStatusSubresource(objects...).Build()
+			reconciler := TokenReconciler{
+				Cache:             &fakeCache{msa: c.msa},
+				SpokeNativeClient: fakeKubeClient,
+				SpokeCache:        newFakeSpokeCache(fakeKubeClient),
+				HubClient:         hubClient,
+				SpokeClientConfig: &rest.Config{
+					TLSClientConfig: rest.TLSClientConfig{CAData: []byte("ca1")},
+				},
+				SpokeNamespace: spokeNamespace,
+				EventRecorder:  events.NewFakeRecorder(10),
+			}
+
+			_, err := reconciler.Reconcile(context.Background(), reconcile.Request{NamespacedName: types.NamespacedName{
+				Namespace: clusterName,
+				Name:      msaName,
+			}})
+			if len(c.expectedError) > 0 {
+				assert.ErrorContains(t, err, c.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			issued := false
+			for _, action := range fakeKubeClient.Actions() {
+				if action.GetVerb() == "create" && action.GetSubresource() == "token" {
+					issued = true
+				}
+			}
+			assert.Equal(t, c.expectedIssued, issued)
+
+			token, err := os.ReadFile(filepath.Join(sinkDir, clusterName, msaName, corev1.ServiceAccountTokenKey))
+			if len(c.expectedDelivered) > 0 {
+				assert.NoError(t, err)
+				assert.Equal(t, c.expectedDelivered, string(token))
+			} else {
+				assert.True(t, os.IsNotExist(err))
+			}
+
+			secret := &corev1.Secret{}
+			err = hubClient.Get(context.TODO(), types.NamespacedName{Namespace: clusterName, Name: msaName}, secret)
+			if c.expectedSecret {
+				assert.NoError(t, err)
+			} else {
+				assert.True(t, apierrors.IsNotFound(err))
+			}
+
+			msa := &authv1beta1.ManagedServiceAccount{}
+			assert.NoError(t, hubClient.Get(context.TODO(), types.NamespacedName{Namespace: clusterName, Name: msaName}, msa))
+			ready := meta.FindStatusCondition(msa.Status.Conditions, authv1beta1.ConditionTypeReady)
+			if assert.NotNil(t, ready) {
+				assert.Equal(t, c.expectedReady.Status, ready.Status)
+				assert.Equal(t, c.expectedReady.Reason, ready.Reason)
+			}
+			if len(c.expectedDelivered) > 0 {
+				assert.Equal(t, "local", msa.Status.Sink.Name)
+				assert.True(t, meta.IsStatusConditionTrue(msa.Status.Conditions, authv1beta1.ConditionTypeSinkDelivered))
+			}
+			if !c.expectedSecret {
+				assert.Nil(t, msa.Status.TokenSecretRef)
+			}
+		})
+	}
+}
@@ -6,13 +6,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"reflect"
 	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 	authv1 "k8s.io/api/authentication/v1"
 	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -21,16 +22,21 @@ import (
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/events"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
 	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
 	"open-cluster-management.io/managed-serviceaccount/pkg/common"
 	"open-cluster-management.io/managed-serviceaccount/pkg/controllers/event"
+	"open-cluster-management.io/managed-serviceaccount/pkg/envelope"
+	"open-cluster-management.io/managed-serviceaccount/pkg/metrics"
 )
 
 var _ reconcile.Reconciler = &TokenReconciler{}
@@ -45,17 +51,34 @@ type TokenReconciler struct {
 	SpokeNamespace       string
 	ClusterName          string
 	SpokeCache           cache.Cache
+	EventRecorder        events.EventRecorder
+	// Envelope encrypts the credentials in the token secrets of the envelope encryption, it is nil
+	// if no KMS plugin is configured.
+	Envelope *envelope.Envelope
+	// ReadManagedCluster reports whether the agent is permitted to read its own ManagedCluster on the
+	// hub cluster, which provides the server URL of the kubeconfig unless it is set in the projection.
+	ReadManagedCluster bool
+
+	// pendingCertificates are the client certificates requested and not issued yet
+	pendingCertificates pendingCertificates
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *TokenReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	b := ctrl.NewControllerManagedBy(mgr).
 		For(&authv1beta1.ManagedServiceAccount{}).
 		Named("managed_serviceaccount_agent_token_controller").
 		Watches(
 			&corev1.Secret{},
 			event.NewSecretEventHandler(),
-		).
+		)
+	if r.ReadManagedCluster {
+		b = b.Watches(
+			&clusterv1.ManagedCluster{},
+			handler.EnqueueRequestsFromMapFunc(r.managedClusterToRequests),
+		)
+	}
+	return b.
 		WatchesRawSource(
 			source.Kind(
 				r.SpokeCache,
@@ -63,6 +86,34 @@ func (r *TokenReconciler) SetupWithManager(mgr ctrl.Manager) error {
 				event.NewServiceAccountEventHandler[*corev1.ServiceAccount](r.ClusterName),
 			),
 		).
+		WatchesRawSource(
+			source.Kind(
+				r.SpokeCache,
+				&rbacv1.Role{},
+				event.NewPermissionEventHandler[*rbacv1.Role](r.ClusterName),
+			),
+		).
+		WatchesRawSource(
+			source.Kind(
+				r.SpokeCache,
+				&rbacv1.RoleBinding{},
+				event.NewPermissionEventHandler[*rbacv1.RoleBinding](r.ClusterName),
+			),
+		).
+		WatchesRawSource(
+			source.Kind(
+				r.SpokeCache,
+				&rbacv1.ClusterRole{},
+				event.NewPermissionEventHandler[*rbacv1.ClusterRole](r.ClusterName),
+			),
+		).
+		WatchesRawSource(
+			source.Kind(
+				r.SpokeCache,
+				&rbacv1.ClusterRoleBinding{},
+				event.NewPermissionEventHandler[*rbacv1.ClusterRoleBinding](r.ClusterName),
+			),
+		).
 		Complete(r)
 }
 
@@ -77,42 +128,70 @@ func (r *TokenReconciler) Reconcile(ctx context.Context, request reconcile.Reque
 			return reconcile.Result{}, errors.Wrapf(err, "fail to get managed serviceaccount")
 		}
 
-		saclient := r.SpokeNativeClient.CoreV1().ServiceAccounts(r.SpokeNamespace)
-		sa, err := saclient.Get(ctx, request.Name, metav1.GetOptions{})
-		if err != nil {
-			if !apierrors.IsNotFound(err) {
-				// fail to get related serviceaccount, requeue
-				return reconcile.Result{}, errors.Wrapf(err, "fail to get related serviceaccount")
-			}
-
-			logger.Info("Both ManagedServiceAccount and related ServiceAccount does not exist")
-			return reconcile.Result{}, nil
+		if err := r.cleanupPermissions(ctx, request.Namespace, request.Name); err != nil {
+			return reconcile.Result{}, errors.Wrapf(err, "fail to clean up related permissions")
 		}
 
-		// check if the serviceacount is managed by the agent, if not, return
-		if sa.Labels[common.LabelKeyIsManagedServiceAccount] != "true" {
-
-			logger.Info("Related ServiceAccount is not managed by the agent, skip deletion")
-			return reconcile.Result{}, nil
+		if err := r.deleteServiceAccounts(ctx, request.Namespace, request.Name); err != nil {
+			return reconcile.Result{}, err
 		}
-
-		if err := saclient.Delete(ctx, request.Name, metav1.DeleteOptions{}); err != nil {
-			if !apierrors.IsNotFound(err) {
-				// fail to delete related serviceaccount, requeue
-				return reconcile.Result{}, errors.Wrapf(err, "fail to delete related serviceaccount")
-			}
-		}
-
-		logger.Info("Delete related ServiceAccount successfully")
+		metrics.DeleteManagedServiceAccount(request.Namespace, request.Name)
+		r.pendingCertificates.delete(request.NamespacedName)
 		return reconcile.Result{}, nil
 	}
 
 	msaCopy := msa.DeepCopy()
-	if err := r.ensureServiceAccount(msaCopy); err != nil {
+	msaCopy.Status.ObservedGeneration = msa.Generation
+	if isRevocationRequested(msaCopy) {
+		if err := r.revokeTokens(ctx, msaCopy); err != nil {
+			return reconcile.Result{}, errors.Wrapf(err, "failed to revoke tokens")
+		}
+		// the status is updated with the revocation
+		msa = msaCopy.DeepCopy()
+	}
+	if err := r.ensureServiceAccount(ctx, msaCopy); err != nil {
 		return reconcile.Result{}, errors.Wrapf(err, "failed to ensure service account")
 	}
 
+	// failing to apply the permissions does not block the token reporting, the error is
+	// recorded in the PermissionsApplied condition and returned after the status is updated
+	permissionErr := r.syncPermissions(ctx, msaCopy)
+
+	if isProjectionNone(msaCopy) && hasSink(msaCopy) {
+		return r.reconcileSinkOnly(ctx, msa, msaCopy, permissionErr)
+	}
+	if isProjectionNone(msaCopy) {
+		if err := r.deleteStaleTokenSecret(ctx, msa, ""); err != nil {
+			return reconcile.Result{}, err
+		}
+		setManagedServiceAccountNoProjectionStatus(msaCopy)
+		observeCredentialRevocation(msaCopy)
+		metrics.Tokens.Delete(msaCopy.Namespace, msaCopy.Name)
+		if !equality.Semantic.DeepEqual(msa.Status, msaCopy.Status) {
+			if err := r.updateStatus(ctx, msaCopy); err != nil {
+				return reconcile.Result{}, err
+			}
+		}
+		if permissionErr != nil {
+			return reconcile.Result{}, errors.Wrapf(permissionErr, "failed to sync permissions")
+		}
+		return reconcile.Result{}, nil
+	}
+
 	expiring, err := r.sync(ctx, msaCopy)
+	if errors.Is(err, errCertificatePending) {
+		// the current credential is kept until the certificate is collected
+		setManagedServiceAccountReadyCondition(msaCopy)
+		if !equality.Semantic.DeepEqual(msa.Status, msaCopy.Status) {
+			if err := r.updateStatus(ctx, msaCopy); err != nil {
+				return reconcile.Result{}, err
+			}
+		}
+		if permissionErr != nil {
+			return reconcile.Result{}, errors.Wrapf(permissionErr, "failed to sync permissions")
+		}
+		return reconcile.Result{RequeueAfter: certificateIssueInterval}, nil
+	}
 	if err != nil {
 		meta.SetStatusCondition(&msaCopy.Status.Conditions, metav1.Condition{
 			Type:    authv1beta1.ConditionTypeTokenReported,
@@ -120,12 +199,17 @@ func (r *TokenReconciler) Reconcile(ctx context.Context, request reconcile.Reque
 			Reason:  "TokenReportFailed",
 			Message: err.Error(),
 		})
-		if errUpdate := r.HubClient.Status().Update(context.TODO(), msaCopy); errUpdate != nil {
-			return reconcile.Result{}, errors.Wrapf(errUpdate, "failed to update status")
+		setManagedServiceAccountReadyCondition(msaCopy)
+		if errUpdate := r.updateStatus(ctx, msaCopy); errUpdate != nil {
+			return reconcile.Result{}, errUpdate
 		}
 		return reconcile.Result{}, errors.Wrapf(err, "failed to sync token")
 	}
 
+	if err := r.deleteStaleTokenSecret(ctx, msa, tokenSecretName(msaCopy)); err != nil {
+		return reconcile.Result{}, err
+	}
+
 	now := metav1.Now()
 	var requeueAfter time.Duration
 	if expiring == nil {
@@ -140,23 +224,60 @@ func (r *TokenReconciler) Reconcile(ctx context.Context, request reconcile.Reque
 		// Requeue even if the token is not refreshed, otherwise if the agent restarts
 		// at the time that the token is not expried, no chance to trigger the expiration
 		// check again
-		requeueAfter = checkTokenRefreshAfter(now,
+		requeueAfter = checkTokenRefreshAfter(now, msa.Spec.Rotation,
 			*msa.Status.ExpirationTimestamp, msa.Status.TokenSecretRef.LastRefreshTimestamp)
 
+		// requeue to remove the previous token from the token secret at the end of the grace period
+		if retire := previousTokenRetireTime(msa, nil); retire.After(now.Time) {
+			if retireAfter := retire.Sub(now.Time) + time.Second; retireAfter < requeueAfter {
+				requeueAfter = retireAfter
+			}
+		}
+
 	} else {
 		// after sync func succeeds, the secret must exist, add the conditions if not exist
 		setManagedServiceAccountSuccessStatus(msaCopy, expiring, now, now)
 	}
+	// the token is up to date, the CredentialRevocation dispatched before is handled
+	observeCredentialRevocation(msaCopy)
 
-	if !reflect.DeepEqual(msa.Status, msaCopy.Status) {
-		if err := r.HubClient.Status().Update(context.TODO(), msaCopy); err != nil {
-			return reconcile.Result{}, errors.Wrapf(err, "failed to update status")
+	// failing to deliver the credential to the sink is recorded in the SinkDelivered condition, and
+	// the delivery is retried with the returned error
+	sinkErr := r.syncSink(ctx, msaCopy, now)
+	setManagedServiceAccountReadyCondition(msaCopy)
+
+	if !equality.Semantic.DeepEqual(msa.Status, msaCopy.Status) {
+		if err := r.updateStatus(ctx, msaCopy); err != nil {
+			return reconcile.Result{}, err
+		}
+		// the token is reported for the first time
+		if msa.Status.TokenSecretRef == nil {
+			metrics.TimeToTokenReported.Observe(now.Sub(msa.CreationTimestamp.Time).Seconds())
 		}
 	}
+	metrics.Tokens.Set(msaCopy.Namespace, msaCopy.Name,
+		msaCopy.Status.TokenSecretRef.LastRefreshTimestamp.Time, msaCopy.Status.ExpirationTimestamp.Time)
+
+	if sinkErr != nil {
+		return reconcile.Result{}, sinkErr
+	}
+	if permissionErr != nil {
+		return reconcile.Result{}, errors.Wrapf(permissionErr, "failed to sync permissions")
+	}
 
 	return reconcile.Result{RequeueAfter: requeueAfter}, nil
 }
 
+// updateStatus updates the status of the ManagedServiceAccount on the hub cluster, the failures
+// are counted in the metrics.
+func (r *TokenReconciler) updateStatus(ctx context.Context, msa *authv1beta1.ManagedServiceAccount) error {
+	if err := r.HubClient.Status().Update(ctx, msa); err != nil {
+		metrics.StatusUpdateFailures.WithLabelValues(msa.Namespace, msa.Name).Inc()
+		return errors.Wrapf(err, "failed to update status")
+	}
+	return nil
+}
+
 func setManagedServiceAccountSuccessStatus(msaCopy *authv1beta1.ManagedServiceAccount,
 	expiring *metav1.Time, lastTransitionTime, lastRreshTimestamp metav1.Time) {
 
@@ -175,15 +296,67 @@ func setManagedServiceAccountSuccessStatus(msaCopy *authv1beta1.ManagedServiceAc
 		LastTransitionTime: lastTransitionTime,
 	})
 
-	msaCopy.Status.ExpirationTimestamp = expiring
 	msaCopy.Status.TokenSecretRef = &authv1beta1.SecretRef{
-		Name:                 msaCopy.Name,
+		Name:                 tokenSecretName(msaCopy),
 		LastRefreshTimestamp: lastRreshTimestamp,
 	}
+	setRotationStatus(msaCopy, expiring, lastRreshTimestamp)
+	setManagedServiceAccountReadyCondition(msaCopy)
+}
+
+// setRotationStatus reports the expiration, the effective validity and the next rotation of the
+// credential issued at lastRefreshTimestamp.
+func setRotationStatus(msaCopy *authv1beta1.ManagedServiceAccount, expiring *metav1.Time,
+	lastRefreshTimestamp metav1.Time) {
+	msaCopy.Status.ExpirationTimestamp = expiring
+	msaCopy.Status.EffectiveValidity = &metav1.Duration{
+		Duration: expiring.Sub(lastRefreshTimestamp.Time).Round(time.Second),
+	}
+	// truncated to the precision of the serialized time, so that the status does not drift
+	msaCopy.Status.NextRotationTimestamp = &metav1.Time{
+		Time: nextRotationTime(msaCopy.Spec.Rotation, lastRefreshTimestamp.Time, expiring.Time).Truncate(time.Second),
+	}
 }
 
-func checkTokenRefreshAfter(now metav1.Time, expiring metav1.Time, lastRefreshTimestamp metav1.Time) time.Duration {
-	exceed, threshold := exceedThreshold(now, expiring, lastRefreshTimestamp)
+// setManagedServiceAccountReadyCondition aggregates the conditions of the ManagedServiceAccount
+// into the Ready condition.
+func setManagedServiceAccountReadyCondition(msaCopy *authv1beta1.ManagedServiceAccount) {
+	ready := metav1.Condition{
+		Type:    authv1beta1.ConditionTypeReady,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Ready",
+		Message: "The token is issued and the permissions are applied",
+	}
+	tokenReported := meta.FindStatusCondition(msaCopy.Status.Conditions, authv1beta1.ConditionTypeTokenReported)
+	permissionsApplied := meta.FindStatusCondition(msaCopy.Status.Conditions,
+		authv1beta1.ConditionTypePermissionsApplied)
+	sinkDelivered := meta.FindStatusCondition(msaCopy.Status.Conditions, authv1beta1.ConditionTypeSinkDelivered)
+	switch {
+	case !isProjectionNone(msaCopy) && (tokenReported == nil || tokenReported.Status != metav1.ConditionTrue):
+		ready.Status = metav1.ConditionFalse
+		ready.Reason = "TokenNotReported"
+		if tokenReported != nil {
+			ready.Message = tokenReported.Message
+		}
+	case permissionsApplied != nil && permissionsApplied.Status != metav1.ConditionTrue:
+		ready.Status = metav1.ConditionFalse
+		ready.Reason = "PermissionsNotApplied"
+		ready.Message = permissionsApplied.Message
+	case sinkDelivered != nil && sinkDelivered.Status != metav1.ConditionTrue:
+		ready.Status = metav1.ConditionFalse
+		ready.Reason = "SinkNotDelivered"
+		ready.Message = sinkDelivered.Message
+	case isProjectionNone(msaCopy) && hasSink(msaCopy):
+		ready.Message = "The credential is delivered to the sink and the permissions are applied"
+	case isProjectionNone(msaCopy):
+		ready.Message = "The service account is provisioned and the token is not projected"
+	}
+	meta.SetStatusCondition(&msaCopy.Status.Conditions, ready)
+}
+
+func checkTokenRefreshAfter(now metav1.Time, rotation authv1beta1.ManagedServiceAccountRotation,
+	expiring metav1.Time, lastRefreshTimestamp metav1.Time) time.Duration {
+	exceed, threshold := exceedThreshold(now, rotation, expiring, lastRefreshTimestamp)
 	if exceed {
 		return 5 * time.Second
 	}
@@ -196,9 +369,10 @@ func (r *TokenReconciler) sync(ctx context.Context,
 	logger := log.FromContext(ctx)
 	secretExists := true
 	currentTokenSecret := &corev1.Secret{}
+	secretName := tokenSecretName(managed)
 	if err := r.HubClient.Get(ctx, types.NamespacedName{
 		Namespace: managed.Namespace,
-		Name:      managed.Name,
+		Name:      secretName,
 	}, currentTokenSecret); err != nil {
 		if !apierrors.IsNotFound(err) {
 			return nil, errors.Wrapf(err, "failed to read current token secret from hub cluster")
@@ -206,28 +380,62 @@ func (r *TokenReconciler) sync(ctx context.Context,
 		secretExists = false
 		currentTokenSecret = nil
 	}
+	// the credentials are handled in plaintext, and encrypted again once the secret is written
+	encrypted := envelope.IsEncrypted(currentTokenSecret)
+	currentTokenSecret, err := r.Envelope.DecryptSecret(ctx, currentTokenSecret)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decrypt the token secret")
+	}
+
+	// refuse to overwrite an existing secret which is not created by the agent when the secret
+	// name is prescribed
+	if secretExists && secretName != managed.Name &&
+		currentTokenSecret.Labels[common.LabelKeyIsManagedServiceAccount] != "true" {
+		r.EventRecorder.Eventf(managed, nil, corev1.EventTypeWarning, common.EventReasonSecretConflict, "UpdateSecret",
+			"Refused to overwrite the secret %s/%s which is not managed by the ManagedServiceAccount",
+			managed.Namespace, secretName)
+		return nil, fmt.Errorf("secret %s/%s exists and is not managed by the ManagedServiceAccount",
+			managed.Namespace, secretName)
+	}
+
+	caData, err := r.spokeCAData()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.checkEncryption(managed); err != nil {
+		return nil, err
+	}
 
 	if shouldCreateUpdate, err := r.shouldCreateUpdateTokenSecret(managed, currentTokenSecret); err != nil {
 		return nil, errors.Wrapf(err, "failed to make a decision on token creation")
 	} else if secretExists && !shouldCreateUpdate {
-		return nil, nil
+		// keep the token, while the CA, the kubeconfig and the metadata of the secret still
+		// follow the changes
+		credential := credentialData(managed, currentTokenSecret)
+		data, err := r.secretData(ctx, managed, caData, credential)
+		if err != nil {
+			return nil, err
+		}
+		setCredentialStatus(managed, credential)
+		return nil, r.syncTokenSecret(ctx, managed, currentTokenSecret, encrypted, data)
 	}
 
-	token, expiring, err := r.createToken(managed)
+	credential, expiring, err := r.issueCredential(ctx, managed)
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to request token for service-account")
+		return nil, err
 	}
+	managed.Status.RotationCount++
+	setCredentialStatus(managed, credential)
 
-	caData := r.SpokeClientConfig.CAData
-	if len(caData) == 0 {
-		var err error
-		caData, err = os.ReadFile(r.SpokeClientConfig.CAFile)
-		if err != nil {
-			return nil, errors.Wrapf(err, "failed to read CA data from file")
-		}
+	data, err := r.secretData(ctx, managed, caData, credential)
+	if err != nil {
+		return nil, err
 	}
 
-	tokenSecret := r.buildSecret(managed, currentTokenSecret, caData, []byte(token))
+	tokenSecret, err := r.buildSecret(ctx, managed, currentTokenSecret, data, expiring)
+	if err != nil {
+		return nil, err
+	}
 	if secretExists {
 		if err := r.HubClient.Update(ctx, tokenSecret); err != nil {
 			return nil, errors.Wrapf(err, "failed to update the token secret")
@@ -238,47 +446,276 @@ func (r *TokenReconciler) sync(ctx context.Context,
 		}
 	}
 
+	metrics.TokenRotations.WithLabelValues(managed.Namespace, managed.Name).Inc()
+	kind := credentialKind(managed)
+	if currentTokenSecret != nil && len(currentTokenSecret.Data[credentialKeys(managed)[0]]) > 0 {
+		r.EventRecorder.Eventf(managed, nil, corev1.EventTypeNormal, common.EventReasonTokenRotated, "RotateToken",
+			"Rotated the %s, the new %s expires at %s", kind, kind, expiring.UTC().Format(time.RFC3339))
+	} else {
+		r.EventRecorder.Eventf(managed, nil, corev1.EventTypeNormal, common.EventReasonTokenIssued, "IssueToken",
+			"Issued the %s, it expires at %s", kind, expiring.UTC().Format(time.RFC3339))
+	}
 	logger.Info("Token refreshed", "expirationTimestamp", expiring)
 	return &expiring, nil
 }
 
-func (r *TokenReconciler) ensureServiceAccount(managed *authv1beta1.ManagedServiceAccount) error {
+// spokeCAData returns the CA data of the managed cluster.
+func (r *TokenReconciler) spokeCAData() ([]byte, error) {
+	if len(r.SpokeClientConfig.CAData) > 0 {
+		return r.SpokeClientConfig.CAData, nil
+	}
+	caData, err := os.ReadFile(r.SpokeClientConfig.CAFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read CA data from file")
+	}
+	return caData, nil
+}
+
+// serviceAccountOf returns the namespace and name of the ServiceAccount on the managed cluster
+// for the ManagedServiceAccount.
+func (r *TokenReconciler) serviceAccountOf(managed *authv1beta1.ManagedServiceAccount) (string, string) {
+	namespace, name := r.SpokeNamespace, managed.Name
+	if sa := managed.Spec.ServiceAccount; sa != nil {
+		if len(sa.Namespace) > 0 {
+			namespace = sa.Namespace
+		}
+		if len(sa.Name) > 0 {
+			name = sa.Name
+		}
+	}
+	return namespace, name
+}
+
+func (r *TokenReconciler) ensureServiceAccount(ctx context.Context, managed *authv1beta1.ManagedServiceAccount) error {
+	if isAdoptionMode(managed) {
+		return r.adoptServiceAccount(ctx, managed)
+	}
+
+	saNamespace, saName := r.serviceAccountOf(managed)
+	if managed.Spec.ServiceAccount != nil && managed.Spec.ServiceAccount.CreateNamespace {
+		ns := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: saNamespace,
+			},
+		}
+		if _, err := r.SpokeNativeClient.CoreV1().Namespaces().
+			Create(ctx, ns, metav1.CreateOptions{}); err != nil {
+			if !apierrors.IsAlreadyExists(err) {
+				return errors.Wrapf(err, "failed ensuring namespace %s", saNamespace)
+			}
+		}
+	}
+
 	sa := &corev1.ServiceAccount{
 		ObjectMeta: metav1.ObjectMeta{
-			Namespace: r.SpokeNamespace,
-			Name:      managed.Name,
-			Labels: map[string]string{
-				common.LabelKeyIsManagedServiceAccount: "true",
-			},
+			Namespace:   saNamespace,
+			Name:        saName,
+			Labels:      ownerLabels(managed.Namespace, managed.Name),
+			Annotations: ownerAnnotations(managed.Name),
 		},
 	}
-	if _, err := r.SpokeNativeClient.CoreV1().
-		ServiceAccounts(r.SpokeNamespace).
-		Create(context.TODO(), sa, metav1.CreateOptions{}); err != nil {
-		if !apierrors.IsAlreadyExists(err) {
-			return errors.Wrapf(err, "failed ensuring service account")
+	saclient := r.SpokeNativeClient.CoreV1().ServiceAccounts(saNamespace)
+	_, err := saclient.Create(ctx, sa, metav1.CreateOptions{})
+	switch {
+	case err == nil:
+		r.EventRecorder.Eventf(managed, nil, corev1.EventTypeNormal, common.EventReasonServiceAccountCreated, "Create",
+			"Created the service account %s/%s on the managed cluster", saNamespace, saName)
+	case !apierrors.IsAlreadyExists(err):
+		return errors.Wrapf(err, "failed ensuring service account")
+	case managed.Spec.ServiceAccount != nil:
+		// the service account is placed explicitly, refuse to issue tokens for the existing
+		// service account unless it is created for this ManagedServiceAccount
+		existing, err := saclient.Get(ctx, saName, metav1.GetOptions{})
+		if err != nil {
+			return errors.Wrapf(err, "failed to get service account")
+		}
+		if !isServiceAccountOwnedBy(existing, managed.Namespace, managed.Name) {
+			return fmt.Errorf("service account %s/%s exists and is not managed by the ManagedServiceAccount",
+				saNamespace, saName)
 		}
 	}
 	return nil
 }
 
+// deleteServiceAccounts deletes the ServiceAccounts created for the ManagedServiceAccount on
+// the managed cluster, the adopted ServiceAccounts are released instead.
+func (r *TokenReconciler) deleteServiceAccounts(ctx context.Context, msaNamespace, msaName string) error {
+	logger := log.FromContext(ctx)
+	// the serviceaccounts are listed from the spoke cache of the labeled serviceaccounts, a
+	// serviceaccount missed by a stale cache is deleted on the reconcile triggered by its event
+	sas := &corev1.ServiceAccountList{}
+	if err := r.SpokeCache.List(ctx, sas, client.MatchingLabels(ownerLabels(msaNamespace, msaName))); err != nil {
+		// fail to list related serviceaccounts, requeue
+		return errors.Wrapf(err, "fail to list related serviceaccounts")
+	}
+
+	targets := []corev1.ServiceAccount{}
+	targets = append(targets, sas.Items...)
+
+	// the serviceaccounts created by the former agents are only labeled with
+	// LabelKeyIsManagedServiceAccount, and reside in the agent namespace with the name of
+	// the ManagedServiceAccount
+	legacy, err := r.SpokeNativeClient.CoreV1().ServiceAccounts(r.SpokeNamespace).Get(ctx, msaName, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+	case err != nil:
+		// fail to get related serviceaccount, requeue
+		return errors.Wrapf(err, "fail to get related serviceaccount")
+	case legacy.Labels[common.LabelKeyIsManagedServiceAccount] != "true":
+		logger.Info("Related ServiceAccount is not managed by the agent, skip deletion")
+	case len(legacy.Labels[common.LabelKeyManagedServiceAccountName]) == 0:
+		targets = append(targets, *legacy)
+	}
+
+	if len(targets) == 0 {
+		logger.Info("Both ManagedServiceAccount and related ServiceAccount does not exist")
+		return nil
+	}
+
+	for _, sa := range targets {
+		if len(sa.Annotations[common.AnnotationKeyAdoptedBy]) > 0 {
+			// the adopted serviceaccount is not created by the agent, leave it on the cluster
+			if err := r.releaseServiceAccount(ctx, &sa); err != nil {
+				return err
+			}
+			logger.Info("Release adopted ServiceAccount successfully", "namespace", sa.Namespace, "name", sa.Name)
+			continue
+		}
+		if err := r.SpokeNativeClient.CoreV1().ServiceAccounts(sa.Namespace).
+			Delete(ctx, sa.Name, metav1.DeleteOptions{}); err != nil {
+			if !apierrors.IsNotFound(err) {
+				// fail to delete related serviceaccount, requeue
+				return errors.Wrapf(err, "fail to delete related serviceaccount")
+			}
+		}
+		logger.Info("Delete related ServiceAccount successfully", "namespace", sa.Namespace, "name", sa.Name)
+	}
+	for _, namespace := range tokenRequesterNamespaces(targets) {
+		if err := r.cleanupTokenRequester(ctx, namespace); err != nil {
+			return err
+		}
+	}
+
+	// the ManagedServiceAccount is gone, the event refers to it by the namespace and name
+	deleted := &authv1beta1.ManagedServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: msaNamespace,
+			Name:      msaName,
+		},
+	}
+	r.EventRecorder.Eventf(deleted, nil, corev1.EventTypeNormal, common.EventReasonCleanedUp, "Cleanup",
+		"Cleaned up %d service accounts on the managed cluster", len(targets))
+	return nil
+}
+
+// isServiceAccountOwnedBy checks whether the ServiceAccount is created for the ManagedServiceAccount
+func isServiceAccountOwnedBy(sa *corev1.ServiceAccount, msaNamespace, msaName string) bool {
+	return sa.Labels[common.LabelKeyIsManagedServiceAccount] == "true" &&
+		sa.Labels[common.LabelKeyManagedServiceAccountNamespace] == msaNamespace &&
+		sa.Labels[common.LabelKeyManagedServiceAccountName] == common.ManagedServiceAccountNameLabelValue(msaName)
+}
+
+// createToken requests a token for the service account, it returns the token, the expiration
+// time and the audiences that the token is issued for.
 func (r *TokenReconciler) createToken(
-	managed *authv1beta1.ManagedServiceAccount) (string, metav1.Time, error) {
+	managed *authv1beta1.ManagedServiceAccount) (string, metav1.Time, []string, error) {
 	var expirationSec = int64(managed.Spec.Rotation.Validity.Seconds())
-	tr, err := r.SpokeNativeClient.CoreV1().ServiceAccounts(r.SpokeNamespace).
-		CreateToken(context.TODO(), managed.Name, &authv1.TokenRequest{
-			Spec: authv1.TokenRequestSpec{
-				ExpirationSeconds: &expirationSec,
-			},
-		}, metav1.CreateOptions{})
+	tokenRequest := &authv1.TokenRequest{
+		Spec: authv1.TokenRequestSpec{
+			ExpirationSeconds: &expirationSec,
+		},
+	}
+	if managed.Spec.Token != nil {
+		tokenRequest.Spec.Audiences = managed.Spec.Token.Audiences
+		if ref := managed.Spec.Token.BoundObjectRef; ref != nil {
+			tokenRequest.Spec.BoundObjectRef = &authv1.BoundObjectReference{
+				Kind:       ref.Kind,
+				APIVersion: "v1",
+				Name:       ref.Name,
+				UID:        ref.UID,
+			}
+		}
+	}
+
+	saNamespace, saName := r.serviceAccountOf(managed)
+	tr, err := r.SpokeNativeClient.CoreV1().ServiceAccounts(saNamespace).
+		CreateToken(context.TODO(), saName, tokenRequest, metav1.CreateOptions{})
+	if err != nil {
+		return "", metav1.Time{}, nil, err
+	}
+	// the api server defaults the audiences of the token request if they are not specified
+	return tr.Status.Token, tr.Status.ExpirationTimestamp, tr.Spec.Audiences, nil
+}
+
+// issueCredential issues a fresh credential of the credential type for the service account, it returns
+// the credential keys of the token secret and the expiration time of the credential.
+func (r *TokenReconciler) issueCredential(ctx context.Context,
+	managed *authv1beta1.ManagedServiceAccount) (map[string][]byte, metav1.Time, error) {
+	if isClientCertificate(managed) {
+		certData, keyData, expiring, err := r.issueCertificate(ctx, managed)
+		if errors.Is(err, errCertificatePending) {
+			return nil, metav1.Time{}, err
+		}
+		if err != nil {
+			return nil, metav1.Time{}, errors.Wrapf(err, "failed to issue client certificate for service-account")
+		}
+		return map[string][]byte{
+			corev1.TLSCertKey:       certData,
+			corev1.TLSPrivateKeyKey: keyData,
+		}, expiring, nil
+	}
+
+	saNamespace, _ := r.serviceAccountOf(managed)
+	if err := r.ensureTokenRequester(ctx, saNamespace); err != nil {
+		return nil, metav1.Time{}, err
+	}
+	token, expiring, audiences, err := r.createToken(managed)
 	if err != nil {
-		return "", metav1.Time{}, err
+		return nil, metav1.Time{}, errors.Wrapf(err, "failed to request token for service-account")
+	}
+	managed.Status.TokenAudiences = audiences
+	return map[string][]byte{corev1.ServiceAccountTokenKey: []byte(token)}, expiring, nil
+}
+
+// credentialKeys returns the keys of the credential in the token secret, the first one is the
+// certificate or the token.
+func credentialKeys(managed *authv1beta1.ManagedServiceAccount) []string {
+	if isClientCertificate(managed) {
+		return []string{corev1.TLSCertKey, corev1.TLSPrivateKeyKey}
+	}
+	return []string{corev1.ServiceAccountTokenKey}
+}
+
+// credentialKind returns the name of the credential type in the events.
+func credentialKind(managed *authv1beta1.ManagedServiceAccount) string {
+	if isClientCertificate(managed) {
+		return "client certificate"
+	}
+	return "token"
+}
+
+// credentialData returns the credential keys of the token secret.
+func credentialData(managed *authv1beta1.ManagedServiceAccount, secret *corev1.Secret) map[string][]byte {
+	data := map[string][]byte{}
+	for _, key := range credentialKeys(managed) {
+		data[key] = secret.Data[key]
+	}
+	return data
+}
+
+// setCredentialStatus reports the claims of the token or the issuer of the client certificate in the status.
+func setCredentialStatus(managed *authv1beta1.ManagedServiceAccount, credential map[string][]byte) {
+	if isClientCertificate(managed) {
+		setCertificateStatus(managed, credential[corev1.TLSCertKey])
+		return
 	}
-	return tr.Status.Token, tr.Status.ExpirationTimestamp, nil
+	setTokenClaimsStatus(managed, credential[corev1.ServiceAccountTokenKey])
 }
 
-func (r *TokenReconciler) buildSecret(managed *authv1beta1.ManagedServiceAccount, currentSecret *corev1.Secret,
-	caData, tokenData []byte) *corev1.Secret {
+// buildSecret builds the token secret of the issued credential, which keeps the previous token in
+// the overlap mode, and encrypts the credentials if the envelope encryption is requested.
+func (r *TokenReconciler) buildSecret(ctx context.Context, managed *authv1beta1.ManagedServiceAccount,
+	currentSecret *corev1.Secret, data map[string][]byte, expiring metav1.Time) (*corev1.Secret, error) {
 	var copySecret *corev1.Secret
 	if currentSecret != nil {
 		copySecret = currentSecret.DeepCopy()
@@ -286,32 +723,21 @@ func (r *TokenReconciler) buildSecret(managed *authv1beta1.ManagedServiceAccount
 		copySecret = &corev1.Secret{
 			ObjectMeta: metav1.ObjectMeta{
 				Namespace: managed.Namespace,
-				Name:      managed.Name,
+				Name:      tokenSecretName(managed),
 			},
 			Type: corev1.SecretTypeOpaque,
 			Data: map[string][]byte{},
 		}
 	}
 
-	if copySecret.Labels == nil {
-		copySecret.Labels = map[string]string{}
-	}
-	copySecret.Labels[common.LabelKeyIsManagedServiceAccount] = "true"
-
-	copySecret.OwnerReferences = []metav1.OwnerReference{
-		{
-			APIVersion: authv1beta1.GroupVersion.String(),
-			Kind:       "ManagedServiceAccount",
-			Name:       managed.Name,
-			UID:        managed.UID,
-		},
-	}
+	setSecretMetadata(managed, copySecret)
 
-	copySecret.Data = map[string][]byte{
-		corev1.ServiceAccountRootCAKey: caData,
-		corev1.ServiceAccountTokenKey:  tokenData,
+	copySecret.Data = data
+	setRotatedTokens(managed, currentSecret, copySecret, expiring, metav1.Now())
+	if err := r.sealTokenSecret(ctx, managed, copySecret); err != nil {
+		return nil, errors.Wrapf(err, "failed to encrypt the token secret")
 	}
-	return copySecret
+	return copySecret, nil
 }
 
 func (r *TokenReconciler) shouldCreateUpdateTokenSecret(msa *authv1beta1.ManagedServiceAccount,
@@ -320,25 +746,66 @@ func (r *TokenReconciler) shouldCreateUpdateTokenSecret(msa *authv1beta1.Managed
 		return true, nil
 	}
 
-	token := secret.Data[corev1.ServiceAccountTokenKey]
-	if match, err := CheckUserInToken(r.SpokeNamespace, msa.Name, string(token)); !match {
-		return true, err
+	saNamespace, saName := r.serviceAccountOf(msa)
+	if isClientCertificate(msa) {
+		// re-issue the certificate if it is missing, e.g. the credential type is changed
+		if !isCertificateDataOf(secret.Data[corev1.TLSCertKey], saNamespace, saName) {
+			return true, nil
+		}
+	} else {
+		token := secret.Data[corev1.ServiceAccountTokenKey]
+		// re-issue the token if it is missing, e.g. the credential type is changed
+		if len(token) == 0 {
+			return true, nil
+		}
+		if match, err := CheckUserInToken(saNamespace, saName, string(token)); !match {
+			return true, err
+		}
+	}
+
+	// re-issue the token if it is requested with different audiences or bound object
+	if secret.Annotations[common.AnnotationKeyTokenSpec] != tokenSpecAnnotation(msa) {
+		return true, nil
+	}
+
+	// re-issue the token on the request of a CredentialRevocation or kubectl-msa rotate
+	if isReissueRequested(msa) {
+		return true, nil
 	}
 
 	return r.isSoonExpiring(msa, secret)
 }
 
+// tokenSpecAnnotation returns the serialized spec.token of the ManagedServiceAccount, or an
+// empty string if the token is requested with the default options.
+func tokenSpecAnnotation(msa *authv1beta1.ManagedServiceAccount) string {
+	if msa.Spec.Token == nil || (len(msa.Spec.Token.Audiences) == 0 && msa.Spec.Token.BoundObjectRef == nil) {
+		return ""
+	}
+	data, err := json.Marshal(msa.Spec.Token)
+	if err != nil {
+		// never happens, the token spec is always serializable
+		return ""
+	}
+	return string(data)
+}
+
 func (r *TokenReconciler) isSoonExpiring(msa *authv1beta1.ManagedServiceAccount, secret *corev1.Secret) (bool, error) {
 	if msa.Status.TokenSecretRef == nil || msa.Status.ExpirationTimestamp == nil || secret == nil {
 		return true, nil
 	}
 
 	now := metav1.Now()
-	if exceed, _ := exceedThreshold(now, *msa.Status.ExpirationTimestamp,
+	if exceed, _ := exceedThreshold(now, msa.Spec.Rotation, *msa.Status.ExpirationTimestamp,
 		msa.Status.TokenSecretRef.LastRefreshTimestamp); exceed {
 		return true, nil
 	}
 
+	// the client certificates cannot be reviewed, they are trusted until the rotation
+	if isClientCertificate(msa) {
+		return false, nil
+	}
+
 	// check if the token is valid or not
 	tokenReview := &authv1.TokenReview{
 		Spec: authv1.TokenReviewSpec{
@@ -348,32 +815,74 @@ func (r *TokenReconciler) isSoonExpiring(msa *authv1beta1.ManagedServiceAccount,
 	tr, err := r.SpokeNativeClient.AuthenticationV1().TokenReviews().Create(
 		context.TODO(), tokenReview, metav1.CreateOptions{})
 	if err != nil {
+		metrics.TokenReviewFailures.WithLabelValues(msa.Namespace, msa.Name, "error").Inc()
 		return false, err
 	}
 
+	if !tr.Status.Authenticated {
+		metrics.TokenReviewFailures.WithLabelValues(msa.Namespace, msa.Name, "rejected").Inc()
+		r.EventRecorder.Eventf(msa, nil, corev1.EventTypeWarning, common.EventReasonTokenInvalid, "ReviewToken",
+			"The token is rejected by the TokenReview on the managed cluster, re-issuing the token")
+	}
 	return !tr.Status.Authenticated, nil
 }
 
-func exceedThreshold(now metav1.Time, expiring metav1.Time, lastRefreshTimestamp metav1.Time) (bool, time.Time) {
+func exceedThreshold(now metav1.Time, rotation authv1beta1.ManagedServiceAccountRotation,
+	expiring metav1.Time, lastRefreshTimestamp metav1.Time) (bool, time.Time) {
 	// Check if the token should be refreshed, the token will not be rotated unless its remaining lifetime is
-	// less than 20% of its rotation validity
+	// less than spec.rotation.refreshBefore (20% of its lifetime by default), within the rotation window if any
 	// Some kubernetes distribution may have a maximum token lifetime, for example, eks will shorten the token lifetime
 	// to 1 day, so here we use the real expiration time and last refresh time, instead of the requested expiration time
 	// in the managedserviceaccount.spec.rotation.validity, to calculate the refresh threshold
-	threshold := lastRefreshTimestamp.Add(expiring.Sub(lastRefreshTimestamp.Time) / 5 * 4)
+	threshold := nextRotationTime(rotation, lastRefreshTimestamp.Time, expiring.Time)
 	return now.After(threshold), threshold
 }
 
-// CheckUserInToken checks the namespace and name from the `sub` claim in JWT token payload
-func CheckUserInToken(namespace, name, token string) (bool, error) {
+// tokenClaims are the claims in the payload of a ServiceAccount token reported in the status.
+type tokenClaims struct {
+	Issuer     string `json:"iss"`
+	ID         string `json:"jti"`
+	Kubernetes struct {
+		ServiceAccount struct {
+			UID types.UID `json:"uid"`
+		} `json:"serviceaccount"`
+	} `json:"kubernetes.io"`
+}
+
+// setTokenClaimsStatus reports the issuer and the ServiceAccount UID of the token in the status,
+// they are left unchanged if the token cannot be decoded.
+func setTokenClaimsStatus(managed *authv1beta1.ManagedServiceAccount, token []byte) {
+	payload, err := decodeTokenPayload(string(token))
+	if err != nil {
+		return
+	}
+	claims := &tokenClaims{}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return
+	}
+	managed.Status.TokenIssuer = claims.Issuer
+	managed.Status.ServiceAccountUID = claims.Kubernetes.ServiceAccount.UID
+}
+
+// decodeTokenPayload decodes the payload of the JWT token.
+func decodeTokenPayload(token string) ([]byte, error) {
 	parts := strings.Split(token, ".")
 	if len(parts) != 3 {
-		return false, errors.New("invalid JWT token format")
+		return nil, errors.New("invalid JWT token format")
 	}
 
 	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
 	if err != nil {
-		return false, fmt.Errorf("failed to decode payload: %w", err)
+		return nil, fmt.Errorf("failed to decode payload: %w", err)
+	}
+	return payload, nil
+}
+
+// CheckUserInToken checks the namespace and name from the `sub` claim in JWT token payload
+func CheckUserInToken(namespace, name, token string) (bool, error) {
+	payload, err := decodeTokenPayload(token)
+	if err != nil {
+		return false, err
 	}
 
 	// the payload example :
@@ -6,22 +6,28 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	authv1 "k8s.io/api/authentication/v1"
 	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apiserver/pkg/authentication/serviceaccount"
 	fakekube "k8s.io/client-go/kubernetes/fake"
 	"k8s.io/client-go/rest"
 	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/events"
 	"k8s.io/klog/v2"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
@@ -29,6 +35,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
 	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
 	"open-cluster-management.io/managed-serviceaccount/pkg/common"
 )
@@ -49,18 +56,22 @@ func TestReconcile(t *testing.T) {
 		msa                    *authv1beta1.ManagedServiceAccount
 		sa                     *corev1.ServiceAccount
 		secret                 *corev1.Secret
+		cluster                *clusterv1.ManagedCluster
+		managedClusterDenied   bool
 		spokeNamespace         string
+		adoptionAllowlist      string
 		getError               error
 		newToken               string
 		isExistingTokenInvalid bool
 		expectedError          string
+		expectedEvents         []string
 		validateFunc           func(t *testing.T, hubClient client.Client, actions []clienttesting.Action)
 	}{
 		{
 			name: "msa and sa both are not found",
 			validateFunc: func(t *testing.T, hubClient client.Client, actions []clienttesting.Action) {
 				assertActions(t, actions,
-					"get", // get service account
+					"get", // get legacy service account
 				)
 			},
 		},
@@ -70,7 +81,7 @@ func TestReconcile(t *testing.T) {
 			sa:             newServiceAccount(clusterName, msaName),
 			validateFunc: func(t *testing.T, hubClient client.Client, actions []clienttesting.Action) {
 				assertActions(t, actions,
-					"get", // get service account
+					"get", // get legacy service account
 				)
 			},
 		},
@@ -81,85 +92,737 @@ func TestReconcile(t *testing.T) {
 				map[string]string{
 					common.LabelKeyIsManagedServiceAccount: "true",
 				}),
+			expectedEvents: []string{
+				"Normal CleanedUp Cleaned up 1 service accounts on the managed cluster",
+			},
+			validateFunc: func(t *testing.T, hubClient client.Client, actions []clienttesting.Action) {
+				assertActions(t, actions,
+					"get",    // get legacy service account
+					"delete", // delete service account
+				)
+			},
+		},
+		{
+			name:           "msa not found, sa in custom namespace is created by msa agent, delete",
+			spokeNamespace: clusterName,
+			sa:             newServiceAccountWithLabels("ns1", "sa1", ownerLabels(clusterName, msaName)),
+			validateFunc: func(t *testing.T, hubClient client.Client, actions []clienttesting.Action) {
+				assertActions(t, actions,
+					"get",    // get legacy service account
+					"delete", // delete service account
+					"list",   // list managed service accounts in the namespace
+					"delete", // delete token requester binding
+				)
+				assert.Equal(t, "ns1", actions[1].GetNamespace())
+				assert.Equal(t, "rolebindings", actions[3].GetResource().Resource)
+			},
+		},
+		{
+			name:           "msa not found, adopted sa is released",
+			spokeNamespace: clusterName,
+			sa: func() *corev1.ServiceAccount {
+				sa := newServiceAccountWithLabels("ns1", "sa1", ownerLabels(clusterName, msaName))
+				sa.Annotations = map[string]string{
+					common.AnnotationKeyAdoptedBy: clusterName + "/" + msaName,
+				}
+				return sa
+			}(),
+			validateFunc: func(t *testing.T, hubClient client.Client, actions []clienttesting.Action) {
+				assertActions(t, actions,
+					"get",    // get legacy service account
+					"update", // release service account
+					"list",   // list managed service accounts in the namespace
+					"delete", // delete token requester binding
+				)
+				sa := actions[1].(clienttesting.UpdateAction).GetObject().(*corev1.ServiceAccount)
+				assert.Empty(t, sa.Labels)
+				assert.Empty(t, sa.Annotations)
+			},
+		},
+		{
+			name:          "error to get msa",
+			getError:      errors.New("internal error"),
+			expectedError: "fail to get managed serviceaccount: internal error",
+		},
+		{
+			name:     "create token",
+			sa:       newServiceAccount(clusterName, msaName),
+			msa:      newManagedServiceAccount(clusterName, msaName).build(),
+			newToken: token1,
+			validateFunc: func(t *testing.T, hubClient client.Client, actions []clienttesting.Action) {
+				assertActions(t, actions, "create", // create serviceaccount
+					"create", // create tokenrequest
+				)
+
+				assertToken(t, hubClient, clusterName, msaName, token1, ca1)
+				assertMSAConditions(t, hubClient, clusterName, msaName, []metav1.Condition{
+					{
+						Type:   authv1beta1.ConditionTypeTokenReported,
+						Status: metav1.ConditionTrue,
+					},
+					{
+						Type:   authv1beta1.ConditionTypeSecretCreated,
+						Status: metav1.ConditionTrue,
+					},
+				})
+			},
+		},
+		{
+			name: "report token status",
+			sa:   newServiceAccount(clusterName, msaName),
+			msa: func() *authv1beta1.ManagedServiceAccount {
+				msa := newManagedServiceAccount(clusterName, msaName).build()
+				msa.Generation = 2
+				msa.Status.RotationCount = 3
+				return msa
+			}(),
+			newToken: newFakeToken(clusterName, msaName),
+			validateFunc: func(t *testing.T, hubClient client.Client, actions []clienttesting.Action) {
+				msa := &authv1beta1.ManagedServiceAccount{}
+				err := hubClient.Get(context.TODO(), types.NamespacedName{
+					Namespace: clusterName,
+					Name:      msaName,
+				}, msa)
+				assert.NoError(t, err)
+				assert.Equal(t, int64(2), msa.Status.ObservedGeneration)
+				assert.Equal(t, int64(4), msa.Status.RotationCount)
+				assert.Equal(t, types.UID("fake-uid-1234"), msa.Status.ServiceAccountUID)
+				assert.Equal(t, "https://kubernetes.default.svc", msa.Status.TokenIssuer)
+				assert.Equal(t, &metav1.Duration{Duration: 500 * time.Second}, msa.Status.EffectiveValidity)
+				assert.NotNil(t, msa.Status.NextRotationTimestamp)
+				assert.WithinDuration(t, time.Now().Add(400*time.Second), msa.Status.NextRotationTimestamp.Time, 2*time.Second)
+				assertMSAConditions(t, hubClient, clusterName, msaName, []metav1.Condition{
+					{
+						Type:   authv1beta1.ConditionTypeReady,
+						Status: metav1.ConditionTrue,
+					},
+				})
+			},
+		},
+		{
+			name:     "create token with audiences and bound object",
+			sa:       newServiceAccount(clusterName, msaName),
+			msa:      newManagedServiceAccount(clusterName, msaName).withTokenAudiences("vault").withBoundPod("pod1").build(),
+			newToken: token1,
+			validateFunc: func(t *testing.T, hubClient client.Client, actions []clienttesting.Action) {
+				assertActions(t, actions, "create", // create serviceaccount
+					"create", // create tokenrequest
+				)
+				tokenRequest := actions[1].(clienttesting.CreateAction).GetObject().(*authv1.TokenRequest)
+				assert.Equal(t, []string{"vault"}, tokenRequest.Spec.Audiences)
+				assert.Equal(t, &authv1.BoundObjectReference{
+					Kind:       "Pod",
+					APIVersion: "v1",
+					Name:       "pod1",
+				}, tokenRequest.Spec.BoundObjectRef)
+
+				assertToken(t, hubClient, clusterName, msaName, token1, ca1)
+				msa := &authv1beta1.ManagedServiceAccount{}
+				err := hubClient.Get(context.TODO(), types.NamespacedName{
+					Namespace: clusterName,
+					Name:      msaName,
+				}, msa)
+				assert.NoError(t, err)
+				assert.Equal(t, []string{"vault"}, msa.Status.TokenAudiences)
+			},
+		},
+		{
+			name:           "re-issue token if audiences changed",
+			spokeNamespace: clusterName,
+			sa:             newServiceAccount(clusterName, msaName),
+			secret:         newSecret(clusterName, msaName, newFakeToken(clusterName, msaName), ca1),
+			msa: newManagedServiceAccount(clusterName, msaName).
+				withRotationValidity(500*time.Second).
+				withTokenSecretRef(msaName, now.Add(300*time.Second), now).
+				withTokenAudiences("vault").
+				build(),
+			newToken: token2,
+			validateFunc: func(t *testing.T, hubClient client.Client, actions []clienttesting.Action) {
+				assertActions(t, actions, "create", // create serviceaccount
+					"create", // create token
+				)
+				assertToken(t, hubClient, clusterName, msaName, token2, ca1)
+
+				secret := &corev1.Secret{}
+				err := hubClient.Get(context.TODO(), types.NamespacedName{
+					Namespace: clusterName,
+					Name:      msaName,
+				}, secret)
+				assert.NoError(t, err)
+				assert.Equal(t, `{"audiences":["vault"]}`, secret.Annotations[common.AnnotationKeyTokenSpec])
+			},
+		},
+		{
+			name:           "create token for service account in custom namespace",
+			spokeNamespace: clusterName,
+			msa:            newManagedServiceAccount(clusterName, msaName).withServiceAccount("ns1", "sa1", true).build(),
+			newToken:       token1,
+			validateFunc: func(t *testing.T, hubClient client.Client, actions []clienttesting.Action) {
+				assertActions(t, actions, "create", // create namespace
+					"create", // create serviceaccount
+					"create", // create token requester binding
+					"create", // create tokenrequest
+				)
+				binding := actions[2].(clienttesting.CreateAction).GetObject().(*rbacv1.RoleBinding)
+				assert.Equal(t, "ns1", binding.Namespace)
+				assert.Equal(t, common.TokenRequesterClusterRoleName, binding.RoleRef.Name)
+				assert.Equal(t, []rbacv1.Subject{{
+					Kind:      rbacv1.ServiceAccountKind,
+					Namespace: clusterName,
+					Name:      common.AgentServiceAccountName,
+				}}, binding.Subjects)
+				assert.Equal(t, "ns1", actions[3].GetNamespace())
+				assert.Equal(t, "sa1", actions[3].(clienttesting.CreateActionImpl).Name)
+				assertToken(t, hubClient, clusterName, msaName, token1, ca1)
+			},
+		},
+		{
+			name:           "refuse existing service account not created for the msa",
+			spokeNamespace: clusterName,
+			sa:             newServiceAccount("ns1", "sa1"),
+			msa:            newManagedServiceAccount(clusterName, msaName).withServiceAccount("ns1", "sa1", false).build(),
+			newToken:       token1,
+			expectedError:  "failed to ensure service account: service account ns1/sa1 exists and is not managed by the ManagedServiceAccount",
+			validateFunc: func(t *testing.T, hubClient client.Client, actions []clienttesting.Action) {
+				assertActions(t, actions, "create", // create serviceaccount
+					"get", // get serviceaccount
+				)
+			},
+		},
+		{
+			name:              "adopt existing service account",
+			spokeNamespace:    clusterName,
+			adoptionAllowlist: "# team b\nns1/*",
+			sa:                newServiceAccount("ns1", "sa1"),
+			msa:               newManagedServiceAccount(clusterName, msaName).withAdoptedServiceAccount("ns1", "sa1").build(),
+			newToken:          token1,
+			validateFunc: func(t *testing.T, hubClient client.Client, actions []clienttesting.Action) {
+				assertActions(t, actions, "get", // get serviceaccount
+					"get",    // get adoption allowlist
+					"update", // adopt serviceaccount
+					"create", // create token requester binding
+					"create", // create tokenrequest
+				)
+				sa := actions[2].(clienttesting.UpdateAction).GetObject().(*corev1.ServiceAccount)
+				assert.True(t, isServiceAccountOwnedBy(sa, clusterName, msaName))
+				assert.Equal(t, clusterName+"/"+msaName, sa.Annotations[common.AnnotationKeyAdoptedBy])
+				assertToken(t, hubClient, clusterName, msaName, token1, ca1)
+			},
+		},
+		{
+			name:              "refuse adoption not permitted by the allowlist",
+			spokeNamespace:    clusterName,
+			adoptionAllowlist: "ns2/*",
+			sa:                newServiceAccount("ns1", "sa1"),
+			msa:               newManagedServiceAccount(clusterName, msaName).withAdoptedServiceAccount("ns1", "sa1").build(),
+			newToken:          token1,
+			expectedError: "failed to ensure service account: adoption of service account ns1/sa1 is not " +
+				"permitted by the allowlist configmap cluster1/managed-serviceaccount-adoption-allowlist",
+			validateFunc: func(t *testing.T, hubClient client.Client, actions []clienttesting.Action) {
+				assertActions(t, actions, "get", // get serviceaccount
+					"get", // get adoption allowlist
+				)
+			},
+		},
+		{
+			name:           "create token failed",
+			sa:             newServiceAccount(clusterName, msaName),
+			msa:            newManagedServiceAccount(clusterName, msaName).build(),
+			newToken:       token1,
+			spokeNamespace: "fail",
+			expectedError:  "failed to sync token: failed to request token for service-account: failed to create token",
+			validateFunc: func(t *testing.T, hubClient client.Client, actions []clienttesting.Action) {
+				assertActions(t, actions, "create", // create serviceaccount
+					"create", // create tokenrequest
+				)
+				assertMSAConditions(t, hubClient, clusterName, msaName, []metav1.Condition{
+					{
+						Type:   authv1beta1.ConditionTypeTokenReported,
+						Status: metav1.ConditionFalse,
+					},
+					{
+						Type:   authv1beta1.ConditionTypeReady,
+						Status: metav1.ConditionFalse,
+					},
+				})
+			},
+		},
+		{
+			name:           "token exists",
+			spokeNamespace: clusterName,
+			sa:             newServiceAccount(clusterName, msaName),
+			secret:         newSecret(clusterName, msaName, newFakeToken(clusterName, msaName), ca1),
+			msa: newManagedServiceAccount(clusterName, msaName).
+				withRotationValidity(500*time.Second).
+				withTokenSecretRef(msaName, now.Add(300*time.Second), now).
+				build(),
+			newToken: newFakeToken(clusterName, msaName),
+			validateFunc: func(t *testing.T, hubClient client.Client, actions []clienttesting.Action) {
+				assertActions(t, actions, "create", // create serviceaccount
+					"create", // create tokenreview
+				)
+				assertToken(t, hubClient, clusterName, msaName, newFakeToken(clusterName, msaName), ca1)
+				assertMSAConditions(t, hubClient, clusterName, msaName, []metav1.Condition{
+					{
+						Type:   authv1beta1.ConditionTypeTokenReported,
+						Status: metav1.ConditionTrue,
+					},
+					{
+						Type:   authv1beta1.ConditionTypeSecretCreated,
+						Status: metav1.ConditionTrue,
+					},
+				})
+			},
+		},
+		{
+			name:           "keep the previous token on rotation",
+			spokeNamespace: clusterName,
+			sa:             newServiceAccount(clusterName, msaName),
+			secret:         newSecret(clusterName, msaName, newFakeToken(clusterName, msaName), ca1),
+			msa: newManagedServiceAccount(clusterName, msaName).
+				withRotationValidity(500*time.Second).
+				withTokenSecretRef(msaName, now.Add(60*time.Second), now.Add(-440*time.Second)).
+				withPreviousTokenGracePeriod(time.Hour).
+				build(),
+			newToken: token2,
+			validateFunc: func(t *testing.T, hubClient client.Client, actions []clienttesting.Action) {
+				assertActions(t, actions, "create", // create serviceaccount
+					"create", // create token
+				)
+				assertToken(t, hubClient, clusterName, msaName, token2, ca1)
+
+				secret := &corev1.Secret{}
+				err := hubClient.Get(context.TODO(), types.NamespacedName{Namespace: clusterName, Name: msaName}, secret)
+				assert.NoError(t, err)
+				assert.Equal(t, newFakeToken(clusterName, msaName), string(secret.Data[common.SecretKeyPreviousToken]))
+				assert.Equal(t, now.Add(60*time.Second).UTC().Format(time.RFC3339),
+					secret.Annotations[common.AnnotationKeyPreviousTokenExpiration])
+				assert.NotEmpty(t, secret.Annotations[common.AnnotationKeyTokenExpiration])
+			},
+		},
+		{
+			name:           "retain the previous token in the grace period",
+			spokeNamespace: clusterName,
+			sa:             newServiceAccount(clusterName, msaName),
+			secret: newSecret(clusterName, msaName, newFakeToken(clusterName, msaName), ca1, func(secret *corev1.Secret) {
+				secret.Data[common.SecretKeyPreviousToken] = []byte(token1)
+				secret.Annotations[common.AnnotationKeyPreviousTokenExpiration] = now.Add(time.Hour).UTC().Format(time.RFC3339)
+			}),
+			msa: newManagedServiceAccount(clusterName, msaName).
+				withRotationValidity(500*time.Second).
+				withTokenSecretRef(msaName, now.Add(300*time.Second), now).
+				withPreviousTokenGracePeriod(time.Hour).
+				build(),
+			validateFunc: func(t *testing.T, hubClient client.Client, actions []clienttesting.Action) {
+				secret := &corev1.Secret{}
+				err := hubClient.Get(context.TODO(), types.NamespacedName{Namespace: clusterName, Name: msaName}, secret)
+				assert.NoError(t, err)
+				assert.Equal(t, token1, string(secret.Data[common.SecretKeyPreviousToken]))
+				assert.Equal(t, now.Add(300*time.Second).UTC().Format(time.RFC3339),
+					secret.Annotations[common.AnnotationKeyTokenExpiration])
+			},
+		},
+		{
+			name:           "remove the previous token after the grace period",
+			spokeNamespace: clusterName,
+			sa:             newServiceAccount(clusterName, msaName),
+			secret: newSecret(clusterName, msaName, newFakeToken(clusterName, msaName), ca1, func(secret *corev1.Secret) {
+				secret.Data[common.SecretKeyPreviousToken] = []byte(token1)
+				secret.Annotations[common.AnnotationKeyPreviousTokenExpiration] = now.Add(time.Hour).UTC().Format(time.RFC3339)
+			}),
+			msa: newManagedServiceAccount(clusterName, msaName).
+				withRotationValidity(500*time.Second).
+				withTokenSecretRef(msaName, now.Add(300*time.Second), now.Add(-60*time.Second)).
+				withPreviousTokenGracePeriod(30 * time.Second).
+				build(),
+			validateFunc: func(t *testing.T, hubClient client.Client, actions []clienttesting.Action) {
+				secret := &corev1.Secret{}
+				err := hubClient.Get(context.TODO(), types.NamespacedName{Namespace: clusterName, Name: msaName}, secret)
+				assert.NoError(t, err)
+				assert.NotContains(t, secret.Data, common.SecretKeyPreviousToken)
+				assert.NotContains(t, secret.Annotations, common.AnnotationKeyPreviousTokenExpiration)
+				assertToken(t, hubClient, clusterName, msaName, newFakeToken(clusterName, msaName), ca1)
+			},
+		},
+		{
+			name:           "revoke tokens",
+			spokeNamespace: clusterName,
+			sa:             newServiceAccountWithLabels(clusterName, msaName, ownerLabels(clusterName, msaName)),
+			secret: newSecret(clusterName, msaName, newFakeToken(clusterName, msaName), ca1, func(secret *corev1.Secret) {
+				secret.Data[common.SecretKeyPreviousToken] = []byte(token1)
+				secret.Annotations[common.AnnotationKeyPreviousTokenExpiration] = now.Add(time.Hour).UTC().Format(time.RFC3339)
+			}),
+			msa: newManagedServiceAccount(clusterName, msaName).
+				withRotationValidity(500*time.Second).
+				withTokenSecretRef(msaName, now.Add(300*time.Second), now).
+				withPreviousTokenGracePeriod(time.Hour).
+				withRevocationGeneration(1).
+				build(),
+			newToken: token2,
+			expectedEvents: []string{
+				"Normal TokensRevoked Revoked the tokens of the service account cluster1/msa1 at generation 1",
+				"Normal ServiceAccountCreated Created the service account cluster1/msa1 on the managed cluster",
+				"Normal TokenIssued Issued the token",
+			},
+			validateFunc: func(t *testing.T, hubClient client.Client, actions []clienttesting.Action) {
+				assertActions(t, actions, "get", // get serviceaccount
+					"delete", // delete serviceaccount
+					"create", // recreate serviceaccount
+					"create", // create token
+				)
+				assertToken(t, hubClient, clusterName, msaName, token2, ca1)
+
+				secret := &corev1.Secret{}
+				err := hubClient.Get(context.TODO(), types.NamespacedName{Namespace: clusterName, Name: msaName}, secret)
+				assert.NoError(t, err)
+				assert.NotContains(t, secret.Data, common.SecretKeyPreviousToken)
+
+				msa := &authv1beta1.ManagedServiceAccount{}
+				err = hubClient.Get(context.TODO(), types.NamespacedName{Namespace: clusterName, Name: msaName}, msa)
+				assert.NoError(t, err)
+				assert.NotNil(t, msa.Status.LastRevocation)
+				assert.Equal(t, int64(1), msa.Status.LastRevocation.Generation)
+				assert.Equal(t, []string{"fake-jti-1234"}, msa.Status.LastRevocation.RevokedTokenIDs)
+				assert.True(t, meta.IsStatusConditionTrue(msa.Status.Conditions, authv1beta1.ConditionTypeTokensRevoked))
+				assert.Equal(t, int64(1), msa.Status.RotationCount)
+			},
+		},
+		{
+			name:           "refuse to revoke tokens of foreign service account",
+			spokeNamespace: clusterName,
+			sa:             newServiceAccount("kube-system", "coredns"),
+			msa: newManagedServiceAccount(clusterName, msaName).
+				withServiceAccount("kube-system", "coredns", false).
+				withRevocationGeneration(1).
+				build(),
+			newToken:      token1,
+			expectedError: "failed to ensure service account: service account kube-system/coredns exists and is not managed by the ManagedServiceAccount",
+			validateFunc: func(t *testing.T, hubClient client.Client, actions []clienttesting.Action) {
+				// the foreign service account is never deleted
+				assertActions(t, actions, "get", // get serviceaccount
+					"create", // create serviceaccount
+					"get",    // get serviceaccount
+				)
+
+				msa := &authv1beta1.ManagedServiceAccount{}
+				err := hubClient.Get(context.TODO(), types.NamespacedName{Namespace: clusterName, Name: msaName}, msa)
+				assert.NoError(t, err)
+				assert.NotNil(t, msa.Status.LastRevocation)
+				assert.Equal(t, int64(1), msa.Status.LastRevocation.Generation)
+				revoked := meta.FindStatusCondition(msa.Status.Conditions, authv1beta1.ConditionTypeTokensRevoked)
+				assert.NotNil(t, revoked)
+				assert.Equal(t, metav1.ConditionFalse, revoked.Status)
+				assert.Equal(t, "RevocationNotSupported", revoked.Reason)
+			},
+		},
+		{
+			name:           "revoked tokens already",
+			spokeNamespace: clusterName,
+			sa:             newServiceAccount(clusterName, msaName),
+			secret:         newSecret(clusterName, msaName, newFakeToken(clusterName, msaName), ca1),
+			msa: newManagedServiceAccount(clusterName, msaName).
+				withRotationValidity(500*time.Second).
+				withTokenSecretRef(msaName, now.Add(300*time.Second), now).
+				withRevocationGeneration(1).
+				withLastRevocation(1).
+				build(),
+			validateFunc: func(t *testing.T, hubClient client.Client, actions []clienttesting.Action) {
+				assertActions(t, actions, "create", // create serviceaccount
+					"create", // create tokenreview
+				)
+				assertToken(t, hubClient, clusterName, msaName, newFakeToken(clusterName, msaName), ca1)
+			},
+		},
+		{
+			name:              "refuse to revoke tokens of adopted service account",
+			spokeNamespace:    "open-cluster-management-agent-addon",
+			sa:                newServiceAccount("default", "app"),
+			adoptionAllowlist: "default/*",
+			msa: newManagedServiceAccount(clusterName, msaName).
+				withAdoptedServiceAccount("default", "app").
+				withRevocationGeneration(1).
+				build(),
+			newToken: token1,
+			validateFunc: func(t *testing.T, hubClient client.Client, actions []clienttesting.Action) {
+				assertActions(t, actions, "get", // get serviceaccount
+					"get",    // get adoption allowlist
+					"update", // adopt serviceaccount
+					"create", // create token requester binding
+					"create", // create tokenrequest
+				)
+				assertToken(t, hubClient, clusterName, msaName, token1, ca1)
+
+				msa := &authv1beta1.ManagedServiceAccount{}
+				err := hubClient.Get(context.TODO(), types.NamespacedName{Namespace: clusterName, Name: msaName}, msa)
+				assert.NoError(t, err)
+				assert.NotNil(t, msa.Status.LastRevocation)
+				assert.Equal(t, int64(1), msa.Status.LastRevocation.Generation)
+				assert.Empty(t, msa.Status.LastRevocation.RevokedTokenIDs)
+				revoked := meta.FindStatusCondition(msa.Status.Conditions, authv1beta1.ConditionTypeTokensRevoked)
+				assert.NotNil(t, revoked)
+				assert.Equal(t, metav1.ConditionFalse, revoked.Status)
+				assert.Equal(t, "RevocationNotSupported", revoked.Reason)
+			},
+		},
+		{
+			name:           "reissue token on request",
+			spokeNamespace: clusterName,
+			sa:             newServiceAccount(clusterName, msaName),
+			secret:         newSecret(clusterName, msaName, newFakeToken(clusterName, msaName), ca1),
+			msa: newManagedServiceAccount(clusterName, msaName).
+				withRotationValidity(500*time.Second).
+				withTokenSecretRef(msaName, now.Add(300*time.Second), now.Add(-60*time.Second)).
+				withReissueAfter(now).
+				build(),
+			newToken: token2,
+			validateFunc: func(t *testing.T, hubClient client.Client, actions []clienttesting.Action) {
+				assertActions(t, actions, "create", // create serviceaccount
+					"create", // create token
+				)
+				assertToken(t, hubClient, clusterName, msaName, token2, ca1)
+			},
+		},
+		{
+			name:           "reissue token on the request of a credential revocation",
+			spokeNamespace: clusterName,
+			sa:             newServiceAccount(clusterName, msaName),
+			secret:         newSecret(clusterName, msaName, newFakeToken(clusterName, msaName), ca1),
+			msa: newManagedServiceAccount(clusterName, msaName).
+				withRotationValidity(500*time.Second).
+				withTokenSecretRef(msaName, now.Add(300*time.Second), now.Add(time.Hour)).
+				withCredentialRevocation("drill", false).
+				build(),
+			newToken: token2,
+			validateFunc: func(t *testing.T, hubClient client.Client, actions []clienttesting.Action) {
+				assertActions(t, actions, "create", // create serviceaccount
+					"create", // create token
+				)
+				assertToken(t, hubClient, clusterName, msaName, token2, ca1)
+				msa := &authv1beta1.ManagedServiceAccount{}
+				err := hubClient.Get(context.TODO(), types.NamespacedName{Namespace: clusterName, Name: msaName}, msa)
+				assert.NoError(t, err)
+				assert.Equal(t, &authv1beta1.CredentialRevocationReference{
+					Name: "drill", UID: "drill-uid", Generation: 1,
+				}, msa.Status.LastCredentialRevocation)
+			},
+		},
+		{
+			name:           "credential revocation handled already",
+			spokeNamespace: clusterName,
+			sa:             newServiceAccount(clusterName, msaName),
+			secret:         newSecret(clusterName, msaName, newFakeToken(clusterName, msaName), ca1),
+			msa: newManagedServiceAccount(clusterName, msaName).
+				withRotationValidity(500*time.Second).
+				withTokenSecretRef(msaName, now.Add(300*time.Second), now).
+				withCredentialRevocation("drill", true).
+				build(),
+			newToken: token2,
+			validateFunc: func(t *testing.T, hubClient client.Client, actions []clienttesting.Action) {
+				assertActions(t, actions, "create", // create serviceaccount
+					"create", // create tokenreview
+				)
+				assertToken(t, hubClient, clusterName, msaName, newFakeToken(clusterName, msaName), ca1)
+			},
+		},
+		{
+			name:     "create token secret with prescribed name and labels",
+			sa:       newServiceAccount(clusterName, msaName),
+			msa:      newManagedServiceAccount(clusterName, msaName).withSecretProjection("custom", map[string]string{"app": "demo"}).build(),
+			newToken: token1,
+			expectedEvents: []string{
+				"Normal ServiceAccountCreated Created the service account /msa1 on the managed cluster",
+				"Normal TokenIssued Issued the token",
+			},
+			validateFunc: func(t *testing.T, hubClient client.Client, actions []clienttesting.Action) {
+				assertActions(t, actions, "create", // create serviceaccount
+					"create", // create tokenrequest
+				)
+				assertToken(t, hubClient, clusterName, "custom", token1, ca1)
+				secret := &corev1.Secret{}
+				err := hubClient.Get(context.TODO(), types.NamespacedName{Namespace: clusterName, Name: "custom"}, secret)
+				assert.NoError(t, err)
+				assert.Equal(t, "demo", secret.Labels["app"])
+				assert.Equal(t, msaName, secret.Labels[common.LabelKeyManagedServiceAccountName])
+
+				msa := &authv1beta1.ManagedServiceAccount{}
+				err = hubClient.Get(context.TODO(), types.NamespacedName{Namespace: clusterName, Name: msaName}, msa)
+				assert.NoError(t, err)
+				assert.Equal(t, "custom", msa.Status.TokenSecretRef.Name)
+			},
+		},
+		{
+			name:           "move token to the renamed secret",
+			spokeNamespace: clusterName,
+			sa:             newServiceAccount(clusterName, msaName),
+			secret: newSecret(clusterName, msaName, newFakeToken(clusterName, msaName), ca1,
+				withTokenSecretOwner(newManagedServiceAccount(clusterName, msaName).build())),
+			msa: newManagedServiceAccount(clusterName, msaName).
+				withRotationValidity(500*time.Second).
+				withTokenSecretRef(msaName, now.Add(300*time.Second), now).
+				withSecretProjection("custom", nil).
+				build(),
+			newToken: token2,
 			validateFunc: func(t *testing.T, hubClient client.Client, actions []clienttesting.Action) {
-				assertActions(t, actions,
-					"get",    // get service account
-					"delete", // delete service account
+				assertActions(t, actions, "create", // create serviceaccount
+					"create", // create tokenrequest
 				)
+				assertToken(t, hubClient, clusterName, "custom", token2, ca1)
+				err := hubClient.Get(context.TODO(), types.NamespacedName{Namespace: clusterName, Name: msaName}, &corev1.Secret{})
+				assert.True(t, apierrors.IsNotFound(err), "the stale secret should be deleted")
 			},
 		},
 		{
-			name:          "error to get msa",
-			getError:      errors.New("internal error"),
-			expectedError: "fail to get managed serviceaccount: internal error",
+			name:           "keep the stale secret not owned by the managed serviceaccount",
+			spokeNamespace: clusterName,
+			sa:             newServiceAccount(clusterName, msaName),
+			secret:         newSecret(clusterName, msaName, token1, ca1),
+			msa: newManagedServiceAccount(clusterName, msaName).
+				withRotationValidity(500*time.Second).
+				withTokenSecretRef(msaName, now.Add(300*time.Second), now).
+				withSecretProjection("custom", nil).
+				build(),
+			newToken: token2,
+			validateFunc: func(t *testing.T, hubClient client.Client, actions []clienttesting.Action) {
+				assertToken(t, hubClient, clusterName, "custom", token2, ca1)
+				assertToken(t, hubClient, clusterName, msaName, token1, ca1)
+			},
 		},
 		{
-			name:     "create token",
-			sa:       newServiceAccount(clusterName, msaName),
-			msa:      newManagedServiceAccount(clusterName, msaName).build(),
-			newToken: token1,
+			name:           "update secret labels without refreshing token",
+			spokeNamespace: clusterName,
+			sa:             newServiceAccount(clusterName, msaName),
+			secret:         newSecret(clusterName, msaName, newFakeToken(clusterName, msaName), ca1),
+			msa: newManagedServiceAccount(clusterName, msaName).
+				withRotationValidity(500*time.Second).
+				withTokenSecretRef(msaName, now.Add(300*time.Second), now).
+				withSecretProjection("", map[string]string{"app": "demo"}).
+				build(),
+			newToken: token2,
 			validateFunc: func(t *testing.T, hubClient client.Client, actions []clienttesting.Action) {
 				assertActions(t, actions, "create", // create serviceaccount
-					"create", // create tokenrequest
+					"create", // create tokenreview
 				)
+				assertToken(t, hubClient, clusterName, msaName, newFakeToken(clusterName, msaName), ca1)
+				secret := &corev1.Secret{}
+				err := hubClient.Get(context.TODO(), types.NamespacedName{Namespace: clusterName, Name: msaName}, secret)
+				assert.NoError(t, err)
+				assert.Equal(t, "demo", secret.Labels["app"])
+			},
+		},
+		{
+			name:           "refuse to overwrite secret not created by the agent",
+			spokeNamespace: clusterName,
+			sa:             newServiceAccount(clusterName, msaName),
+			secret:         newSecret(clusterName, "custom", token1, ca1),
+			msa:            newManagedServiceAccount(clusterName, msaName).withSecretProjection("custom", nil).build(),
+			newToken:       token2,
+			expectedError:  "failed to sync token: secret cluster1/custom exists and is not managed by the ManagedServiceAccount",
+			expectedEvents: []string{
+				"Warning SecretConflict Refused to overwrite the secret cluster1/custom which is not managed by the ManagedServiceAccount",
+			},
+			validateFunc: func(t *testing.T, hubClient client.Client, actions []clienttesting.Action) {
+				assertToken(t, hubClient, clusterName, "custom", token1, ca1)
+			},
+		},
+		{
+			name:           "token is not projected",
+			spokeNamespace: clusterName,
+			sa:             newServiceAccount(clusterName, msaName),
+			secret: newSecret(clusterName, msaName, newFakeToken(clusterName, msaName), ca1,
+				withTokenSecretOwner(newManagedServiceAccount(clusterName, msaName).build())),
+			msa: newManagedServiceAccount(clusterName, msaName).
+				withRotationValidity(500*time.Second).
+				withTokenSecretRef(msaName, now.Add(300*time.Second), now).
+				withProjectionType(authv1beta1.ProjectionTypeNone).
+				build(),
+			newToken: token2,
+			validateFunc: func(t *testing.T, hubClient client.Client, actions []clienttesting.Action) {
+				assertActions(t, actions, "create") // create serviceaccount
+				err := hubClient.Get(context.TODO(), types.NamespacedName{Namespace: clusterName, Name: msaName}, &corev1.Secret{})
+				assert.True(t, apierrors.IsNotFound(err), "the token secret should be deleted")
 
-				assertToken(t, hubClient, clusterName, msaName, token1, ca1)
+				msa := &authv1beta1.ManagedServiceAccount{}
+				err = hubClient.Get(context.TODO(), types.NamespacedName{Namespace: clusterName, Name: msaName}, msa)
+				assert.NoError(t, err)
+				assert.Nil(t, msa.Status.TokenSecretRef)
+				assert.Nil(t, msa.Status.ExpirationTimestamp)
 				assertMSAConditions(t, hubClient, clusterName, msaName, []metav1.Condition{
 					{
 						Type:   authv1beta1.ConditionTypeTokenReported,
-						Status: metav1.ConditionTrue,
+						Status: metav1.ConditionFalse,
 					},
 					{
-						Type:   authv1beta1.ConditionTypeSecretCreated,
+						Type:   authv1beta1.ConditionTypeReady,
 						Status: metav1.ConditionTrue,
 					},
 				})
 			},
 		},
 		{
-			name:           "create token failed",
-			sa:             newServiceAccount(clusterName, msaName),
-			msa:            newManagedServiceAccount(clusterName, msaName).build(),
-			newToken:       token1,
-			spokeNamespace: "fail",
-			expectedError:  "failed to sync token: failed to request token for service-account: failed to create token",
+			name: "create token secret in kubeconfig format",
+			sa:   newServiceAccount(clusterName, msaName),
+			cluster: &clusterv1.ManagedCluster{
+				ObjectMeta: metav1.ObjectMeta{Name: clusterName},
+				Spec: clusterv1.ManagedClusterSpec{
+					ManagedClusterClientConfigs: []clusterv1.ClientConfig{
+						{URL: "https://cluster1:6443", CABundle: []byte(ca2)},
+					},
+				},
+			},
+			msa:      newManagedServiceAccount(clusterName, msaName).withKubeconfigProjection("").build(),
+			newToken: token1,
 			validateFunc: func(t *testing.T, hubClient client.Client, actions []clienttesting.Action) {
 				assertActions(t, actions, "create", // create serviceaccount
 					"create", // create tokenrequest
 				)
-				assertMSAConditions(t, hubClient, clusterName, msaName, []metav1.Condition{
-					{
-						Type:   authv1beta1.ConditionTypeTokenReported,
-						Status: metav1.ConditionFalse,
-					},
-				})
+				assertToken(t, hubClient, clusterName, msaName, token1, ca1)
+				assertKubeconfig(t, hubClient, clusterName, msaName, "https://cluster1:6443", token1, ca2)
 			},
 		},
 		{
-			name:           "token exists",
+			name:     "create token secret in kubeconfig format with server override",
+			sa:       newServiceAccount(clusterName, msaName),
+			msa:      newManagedServiceAccount(clusterName, msaName).withKubeconfigProjection("https://proxy:8090").build(),
+			newToken: token1,
+			validateFunc: func(t *testing.T, hubClient client.Client, actions []clienttesting.Action) {
+				assertToken(t, hubClient, clusterName, msaName, token1, ca1)
+				assertKubeconfig(t, hubClient, clusterName, msaName, "https://proxy:8090", token1, ca1)
+			},
+		},
+		{
+			name:          "no server url for kubeconfig format",
+			sa:            newServiceAccount(clusterName, msaName),
+			cluster:       &clusterv1.ManagedCluster{ObjectMeta: metav1.ObjectMeta{Name: clusterName}},
+			msa:           newManagedServiceAccount(clusterName, msaName).withKubeconfigProjection("").build(),
+			newToken:      token1,
+			expectedError: "failed to sync token: no server URL found in the client configs of managed cluster cluster1",
+		},
+		{
+			name:                 "managed cluster not readable for kubeconfig format",
+			sa:                   newServiceAccount(clusterName, msaName),
+			managedClusterDenied: true,
+			msa:                  newManagedServiceAccount(clusterName, msaName).withKubeconfigProjection("").build(),
+			newToken:             token1,
+			expectedError: "failed to sync token: the agent is not permitted to read managed cluster cluster1 on the " +
+				"hub cluster, set spec.projection.secret.server instead",
+		},
+		{
+			name:           "write kubeconfig without refreshing token",
 			spokeNamespace: clusterName,
 			sa:             newServiceAccount(clusterName, msaName),
 			secret:         newSecret(clusterName, msaName, newFakeToken(clusterName, msaName), ca1),
 			msa: newManagedServiceAccount(clusterName, msaName).
 				withRotationValidity(500*time.Second).
 				withTokenSecretRef(msaName, now.Add(300*time.Second), now).
+				withKubeconfigProjection("https://proxy:8090").
 				build(),
-			newToken: newFakeToken(clusterName, msaName),
+			newToken: token2,
 			validateFunc: func(t *testing.T, hubClient client.Client, actions []clienttesting.Action) {
 				assertActions(t, actions, "create", // create serviceaccount
 					"create", // create tokenreview
 				)
-				assertToken(t, hubClient, clusterName, msaName, newFakeToken(clusterName, msaName), ca1)
-				assertMSAConditions(t, hubClient, clusterName, msaName, []metav1.Condition{
-					{
-						Type:   authv1beta1.ConditionTypeTokenReported,
-						Status: metav1.ConditionTrue,
-					},
-					{
-						Type:   authv1beta1.ConditionTypeSecretCreated,
-						Status: metav1.ConditionTrue,
-					},
-				})
+				assertKubeconfig(t, hubClient, clusterName, msaName, "https://proxy:8090",
+					newFakeToken(clusterName, msaName), ca1)
 			},
 		},
 		{
@@ -221,6 +884,10 @@ func TestReconcile(t *testing.T) {
 				build(),
 			newToken:               token1,
 			isExistingTokenInvalid: true,
+			expectedEvents: []string{
+				"Warning TokenInvalid The token is rejected by the TokenReview on the managed cluster",
+				"Normal TokenRotated Rotated the token",
+			},
 			validateFunc: func(t *testing.T, hubClient client.Client, actions []clienttesting.Action) {
 				assertActions(t, actions, "create", // create serviceaccount
 					"create", // create tokenreview
@@ -295,6 +962,17 @@ func TestReconcile(t *testing.T) {
 			if c.sa != nil {
 				objs = append(objs, c.sa)
 			}
+			if len(c.adoptionAllowlist) > 0 {
+				objs = append(objs, &corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: c.spokeNamespace,
+						Name:      common.AdoptionAllowlistConfigMapName,
+					},
+					Data: map[string]string{
+						common.AdoptionAllowlistKey: c.adoptionAllowlist,
+					},
+				})
+			}
 			fakeKubeClient := fakekube.NewSimpleClientset(objs...)
 			fakeKubeClient.PrependReactor(
 				"create",
@@ -304,7 +982,14 @@ func TestReconcile(t *testing.T) {
 						if action.GetNamespace() == "fail" {
 							return true, nil, errors.New("failed to create token")
 						}
+						audiences := action.(clienttesting.CreateAction).GetObject().(*authv1.TokenRequest).Spec.Audiences
+						if len(audiences) == 0 {
+							audiences = []string{"https://kubernetes.default.svc"}
+						}
 						return true, &authv1.TokenRequest{
+							Spec: authv1.TokenRequestSpec{
+								Audiences: audiences,
+							},
 							Status: authv1.TokenRequestStatus{
 								Token:               c.newToken,
 								ExpirationTimestamp: metav1.NewTime(time.Now().Add(500 * time.Second)),
@@ -331,6 +1016,7 @@ func TestReconcile(t *testing.T) {
 			testscheme := runtime.NewScheme()
 			authv1beta1.AddToScheme(testscheme)
 			corev1.AddToScheme(testscheme)
+			clusterv1.AddToScheme(testscheme)
 			var objects []client.Object
 			if c.msa != nil {
 				objects = append(objects, c.msa)
@@ -338,22 +1024,29 @@ func TestReconcile(t *testing.T) {
 			if c.secret != nil {
 				objects = append(objects, c.secret)
 			}
+			if c.cluster != nil {
+				objects = append(objects, c.cluster)
+			}
 
 			hubClient := fake.NewClientBuilder().WithScheme(testscheme).WithObjects(objects...).
 				WithStatusSubresource(objects...).Build()
+			recorder := events.NewFakeRecorder(10)
 			reconciler := TokenReconciler{
 				Cache: &fakeCache{
 					msa:      c.msa,
 					getError: c.getError,
 				},
 				SpokeNativeClient: fakeKubeClient,
+				SpokeCache:        newFakeSpokeCache(fakeKubeClient),
 				HubClient:         hubClient,
 				SpokeClientConfig: &rest.Config{
 					TLSClientConfig: rest.TLSClientConfig{
 						CAData: []byte(ca1),
 					},
 				},
-				SpokeNamespace: c.spokeNamespace,
+				SpokeNamespace:     c.spokeNamespace,
+				EventRecorder:      recorder,
+				ReadManagedCluster: !c.managedClusterDenied,
 			}
 
 			_, err := reconciler.Reconcile(context.Background(), reconcile.Request{NamespacedName: types.NamespacedName{
@@ -364,6 +1057,9 @@ func TestReconcile(t *testing.T) {
 			if len(c.expectedError) != 0 {
 				assert.EqualError(t, err, c.expectedError)
 			}
+			if c.expectedEvents != nil {
+				assertEvents(t, recorder, c.expectedEvents...)
+			}
 			if c.validateFunc != nil {
 				c.validateFunc(t, hubClient, fakeKubeClient.Actions())
 			}
@@ -372,6 +1068,21 @@ func TestReconcile(t *testing.T) {
 	}
 }
 
+// assertEvents checks the recorded events start with the expected ones in order.
+func assertEvents(t *testing.T, recorder *events.FakeRecorder, expected ...string) {
+	close(recorder.Events)
+	recorded := []string{}
+	for event := range recorder.Events {
+		recorded = append(recorded, event)
+	}
+	if !assert.Len(t, recorded, len(expected), "recorded events: %v", recorded) {
+		return
+	}
+	for i := range expected {
+		assert.True(t, strings.HasPrefix(recorded[i], expected[i]), "expected %q, got %q", expected[i], recorded[i])
+	}
+}
+
 type fakeCache struct {
 	msa      *authv1beta1.ManagedServiceAccount
 	getError error
@@ -434,6 +1145,58 @@ func (f fakeCache) RemoveInformer(ctx context.Context, obj client.Object) error
 	panic("implement me")
 }
 
+// fakeSpokeCache serves the lists of the spoke cache from the tracker of the fake clientset, so that
+// the lists are not recorded in the actions of the clientset.
+type fakeSpokeCache struct {
+	cache.Cache
+	tracker clienttesting.ObjectTracker
+}
+
+func newFakeSpokeCache(kubeClient *fakekube.Clientset) *fakeSpokeCache {
+	return &fakeSpokeCache{tracker: kubeClient.Tracker()}
+}
+
+func (f *fakeSpokeCache) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	var gvk schema.GroupVersionKind
+	switch list.(type) {
+	case *corev1.ServiceAccountList:
+		gvk = corev1.SchemeGroupVersion.WithKind("ServiceAccount")
+	case *rbacv1.RoleList:
+		gvk = rbacv1.SchemeGroupVersion.WithKind("Role")
+	case *rbacv1.RoleBindingList:
+		gvk = rbacv1.SchemeGroupVersion.WithKind("RoleBinding")
+	case *rbacv1.ClusterRoleList:
+		gvk = rbacv1.SchemeGroupVersion.WithKind("ClusterRole")
+	case *rbacv1.ClusterRoleBindingList:
+		gvk = rbacv1.SchemeGroupVersion.WithKind("ClusterRoleBinding")
+	default:
+		panic("implement me")
+	}
+	gvr, _ := meta.UnsafeGuessKindToResource(gvk)
+
+	listOptions := &client.ListOptions{}
+	listOptions.ApplyOptions(opts)
+	objects, err := f.tracker.List(gvr, gvk, listOptions.Namespace)
+	if err != nil {
+		return err
+	}
+	items, err := meta.ExtractList(objects)
+	if err != nil {
+		return err
+	}
+	var matched []runtime.Object
+	for _, item := range items {
+		accessor, err := meta.Accessor(item)
+		if err != nil {
+			return err
+		}
+		if listOptions.LabelSelector == nil || listOptions.LabelSelector.Matches(labels.Set(accessor.GetLabels())) {
+			matched = append(matched, item)
+		}
+	}
+	return meta.SetList(list, matched)
+}
+
 type managedServiceAccountBuilder struct {
 	msa *authv1beta1.ManagedServiceAccount
 }
@@ -460,6 +1223,74 @@ func (b *managedServiceAccountBuilder) withRotationValidity(duration time.Durati
 	return b
 }
 
+func (b *managedServiceAccountBuilder) withServiceAccount(namespace, name string,
+	createNamespace bool) *managedServiceAccountBuilder {
+	b.msa.Spec.ServiceAccount = &authv1beta1.SpokeServiceAccount{
+		Namespace:       namespace,
+		Name:            name,
+		CreateNamespace: createNamespace,
+	}
+	return b
+}
+
+func (b *managedServiceAccountBuilder) withAdoptedServiceAccount(namespace, name string) *managedServiceAccountBuilder {
+	b.msa.Spec.ServiceAccount = &authv1beta1.SpokeServiceAccount{
+		Namespace: namespace,
+		Name:      name,
+		Mode:      authv1beta1.ServiceAccountModeAdopt,
+	}
+	return b
+}
+
+func (b *managedServiceAccountBuilder) withProjectionType(projectionType authv1beta1.ProjectionType) *managedServiceAccountBuilder {
+	b.msa.Spec.Projection = &authv1beta1.ManagedServiceAccountProjection{
+		Type: projectionType,
+	}
+	return b
+}
+
+func (b *managedServiceAccountBuilder) withKubeconfigProjection(server string) *managedServiceAccountBuilder {
+	b.msa.Spec.Projection = &authv1beta1.ManagedServiceAccountProjection{
+		Type: authv1beta1.ProjectionTypeSecret,
+		Secret: &authv1beta1.SecretProjection{
+			Format: authv1beta1.SecretFormatKubeconfig,
+			Server: server,
+		},
+	}
+	return b
+}
+
+func (b *managedServiceAccountBuilder) withSecretProjection(name string,
+	labels map[string]string) *managedServiceAccountBuilder {
+	b.msa.Spec.Projection = &authv1beta1.ManagedServiceAccountProjection{
+		Type: authv1beta1.ProjectionTypeSecret,
+		Secret: &authv1beta1.SecretProjection{
+			Name:   name,
+			Labels: labels,
+		},
+	}
+	return b
+}
+
+func (b *managedServiceAccountBuilder) withTokenAudiences(audiences ...string) *managedServiceAccountBuilder {
+	if b.msa.Spec.Token == nil {
+		b.msa.Spec.Token = &authv1beta1.ManagedServiceAccountToken{}
+	}
+	b.msa.Spec.Token.Audiences = audiences
+	return b
+}
+
+func (b *managedServiceAccountBuilder) withBoundPod(name string) *managedServiceAccountBuilder {
+	if b.msa.Spec.Token == nil {
+		b.msa.Spec.Token = &authv1beta1.ManagedServiceAccountToken{}
+	}
+	b.msa.Spec.Token.BoundObjectRef = &authv1beta1.BoundObjectReference{
+		Kind: "Pod",
+		Name: name,
+	}
+	return b
+}
+
 func (b *managedServiceAccountBuilder) withTokenSecretRef(secretName string,
 	expiration, lastRefresh time.Time) *managedServiceAccountBuilder {
 	b.msa.Status.TokenSecretRef = &authv1beta1.SecretRef{
@@ -471,6 +1302,51 @@ func (b *managedServiceAccountBuilder) withTokenSecretRef(secretName string,
 	return b
 }
 
+func (b *managedServiceAccountBuilder) withPreviousTokenGracePeriod(gracePeriod time.Duration) *managedServiceAccountBuilder {
+	b.msa.Spec.Rotation.PreviousTokenGracePeriod = &metav1.Duration{Duration: gracePeriod}
+	return b
+}
+
+func (b *managedServiceAccountBuilder) withRevocationGeneration(generation int64) *managedServiceAccountBuilder {
+	b.msa.Spec.RevocationGeneration = generation
+	return b
+}
+
+func (b *managedServiceAccountBuilder) withLastRevocation(generation int64) *managedServiceAccountBuilder {
+	b.msa.Status.LastRevocation = &authv1beta1.TokenRevocation{
+		Generation: generation,
+		Timestamp:  metav1.Now(),
+	}
+	return b
+}
+
+func (b *managedServiceAccountBuilder) withReissueAfter(reissueAfter time.Time) *managedServiceAccountBuilder {
+	if b.msa.Annotations == nil {
+		b.msa.Annotations = map[string]string{}
+	}
+	b.msa.Annotations[common.AnnotationKeyReissueAfter] = reissueAfter.UTC().Format(time.RFC3339)
+	return b
+}
+
+// withCredentialRevocation dispatches the CredentialRevocation to the ManagedServiceAccount, and echoes
+// it in the status if it is handled already.
+func (b *managedServiceAccountBuilder) withCredentialRevocation(name string, handled bool) *managedServiceAccountBuilder {
+	if b.msa.Annotations == nil {
+		b.msa.Annotations = map[string]string{}
+	}
+	b.msa.Annotations[common.AnnotationKeyCredentialRevocation] = name
+	b.msa.Annotations[common.AnnotationKeyCredentialRevocationUID] = name + "-uid"
+	b.msa.Annotations[common.AnnotationKeyCredentialRevocationGeneration] = "1"
+	if handled {
+		b.msa.Status.LastCredentialRevocation = &authv1beta1.CredentialRevocationReference{
+			Name:       name,
+			UID:        types.UID(name + "-uid"),
+			Generation: 1,
+		}
+	}
+	return b
+}
+
 func newSecret(namespace, name, token, ca string, modifiers ...func(*corev1.Secret)) *corev1.Secret {
 	secret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
@@ -493,6 +1369,13 @@ func newSecret(namespace, name, token, ca string, modifiers ...func(*corev1.Secr
 	return secret
 }
 
+// withTokenSecretOwner labels the secret as the token secret owned by the ManagedServiceAccount.
+func withTokenSecretOwner(managed *authv1beta1.ManagedServiceAccount) func(*corev1.Secret) {
+	return func(secret *corev1.Secret) {
+		setSecretMetadata(managed, secret)
+	}
+}
+
 func newServiceAccount(namespace, name string) *corev1.ServiceAccount {
 	return &corev1.ServiceAccount{
 		ObjectMeta: metav1.ObjectMeta{
@@ -551,6 +1434,24 @@ func assertToken(t *testing.T, client client.Client, secretNamespace, secretName
 	assert.Equal(t, ca, string(caData), "unexpected ca")
 }
 
+func assertKubeconfig(t *testing.T, client client.Client, secretNamespace, secretName, server, token, ca string) {
+	secret := &corev1.Secret{}
+	err := client.Get(context.TODO(), types.NamespacedName{
+		Namespace: secretNamespace,
+		Name:      secretName,
+	}, secret)
+	assert.NoError(t, err)
+	assert.Equal(t, server, string(secret.Data[common.SecretKeyServer]))
+
+	config, err := clientcmd.Load(secret.Data[common.SecretKeyKubeconfig])
+	assert.NoError(t, err)
+	restConfig, err := clientcmd.NewDefaultClientConfig(*config, nil).ClientConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, server, restConfig.Host)
+	assert.Equal(t, token, restConfig.BearerToken)
+	assert.Equal(t, ca, string(restConfig.CAData))
+}
+
 func assertMSAConditions(t *testing.T, client client.Client, msaNamespace, msaName string, expected []metav1.Condition) {
 	msa := &authv1beta1.ManagedServiceAccount{}
 	err := client.Get(context.TODO(), types.NamespacedName{
@@ -565,10 +1466,106 @@ func assertMSAConditions(t *testing.T, client client.Client, msaNamespace, msaNa
 	}
 }
 
+func TestReconcileLongManagedServiceAccountName(t *testing.T) {
+	msaName := strings.Repeat("a", 100)
+	msa := newManagedServiceAccount("cluster1", msaName).withServiceAccount("ns1", "sa1", false).build()
+	fakeKubeClient := fakekube.NewSimpleClientset()
+	reconciler := TokenReconciler{
+		SpokeNativeClient: fakeKubeClient,
+		SpokeCache:        newFakeSpokeCache(fakeKubeClient),
+		SpokeNamespace:    "open-cluster-management-agent-addon",
+		EventRecorder:     events.NewFakeRecorder(10),
+	}
+
+	assert.NoError(t, reconciler.ensureServiceAccount(context.TODO(), msa))
+	sa, err := fakeKubeClient.CoreV1().ServiceAccounts("ns1").Get(context.TODO(), "sa1", metav1.GetOptions{})
+	assert.NoError(t, err)
+	for key, value := range sa.Labels {
+		assert.Empty(t, validation.IsValidLabelValue(value), "invalid value of label %s", key)
+	}
+	assert.Equal(t, msaName, sa.Annotations[common.AnnotationKeyManagedServiceAccountName])
+	assert.True(t, isServiceAccountOwnedBy(sa, "cluster1", msaName))
+	assert.False(t, isServiceAccountOwnedBy(sa, "cluster1", strings.Repeat("a", 99)+"b"))
+	// the existing service account is recognized on the later reconciles
+	assert.NoError(t, reconciler.ensureServiceAccount(context.TODO(), msa))
+
+	secret := &corev1.Secret{}
+	setSecretMetadata(msa, secret)
+	for key, value := range secret.Labels {
+		assert.Empty(t, validation.IsValidLabelValue(value), "invalid value of label %s", key)
+	}
+	assert.Equal(t, msaName, secret.Annotations[common.AnnotationKeyManagedServiceAccountName])
+
+	assert.NoError(t, reconciler.deleteServiceAccounts(context.TODO(), "cluster1", msaName))
+	_, err = fakeKubeClient.CoreV1().ServiceAccounts("ns1").Get(context.TODO(), "sa1", metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+}
+
+func TestSetManagedServiceAccountReadyCondition(t *testing.T) {
+	tokenReported := metav1.Condition{
+		Type:   authv1beta1.ConditionTypeTokenReported,
+		Status: metav1.ConditionTrue,
+		Reason: "TokenReported",
+	}
+	cases := []struct {
+		name           string
+		msa            *authv1beta1.ManagedServiceAccount
+		conditions     []metav1.Condition
+		expectedStatus metav1.ConditionStatus
+		expectedReason string
+	}{
+		{
+			name:           "token not reported",
+			msa:            newManagedServiceAccount("cluster1", "msa1").build(),
+			expectedStatus: metav1.ConditionFalse,
+			expectedReason: "TokenNotReported",
+		},
+		{
+			name:           "token reported",
+			msa:            newManagedServiceAccount("cluster1", "msa1").build(),
+			conditions:     []metav1.Condition{tokenReported},
+			expectedStatus: metav1.ConditionTrue,
+			expectedReason: "Ready",
+		},
+		{
+			name: "permissions not applied",
+			msa:  newManagedServiceAccount("cluster1", "msa1").build(),
+			conditions: []metav1.Condition{
+				tokenReported,
+				{
+					Type:    authv1beta1.ConditionTypePermissionsApplied,
+					Status:  metav1.ConditionFalse,
+					Reason:  "PermissionsApplyFailed",
+					Message: "forbidden",
+				},
+			},
+			expectedStatus: metav1.ConditionFalse,
+			expectedReason: "PermissionsNotApplied",
+		},
+		{
+			name:           "token not projected",
+			msa:            newManagedServiceAccount("cluster1", "msa1").withProjectionType(authv1beta1.ProjectionTypeNone).build(),
+			expectedStatus: metav1.ConditionTrue,
+			expectedReason: "Ready",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.msa.Status.Conditions = c.conditions
+			setManagedServiceAccountReadyCondition(c.msa)
+			ready := meta.FindStatusCondition(c.msa.Status.Conditions, authv1beta1.ConditionTypeReady)
+			assert.NotNil(t, ready)
+			assert.Equal(t, c.expectedStatus, ready.Status)
+			assert.Equal(t, c.expectedReason, ready.Reason)
+		})
+	}
+}
+
 func TestCheckTokenRefreshAfter(t *testing.T) {
 	now := metav1.Time{Time: time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC)}
 	cases := []struct {
 		name                 string
+		rotation             authv1beta1.ManagedServiceAccountRotation
 		expiring             metav1.Time
 		lastRefreshTimestamp metav1.Time
 		expectedRequeueAfter time.Duration
@@ -585,11 +1582,68 @@ func TestCheckTokenRefreshAfter(t *testing.T) {
 			lastRefreshTimestamp: metav1.Time{Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
 			expectedRequeueAfter: 7*time.Hour + 5*time.Second,
 		},
+		{
+			name:                 "refresh before a duration",
+			rotation:             authv1beta1.ManagedServiceAccountRotation{RefreshBefore: "1h"},
+			expiring:             metav1.Time{Time: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)},
+			lastRefreshTimestamp: metav1.Time{Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+			expectedRequeueAfter: 8*time.Hour + 5*time.Second,
+		},
+		{
+			name:                 "refresh before a percentage",
+			rotation:             authv1beta1.ManagedServiceAccountRotation{RefreshBefore: "50%"},
+			expiring:             metav1.Time{Time: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)},
+			lastRefreshTimestamp: metav1.Time{Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+			expectedRequeueAfter: 4*time.Hour + 5*time.Second,
+		},
+		{
+			name:                 "refresh before longer than the lifetime",
+			rotation:             authv1beta1.ManagedServiceAccountRotation{RefreshBefore: "24h"},
+			expiring:             metav1.Time{Time: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)},
+			lastRefreshTimestamp: metav1.Time{Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+			expectedRequeueAfter: 7*time.Hour + 5*time.Second,
+		},
+		{
+			name: "threshold in the window",
+			rotation: authv1beta1.ManagedServiceAccountRotation{
+				Window: &authv1beta1.RotationWindow{
+					Schedule: "0 7 * * *",
+					Duration: metav1.Duration{Duration: 2 * time.Hour},
+				},
+			},
+			expiring:             metav1.Time{Time: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)},
+			lastRefreshTimestamp: metav1.Time{Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+			expectedRequeueAfter: 7*time.Hour + 5*time.Second,
+		},
+		{
+			name: "postponed to the next window",
+			rotation: authv1beta1.ManagedServiceAccountRotation{
+				Window: &authv1beta1.RotationWindow{
+					Schedule: "30 8 * * *",
+					Duration: metav1.Duration{Duration: 30 * time.Minute},
+				},
+			},
+			expiring:             metav1.Time{Time: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)},
+			lastRefreshTimestamp: metav1.Time{Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+			expectedRequeueAfter: 7*time.Hour + 30*time.Minute + 5*time.Second,
+		},
+		{
+			name: "no window before the expiration",
+			rotation: authv1beta1.ManagedServiceAccountRotation{
+				Window: &authv1beta1.RotationWindow{
+					Schedule: "55 9 * * *",
+					Duration: metav1.Duration{Duration: time.Hour},
+				},
+			},
+			expiring:             metav1.Time{Time: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)},
+			lastRefreshTimestamp: metav1.Time{Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+			expectedRequeueAfter: 7*time.Hour + 5*time.Second,
+		},
 	}
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
 
-			ra := checkTokenRefreshAfter(now, c.expiring, c.lastRefreshTimestamp)
+			ra := checkTokenRefreshAfter(now, c.rotation, c.expiring, c.lastRefreshTimestamp)
 			if ra != c.expectedRequeueAfter {
 				t.Errorf("expected %v but got %v", c.expectedRequeueAfter, ra)
 			}
@@ -633,6 +1687,7 @@ func newFakeToken(namespace, name string) string {
 		"exp": "1779286676",
 		"iss": "https://kubernetes.default.svc",
 		"aud": "https://kubernetes.default.svc",
+		"jti": "fake-jti-1234",
 		"kubernetes.io": map[string]interface{}{
 			"namespace": namespace,
 			"serviceaccount": map[string]string{
@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"open-cluster-management.io/managed-serviceaccount/pkg/common"
+)
+
+// ensureTokenRequester binds the token requester ClusterRole to the agent in the namespace of the
+// ServiceAccount. The agent is not permitted to request tokens cluster-wide, it is only permitted
+// in its own namespace and in the namespaces of the ServiceAccounts it creates or adopts from the
+// allowlist, so it must be called after the ServiceAccount is ensured.
+func (r *TokenReconciler) ensureTokenRequester(ctx context.Context, namespace string) error {
+	if namespace == r.SpokeNamespace {
+		// granted by the Role of the agent
+		return nil
+	}
+	binding := &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      common.TokenRequesterClusterRoleName,
+			Labels: map[string]string{
+				common.LabelKeyIsManagedServiceAccount: "true",
+			},
+		},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "ClusterRole",
+			Name:     common.TokenRequesterClusterRoleName,
+		},
+		Subjects: []rbacv1.Subject{
+			{
+				Kind:      rbacv1.ServiceAccountKind,
+				Namespace: r.SpokeNamespace,
+				Name:      common.AgentServiceAccountName,
+			},
+		},
+	}
+	_, err := r.SpokeNativeClient.RbacV1().RoleBindings(namespace).Create(ctx, binding, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return errors.Wrapf(err, "failed to bind the token requester role in namespace %s", namespace)
+	}
+	return nil
+}
+
+// cleanupTokenRequester removes the token requester binding of the agent from the namespace once
+// no ServiceAccount in the namespace is managed by the agent.
+func (r *TokenReconciler) cleanupTokenRequester(ctx context.Context, namespace string) error {
+	if namespace == r.SpokeNamespace {
+		return nil
+	}
+	sas, err := r.SpokeNativeClient.CoreV1().ServiceAccounts(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(map[string]string{
+			common.LabelKeyIsManagedServiceAccount: "true",
+		}).String(),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "fail to list managed serviceaccounts in namespace %s", namespace)
+	}
+	if len(sas.Items) > 0 {
+		return nil
+	}
+	err = r.SpokeNativeClient.RbacV1().RoleBindings(namespace).
+		Delete(ctx, common.TokenRequesterClusterRoleName, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "fail to delete the token requester binding in namespace %s", namespace)
+	}
+	log.FromContext(ctx).Info("Delete the token requester binding", "namespace", namespace)
+	return nil
+}
+
+// tokenRequesterNamespaces returns the namespaces of the ServiceAccounts, which may hold the token
+// requester bindings of the agent.
+func tokenRequesterNamespaces(sas []corev1.ServiceAccount) []string {
+	namespaces := []string{}
+	seen := map[string]bool{}
+	for _, sa := range sas {
+		if seen[sa.Namespace] {
+			continue
+		}
+		seen[sa.Namespace] = true
+		namespaces = append(namespaces, sa.Namespace)
+	}
+	return namespaces
+}
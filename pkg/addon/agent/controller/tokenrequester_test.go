@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakekube "k8s.io/client-go/kubernetes/fake"
+
+	"open-cluster-management.io/managed-serviceaccount/pkg/common"
+)
+
+func TestCleanupTokenRequester(t *testing.T) {
+	agentNamespace := "open-cluster-management-agent-addon"
+	newBinding := func(namespace string) *rbacv1.RoleBinding {
+		return &rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: namespace,
+				Name:      common.TokenRequesterClusterRoleName,
+			},
+		}
+	}
+	cases := []struct {
+		name            string
+		namespace       string
+		objects         []runtime.Object
+		expectedDeleted bool
+	}{
+		{
+			name:      "delete binding once no managed serviceaccount is left",
+			namespace: "ns1",
+			objects: []runtime.Object{
+				newBinding("ns1"),
+				newServiceAccount("ns1", "sa1"),
+				newServiceAccountWithLabels("ns2", "sa2", ownerLabels("cluster1", "msa2")),
+			},
+			expectedDeleted: true,
+		},
+		{
+			name:      "keep binding for the other managed serviceaccounts",
+			namespace: "ns1",
+			objects: []runtime.Object{
+				newBinding("ns1"),
+				newServiceAccountWithLabels("ns1", "sa2", ownerLabels("cluster1", "msa2")),
+			},
+		},
+		{
+			name:      "binding not found",
+			namespace: "ns1",
+		},
+		{
+			name:      "agent namespace is skipped",
+			namespace: agentNamespace,
+			objects: []runtime.Object{
+				newBinding(agentNamespace),
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fakeKubeClient := fakekube.NewSimpleClientset(c.objects...)
+			reconciler := TokenReconciler{
+				SpokeNativeClient: fakeKubeClient,
+				SpokeNamespace:    agentNamespace,
+			}
+			assert.NoError(t, reconciler.cleanupTokenRequester(context.TODO(), c.namespace))
+			if len(c.objects) == 0 {
+				return
+			}
+			_, err := fakeKubeClient.RbacV1().RoleBindings(c.namespace).
+				Get(context.TODO(), common.TokenRequesterClusterRoleName, metav1.GetOptions{})
+			if c.expectedDeleted {
+				assert.True(t, apierrors.IsNotFound(err))
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
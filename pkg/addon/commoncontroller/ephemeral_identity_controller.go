@@ -6,7 +6,9 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/events"
 	"k8s.io/utils/clock"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
@@ -16,13 +18,16 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+	"open-cluster-management.io/managed-serviceaccount/pkg/common"
 )
 
-func NewEphemeralIdentityReconciler(cache cache.Cache, hubClient client.Client) *EphemeralIdentityReconciler {
+func NewEphemeralIdentityReconciler(cache cache.Cache, hubClient client.Client,
+	recorder events.EventRecorder) *EphemeralIdentityReconciler {
 	return &EphemeralIdentityReconciler{
-		Cache:     cache,
-		HubClient: hubClient,
-		clock:     clock.RealClock{},
+		Cache:         cache,
+		HubClient:     hubClient,
+		EventRecorder: recorder,
+		clock:         clock.RealClock{},
 	}
 }
 
@@ -31,7 +36,8 @@ var _ reconcile.Reconciler = &EphemeralIdentityReconciler{}
 type EphemeralIdentityReconciler struct {
 	clock clock.Clock
 	cache.Cache
-	HubClient client.Client
+	HubClient     client.Client
+	EventRecorder events.EventRecorder
 }
 
 // SetupWithManager sets up the controller with the Manager.
@@ -72,6 +78,8 @@ func (r *EphemeralIdentityReconciler) Reconcile(ctx context.Context, request rec
 		if err := r.HubClient.Delete(context.TODO(), managed); err != nil {
 			return reconcile.Result{}, errors.Wrapf(err, "fail to delete expired ManagedServiceAccount")
 		}
+		r.EventRecorder.Eventf(managed, nil, corev1.EventTypeNormal, common.EventReasonExpired, "Delete",
+			"Deleted the ManagedServiceAccount %d seconds after its creation", *managed.Spec.TTLSecondsAfterCreation)
 		return reconcile.Result{}, nil
 	}
 
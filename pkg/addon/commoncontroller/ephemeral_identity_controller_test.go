@@ -12,6 +12,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/events"
 	clock "k8s.io/utils/clock/testing"
 	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
@@ -31,6 +32,7 @@ func TestReconcile(t *testing.T) {
 		getError       error
 		expectedResult reconcile.Result
 		expectedError  string
+		expectedEvents []string
 		validateFunc   func(t *testing.T, hubClient client.Client)
 	}{
 		{
@@ -49,6 +51,9 @@ func TestReconcile(t *testing.T) {
 		{
 			name: "expired",
 			msa:  newManagedServiceAccount(clusterName, msaName).withTTLSecondsAfterCreation(now.Add(-1000*time.Second), 800).build(),
+			expectedEvents: []string{
+				"Normal Expired Deleted the ManagedServiceAccount 800 seconds after its creation",
+			},
 			validateFunc: func(t *testing.T, hubClient client.Client) {
 				msa := &authv1beta1.ManagedServiceAccount{}
 				err := hubClient.Get(context.TODO(), types.NamespacedName{
@@ -92,17 +97,26 @@ func TestReconcile(t *testing.T) {
 				WithRuntimeObjects(objs...).
 				Build()
 
+			recorder := events.NewFakeRecorder(10)
 			reconciler := NewEphemeralIdentityReconciler(
 				&fakeCache{
 					msa:      c.msa,
 					getError: c.getError,
-				}, hubClient)
+				}, hubClient, recorder)
 			reconciler.clock = clock.NewFakeClock(now)
 
 			result, err := reconciler.Reconcile(context.Background(), reconcile.Request{NamespacedName: types.NamespacedName{
 				Name:      msaName,
 				Namespace: clusterName,
 			}})
+			close(recorder.Events)
+			recorded := []string{}
+			for event := range recorder.Events {
+				recorded = append(recorded, event)
+			}
+			if len(c.expectedEvents) > 0 {
+				assert.Equal(t, c.expectedEvents, recorded)
+			}
 			if err == nil {
 				assert.Equal(t, c.expectedResult, result, "invalid result")
 				return
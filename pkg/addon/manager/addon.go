@@ -14,6 +14,7 @@ import (
 
 	"open-cluster-management.io/addon-framework/pkg/addonfactory"
 	"open-cluster-management.io/addon-framework/pkg/agent"
+	"open-cluster-management.io/addon-framework/pkg/utils"
 	addonv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
 	clusterv1 "open-cluster-management.io/api/cluster/v1"
 	"open-cluster-management.io/managed-serviceaccount/pkg/common"
@@ -70,7 +71,7 @@ func setupPermission(nativeClient kubernetes.Interface) agent.PermissionConfigFu
 			Rules: []rbacv1.PolicyRule{
 				{
 					APIGroups: []string{""},
-					Verbs:     []string{"get", "list", "watch", "create", "update"},
+					Verbs:     []string{"get", "list", "watch", "create", "update", "delete"},
 					Resources: []string{"secrets"},
 				},
 				{
@@ -83,6 +84,11 @@ func setupPermission(nativeClient kubernetes.Interface) agent.PermissionConfigFu
 					Verbs:     []string{"get", "update", "patch"},
 					Resources: []string{"managedserviceaccounts/status"},
 				},
+				{
+					APIGroups: []string{"", "events.k8s.io"},
+					Verbs:     []string{"create", "update", "patch"},
+					Resources: []string{"events"},
+				},
 			},
 		}
 		roleBinding := &rbacv1.RoleBinding{
@@ -111,6 +117,51 @@ func setupPermission(nativeClient kubernetes.Interface) agent.PermissionConfigFu
 			},
 		}
 
+		// the agent reads its own managed cluster for the server URL of the kubeconfig token secrets,
+		// a cluster role is created per cluster since the managed clusters are cluster scoped. The
+		// deletion of the managed cluster is not blocked, which requires the manager to update the
+		// managedclusters/finalizers.
+		clusterOwner := []metav1.OwnerReference{
+			{
+				APIVersion: clusterv1.GroupVersion.String(),
+				Kind:       "ManagedCluster",
+				UID:        cluster.UID,
+				Name:       cluster.Name,
+			},
+		}
+		clusterRoleName := "open-cluster-management:managed-serviceaccount:addon-agent:" + cluster.Name
+		clusterRole := &rbacv1.ClusterRole{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            clusterRoleName,
+				OwnerReferences: clusterOwner,
+			},
+			Rules: []rbacv1.PolicyRule{
+				{
+					APIGroups:     []string{clusterv1.GroupName},
+					Verbs:         []string{"get", "list", "watch"},
+					Resources:     []string{"managedclusters"},
+					ResourceNames: []string{cluster.Name},
+				},
+			},
+		}
+		clusterRoleBinding := &rbacv1.ClusterRoleBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            clusterRoleName,
+				OwnerReferences: clusterOwner,
+			},
+			RoleRef: rbacv1.RoleRef{
+				APIGroup: rbacv1.GroupName,
+				Kind:     "ClusterRole",
+				Name:     clusterRoleName,
+			},
+			Subjects: []rbacv1.Subject{
+				{
+					Kind: rbacv1.UserKind,
+					Name: agentUser,
+				},
+			},
+		}
+
 		if _, err := nativeClient.RbacV1().Roles(namespace).Create(
 			context.TODO(),
 			role,
@@ -127,6 +178,13 @@ func setupPermission(nativeClient kubernetes.Interface) agent.PermissionConfigFu
 				return err
 			}
 		}
+		// the cluster role and binding are updated if they are changed by an upgrade of the manager
+		if _, _, err := utils.ApplyClusterRole(context.TODO(), nativeClient.RbacV1(), clusterRole); err != nil {
+			return err
+		}
+		if _, _, err := utils.ApplyClusterRoleBinding(context.TODO(), nativeClient.RbacV1(), clusterRoleBinding); err != nil {
+			return err
+		}
 		return nil
 	}
 }
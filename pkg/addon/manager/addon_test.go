@@ -1,6 +1,7 @@
 package manager
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -26,13 +27,44 @@ func TestNewRegistrationOption(t *testing.T) {
 	assert.NoError(t, err)
 
 	actions := fakeKubeClient.Actions()
-	assert.Len(t, actions, 2)
+	assert.Len(t, actions, 6)
 	role := actions[0].(clienttesting.CreateAction).GetObject().(*rbacv1.Role)
 	assert.Equal(t, clusterName, role.Namespace, "invalid role ns")
 	assert.Equal(t, "managed-serviceaccount-addon-agent", role.Name, "invalid role name")
 	rolebinding := actions[1].(clienttesting.CreateAction).GetObject().(*rbacv1.RoleBinding)
 	assert.Equal(t, clusterName, rolebinding.Namespace, "invalid rolebinding ns")
 	assert.Equal(t, "managed-serviceaccount-addon-agent", rolebinding.Name, "invalid rolebinding name")
+	clusterRole := actions[3].(clienttesting.CreateAction).GetObject().(*rbacv1.ClusterRole)
+	assert.Equal(t, "open-cluster-management:managed-serviceaccount:addon-agent:cluster1", clusterRole.Name)
+	assert.Equal(t, []string{clusterName}, clusterRole.Rules[0].ResourceNames, "the agent reads its own cluster only")
+	assert.Nil(t, clusterRole.OwnerReferences[0].BlockOwnerDeletion, "the deletion of the cluster is not blocked")
+	clusterRoleBinding := actions[5].(clienttesting.CreateAction).GetObject().(*rbacv1.ClusterRoleBinding)
+	assert.Equal(t, clusterRole.Name, clusterRoleBinding.RoleRef.Name)
+	assert.Equal(t, "ManagedCluster", clusterRoleBinding.OwnerReferences[0].Kind)
+}
+
+func TestSetupPermissionUpdatesClusterRole(t *testing.T) {
+	clusterName := "cluster1"
+	fakeKubeClient := fakekube.NewSimpleClientset(&rbacv1.ClusterRole{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "open-cluster-management:managed-serviceaccount:addon-agent:cluster1",
+		},
+		Rules: []rbacv1.PolicyRule{
+			{
+				APIGroups: []string{clusterv1.GroupName},
+				Verbs:     []string{"get"},
+				Resources: []string{"managedclusters"},
+			},
+		},
+	})
+
+	err := setupPermission(fakeKubeClient)(newTestCluster(clusterName), newTestAddOn("addon", clusterName))
+	assert.NoError(t, err)
+
+	clusterRole, err := fakeKubeClient.RbacV1().ClusterRoles().Get(context.TODO(),
+		"open-cluster-management:managed-serviceaccount:addon-agent:cluster1", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{clusterName}, clusterRole.Rules[0].ResourceNames, "stale cluster role is updated")
 }
 
 func TestManifestAddonAgent(t *testing.T) {
@@ -46,6 +78,7 @@ func TestManifestAddonAgent(t *testing.T) {
 		"open-cluster-management:managed-serviceaccount:addon-agent",
 		"open-cluster-management:managed-serviceaccount:addon-agent",
 		"open-cluster-management:managed-serviceaccount:addon-agent",
+		"open-cluster-management:managed-serviceaccount:token-requester",
 		"managed-serviceaccount-addon-agent",
 	}
 
@@ -0,0 +1,221 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	addonv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+	"open-cluster-management.io/managed-serviceaccount/pkg/common"
+)
+
+var _ reconcile.Reconciler = &ClusterManagedServiceAccountTemplateReconciler{}
+
+// ClusterManagedServiceAccountTemplateReconciler provisions the ManagedServiceAccounts of the
+// ClusterManagedServiceAccountTemplates on the ManagedClusters joining the fleet, and removes them
+// from the ManagedClusters no longer matching.
+type ClusterManagedServiceAccountTemplateReconciler struct {
+	cache.Cache
+	HubClient client.Client
+}
+
+func NewClusterManagedServiceAccountTemplateReconciler(cache cache.Cache,
+	hubClient client.Client) *ClusterManagedServiceAccountTemplateReconciler {
+	return &ClusterManagedServiceAccountTemplateReconciler{
+		Cache:     cache,
+		HubClient: hubClient,
+	}
+}
+
+// SetupWithManager sets up the ClusterManagedServiceAccountTemplateReconciler with the manager.
+func (r *ClusterManagedServiceAccountTemplateReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// Predicate to filter only the ManagedClusterAddOns of this addon
+	addonFilter := func(obj client.Object) bool {
+		return obj.GetName() == common.AddonName
+	}
+
+	// Predicate to filter only ManagedServiceAccounts provisioned by a template
+	msaFilter := func(obj client.Object) bool {
+		_, ok := obj.GetLabels()[common.LabelKeyClusterManagedServiceAccountTemplate]
+		return ok
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&authv1beta1.ClusterManagedServiceAccountTemplate{}).
+		Watches(
+			&clusterv1.ManagedCluster{},
+			handler.EnqueueRequestsFromMapFunc(r.mapToAllTemplates),
+			builder.WithPredicates(managedClusterSelectionChanged()),
+		).
+		Watches(
+			&addonv1alpha1.ManagedClusterAddOn{},
+			handler.EnqueueRequestsFromMapFunc(r.mapToAllTemplates),
+			builder.WithPredicates(predicate.NewPredicateFuncs(addonFilter)),
+		).
+		Watches(
+			&authv1beta1.ManagedServiceAccount{},
+			handler.EnqueueRequestsFromMapFunc(r.mapManagedServiceAccountToTemplate),
+			builder.WithPredicates(predicate.NewPredicateFuncs(msaFilter)),
+		).
+		Complete(r)
+}
+
+// managedClusterSelectionChanged filters the ManagedCluster updates to the changes which may affect
+// the selection of the templates, every template lists all the clusters once it is reconciled, so the
+// frequent status updates of the clusters are ignored.
+func managedClusterSelectionChanged() predicate.Predicate {
+	return predicate.Or(
+		predicate.LabelChangedPredicate{},
+		predicate.GenerationChangedPredicate{},
+		predicate.Funcs{
+			UpdateFunc: func(e event.UpdateEvent) bool {
+				return e.ObjectOld.GetDeletionTimestamp().IsZero() != e.ObjectNew.GetDeletionTimestamp().IsZero()
+			},
+		},
+	)
+}
+
+// mapToAllTemplates maps the changes of the ManagedClusters and the addon to all the templates.
+func (r *ClusterManagedServiceAccountTemplateReconciler) mapToAllTemplates(
+	ctx context.Context, _ client.Object) []reconcile.Request {
+	templates := &authv1beta1.ClusterManagedServiceAccountTemplateList{}
+	if err := r.List(ctx, templates); err != nil {
+		logger.Error(err, "failed to list clustermanagedserviceaccounttemplates")
+		return []reconcile.Request{}
+	}
+
+	var requests []reconcile.Request
+	for _, template := range templates.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: template.Name},
+		})
+	}
+	return requests
+}
+
+// mapManagedServiceAccountToTemplate maps the ManagedServiceAccount to the template provisioning it.
+func (r *ClusterManagedServiceAccountTemplateReconciler) mapManagedServiceAccountToTemplate(
+	_ context.Context, obj client.Object) []reconcile.Request {
+	return []reconcile.Request{
+		{
+			NamespacedName: types.NamespacedName{
+				Name: obj.GetLabels()[common.LabelKeyClusterManagedServiceAccountTemplate],
+			},
+		},
+	}
+}
+
+func (r *ClusterManagedServiceAccountTemplateReconciler) Reconcile(ctx context.Context,
+	req reconcile.Request) (reconcile.Result, error) {
+	template := &authv1beta1.ClusterManagedServiceAccountTemplate{}
+	if err := r.Get(ctx, req.NamespacedName, template); err != nil {
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+	ownerLabels := map[string]string{common.LabelKeyClusterManagedServiceAccountTemplate: template.Name}
+
+	if !template.DeletionTimestamp.IsZero() {
+		if err := deleteManagedServiceAccounts(ctx, r, r.HubClient, ownerLabels, sets.New[string]()); err != nil {
+			return reconcile.Result{}, err
+		}
+		if controllerutil.RemoveFinalizer(template, common.FinalizerClusterManagedServiceAccountTemplateCleanup) {
+			if err := r.HubClient.Update(ctx, template); err != nil {
+				return reconcile.Result{}, errors.Wrapf(err, "failed to remove finalizer")
+			}
+		}
+		return reconcile.Result{}, nil
+	}
+
+	if controllerutil.AddFinalizer(template, common.FinalizerClusterManagedServiceAccountTemplateCleanup) {
+		if err := r.HubClient.Update(ctx, template); err != nil {
+			return reconcile.Result{}, errors.Wrapf(err, "failed to add finalizer")
+		}
+	}
+
+	selector, err := selectorOf(template.Spec.ClusterSelector)
+	if err != nil {
+		return reconcile.Result{}, errors.Wrapf(err, "invalid cluster selector")
+	}
+	clusters := &clusterv1.ManagedClusterList{}
+	if err := r.List(ctx, clusters, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return reconcile.Result{}, errors.Wrapf(err, "failed to list managed clusters")
+	}
+
+	templateCopy := template.DeepCopy()
+	templateCopy.Status.ObservedGeneration = template.Generation
+	templateCopy.Status.Clusters = 0
+	templateCopy.Status.Provisioned = 0
+
+	var errs []error
+	matching := sets.New[string]()
+	for _, cluster := range clusters.Items {
+		if !cluster.DeletionTimestamp.IsZero() {
+			continue
+		}
+		matching.Insert(cluster.Name)
+		templateCopy.Status.Clusters++
+
+		available, err := r.isAddonAvailable(ctx, cluster.Name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !available {
+			continue
+		}
+		msa, err := applyManagedServiceAccountTemplate(ctx, r, r.HubClient, cluster.Name, template.Name,
+			&template.Spec.Template, ownerLabels)
+		var conflictErr *managedServiceAccountConflictError
+		switch {
+		case errors.As(err, &conflictErr):
+			// the ManagedServiceAccount created by others is left alone without retrying
+			logger.Info("ManagedServiceAccount exists and is not created from the template",
+				"namespace", cluster.Name, "name", template.Name, "owner", conflictErr.owner)
+		case err != nil:
+			errs = append(errs, err)
+		}
+		if msa != nil {
+			templateCopy.Status.Provisioned++
+		}
+	}
+
+	if err := deleteManagedServiceAccounts(ctx, r, r.HubClient, ownerLabels, matching); err != nil {
+		errs = append(errs, err)
+	}
+
+	if !equality.Semantic.DeepEqual(template.Status, templateCopy.Status) {
+		if err := r.HubClient.Status().Update(ctx, templateCopy); err != nil {
+			return reconcile.Result{}, errors.Wrapf(err, "failed to update status")
+		}
+	}
+	return reconcile.Result{}, utilerrors.NewAggregate(errs)
+}
+
+// isAddonAvailable checks whether the addon agent is available on the ManagedCluster.
+func (r *ClusterManagedServiceAccountTemplateReconciler) isAddonAvailable(ctx context.Context,
+	clusterName string) (bool, error) {
+	addon := &addonv1alpha1.ManagedClusterAddOn{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: clusterName, Name: common.AddonName}, addon); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "failed to get managed cluster addon in %s", clusterName)
+	}
+	return meta.IsStatusConditionTrue(addon.Status.Conditions, addonv1alpha1.ManagedClusterAddOnConditionAvailable), nil
+}
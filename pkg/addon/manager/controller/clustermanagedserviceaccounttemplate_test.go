@@ -0,0 +1,240 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	addonv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+	"open-cluster-management.io/managed-serviceaccount/pkg/common"
+)
+
+func TestClusterManagedServiceAccountTemplateReconcile(t *testing.T) {
+	cases := []struct {
+		name           string
+		template       *authv1beta1.ClusterManagedServiceAccountTemplate
+		objects        []client.Object
+		expectedStatus authv1beta1.ClusterManagedServiceAccountTemplateStatus
+		validateFunc   func(t *testing.T, hubClient client.Client)
+	}{
+		{
+			name:     "provision on the clusters with the addon available",
+			template: newClusterManagedServiceAccountTemplate(),
+			objects: []client.Object{
+				newClusterAddon("cluster1", true),
+				newClusterAddon("cluster2", false),
+				newClusterAddon("cluster3", true),
+			},
+			expectedStatus: authv1beta1.ClusterManagedServiceAccountTemplateStatus{Clusters: 2, Provisioned: 1},
+			validateFunc: func(t *testing.T, hubClient client.Client) {
+				msa := getMSA(t, hubClient, "cluster1", "platform-tooling")
+				assert.Equal(t, "platform-tooling", msa.Labels[common.LabelKeyClusterManagedServiceAccountTemplate])
+				assert.Equal(t, time.Hour, msa.Spec.Rotation.Validity.Duration)
+				for _, cluster := range []string{"cluster2", "cluster3"} {
+					err := hubClient.Get(context.TODO(), types.NamespacedName{Namespace: cluster, Name: "platform-tooling"},
+						&authv1beta1.ManagedServiceAccount{})
+					assert.True(t, apierrors.IsNotFound(err))
+				}
+			},
+		},
+		{
+			name:     "remove from the clusters no longer matching",
+			template: newClusterManagedServiceAccountTemplate(),
+			objects: []client.Object{
+				newClusterAddon("cluster1", true),
+				newClusterAddon("cluster3", true),
+				newTemplateMSA("cluster1"),
+				newTemplateMSA("cluster3"),
+				newRevocationMSA("cluster3", "other"),
+			},
+			expectedStatus: authv1beta1.ClusterManagedServiceAccountTemplateStatus{Clusters: 2, Provisioned: 1},
+			validateFunc: func(t *testing.T, hubClient client.Client) {
+				getMSA(t, hubClient, "cluster1", "platform-tooling")
+				getMSA(t, hubClient, "cluster3", "other")
+				err := hubClient.Get(context.TODO(), types.NamespacedName{Namespace: "cluster3", Name: "platform-tooling"},
+					&authv1beta1.ManagedServiceAccount{})
+				assert.True(t, apierrors.IsNotFound(err))
+			},
+		},
+		{
+			name:     "keep provisioned while the addon is unavailable",
+			template: newClusterManagedServiceAccountTemplate(),
+			objects: []client.Object{
+				newClusterAddon("cluster2", false),
+				newTemplateMSA("cluster2"),
+			},
+			expectedStatus: authv1beta1.ClusterManagedServiceAccountTemplateStatus{Clusters: 2},
+			validateFunc: func(t *testing.T, hubClient client.Client) {
+				getMSA(t, hubClient, "cluster2", "platform-tooling")
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			hubClient := newTemplateTestClient(append(c.objects, c.template), c.template)
+			reconciler := NewClusterManagedServiceAccountTemplateReconciler(&clientCache{Reader: hubClient}, hubClient)
+			_, err := reconciler.Reconcile(context.TODO(), reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: c.template.Name},
+			})
+			assert.NoError(t, err)
+
+			template := &authv1beta1.ClusterManagedServiceAccountTemplate{}
+			err = hubClient.Get(context.TODO(), types.NamespacedName{Name: c.template.Name}, template)
+			assert.NoError(t, err)
+			assert.Contains(t, template.Finalizers, common.FinalizerClusterManagedServiceAccountTemplateCleanup)
+			assert.Equal(t, c.expectedStatus, template.Status)
+			if c.validateFunc != nil {
+				c.validateFunc(t, hubClient)
+			}
+		})
+	}
+}
+
+func TestClusterManagedServiceAccountTemplateDeletion(t *testing.T) {
+	template := newClusterManagedServiceAccountTemplate(func(template *authv1beta1.ClusterManagedServiceAccountTemplate) {
+		template.Finalizers = []string{common.FinalizerClusterManagedServiceAccountTemplateCleanup}
+		template.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	})
+	hubClient := newTemplateTestClient([]client.Object{
+		template,
+		newClusterAddon("cluster1", true),
+		newTemplateMSA("cluster1"),
+	}, template)
+
+	reconciler := NewClusterManagedServiceAccountTemplateReconciler(&clientCache{Reader: hubClient}, hubClient)
+	_, err := reconciler.Reconcile(context.TODO(), reconcile.Request{
+		NamespacedName: types.NamespacedName{Name: template.Name},
+	})
+	assert.NoError(t, err)
+
+	err = hubClient.Get(context.TODO(), types.NamespacedName{Namespace: "cluster1", Name: "platform-tooling"},
+		&authv1beta1.ManagedServiceAccount{})
+	assert.True(t, apierrors.IsNotFound(err))
+	err = hubClient.Get(context.TODO(), types.NamespacedName{Name: template.Name},
+		&authv1beta1.ClusterManagedServiceAccountTemplate{})
+	assert.True(t, apierrors.IsNotFound(err))
+}
+
+func TestManagedClusterSelectionChanged(t *testing.T) {
+	cluster := newRevocationCluster("cluster1", "prod")
+	cluster.Generation = 1
+
+	cases := []struct {
+		name     string
+		modify   func(cluster *clusterv1.ManagedCluster)
+		expected bool
+	}{
+		{
+			name: "status updated",
+			modify: func(cluster *clusterv1.ManagedCluster) {
+				cluster.Status.Conditions = []metav1.Condition{{Type: clusterv1.ManagedClusterConditionAvailable}}
+			},
+		},
+		{
+			name: "labels changed",
+			modify: func(cluster *clusterv1.ManagedCluster) {
+				cluster.Labels["env"] = "dev"
+			},
+			expected: true,
+		},
+		{
+			name: "spec changed",
+			modify: func(cluster *clusterv1.ManagedCluster) {
+				cluster.Generation = 2
+			},
+			expected: true,
+		},
+		{
+			name: "deleting",
+			modify: func(cluster *clusterv1.ManagedCluster) {
+				cluster.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+			},
+			expected: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			updated := cluster.DeepCopy()
+			c.modify(updated)
+			assert.Equal(t, c.expected, managedClusterSelectionChanged().Update(event.UpdateEvent{
+				ObjectOld: cluster,
+				ObjectNew: updated,
+			}))
+		})
+	}
+}
+
+func newTemplateTestClient(objects []client.Object, statusObjects ...client.Object) client.Client {
+	testscheme := runtime.NewScheme()
+	authv1beta1.AddToScheme(testscheme)
+	clusterv1.Install(testscheme)
+	addonv1alpha1.Install(testscheme)
+	objects = append(objects,
+		newRevocationCluster("cluster1", "prod"),
+		newRevocationCluster("cluster2", "prod"),
+		newRevocationCluster("cluster3", "dev"),
+	)
+	return fake.NewClientBuilder().WithScheme(testscheme).WithObjects(objects...).
+		WithStatusSubresource(statusObjects...).Build()
+}
+
+func newClusterManagedServiceAccountTemplate(
+	modifiers ...func(*authv1beta1.ClusterManagedServiceAccountTemplate)) *authv1beta1.ClusterManagedServiceAccountTemplate {
+	template := &authv1beta1.ClusterManagedServiceAccountTemplate{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "platform-tooling",
+		},
+		Spec: authv1beta1.ClusterManagedServiceAccountTemplateSpec{
+			ClusterSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}},
+			Template: authv1beta1.ManagedServiceAccountTemplate{
+				Spec: authv1beta1.ManagedServiceAccountSpec{
+					Rotation: authv1beta1.ManagedServiceAccountRotation{
+						Enabled:  true,
+						Validity: metav1.Duration{Duration: time.Hour},
+					},
+				},
+			},
+		},
+	}
+	for _, modifier := range modifiers {
+		modifier(template)
+	}
+	return template
+}
+
+func newClusterAddon(clusterName string, available bool) *addonv1alpha1.ManagedClusterAddOn {
+	status := metav1.ConditionFalse
+	if available {
+		status = metav1.ConditionTrue
+	}
+	return &addonv1alpha1.ManagedClusterAddOn{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: clusterName,
+			Name:      common.AddonName,
+		},
+		Status: addonv1alpha1.ManagedClusterAddOnStatus{
+			Conditions: []metav1.Condition{
+				{Type: addonv1alpha1.ManagedClusterAddOnConditionAvailable, Status: status},
+			},
+		},
+	}
+}
+
+func newTemplateMSA(namespace string) *authv1beta1.ManagedServiceAccount {
+	return newRevocationMSA(namespace, "platform-tooling", func(msa *authv1beta1.ManagedServiceAccount) {
+		msa.Labels = map[string]string{common.LabelKeyClusterManagedServiceAccountTemplate: "platform-tooling"}
+	})
+}
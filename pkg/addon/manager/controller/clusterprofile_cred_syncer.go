@@ -2,19 +2,25 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	clientcmdv1 "k8s.io/client-go/tools/clientcmd/api/v1"
+	"k8s.io/client-go/tools/events"
 	cpv1alpha1 "sigs.k8s.io/cluster-inventory-api/apis/v1alpha1"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -22,6 +28,7 @@ import (
 	clusterv1 "open-cluster-management.io/api/cluster/v1"
 	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
 	"open-cluster-management.io/managed-serviceaccount/pkg/common"
+	"open-cluster-management.io/managed-serviceaccount/pkg/metrics"
 )
 
 const (
@@ -33,32 +40,44 @@ const (
 
 const ClusterProfileManagerName = "open-cluster-management"
 
+// ClusterExecExtensionName is the extension of the cluster in the access provider, which is passed to the
+// exec credentials plugin as the ExecCredential cluster config.
+const ClusterExecExtensionName = "client.authentication.k8s.io/exec"
+
+// clusterProfileClusterNameIndex indexes the clusterprofiles managed by this controller by the name of
+// the managed cluster
+const clusterProfileClusterNameIndex = "clusterprofile.clusterName"
+
 var _ reconcile.Reconciler = &ClusterProfileCredSyncer{}
 
 var logger = ctrl.Log.WithName("ClusterProfileCredSyncer")
 
 type ClusterProfileCredSyncer struct {
 	cache.Cache
-	HubClient client.Client
+	HubClient     client.Client
+	EventRecorder events.EventRecorder
 }
 
-func NewClusterProfileCredSyncer(cache cache.Cache, hubClient client.Client) *ClusterProfileCredSyncer {
+func NewClusterProfileCredSyncer(cache cache.Cache, hubClient client.Client,
+	recorder events.EventRecorder) *ClusterProfileCredSyncer {
 	return &ClusterProfileCredSyncer{
-		Cache:     cache,
-		HubClient: hubClient,
+		Cache:         cache,
+		HubClient:     hubClient,
+		EventRecorder: recorder,
 	}
 }
 
 // SetupWithManager sets up the clusterProfileCredSyncer with the manager.
 func (r *ClusterProfileCredSyncer) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &cpv1alpha1.ClusterProfile{},
+		clusterProfileClusterNameIndex, indexClusterProfileByClusterName); err != nil {
+		return errors.Wrapf(err, "failed to index clusterprofiles by cluster name")
+	}
+
 	// Predicate to filter only ClusterProfiles managed by this controller
 	cpFilter := func(obj client.Object) bool {
 		if cp, ok := obj.(*cpv1alpha1.ClusterProfile); ok {
-			if cp.Labels[cpv1alpha1.LabelClusterManagerKey] != ClusterProfileManagerName {
-				return false
-			}
-			_, ok := cp.Labels[clusterv1.ClusterNameLabelKey]
-			return ok
+			return isManagedClusterProfile(cp)
 		}
 		return false
 	}
@@ -91,70 +110,85 @@ func (r *ClusterProfileCredSyncer) SetupWithManager(mgr ctrl.Manager) error {
 			handler.EnqueueRequestsFromMapFunc(r.mapTokenSecretToClusterProfile),
 			builder.WithPredicates(predicate.NewPredicateFuncs(secretFilter)),
 		).
+		Watches(
+			&clusterv1.ManagedCluster{},
+			handler.EnqueueRequestsFromMapFunc(r.mapManagedClusterToClusterProfile),
+			builder.WithPredicates(managedClusterClientConfigsChanged()),
+		).
 		Complete(r)
 }
 
-// mapManagedServiceAccountToClusterProfile maps managedserviceaccount events to the corresponding clusterprofile
+// managedClusterClientConfigsChanged filters the ManagedCluster updates to the changes of the client
+// configs the access provider is built from, the status heartbeats are ignored.
+func managedClusterClientConfigsChanged() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldCluster, ok := e.ObjectOld.(*clusterv1.ManagedCluster)
+			if !ok {
+				return false
+			}
+			newCluster, ok := e.ObjectNew.(*clusterv1.ManagedCluster)
+			if !ok {
+				return false
+			}
+			return !equality.Semantic.DeepEqual(oldCluster.Spec.ManagedClusterClientConfigs,
+				newCluster.Spec.ManagedClusterClientConfigs)
+		},
+	}
+}
+
+// mapManagedServiceAccountToClusterProfile maps managedserviceaccount events to the corresponding clusterprofiles
 func (r *ClusterProfileCredSyncer) mapManagedServiceAccountToClusterProfile(ctx context.Context, obj client.Object) []reconcile.Request {
-	// when a managedserviceaccount changes, reconcile the corresponding clusterprofile
-	// clusterprofile name = managedserviceaccount namespace
+	// when a managedserviceaccount changes, reconcile the clusterprofiles of the cluster
+	// cluster name = managedserviceaccount namespace
 	msa, ok := obj.(*authv1beta1.ManagedServiceAccount)
 	if !ok {
 		logger.Error(fmt.Errorf("unexpected object type"), "expected managedserviceaccount")
 		return []reconcile.Request{}
 	}
-
-	// Find all ClusterProfiles with name matching the managedserviceaccount namespace
-	cpList := &cpv1alpha1.ClusterProfileList{}
-	if err := r.List(ctx, cpList); err != nil {
-		logger.Error(err, "failed to list clusterprofiles")
-		return []reconcile.Request{}
-	}
-
-	var requests []reconcile.Request
-	for _, cp := range cpList.Items {
-		if cp.Name == msa.Namespace {
-			requests = append(requests, reconcile.Request{
-				NamespacedName: types.NamespacedName{
-					Namespace: cp.Namespace,
-					Name:      cp.Name,
-				},
-			})
-		}
-	}
-
-	return requests
+	return r.clusterProfilesOf(ctx, msa.Namespace)
 }
 
-// mapTokenSecretToClusterProfile maps token secret events to the corresponding clusterprofile
+// mapTokenSecretToClusterProfile maps token secret events to the corresponding clusterprofiles
 func (r *ClusterProfileCredSyncer) mapTokenSecretToClusterProfile(ctx context.Context, obj client.Object) []reconcile.Request {
-	// when a token secret changes, reconcile the corresponding clusterprofile
-	// clusterprofile name = secret namespace
+	// when a token secret changes, reconcile the clusterprofiles of the cluster
+	// cluster name = secret namespace
 	secret, ok := obj.(*corev1.Secret)
 	if !ok {
 		logger.Error(fmt.Errorf("unexpected object type"), "expected secret")
 		return []reconcile.Request{}
 	}
+	return r.clusterProfilesOf(ctx, secret.Namespace)
+}
 
-	// Find all ClusterProfiles with name matching the secret namespace
+// mapManagedClusterToClusterProfile maps managedcluster events to the clusterprofiles of the cluster, so
+// that the access provider follows the changes of the client configs
+func (r *ClusterProfileCredSyncer) mapManagedClusterToClusterProfile(ctx context.Context, obj client.Object) []reconcile.Request {
+	cluster, ok := obj.(*clusterv1.ManagedCluster)
+	if !ok {
+		logger.Error(fmt.Errorf("unexpected object type"), "expected managedcluster")
+		return []reconcile.Request{}
+	}
+	return r.clusterProfilesOf(ctx, cluster.Name)
+}
+
+// clusterProfilesOf returns the requests of the clusterprofiles managed by this controller for the cluster
+func (r *ClusterProfileCredSyncer) clusterProfilesOf(ctx context.Context, clusterName string) []reconcile.Request {
 	cpList := &cpv1alpha1.ClusterProfileList{}
-	if err := r.List(ctx, cpList); err != nil {
-		logger.Error(err, "failed to list clusterprofiles")
+	if err := r.List(ctx, cpList, client.MatchingFields{clusterProfileClusterNameIndex: clusterName}); err != nil {
+		logger.Error(err, "failed to list clusterprofiles", "cluster", clusterName)
 		return []reconcile.Request{}
 	}
 
 	var requests []reconcile.Request
 	for _, cp := range cpList.Items {
-		if cp.Name == secret.Namespace {
-			requests = append(requests, reconcile.Request{
-				NamespacedName: types.NamespacedName{
-					Namespace: cp.Namespace,
-					Name:      cp.Name,
-				},
-			})
-		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Namespace: cp.Namespace,
+				Name:      cp.Name,
+			},
+		})
 	}
-
 	return requests
 }
 
@@ -167,44 +201,65 @@ func (r *ClusterProfileCredSyncer) Reconcile(ctx context.Context, req reconcile.
 		if apierrors.IsNotFound(err) {
 			// clusterprofile is deleted, owner reference will handle cleanup automatically
 			logger.Info("ClusterProfile not found, secrets will be cleaned up by garbage collection")
+			metrics.ClusterProfileSyncedSecrets.DeleteLabelValues(req.Namespace, req.Name)
+			metrics.ClusterProfileOrphanedSecrets.DeleteLabelValues(req.Namespace, req.Name)
 			return reconcile.Result{}, nil
 		}
 		return reconcile.Result{}, errors.Wrapf(err, "failed to get clusterprofile")
 	}
+	// the watches of the managedserviceaccounts, the secrets and the managedclusters are not filtered by
+	// the cluster manager, the clusterprofiles of the other cluster managers are never touched
+	if !isManagedClusterProfile(cp) {
+		logger.V(4).Info("ClusterProfile is not managed by this controller", "namespace", req.Namespace, "name", req.Name)
+		return reconcile.Result{}, nil
+	}
 
-	// List managedserviceaccount only in the namespace matching the clusterprofile name
-	// and with the required sync label
+	// List managedserviceaccount only in the namespace of the cluster and with the required sync label
+	clusterName := clusterNameOf(cp)
 	msaList := &authv1beta1.ManagedServiceAccountList{}
 	if err := r.List(ctx, msaList,
-		client.InNamespace(cp.Name),
+		client.InNamespace(clusterName),
 		client.MatchingLabels{LabelKeyClusterProfileSync: "true"},
 	); err != nil {
-		return reconcile.Result{}, errors.Wrapf(err, "failed to list managedserviceaccounts in namespace %s", cp.Name)
+		return reconcile.Result{}, errors.Wrapf(err, "failed to list managedserviceaccounts in namespace %s", clusterName)
 	}
 
 	// Sync credentials from managedserviceaccounts to clusterprofile namespace
 	var errs []error
+	var synced []authv1beta1.ManagedServiceAccount
 	for _, msa := range msaList.Items {
-		if err := r.syncCreds(ctx, &msa, cp); err != nil {
+		ok, err := r.syncCreds(ctx, &msa, cp)
+		if err != nil {
 			errs = append(errs, errors.Wrapf(err, "failed to sync credential for msa %s/%s", msa.Namespace, msa.Name))
 		}
+		if ok {
+			synced = append(synced, msa)
+		}
 	}
+	metrics.ClusterProfileSyncedSecrets.WithLabelValues(cp.Namespace, cp.Name).Set(float64(len(synced)))
 
 	// Clean up synced credentials that no longer have corresponding managedserviceaccounts
 	if err := r.cleanupOrphanedCreds(ctx, cp, msaList.Items); err != nil {
 		errs = append(errs, errors.Wrapf(err, "failed to cleanup orphaned credentials"))
 	}
 
+	// Publish the access provider, so that the consumers of the clusterprofile reach the cluster
+	// with the credentials plugin
+	if err := r.syncAccessProvider(ctx, cp, synced); err != nil {
+		errs = append(errs, errors.Wrapf(err, "failed to sync access provider"))
+	}
+
 	logger.Info("Reconcile completed", "namespace", req.Namespace, "name", req.Name)
 	return reconcile.Result{}, utilerrors.NewAggregate(errs)
 }
 
-// syncCreds syncs the credential secret from a managedserviceaccount to the clusterprofile namespace
-func (r *ClusterProfileCredSyncer) syncCreds(ctx context.Context, msa *authv1beta1.ManagedServiceAccount, cp *cpv1alpha1.ClusterProfile) error {
+// syncCreds syncs the credential secret from a managedserviceaccount to the clusterprofile namespace,
+// it returns whether the synced credential is up to date
+func (r *ClusterProfileCredSyncer) syncCreds(ctx context.Context, msa *authv1beta1.ManagedServiceAccount, cp *cpv1alpha1.ClusterProfile) (bool, error) {
 	// Check if the managedserviceaccount has a token secret
 	if msa.Status.TokenSecretRef == nil {
 		logger.V(4).Info("ManagedServiceAccount has no token secret yet", "msa", msa.Name, "namespace", msa.Namespace)
-		return nil
+		return false, nil
 	}
 
 	// Get the source secret using TokenSecretRef
@@ -216,9 +271,9 @@ func (r *ClusterProfileCredSyncer) syncCreds(ctx context.Context, msa *authv1bet
 	if err := r.Get(ctx, sourceSecretName, sourceSecret); err != nil {
 		if apierrors.IsNotFound(err) {
 			logger.V(4).Info("Source secret not found", "secret", sourceSecretName.String())
-			return nil
+			return false, nil
 		}
-		return errors.Wrapf(err, "failed to get source secret %s", sourceSecretName.String())
+		return false, errors.Wrapf(err, "failed to get source secret %s", sourceSecretName.String())
 	}
 
 	// Create the synced credential secret name: <namespace>-<name>
@@ -234,15 +289,17 @@ func (r *ClusterProfileCredSyncer) syncCreds(ctx context.Context, msa *authv1bet
 	err := r.Get(ctx, syncedCredNamespacedName, syncedCred)
 	if err != nil {
 		if !apierrors.IsNotFound(err) {
-			return errors.Wrapf(err, "failed to get synced credential %s", syncedCredNamespacedName.String())
+			return false, errors.Wrapf(err, "failed to get synced credential %s", syncedCredNamespacedName.String())
 		}
 		// Secret doesn't exist, create it
 		syncedCred = r.buildSyncedCred(msa, cp, syncedCredName, sourceSecret)
 		if err := r.HubClient.Create(ctx, syncedCred); err != nil {
-			return errors.Wrapf(err, "failed to create synced credential %s", syncedCredNamespacedName.String())
+			return false, errors.Wrapf(err, "failed to create synced credential %s", syncedCredNamespacedName.String())
 		}
 		logger.Info("Created synced credential", "secret", syncedCredNamespacedName.String())
-		return nil
+		r.EventRecorder.Eventf(msa, cp, corev1.EventTypeNormal, common.EventReasonCredentialSynced, "Sync",
+			"Synced the token secret to %s", syncedCredNamespacedName.String())
+		return true, nil
 	}
 
 	// Secret exists, update it if needed
@@ -252,12 +309,14 @@ func (r *ClusterProfileCredSyncer) syncCreds(ctx context.Context, msa *authv1bet
 		syncedCred.Labels = updatedCred.Labels
 		syncedCred.OwnerReferences = updatedCred.OwnerReferences
 		if err := r.HubClient.Update(ctx, syncedCred); err != nil {
-			return errors.Wrapf(err, "failed to update synced credential %s", syncedCredNamespacedName.String())
+			return false, errors.Wrapf(err, "failed to update synced credential %s", syncedCredNamespacedName.String())
 		}
 		logger.Info("Updated synced credential", "secret", syncedCredNamespacedName.String())
+		r.EventRecorder.Eventf(msa, cp, corev1.EventTypeNormal, common.EventReasonCredentialSynced, "Sync",
+			"Synced the token secret to %s", syncedCredNamespacedName.String())
 	}
 
-	return nil
+	return true, nil
 }
 
 // buildSyncedCred builds a synced credential secret from the source secret
@@ -368,9 +427,168 @@ func (r *ClusterProfileCredSyncer) cleanupOrphanedCreds(ctx context.Context, cp
 			logger.Info("Deleting orphaned synced credential", "secret", secret.Name, "syncedFrom", syncedFrom)
 			if err := r.HubClient.Delete(ctx, &secret); err != nil && !apierrors.IsNotFound(err) {
 				errs = append(errs, errors.Wrapf(err, "failed to delete orphaned secret %s", secret.Name))
+				continue
 			}
+			metrics.ClusterProfileOrphanedSecrets.WithLabelValues(cp.Namespace, cp.Name).Inc()
 		}
 	}
 
 	return utilerrors.NewAggregate(errs)
 }
+
+// isManagedClusterProfile returns whether the clusterprofile is managed by this controller for a cluster
+func isManagedClusterProfile(cp *cpv1alpha1.ClusterProfile) bool {
+	return cp.Labels[cpv1alpha1.LabelClusterManagerKey] == ClusterProfileManagerName && clusterNameOf(cp) != ""
+}
+
+// clusterNameOf returns the name of the managed cluster the clusterprofile is managed for, which is also
+// the namespace of the managedserviceaccounts synced to the clusterprofile
+func clusterNameOf(cp *cpv1alpha1.ClusterProfile) string {
+	return cp.Labels[clusterv1.ClusterNameLabelKey]
+}
+
+// indexClusterProfileByClusterName returns the name of the cluster of the clusterprofiles managed by
+// this controller
+func indexClusterProfileByClusterName(obj client.Object) []string {
+	cp, ok := obj.(*cpv1alpha1.ClusterProfile)
+	if !ok || !isManagedClusterProfile(cp) {
+		return nil
+	}
+	return []string{clusterNameOf(cp)}
+}
+
+// syncAccessProvider sets the access provider named after the cluster manager in the status of the
+// clusterprofile, with the server and the CA of the managed cluster and the exec config read by the
+// credentials plugin. The access provider is removed while no credential is synced or the server of
+// the cluster is unknown, and the access providers of the other cluster managers are kept.
+func (r *ClusterProfileCredSyncer) syncAccessProvider(ctx context.Context, cp *cpv1alpha1.ClusterProfile,
+	synced []authv1beta1.ManagedServiceAccount) error {
+	provider, err := r.accessProviderOf(ctx, cp, synced)
+	if err != nil {
+		return err
+	}
+
+	cpCopy := cp.DeepCopy()
+	if provider != nil {
+		cpCopy.Status.AccessProviders = setAccessProvider(cpCopy.Status.AccessProviders, *provider)
+		cpCopy.Status.CredentialProviders = setAccessProvider(cpCopy.Status.CredentialProviders, *provider)
+	} else {
+		cpCopy.Status.AccessProviders = removeAccessProvider(cpCopy.Status.AccessProviders, ClusterProfileManagerName)
+		cpCopy.Status.CredentialProviders = removeAccessProvider(cpCopy.Status.CredentialProviders, ClusterProfileManagerName)
+	}
+	if equality.Semantic.DeepEqual(cp.Status, cpCopy.Status) {
+		return nil
+	}
+	if err := r.HubClient.Status().Update(ctx, cpCopy); err != nil {
+		return errors.Wrapf(err, "failed to update status of clusterprofile %s/%s", cp.Namespace, cp.Name)
+	}
+	if provider != nil {
+		logger.Info("Updated access provider", "namespace", cp.Namespace, "name", cp.Name, "server", provider.Cluster.Server)
+	} else {
+		logger.Info("Removed access provider", "namespace", cp.Namespace, "name", cp.Name)
+	}
+	return nil
+}
+
+// accessProviderOf returns the access provider of the clusterprofile, or nil if no credential is synced
+// or the server of the cluster is unknown
+func (r *ClusterProfileCredSyncer) accessProviderOf(ctx context.Context, cp *cpv1alpha1.ClusterProfile,
+	synced []authv1beta1.ManagedServiceAccount) (*cpv1alpha1.AccessProvider, error) {
+	clusterName := clusterNameOf(cp)
+	if len(synced) == 0 {
+		logger.V(4).Info("No credential is synced", "namespace", cp.Namespace, "name", cp.Name)
+		return nil, nil
+	}
+	cluster := &clusterv1.ManagedCluster{}
+	if err := r.Get(ctx, types.NamespacedName{Name: clusterName}, cluster); err != nil {
+		if apierrors.IsNotFound(err) {
+			logger.V(4).Info("ManagedCluster not found", "cluster", clusterName)
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "failed to get managedcluster %s", clusterName)
+	}
+
+	var server string
+	var caData []byte
+	for _, config := range cluster.Spec.ManagedClusterClientConfigs {
+		if len(config.URL) == 0 {
+			continue
+		}
+		server, caData = config.URL, config.CABundle
+		break
+	}
+	if len(server) == 0 {
+		logger.V(4).Info("ManagedCluster has no server URL in the client configs", "cluster", clusterName)
+		return nil, nil
+	}
+	if len(caData) == 0 {
+		// fall back to the CA reported along with the tokens
+		caData = r.reportedCAData(ctx, synced)
+	}
+
+	execConfig, err := json.Marshal(map[string]interface{}{
+		"clusterName": clusterName,
+		"clusterProfile": map[string]string{
+			"namespace": cp.Namespace,
+			"name":      cp.Name,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &cpv1alpha1.AccessProvider{
+		Name: ClusterProfileManagerName,
+		Cluster: clientcmdv1.Cluster{
+			Server:                   server,
+			CertificateAuthorityData: caData,
+			Extensions: []clientcmdv1.NamedExtension{
+				{
+					Name:      ClusterExecExtensionName,
+					Extension: runtime.RawExtension{Raw: execConfig},
+				},
+			},
+		},
+	}, nil
+}
+
+// reportedCAData returns the CA in the first token secret of the managedserviceaccounts reporting one
+func (r *ClusterProfileCredSyncer) reportedCAData(ctx context.Context, msaList []authv1beta1.ManagedServiceAccount) []byte {
+	for _, msa := range msaList {
+		if msa.Status.TokenSecretRef == nil {
+			continue
+		}
+		secret := &corev1.Secret{}
+		if err := r.Get(ctx, types.NamespacedName{
+			Namespace: msa.Namespace,
+			Name:      msa.Status.TokenSecretRef.Name,
+		}, secret); err != nil {
+			continue
+		}
+		if caData := secret.Data[corev1.ServiceAccountRootCAKey]; len(caData) > 0 {
+			return caData
+		}
+	}
+	return nil
+}
+
+// setAccessProvider replaces the access provider of the same name, or appends it
+func setAccessProvider(providers []cpv1alpha1.AccessProvider, provider cpv1alpha1.AccessProvider) []cpv1alpha1.AccessProvider {
+	for i := range providers {
+		if providers[i].Name == provider.Name {
+			providers[i] = provider
+			return providers
+		}
+	}
+	return append(providers, provider)
+}
+
+// removeAccessProvider removes the access provider of the name
+func removeAccessProvider(providers []cpv1alpha1.AccessProvider, name string) []cpv1alpha1.AccessProvider {
+	var kept []cpv1alpha1.AccessProvider
+	for _, provider := range providers {
+		if provider.Name != name {
+			kept = append(kept, provider)
+		}
+	}
+	return kept
+}
@@ -12,6 +12,8 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	clientcmdv1 "k8s.io/client-go/tools/clientcmd/api/v1"
+	"k8s.io/client-go/tools/events"
 	clusterv1 "open-cluster-management.io/api/cluster/v1"
 	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
 	"open-cluster-management.io/managed-serviceaccount/pkg/common"
@@ -19,6 +21,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
@@ -87,6 +90,43 @@ func TestClusterProfileCredSyncerReconcile(t *testing.T) {
 				assert.Equal(t, "cluster1", cred2.OwnerReferences[0].Name)
 			},
 		},
+		{
+			name: "Sync credentials from the namespace of the cluster name label",
+			clusterProfile: newClusterProfile(testClusterProfileNamespace, "profile1").
+				withLabel(clusterv1.ClusterNameLabelKey, "cluster1").
+				build(),
+			msaList: []authv1beta1.ManagedServiceAccount{
+				*newManagedServiceAccountWithToken("cluster1", "msa1").build(),
+				*newManagedServiceAccountWithToken("profile1", "msa2").build(),
+			},
+			existingSecrets: []corev1.Secret{
+				*newTokenSecret("cluster1", "msa1").build(),
+				*newTokenSecret("profile1", "msa2").build(),
+			},
+			validateFunc: func(t *testing.T, hubClient client.Client) {
+				synced := &corev1.SecretList{}
+				assert.NoError(t, hubClient.List(context.TODO(), synced, client.InNamespace(testClusterProfileNamespace)))
+				assert.Len(t, synced.Items, 1)
+				assert.Equal(t, "cluster1-msa1", synced.Items[0].Name)
+			},
+		},
+		{
+			name: "Skip ClusterProfiles of other cluster managers",
+			clusterProfile: newClusterProfile(testClusterProfileNamespace, "cluster1").
+				withLabel(cpv1alpha1.LabelClusterManagerKey, "other").
+				build(),
+			msaList: []authv1beta1.ManagedServiceAccount{
+				*newManagedServiceAccountWithToken("cluster1", "msa1").build(),
+			},
+			existingSecrets: []corev1.Secret{
+				*newTokenSecret("cluster1", "msa1").build(),
+			},
+			validateFunc: func(t *testing.T, hubClient client.Client) {
+				synced := &corev1.SecretList{}
+				assert.NoError(t, hubClient.List(context.TODO(), synced, client.InNamespace(testClusterProfileNamespace)))
+				assert.Empty(t, synced.Items)
+			},
+		},
 		{
 			name: "Update existing synced credential when token changes",
 			clusterProfile: newClusterProfile(testClusterProfileNamespace, "cluster1").
@@ -294,6 +334,7 @@ func TestClusterProfileCredSyncerReconcile(t *testing.T) {
 					secrets:        tc.existingSecrets,
 				},
 				hubClient,
+				events.NewFakeRecorder(10),
 			)
 
 			// Determine the reconcile request based on cluster profile
@@ -323,6 +364,7 @@ func TestClusterProfileCredSyncerReconcile(t *testing.T) {
 // clusterProfileFakeCache is a fake cache implementation for testing
 type clusterProfileFakeCache struct {
 	clusterProfile *cpv1alpha1.ClusterProfile
+	managedCluster *clusterv1.ManagedCluster
 	msaList        []authv1beta1.ManagedServiceAccount
 	secrets        []corev1.Secret
 }
@@ -338,6 +380,15 @@ func (f *clusterProfileFakeCache) Get(ctx context.Context, key client.ObjectKey,
 		}
 		f.clusterProfile.DeepCopyInto(v)
 		return nil
+	case *clusterv1.ManagedCluster:
+		if f.managedCluster == nil || f.managedCluster.Name != key.Name {
+			return apierrors.NewNotFound(schema.GroupResource{
+				Group:    clusterv1.GroupVersion.Group,
+				Resource: "managedclusters",
+			}, key.Name)
+		}
+		f.managedCluster.DeepCopyInto(v)
+		return nil
 	case *corev1.Secret:
 		for _, secret := range f.secrets {
 			if secret.Namespace == key.Namespace && secret.Name == key.Name {
@@ -424,7 +475,7 @@ func (f *clusterProfileFakeCache) List(ctx context.Context, list client.ObjectLi
 	case *cpv1alpha1.ClusterProfileList:
 		// Return the cluster profile as a list
 		if f.clusterProfile != nil {
-			v.Items = []cpv1alpha1.ClusterProfile{*f.clusterProfile}
+			v.Items = filterClusterProfiles([]cpv1alpha1.ClusterProfile{*f.clusterProfile}, opts...)
 		} else {
 			v.Items = []cpv1alpha1.ClusterProfile{}
 		}
@@ -497,6 +548,11 @@ func newClusterProfile(namespace, name string) *clusterProfileBuilder {
 	}
 }
 
+func (b *clusterProfileBuilder) withLabel(key, value string) *clusterProfileBuilder {
+	b.cp.Labels[key] = value
+	return b
+}
+
 func (b *clusterProfileBuilder) build() *cpv1alpha1.ClusterProfile {
 	return b.cp
 }
@@ -514,12 +570,34 @@ func (f *multiClusterProfileFakeCache) Get(ctx context.Context, key client.Objec
 func (f *multiClusterProfileFakeCache) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
 	switch v := list.(type) {
 	case *cpv1alpha1.ClusterProfileList:
-		v.Items = f.clusterProfiles
+		v.Items = filterClusterProfiles(f.clusterProfiles, opts...)
 		return nil
 	}
 	return fmt.Errorf("unsupported list type: %T", list)
 }
 
+// filterClusterProfiles applies the cluster name index of the field selector like the informer cache
+func filterClusterProfiles(clusterProfiles []cpv1alpha1.ClusterProfile, opts ...client.ListOption) []cpv1alpha1.ClusterProfile {
+	clusterName, indexed := "", false
+	for _, opt := range opts {
+		if fields, ok := opt.(client.MatchingFields); ok {
+			clusterName, indexed = fields[clusterProfileClusterNameIndex]
+		}
+	}
+	if !indexed {
+		return clusterProfiles
+	}
+	filtered := []cpv1alpha1.ClusterProfile{}
+	for i := range clusterProfiles {
+		for _, value := range indexClusterProfileByClusterName(&clusterProfiles[i]) {
+			if value == clusterName {
+				filtered = append(filtered, clusterProfiles[i])
+			}
+		}
+	}
+	return filtered
+}
+
 func (f *multiClusterProfileFakeCache) GetInformer(ctx context.Context, obj client.Object, opts ...cache.InformerGetOption) (cache.Informer, error) {
 	panic("not implemented")
 }
@@ -935,6 +1013,7 @@ func TestTokenRotationTriggersSync(t *testing.T) {
 					secrets:        tc.existingSecrets,
 				},
 				hubClient,
+				events.NewFakeRecorder(10),
 			)
 
 			// Reconcile (simulates the controller responding to token secret change)
@@ -953,3 +1032,238 @@ func TestTokenRotationTriggersSync(t *testing.T) {
 		})
 	}
 }
+
+func TestClusterProfileAccessProvider(t *testing.T) {
+	newManagedCluster := func(caBundle []byte) *clusterv1.ManagedCluster {
+		return &clusterv1.ManagedCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "cluster1"},
+			Spec: clusterv1.ManagedClusterSpec{
+				ManagedClusterClientConfigs: []clusterv1.ClientConfig{
+					{URL: ""},
+					{URL: "https://cluster1:6443", CABundle: caBundle},
+				},
+			},
+		}
+	}
+	expectedProvider := func(caData []byte) cpv1alpha1.AccessProvider {
+		return cpv1alpha1.AccessProvider{
+			Name: ClusterProfileManagerName,
+			Cluster: clientcmdv1.Cluster{
+				Server:                   "https://cluster1:6443",
+				CertificateAuthorityData: caData,
+				Extensions: []clientcmdv1.NamedExtension{
+					{
+						Name: ClusterExecExtensionName,
+						Extension: runtime.RawExtension{
+							Raw: []byte(`{"clusterName":"cluster1","clusterProfile":{"name":"cluster1","namespace":"test-ns"}}`),
+						},
+					},
+				},
+			},
+		}
+	}
+	otherProvider := cpv1alpha1.AccessProvider{
+		Name:    "other",
+		Cluster: clientcmdv1.Cluster{Server: "https://other:6443"},
+	}
+
+	testCases := []struct {
+		name              string
+		clusterProfile    *cpv1alpha1.ClusterProfile
+		managedCluster    *clusterv1.ManagedCluster
+		unsynced          bool
+		expectedProviders []cpv1alpha1.AccessProvider
+	}{
+		{
+			name:           "publish the access provider",
+			clusterProfile: newClusterProfile(testClusterProfileNamespace, "cluster1").build(),
+			managedCluster: newManagedCluster([]byte("cluster-ca")),
+			expectedProviders: []cpv1alpha1.AccessProvider{
+				expectedProvider([]byte("cluster-ca")),
+			},
+		},
+		{
+			name:           "fall back to the reported CA",
+			clusterProfile: newClusterProfile(testClusterProfileNamespace, "cluster1").build(),
+			managedCluster: newManagedCluster(nil),
+			expectedProviders: []cpv1alpha1.AccessProvider{
+				expectedProvider([]byte("test-ca")),
+			},
+		},
+		{
+			name: "replace the access provider and keep the others",
+			clusterProfile: func() *cpv1alpha1.ClusterProfile {
+				cp := newClusterProfile(testClusterProfileNamespace, "cluster1").build()
+				cp.Status.AccessProviders = []cpv1alpha1.AccessProvider{
+					otherProvider,
+					{Name: ClusterProfileManagerName, Cluster: clientcmdv1.Cluster{Server: "https://stale:6443"}},
+				}
+				return cp
+			}(),
+			managedCluster: newManagedCluster([]byte("cluster-ca")),
+			expectedProviders: []cpv1alpha1.AccessProvider{
+				otherProvider,
+				expectedProvider([]byte("cluster-ca")),
+			},
+		},
+		{
+			name: "remove the access provider without synced credentials",
+			clusterProfile: func() *cpv1alpha1.ClusterProfile {
+				cp := newClusterProfile(testClusterProfileNamespace, "cluster1").build()
+				cp.Status.AccessProviders = []cpv1alpha1.AccessProvider{otherProvider, expectedProvider([]byte("cluster-ca"))}
+				cp.Status.CredentialProviders = []cpv1alpha1.AccessProvider{otherProvider, expectedProvider([]byte("cluster-ca"))}
+				return cp
+			}(),
+			managedCluster:    newManagedCluster([]byte("cluster-ca")),
+			unsynced:          true,
+			expectedProviders: []cpv1alpha1.AccessProvider{otherProvider},
+		},
+		{
+			name:           "managed cluster not found",
+			clusterProfile: newClusterProfile(testClusterProfileNamespace, "cluster1").build(),
+		},
+		{
+			name:           "no server url",
+			clusterProfile: newClusterProfile(testClusterProfileNamespace, "cluster1").build(),
+			managedCluster: &clusterv1.ManagedCluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster1"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testscheme := runtime.NewScheme()
+			authv1beta1.AddToScheme(testscheme)
+			corev1.AddToScheme(testscheme)
+			cpv1alpha1.AddToScheme(testscheme)
+
+			msaList := []authv1beta1.ManagedServiceAccount{
+				*newManagedServiceAccountWithToken("cluster1", "msa1").build(),
+			}
+			if tc.unsynced {
+				msaList[0].Status.TokenSecretRef = nil
+			}
+			secrets := []corev1.Secret{
+				*newTokenSecret("cluster1", "msa1").build(),
+			}
+			hubClient := fake.NewClientBuilder().
+				WithScheme(testscheme).
+				WithRuntimeObjects(tc.clusterProfile, &msaList[0], &secrets[0]).
+				WithStatusSubresource(tc.clusterProfile).
+				Build()
+
+			fakeCache := &clusterProfileFakeCache{
+				clusterProfile: tc.clusterProfile,
+				managedCluster: tc.managedCluster,
+				msaList:        msaList,
+				secrets:        secrets,
+			}
+			reconciler := NewClusterProfileCredSyncer(fakeCache, hubClient, events.NewFakeRecorder(10))
+			request := reconcile.Request{NamespacedName: types.NamespacedName{
+				Namespace: tc.clusterProfile.Namespace,
+				Name:      tc.clusterProfile.Name,
+			}}
+
+			_, err := reconciler.Reconcile(context.Background(), request)
+			assert.NoError(t, err)
+
+			cp := &cpv1alpha1.ClusterProfile{}
+			assert.NoError(t, hubClient.Get(context.TODO(), request.NamespacedName, cp))
+			if tc.expectedProviders == nil {
+				assert.Equal(t, tc.clusterProfile.Status, cp.Status)
+				return
+			}
+			assert.Equal(t, tc.expectedProviders, cp.Status.AccessProviders)
+			// the deprecated credential providers are published as well
+			assert.Contains(t, cp.Status.CredentialProviders, tc.expectedProviders[len(tc.expectedProviders)-1])
+
+			// the status is not updated again while the managed cluster is unchanged
+			synced := &corev1.SecretList{}
+			assert.NoError(t, hubClient.List(context.TODO(), synced))
+			fakeCache.clusterProfile = cp
+			fakeCache.secrets = synced.Items
+			_, err = reconciler.Reconcile(context.Background(), request)
+			assert.NoError(t, err)
+			resynced := &cpv1alpha1.ClusterProfile{}
+			assert.NoError(t, hubClient.Get(context.TODO(), request.NamespacedName, resynced))
+			assert.Equal(t, cp.ResourceVersion, resynced.ResourceVersion)
+		})
+	}
+}
+
+func TestManagedClusterClientConfigsChanged(t *testing.T) {
+	cluster := &clusterv1.ManagedCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster1"},
+		Spec: clusterv1.ManagedClusterSpec{
+			ManagedClusterClientConfigs: []clusterv1.ClientConfig{
+				{URL: "https://cluster1:6443", CABundle: []byte("cluster-ca")},
+			},
+		},
+	}
+
+	cases := []struct {
+		name     string
+		modify   func(cluster *clusterv1.ManagedCluster)
+		expected bool
+	}{
+		{
+			name: "status updated",
+			modify: func(cluster *clusterv1.ManagedCluster) {
+				cluster.Status.Conditions = []metav1.Condition{{Type: clusterv1.ManagedClusterConditionAvailable}}
+			},
+		},
+		{
+			name: "labels changed",
+			modify: func(cluster *clusterv1.ManagedCluster) {
+				cluster.Labels = map[string]string{"env": "dev"}
+			},
+		},
+		{
+			name: "ca bundle rotated",
+			modify: func(cluster *clusterv1.ManagedCluster) {
+				cluster.Spec.ManagedClusterClientConfigs[0].CABundle = []byte("rotated-ca")
+			},
+			expected: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			updated := cluster.DeepCopy()
+			c.modify(updated)
+			assert.Equal(t, c.expected, managedClusterClientConfigsChanged().Update(event.UpdateEvent{
+				ObjectOld: cluster,
+				ObjectNew: updated,
+			}))
+		})
+	}
+}
+
+func TestMapManagedClusterToClusterProfile(t *testing.T) {
+	otherCluster := newClusterProfile(testClusterProfileNamespace, "cluster2").build()
+	renamed := newClusterProfile("tenant-a", "profile1").
+		withLabel(clusterv1.ClusterNameLabelKey, "cluster1").
+		build()
+	otherManager := newClusterProfile("tenant-b", "cluster1").
+		withLabel(cpv1alpha1.LabelClusterManagerKey, "other").
+		build()
+
+	reconciler := &ClusterProfileCredSyncer{
+		Cache: &multiClusterProfileFakeCache{
+			clusterProfiles: []cpv1alpha1.ClusterProfile{
+				*newClusterProfile(testClusterProfileNamespace, "cluster1").build(),
+				*otherCluster,
+				*renamed,
+				*otherManager,
+			},
+		},
+	}
+
+	requests := reconciler.mapManagedClusterToClusterProfile(context.Background(),
+		&clusterv1.ManagedCluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster1"}})
+	assert.ElementsMatch(t, []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Namespace: testClusterProfileNamespace, Name: "cluster1"}},
+		{NamespacedName: types.NamespacedName{Namespace: "tenant-a", Name: "profile1"}},
+	}, requests)
+
+	requests = reconciler.mapManagedClusterToClusterProfile(context.Background(), &corev1.Secret{})
+	assert.Empty(t, requests)
+}
@@ -0,0 +1,341 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+	"open-cluster-management.io/managed-serviceaccount/pkg/common"
+)
+
+// maxPendingServiceAccounts limits the ManagedServiceAccounts listed in the status of the CredentialRevocation.
+const maxPendingServiceAccounts = 100
+
+var _ reconcile.Reconciler = &CredentialRevocationReconciler{}
+
+// CredentialRevocationReconciler dispatches the CredentialRevocations to the selected
+// ManagedServiceAccounts, and tracks the progress of the agents handling them.
+type CredentialRevocationReconciler struct {
+	cache.Cache
+	HubClient client.Client
+}
+
+func NewCredentialRevocationReconciler(cache cache.Cache, hubClient client.Client) *CredentialRevocationReconciler {
+	return &CredentialRevocationReconciler{
+		Cache:     cache,
+		HubClient: hubClient,
+	}
+}
+
+// SetupWithManager sets up the CredentialRevocationReconciler with the manager.
+func (r *CredentialRevocationReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// Predicate to filter only ManagedServiceAccounts dispatched a CredentialRevocation
+	msaFilter := func(obj client.Object) bool {
+		_, ok := obj.GetAnnotations()[common.AnnotationKeyCredentialRevocation]
+		return ok
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&authv1beta1.CredentialRevocation{}).
+		Watches(
+			&authv1beta1.ManagedServiceAccount{},
+			handler.EnqueueRequestsFromMapFunc(r.mapManagedServiceAccountToCredentialRevocation),
+			builder.WithPredicates(predicate.NewPredicateFuncs(msaFilter)),
+		).
+		Complete(r)
+}
+
+// mapManagedServiceAccountToCredentialRevocation maps the ManagedServiceAccount to the last
+// CredentialRevocation dispatched to it.
+func (r *CredentialRevocationReconciler) mapManagedServiceAccountToCredentialRevocation(
+	_ context.Context, obj client.Object) []reconcile.Request {
+	return []reconcile.Request{
+		{
+			NamespacedName: types.NamespacedName{
+				Name: obj.GetAnnotations()[common.AnnotationKeyCredentialRevocation],
+			},
+		},
+	}
+}
+
+func (r *CredentialRevocationReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	revocation := &authv1beta1.CredentialRevocation{}
+	if err := r.Get(ctx, req.NamespacedName, revocation); err != nil {
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+	if meta.IsStatusConditionTrue(revocation.Status.Conditions, authv1beta1.ConditionTypeComplete) {
+		return reconcile.Result{}, nil
+	}
+
+	now := metav1.Now()
+	if revocation.Status.StartTimestamp == nil {
+		return reconcile.Result{}, r.start(ctx, revocation, now)
+	}
+
+	revocationCopy := revocation.DeepCopy()
+	var clusterNames []string
+	for _, cluster := range revocation.Status.Clusters {
+		clusterNames = append(clusterNames, cluster.ClusterName)
+	}
+	start := revocation.Status.StartTimestamp.Time
+	dispatched := dispatchedCredentialRevocation(revocation)
+
+	msaSelector, err := selectorOf(revocation.Spec.ServiceAccountSelector)
+	if err != nil {
+		return reconcile.Result{}, errors.Wrapf(err, "invalid service account selector")
+	}
+
+	var errs []error
+	summary := authv1beta1.CredentialRevocationSummary{Clusters: int32(len(clusterNames))}
+	clusters := []authv1beta1.ClusterRevocationStatus{}
+	listed := 0
+	for _, clusterName := range clusterNames {
+		msas := &authv1beta1.ManagedServiceAccountList{}
+		if err := r.List(ctx, msas, client.InNamespace(clusterName),
+			client.MatchingLabelsSelector{Selector: msaSelector}); err != nil {
+			return reconcile.Result{}, errors.Wrapf(err, "failed to list managed serviceaccounts in %s", clusterName)
+		}
+
+		cluster := authv1beta1.ClusterRevocationStatus{ClusterName: clusterName}
+		for i := range msas.Items {
+			msa := &msas.Items[i]
+			// the ManagedServiceAccounts created after the start hold fresh tokens already
+			if msa.CreationTimestamp.Time.After(start) {
+				continue
+			}
+			summary.ServiceAccounts++
+			switch {
+			case !isRevocationApplicable(revocation.Spec.Action, msa):
+				cluster.Skipped++
+			case isRevocationHandled(revocation.Spec.Action, msa, dispatched):
+				cluster.Completed++
+			default:
+				if err := r.dispatch(ctx, revocation, msa, dispatched); err != nil {
+					errs = append(errs, err)
+				}
+				cluster.Pending++
+				if listed < maxPendingServiceAccounts {
+					cluster.PendingServiceAccounts = append(cluster.PendingServiceAccounts, msa.Name)
+					listed++
+				}
+			}
+		}
+
+		clusters = append(clusters, cluster)
+		summary.Completed += cluster.Completed
+		summary.Skipped += cluster.Skipped
+		summary.Pending += cluster.Pending
+		if cluster.Pending == 0 {
+			summary.CompletedClusters++
+		}
+	}
+	revocationCopy.Status.Clusters = clusters
+	revocationCopy.Status.Summary = summary
+
+	var requeueAfter time.Duration
+	switch {
+	case summary.Pending == 0:
+		meta.SetStatusCondition(&revocationCopy.Status.Conditions, metav1.Condition{
+			Type:   authv1beta1.ConditionTypeComplete,
+			Status: metav1.ConditionTrue,
+			Reason: "Completed",
+			Message: fmt.Sprintf("%d ManagedServiceAccounts on %d clusters are handled, %d are skipped",
+				summary.Completed, summary.Clusters, summary.Skipped),
+		})
+		revocationCopy.Status.CompletionTimestamp = &now
+	case revocation.Spec.Timeout != nil && !now.Time.Before(start.Add(revocation.Spec.Timeout.Duration)):
+		meta.SetStatusCondition(&revocationCopy.Status.Conditions, metav1.Condition{
+			Type:   authv1beta1.ConditionTypeComplete,
+			Status: metav1.ConditionTrue,
+			Reason: "TimedOut",
+			Message: fmt.Sprintf("%d ManagedServiceAccounts on %d clusters are still pending after %s",
+				summary.Pending, summary.Clusters-summary.CompletedClusters, revocation.Spec.Timeout.Duration),
+		})
+		revocationCopy.Status.CompletionTimestamp = &now
+	default:
+		meta.SetStatusCondition(&revocationCopy.Status.Conditions, metav1.Condition{
+			Type:   authv1beta1.ConditionTypeComplete,
+			Status: metav1.ConditionFalse,
+			Reason: "InProgress",
+			Message: fmt.Sprintf("%d ManagedServiceAccounts on %d clusters are pending",
+				summary.Pending, summary.Clusters-summary.CompletedClusters),
+		})
+		if revocation.Spec.Timeout != nil {
+			requeueAfter = start.Add(revocation.Spec.Timeout.Duration).Sub(now.Time)
+		}
+	}
+
+	if !equality.Semantic.DeepEqual(revocation.Status, revocationCopy.Status) {
+		if err := r.HubClient.Status().Update(ctx, revocationCopy); err != nil {
+			return reconcile.Result{}, errors.Wrapf(err, "failed to update status")
+		}
+	}
+	return reconcile.Result{RequeueAfter: requeueAfter}, utilerrors.NewAggregate(errs)
+}
+
+// start records the start and the selected clusters in the status before anything is dispatched,
+// so that a failed reconcile never restarts the revocation with a later start and dispatches it
+// again to the ManagedServiceAccounts handled already. The status update triggers the next
+// reconcile to dispatch the revocation.
+func (r *CredentialRevocationReconciler) start(ctx context.Context,
+	revocation *authv1beta1.CredentialRevocation, now metav1.Time) error {
+	// the selected clusters are recorded in the status along with the start, the clusters
+	// joining afterwards are not targeted
+	clusterNames, err := r.selectClusters(ctx, revocation)
+	if err != nil {
+		return err
+	}
+
+	revocationCopy := revocation.DeepCopy()
+	// the start is compared with the creation timestamps of the ManagedServiceAccounts in seconds
+	start := metav1.NewTime(now.Truncate(time.Second))
+	revocationCopy.Status.StartTimestamp = &start
+	revocationCopy.Status.Clusters = []authv1beta1.ClusterRevocationStatus{}
+	for _, clusterName := range clusterNames {
+		revocationCopy.Status.Clusters = append(revocationCopy.Status.Clusters,
+			authv1beta1.ClusterRevocationStatus{ClusterName: clusterName})
+	}
+	revocationCopy.Status.Summary = authv1beta1.CredentialRevocationSummary{Clusters: int32(len(clusterNames))}
+	meta.SetStatusCondition(&revocationCopy.Status.Conditions, metav1.Condition{
+		Type:    authv1beta1.ConditionTypeComplete,
+		Status:  metav1.ConditionFalse,
+		Reason:  "InProgress",
+		Message: fmt.Sprintf("Starting on %d clusters", len(clusterNames)),
+	})
+	if err := r.HubClient.Status().Update(ctx, revocationCopy); err != nil {
+		return errors.Wrapf(err, "failed to update status")
+	}
+	return nil
+}
+
+// selectClusters returns the names of the ManagedClusters selected by the CredentialRevocation.
+func (r *CredentialRevocationReconciler) selectClusters(ctx context.Context,
+	revocation *authv1beta1.CredentialRevocation) ([]string, error) {
+	selector, err := selectorOf(revocation.Spec.ClusterSelector)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid cluster selector")
+	}
+	clusters := &clusterv1.ManagedClusterList{}
+	if err := r.List(ctx, clusters, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, errors.Wrapf(err, "failed to list managed clusters")
+	}
+
+	names := []string{}
+	restricted := sets.New(revocation.Spec.ClusterNames...)
+	for _, cluster := range clusters.Items {
+		if restricted.Len() > 0 && !restricted.Has(cluster.Name) {
+			continue
+		}
+		names = append(names, cluster.Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// dispatchedCredentialRevocation returns the reference to the CredentialRevocation which is set in the
+// annotations of the ManagedServiceAccounts on dispatch, and echoed by the agents once handled.
+func dispatchedCredentialRevocation(revocation *authv1beta1.CredentialRevocation) authv1beta1.CredentialRevocationReference {
+	return authv1beta1.CredentialRevocationReference{
+		Name:       revocation.Name,
+		UID:        revocation.UID,
+		Generation: revocation.Generation,
+	}
+}
+
+// isDispatched checks whether the CredentialRevocation is dispatched to the ManagedServiceAccount.
+func isDispatched(msa *authv1beta1.ManagedServiceAccount, ref authv1beta1.CredentialRevocationReference) bool {
+	return msa.Annotations[common.AnnotationKeyCredentialRevocation] == ref.Name &&
+		msa.Annotations[common.AnnotationKeyCredentialRevocationUID] == string(ref.UID) &&
+		msa.Annotations[common.AnnotationKeyCredentialRevocationGeneration] == strconv.FormatInt(ref.Generation, 10)
+}
+
+// dispatch requests the agent to revoke or re-issue the token of the ManagedServiceAccount, unless
+// it is requested already. The request is identified by the annotations, which the agent echoes in
+// the status once it is handled.
+func (r *CredentialRevocationReconciler) dispatch(ctx context.Context, revocation *authv1beta1.CredentialRevocation,
+	msa *authv1beta1.ManagedServiceAccount, ref authv1beta1.CredentialRevocationReference) error {
+	if isDispatched(msa, ref) {
+		return nil
+	}
+
+	dispatched := msa.DeepCopy()
+	if dispatched.Annotations == nil {
+		dispatched.Annotations = map[string]string{}
+	}
+	dispatched.Annotations[common.AnnotationKeyCredentialRevocation] = ref.Name
+	dispatched.Annotations[common.AnnotationKeyCredentialRevocationUID] = string(ref.UID)
+	dispatched.Annotations[common.AnnotationKeyCredentialRevocationGeneration] = strconv.FormatInt(ref.Generation, 10)
+	if revocation.Spec.Action != authv1beta1.CredentialRevocationActionReissue {
+		generation := dispatched.Spec.RevocationGeneration
+		if last := dispatched.Status.LastRevocation; last != nil && last.Generation > generation {
+			generation = last.Generation
+		}
+		dispatched.Spec.RevocationGeneration = generation + 1
+	}
+	if err := r.HubClient.Update(ctx, dispatched); err != nil {
+		return errors.Wrapf(err, "failed to dispatch to managed serviceaccount %s/%s", msa.Namespace, msa.Name)
+	}
+	return nil
+}
+
+// isRevocationApplicable checks whether the action applies to the ManagedServiceAccount. The
+// tokens of an adopted ServiceAccount and the client certificates cannot be revoked, and no token
+// is issued on the hub cluster without the projection.
+func isRevocationApplicable(action authv1beta1.CredentialRevocationAction,
+	msa *authv1beta1.ManagedServiceAccount) bool {
+	switch action {
+	case authv1beta1.CredentialRevocationActionReissue:
+		return msa.Spec.Projection == nil || msa.Spec.Projection.Type != authv1beta1.ProjectionTypeNone
+	default:
+		return (msa.Spec.ServiceAccount == nil || msa.Spec.ServiceAccount.Mode != authv1beta1.ServiceAccountModeAdopt) &&
+			msa.Spec.CredentialType != authv1beta1.CredentialTypeClientCertificate
+	}
+}
+
+// isRevocationHandled checks whether the agent has echoed the CredentialRevocation in the status of
+// the ManagedServiceAccount, which it does once the token is revoked or re-issued. The timestamps
+// reported by the agent are never compared with the clock of the hub cluster.
+func isRevocationHandled(action authv1beta1.CredentialRevocationAction,
+	msa *authv1beta1.ManagedServiceAccount, ref authv1beta1.CredentialRevocationReference) bool {
+	last := msa.Status.LastCredentialRevocation
+	if last == nil || *last != ref {
+		return false
+	}
+	return action == authv1beta1.CredentialRevocationActionReissue || !isRevocationPending(msa)
+}
+
+// isRevocationPending checks whether the spec.revocationGeneration is not handled by the agent yet.
+func isRevocationPending(msa *authv1beta1.ManagedServiceAccount) bool {
+	var revoked int64
+	if msa.Status.LastRevocation != nil {
+		revoked = msa.Status.LastRevocation.Generation
+	}
+	return msa.Spec.RevocationGeneration > revoked
+}
+
+func selectorOf(labelSelector *metav1.LabelSelector) (labels.Selector, error) {
+	if labelSelector == nil {
+		return labels.Everything(), nil
+	}
+	return metav1.LabelSelectorAsSelector(labelSelector)
+}
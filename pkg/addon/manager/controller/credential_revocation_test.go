@@ -0,0 +1,397 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+	"open-cluster-management.io/managed-serviceaccount/pkg/common"
+)
+
+func TestCredentialRevocationReconcile(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	start := metav1.NewTime(now.Add(-time.Minute))
+
+	cases := []struct {
+		name            string
+		revocation      *authv1beta1.CredentialRevocation
+		msas            []*authv1beta1.ManagedServiceAccount
+		expectedReason  string
+		expectedSummary authv1beta1.CredentialRevocationSummary
+		validateFunc    func(t *testing.T, hubClient client.Client, revocation *authv1beta1.CredentialRevocation)
+	}{
+		{
+			name: "dispatch revocation to the selected clusters",
+			revocation: newCredentialRevocation(authv1beta1.CredentialRevocationActionRevoke, func(r *authv1beta1.CredentialRevocation) {
+				r.Spec.ClusterSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}}
+			}),
+			msas: []*authv1beta1.ManagedServiceAccount{
+				newRevocationMSA("cluster1", "msa1"),
+				newRevocationMSA("cluster1", "msa2", func(msa *authv1beta1.ManagedServiceAccount) {
+					msa.Spec.ServiceAccount = &authv1beta1.SpokeServiceAccount{
+						Mode: authv1beta1.ServiceAccountModeAdopt,
+					}
+				}),
+				newRevocationMSA("cluster1", "msa3", func(msa *authv1beta1.ManagedServiceAccount) {
+					msa.Spec.CredentialType = authv1beta1.CredentialTypeClientCertificate
+				}),
+				newRevocationMSA("cluster2", "msa1"),
+			},
+			expectedReason: "InProgress",
+			expectedSummary: authv1beta1.CredentialRevocationSummary{
+				Clusters: 1, ServiceAccounts: 3, Skipped: 2, Pending: 1,
+			},
+			validateFunc: func(t *testing.T, hubClient client.Client, revocation *authv1beta1.CredentialRevocation) {
+				assert.NotNil(t, revocation.Status.StartTimestamp)
+				assert.Equal(t, []authv1beta1.ClusterRevocationStatus{
+					{ClusterName: "cluster1", Skipped: 2, Pending: 1, PendingServiceAccounts: []string{"msa1"}},
+				}, revocation.Status.Clusters)
+
+				msa := getMSA(t, hubClient, "cluster1", "msa1")
+				assert.Equal(t, int64(1), msa.Spec.RevocationGeneration)
+				assert.Equal(t, "drill", msa.Annotations[common.AnnotationKeyCredentialRevocation])
+				assert.Equal(t, int64(0), getMSA(t, hubClient, "cluster1", "msa2").Spec.RevocationGeneration)
+				assert.Equal(t, int64(0), getMSA(t, hubClient, "cluster1", "msa3").Spec.RevocationGeneration)
+				assert.Equal(t, int64(0), getMSA(t, hubClient, "cluster2", "msa1").Spec.RevocationGeneration)
+			},
+		},
+		{
+			name: "revocation dispatched already",
+			revocation: newCredentialRevocation(authv1beta1.CredentialRevocationActionRevoke, func(r *authv1beta1.CredentialRevocation) {
+				r.Spec.ClusterNames = []string{"cluster1"}
+				r.Status.StartTimestamp = &start
+				r.Status.Clusters = startedClusters("cluster1")
+			}),
+			msas: []*authv1beta1.ManagedServiceAccount{
+				newRevocationMSA("cluster1", "msa1", func(msa *authv1beta1.ManagedServiceAccount) {
+					dispatchRevocation(msa)
+					msa.Spec.RevocationGeneration = 3
+					msa.Status.LastRevocation = &authv1beta1.TokenRevocation{Generation: 2}
+				}),
+			},
+			expectedReason: "InProgress",
+			expectedSummary: authv1beta1.CredentialRevocationSummary{
+				Clusters: 1, ServiceAccounts: 1, Pending: 1,
+			},
+			validateFunc: func(t *testing.T, hubClient client.Client, revocation *authv1beta1.CredentialRevocation) {
+				assert.Equal(t, int64(3), getMSA(t, hubClient, "cluster1", "msa1").Spec.RevocationGeneration)
+			},
+		},
+		{
+			name: "revocation handled but not echoed yet",
+			revocation: newCredentialRevocation(authv1beta1.CredentialRevocationActionRevoke, func(r *authv1beta1.CredentialRevocation) {
+				r.Status.StartTimestamp = &start
+				r.Status.Clusters = startedClusters("cluster1")
+			}),
+			msas: []*authv1beta1.ManagedServiceAccount{
+				newRevocationMSA("cluster1", "msa1", func(msa *authv1beta1.ManagedServiceAccount) {
+					dispatchRevocation(msa)
+					msa.Spec.RevocationGeneration = 1
+					// the timestamp reported by the agent is ahead of the hub clock
+					msa.Status.LastRevocation = &authv1beta1.TokenRevocation{Generation: 1, Timestamp: metav1.NewTime(now.Add(time.Hour))}
+				}),
+			},
+			expectedReason: "InProgress",
+			expectedSummary: authv1beta1.CredentialRevocationSummary{
+				Clusters: 1, ServiceAccounts: 1, Pending: 1,
+			},
+			validateFunc: func(t *testing.T, hubClient client.Client, revocation *authv1beta1.CredentialRevocation) {
+				// the revocation is not dispatched twice
+				assert.Equal(t, int64(1), getMSA(t, hubClient, "cluster1", "msa1").Spec.RevocationGeneration)
+			},
+		},
+		{
+			name: "dispatch revocation over a former request of the same name",
+			revocation: newCredentialRevocation(authv1beta1.CredentialRevocationActionRevoke, func(r *authv1beta1.CredentialRevocation) {
+				r.Status.StartTimestamp = &start
+				r.Status.Clusters = startedClusters("cluster1")
+			}),
+			msas: []*authv1beta1.ManagedServiceAccount{
+				newRevocationMSA("cluster1", "msa1", func(msa *authv1beta1.ManagedServiceAccount) {
+					dispatchRevocation(msa)
+					msa.Annotations[common.AnnotationKeyCredentialRevocationUID] = "former-uid"
+					msa.Spec.RevocationGeneration = 1
+					msa.Status.LastRevocation = &authv1beta1.TokenRevocation{Generation: 1}
+					msa.Status.LastCredentialRevocation = &authv1beta1.CredentialRevocationReference{
+						Name: "drill", UID: "former-uid", Generation: 1,
+					}
+				}),
+			},
+			expectedReason: "InProgress",
+			expectedSummary: authv1beta1.CredentialRevocationSummary{
+				Clusters: 1, ServiceAccounts: 1, Pending: 1,
+			},
+			validateFunc: func(t *testing.T, hubClient client.Client, revocation *authv1beta1.CredentialRevocation) {
+				msa := getMSA(t, hubClient, "cluster1", "msa1")
+				assert.Equal(t, int64(2), msa.Spec.RevocationGeneration)
+				assert.Equal(t, "drill-uid", msa.Annotations[common.AnnotationKeyCredentialRevocationUID])
+			},
+		},
+		{
+			name: "track the targets selected at the start",
+			revocation: newCredentialRevocation(authv1beta1.CredentialRevocationActionRevoke, func(r *authv1beta1.CredentialRevocation) {
+				r.Status.StartTimestamp = &start
+				r.Status.Clusters = startedClusters("cluster1")
+			}),
+			msas: []*authv1beta1.ManagedServiceAccount{
+				newRevocationMSA("cluster1", "msa1"),
+				newRevocationMSA("cluster1", "msa2", func(msa *authv1beta1.ManagedServiceAccount) {
+					msa.CreationTimestamp = metav1.NewTime(now)
+				}),
+				newRevocationMSA("cluster2", "msa1"),
+			},
+			expectedReason: "InProgress",
+			expectedSummary: authv1beta1.CredentialRevocationSummary{
+				Clusters: 1, ServiceAccounts: 1, Pending: 1,
+			},
+			validateFunc: func(t *testing.T, hubClient client.Client, revocation *authv1beta1.CredentialRevocation) {
+				assert.Equal(t, int64(1), getMSA(t, hubClient, "cluster1", "msa1").Spec.RevocationGeneration)
+				assert.Equal(t, int64(0), getMSA(t, hubClient, "cluster1", "msa2").Spec.RevocationGeneration)
+				assert.Equal(t, int64(0), getMSA(t, hubClient, "cluster2", "msa1").Spec.RevocationGeneration)
+			},
+		},
+		{
+			name: "revocation completed",
+			revocation: newCredentialRevocation(authv1beta1.CredentialRevocationActionRevoke, func(r *authv1beta1.CredentialRevocation) {
+				r.Status.StartTimestamp = &start
+				r.Status.Clusters = startedClusters("cluster1", "cluster2")
+			}),
+			msas: []*authv1beta1.ManagedServiceAccount{
+				newRevocationMSA("cluster1", "msa1", func(msa *authv1beta1.ManagedServiceAccount) {
+					dispatchRevocation(msa)
+					echoRevocation(msa)
+					msa.Spec.RevocationGeneration = 1
+					// the timestamp reported by the agent is behind the hub clock
+					msa.Status.LastRevocation = &authv1beta1.TokenRevocation{Generation: 1, Timestamp: metav1.NewTime(now.Add(-time.Hour))}
+				}),
+			},
+			expectedReason: "Completed",
+			expectedSummary: authv1beta1.CredentialRevocationSummary{
+				Clusters: 2, CompletedClusters: 2, ServiceAccounts: 1, Completed: 1,
+			},
+			validateFunc: func(t *testing.T, hubClient client.Client, revocation *authv1beta1.CredentialRevocation) {
+				assert.NotNil(t, revocation.Status.CompletionTimestamp)
+			},
+		},
+		{
+			name:       "dispatch reissue",
+			revocation: newCredentialRevocation(authv1beta1.CredentialRevocationActionReissue),
+			msas: []*authv1beta1.ManagedServiceAccount{
+				newRevocationMSA("cluster1", "msa1", func(msa *authv1beta1.ManagedServiceAccount) {
+					msa.Status.TokenSecretRef = &authv1beta1.SecretRef{
+						Name:                 "msa1",
+						LastRefreshTimestamp: metav1.NewTime(now.Add(-time.Hour)),
+					}
+				}),
+				newRevocationMSA("cluster2", "msa1", func(msa *authv1beta1.ManagedServiceAccount) {
+					msa.Spec.Projection = &authv1beta1.ManagedServiceAccountProjection{
+						Type: authv1beta1.ProjectionTypeNone,
+					}
+				}),
+			},
+			expectedReason: "InProgress",
+			expectedSummary: authv1beta1.CredentialRevocationSummary{
+				Clusters: 2, CompletedClusters: 1, ServiceAccounts: 2, Skipped: 1, Pending: 1,
+			},
+			validateFunc: func(t *testing.T, hubClient client.Client, revocation *authv1beta1.CredentialRevocation) {
+				msa := getMSA(t, hubClient, "cluster1", "msa1")
+				assert.Equal(t, "drill", msa.Annotations[common.AnnotationKeyCredentialRevocation])
+				assert.Equal(t, "drill-uid", msa.Annotations[common.AnnotationKeyCredentialRevocationUID])
+				assert.Equal(t, "1", msa.Annotations[common.AnnotationKeyCredentialRevocationGeneration])
+				assert.Equal(t, int64(0), msa.Spec.RevocationGeneration)
+			},
+		},
+		{
+			name: "reissue completed",
+			revocation: newCredentialRevocation(authv1beta1.CredentialRevocationActionReissue, func(r *authv1beta1.CredentialRevocation) {
+				r.Status.StartTimestamp = &start
+				r.Status.Clusters = startedClusters("cluster1", "cluster2")
+			}),
+			msas: []*authv1beta1.ManagedServiceAccount{
+				newRevocationMSA("cluster1", "msa1", func(msa *authv1beta1.ManagedServiceAccount) {
+					dispatchRevocation(msa)
+					echoRevocation(msa)
+					// the timestamp reported by the agent is behind the hub clock
+					msa.Status.TokenSecretRef = &authv1beta1.SecretRef{
+						Name:                 "msa1",
+						LastRefreshTimestamp: metav1.NewTime(now.Add(-time.Hour)),
+					}
+				}),
+			},
+			expectedReason: "Completed",
+			expectedSummary: authv1beta1.CredentialRevocationSummary{
+				Clusters: 2, CompletedClusters: 2, ServiceAccounts: 1, Completed: 1,
+			},
+		},
+		{
+			name: "timed out",
+			revocation: newCredentialRevocation(authv1beta1.CredentialRevocationActionRevoke, func(r *authv1beta1.CredentialRevocation) {
+				r.Spec.Timeout = &metav1.Duration{Duration: 30 * time.Second}
+				r.Status.StartTimestamp = &start
+				r.Status.Clusters = startedClusters("cluster1", "cluster2")
+			}),
+			msas: []*authv1beta1.ManagedServiceAccount{
+				newRevocationMSA("cluster2", "msa1"),
+			},
+			expectedReason: "TimedOut",
+			expectedSummary: authv1beta1.CredentialRevocationSummary{
+				Clusters: 2, CompletedClusters: 1, ServiceAccounts: 1, Pending: 1,
+			},
+			validateFunc: func(t *testing.T, hubClient client.Client, revocation *authv1beta1.CredentialRevocation) {
+				assert.NotNil(t, revocation.Status.CompletionTimestamp)
+				assert.Equal(t, []string{"msa1"}, revocation.Status.Clusters[1].PendingServiceAccounts)
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			testscheme := runtime.NewScheme()
+			authv1beta1.AddToScheme(testscheme)
+			clusterv1.AddToScheme(testscheme)
+
+			objects := []client.Object{
+				c.revocation,
+				newRevocationCluster("cluster1", "prod"),
+				newRevocationCluster("cluster2", "dev"),
+			}
+			for _, msa := range c.msas {
+				objects = append(objects, msa)
+			}
+			hubClient := fake.NewClientBuilder().WithScheme(testscheme).WithObjects(objects...).
+				WithStatusSubresource(c.revocation).Build()
+
+			reconciler := NewCredentialRevocationReconciler(&clientCache{Reader: hubClient}, hubClient)
+			request := reconcile.Request{NamespacedName: types.NamespacedName{Name: c.revocation.Name}}
+			if c.revocation.Status.StartTimestamp == nil {
+				// the first reconcile records the start and the clusters without dispatching
+				_, err := reconciler.Reconcile(context.TODO(), request)
+				assert.NoError(t, err)
+				for _, msa := range c.msas {
+					dispatched := getMSA(t, hubClient, msa.Namespace, msa.Name)
+					assert.Empty(t, dispatched.Annotations[common.AnnotationKeyCredentialRevocation])
+					assert.Equal(t, msa.Spec.RevocationGeneration, dispatched.Spec.RevocationGeneration)
+				}
+			}
+			_, err := reconciler.Reconcile(context.TODO(), request)
+			assert.NoError(t, err)
+
+			revocation := &authv1beta1.CredentialRevocation{}
+			err = hubClient.Get(context.TODO(), types.NamespacedName{Name: c.revocation.Name}, revocation)
+			assert.NoError(t, err)
+			complete := meta.FindStatusCondition(revocation.Status.Conditions, authv1beta1.ConditionTypeComplete)
+			assert.NotNil(t, complete)
+			assert.Equal(t, c.expectedReason, complete.Reason)
+			assert.Equal(t, c.expectedSummary, revocation.Status.Summary)
+			if c.validateFunc != nil {
+				c.validateFunc(t, hubClient, revocation)
+			}
+		})
+	}
+}
+
+func TestMapManagedServiceAccountToCredentialRevocation(t *testing.T) {
+	reconciler := &CredentialRevocationReconciler{}
+	msa := newRevocationMSA("cluster1", "msa1", func(msa *authv1beta1.ManagedServiceAccount) {
+		msa.Annotations = map[string]string{common.AnnotationKeyCredentialRevocation: "drill"}
+	})
+	requests := reconciler.mapManagedServiceAccountToCredentialRevocation(context.TODO(), msa)
+	assert.Equal(t, []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Name: "drill"}},
+	}, requests)
+}
+
+// clientCache serves the reads of the reconciler from the fake client
+type clientCache struct {
+	client.Reader
+	cache.Informers
+}
+
+func newCredentialRevocation(action authv1beta1.CredentialRevocationAction,
+	modifiers ...func(*authv1beta1.CredentialRevocation)) *authv1beta1.CredentialRevocation {
+	revocation := &authv1beta1.CredentialRevocation{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "drill",
+			UID:        "drill-uid",
+			Generation: 1,
+		},
+		Spec: authv1beta1.CredentialRevocationSpec{
+			Action: action,
+		},
+	}
+	for _, modifier := range modifiers {
+		modifier(revocation)
+	}
+	return revocation
+}
+
+// dispatchRevocation sets the annotations of the ManagedServiceAccount as the "drill" CredentialRevocation
+// is dispatched to it.
+func dispatchRevocation(msa *authv1beta1.ManagedServiceAccount) {
+	msa.Annotations = map[string]string{
+		common.AnnotationKeyCredentialRevocation:           "drill",
+		common.AnnotationKeyCredentialRevocationUID:        "drill-uid",
+		common.AnnotationKeyCredentialRevocationGeneration: "1",
+	}
+}
+
+// echoRevocation sets the status of the ManagedServiceAccount as the agent handles the "drill"
+// CredentialRevocation.
+func echoRevocation(msa *authv1beta1.ManagedServiceAccount) {
+	msa.Status.LastCredentialRevocation = &authv1beta1.CredentialRevocationReference{
+		Name:       "drill",
+		UID:        "drill-uid",
+		Generation: 1,
+	}
+}
+
+// startedClusters returns the clusters recorded in the status at the start of the request.
+func startedClusters(names ...string) []authv1beta1.ClusterRevocationStatus {
+	clusters := []authv1beta1.ClusterRevocationStatus{}
+	for _, name := range names {
+		clusters = append(clusters, authv1beta1.ClusterRevocationStatus{ClusterName: name})
+	}
+	return clusters
+}
+
+func newRevocationCluster(name, env string) *clusterv1.ManagedCluster {
+	return &clusterv1.ManagedCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{"env": env},
+		},
+	}
+}
+
+func newRevocationMSA(namespace, name string,
+	modifiers ...func(*authv1beta1.ManagedServiceAccount)) *authv1beta1.ManagedServiceAccount {
+	msa := &authv1beta1.ManagedServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+		},
+	}
+	for _, modifier := range modifiers {
+		modifier(msa)
+	}
+	return msa
+}
+
+func getMSA(t *testing.T, hubClient client.Client, namespace, name string) *authv1beta1.ManagedServiceAccount {
+	msa := &authv1beta1.ManagedServiceAccount{}
+	err := hubClient.Get(context.TODO(), types.NamespacedName{Namespace: namespace, Name: name}, msa)
+	assert.NoError(t, err)
+	return msa
+}
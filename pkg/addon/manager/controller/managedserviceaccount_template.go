@@ -0,0 +1,176 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+	"open-cluster-management.io/managed-serviceaccount/pkg/common"
+)
+
+// managedServiceAccountConflictError is returned if a ManagedServiceAccount of the same name exists
+// and is not created by the owner, the existing ManagedServiceAccount is left untouched.
+type managedServiceAccountConflictError struct {
+	namespace, name string
+	// owner describes what the existing ManagedServiceAccount is created by, it is empty if it is
+	// not created from a template.
+	owner string
+}
+
+func (e *managedServiceAccountConflictError) Error() string {
+	if len(e.owner) == 0 {
+		return fmt.Sprintf("managed serviceaccount %s/%s exists and is not created from a template",
+			e.namespace, e.name)
+	}
+	return fmt.Sprintf("managed serviceaccount %s/%s exists and is created by %s", e.namespace, e.name, e.owner)
+}
+
+// ownerOfManagedServiceAccount describes the ManagedServiceAccountSet or the
+// ClusterManagedServiceAccountTemplate creating the ManagedServiceAccount by its labels.
+func ownerOfManagedServiceAccount(msa *authv1beta1.ManagedServiceAccount) string {
+	if name, ok := msa.Labels[common.LabelKeyManagedServiceAccountSetName]; ok {
+		return fmt.Sprintf("ManagedServiceAccountSet %s/%s",
+			msa.Labels[common.LabelKeyManagedServiceAccountSetNamespace], name)
+	}
+	if name, ok := msa.Labels[common.LabelKeyClusterManagedServiceAccountTemplate]; ok {
+		return fmt.Sprintf("ClusterManagedServiceAccountTemplate %s", name)
+	}
+	return ""
+}
+
+// applyManagedServiceAccountTemplate creates or updates the ManagedServiceAccount from the template
+// and labels it with the owner labels, it returns a managedServiceAccountConflictError if the
+// ManagedServiceAccount exists and is not created by the owner, and nil if it is being deleted.
+// The ManagedServiceAccount is deleted if the template changes its immutable spec.serviceAccount,
+// it is recreated once the deletion completes.
+func applyManagedServiceAccountTemplate(ctx context.Context, reader client.Reader, hubClient client.Client,
+	namespace, name string, template *authv1beta1.ManagedServiceAccountTemplate,
+	ownerLabels map[string]string) (*authv1beta1.ManagedServiceAccount, error) {
+	existing := &authv1beta1.ManagedServiceAccount{}
+	err := reader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, existing)
+	switch {
+	case apierrors.IsNotFound(err):
+		msa := &authv1beta1.ManagedServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: namespace,
+				Name:      name,
+			},
+		}
+		mergeManagedServiceAccountTemplate(msa, template, ownerLabels)
+		if err := hubClient.Create(ctx, msa); err != nil {
+			return nil, errors.Wrapf(err, "failed to create managed serviceaccount %s/%s", namespace, name)
+		}
+		return msa, nil
+	case err != nil:
+		return nil, errors.Wrapf(err, "failed to get managed serviceaccount %s/%s", namespace, name)
+	case !isManagedServiceAccountOwnedBy(existing, ownerLabels):
+		// leave the ManagedServiceAccount created by others alone
+		return nil, &managedServiceAccountConflictError{
+			namespace: namespace,
+			name:      name,
+			owner:     ownerOfManagedServiceAccount(existing),
+		}
+	case !existing.DeletionTimestamp.IsZero():
+		return nil, nil
+	}
+
+	msa := existing.DeepCopy()
+	mergeManagedServiceAccountTemplate(msa, template, ownerLabels)
+	if !equality.Semantic.DeepEqual(existing.Spec.ServiceAccount, msa.Spec.ServiceAccount) {
+		logger.Info("Recreating ManagedServiceAccount as the template changes its serviceAccount",
+			"namespace", namespace, "name", name)
+		if err := hubClient.Delete(ctx, existing); err != nil && !apierrors.IsNotFound(err) {
+			return nil, errors.Wrapf(err, "failed to delete managed serviceaccount %s/%s", namespace, name)
+		}
+		return nil, nil
+	}
+	if equality.Semantic.DeepEqual(existing, msa) {
+		return existing, nil
+	}
+	if err := hubClient.Update(ctx, msa); err != nil {
+		return nil, errors.Wrapf(err, "failed to update managed serviceaccount %s/%s", namespace, name)
+	}
+	return msa, nil
+}
+
+// deleteManagedServiceAccounts deletes the ManagedServiceAccounts labeled with the owner labels,
+// except for those in the namespaces to keep.
+func deleteManagedServiceAccounts(ctx context.Context, reader client.Reader, hubClient client.Client,
+	ownerLabels map[string]string, keep sets.Set[string]) error {
+	msas := &authv1beta1.ManagedServiceAccountList{}
+	if err := reader.List(ctx, msas, client.MatchingLabels(ownerLabels)); err != nil {
+		return errors.Wrapf(err, "failed to list managed serviceaccounts")
+	}
+
+	var errs []error
+	for i := range msas.Items {
+		msa := &msas.Items[i]
+		if keep.Has(msa.Namespace) || !msa.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if err := hubClient.Delete(ctx, msa); err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, errors.Wrapf(err, "failed to delete managed serviceaccount %s/%s", msa.Namespace, msa.Name))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// mergeManagedServiceAccountTemplate applies the template to the ManagedServiceAccount. The labels
+// and annotations set by others are kept, and the spec.revocationGeneration is never decreased as
+// it may be increased by a CredentialRevocation. The spec is defaulted the same way as the webhook
+// does, so that an unchanged template does not update the ManagedServiceAccount.
+func mergeManagedServiceAccountTemplate(msa *authv1beta1.ManagedServiceAccount,
+	template *authv1beta1.ManagedServiceAccountTemplate, ownerLabels map[string]string) {
+	if msa.Labels == nil {
+		msa.Labels = map[string]string{}
+	}
+	for k, v := range template.Labels {
+		msa.Labels[k] = v
+	}
+	for k, v := range ownerLabels {
+		msa.Labels[k] = v
+	}
+	if len(template.Annotations) > 0 && msa.Annotations == nil {
+		msa.Annotations = map[string]string{}
+	}
+	for k, v := range template.Annotations {
+		msa.Annotations[k] = v
+	}
+
+	revocationGeneration := msa.Spec.RevocationGeneration
+	msa.Spec = *template.Spec.DeepCopy()
+	if revocationGeneration > msa.Spec.RevocationGeneration {
+		msa.Spec.RevocationGeneration = revocationGeneration
+	}
+	if sa := msa.Spec.ServiceAccount; sa != nil && len(sa.Mode) == 0 {
+		sa.Mode = authv1beta1.ServiceAccountModeCreate
+	}
+	if projection := msa.Spec.Projection; projection != nil {
+		if len(projection.Type) == 0 {
+			projection.Type = authv1beta1.ProjectionTypeSecret
+		}
+		if projection.Secret != nil && len(projection.Secret.Format) == 0 {
+			projection.Secret.Format = authv1beta1.SecretFormatToken
+		}
+	}
+}
+
+// isManagedServiceAccountOwnedBy checks whether the ManagedServiceAccount is labeled with the
+// owner labels.
+func isManagedServiceAccountOwnedBy(msa *authv1beta1.ManagedServiceAccount, ownerLabels map[string]string) bool {
+	for k, v := range ownerLabels {
+		if msa.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,189 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+	"open-cluster-management.io/managed-serviceaccount/pkg/common"
+)
+
+func TestMergeManagedServiceAccountTemplate(t *testing.T) {
+	template := &authv1beta1.ManagedServiceAccountTemplate{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:      map[string]string{"team": "platform"},
+			Annotations: map[string]string{"owner": "platform"},
+		},
+		Spec: authv1beta1.ManagedServiceAccountSpec{
+			Rotation: authv1beta1.ManagedServiceAccountRotation{
+				Validity: metav1.Duration{Duration: time.Hour},
+			},
+			RevocationGeneration: 1,
+		},
+	}
+	msa := &authv1beta1.ManagedServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "cluster1",
+			Name:        "msa1",
+			Labels:      map[string]string{"app": "demo"},
+			Annotations: map[string]string{"note": "kept"},
+		},
+		Spec: authv1beta1.ManagedServiceAccountSpec{
+			Rotation: authv1beta1.ManagedServiceAccountRotation{
+				Validity: metav1.Duration{Duration: 24 * time.Hour},
+			},
+			RevocationGeneration: 2,
+		},
+	}
+
+	mergeManagedServiceAccountTemplate(msa, template, map[string]string{"owner": "set"})
+	assert.Equal(t, map[string]string{"app": "demo", "team": "platform", "owner": "set"}, msa.Labels)
+	assert.Equal(t, map[string]string{"note": "kept", "owner": "platform"}, msa.Annotations)
+	assert.Equal(t, time.Hour, msa.Spec.Rotation.Validity.Duration)
+	assert.Equal(t, int64(2), msa.Spec.RevocationGeneration)
+	assert.True(t, isManagedServiceAccountOwnedBy(msa, map[string]string{"owner": "set"}))
+	assert.False(t, isManagedServiceAccountOwnedBy(msa, map[string]string{"owner": "template"}))
+}
+
+func TestApplyManagedServiceAccountTemplate(t *testing.T) {
+	ownerLabels := map[string]string{"owner": "set"}
+	template := &authv1beta1.ManagedServiceAccountTemplate{
+		Spec: authv1beta1.ManagedServiceAccountSpec{
+			Rotation: authv1beta1.ManagedServiceAccountRotation{
+				Validity: metav1.Duration{Duration: time.Hour},
+			},
+			Projection: &authv1beta1.ManagedServiceAccountProjection{},
+		},
+	}
+	templateWithServiceAccount := template.DeepCopy()
+	templateWithServiceAccount.Spec.ServiceAccount = &authv1beta1.SpokeServiceAccount{Name: "deployer"}
+
+	cases := []struct {
+		name            string
+		template        *authv1beta1.ManagedServiceAccountTemplate
+		existing        *authv1beta1.ManagedServiceAccount
+		expectedApplied bool
+		expectedDeleted bool
+		expectedError   string
+		validate        func(t *testing.T, msa *authv1beta1.ManagedServiceAccount)
+	}{
+		{
+			name:            "create",
+			template:        template,
+			expectedApplied: true,
+			validate: func(t *testing.T, msa *authv1beta1.ManagedServiceAccount) {
+				assert.Equal(t, ownerLabels, msa.Labels)
+				assert.Equal(t, time.Hour, msa.Spec.Rotation.Validity.Duration)
+				assert.Equal(t, authv1beta1.ProjectionTypeSecret, msa.Spec.Projection.Type)
+			},
+		},
+		{
+			name:     "update and keep the revocation generation",
+			template: template,
+			existing: newRevocationMSA("cluster1", "msa1", func(msa *authv1beta1.ManagedServiceAccount) {
+				msa.Labels = ownerLabels
+				msa.Spec.Rotation.Validity = metav1.Duration{Duration: 24 * time.Hour}
+				msa.Spec.RevocationGeneration = 2
+			}),
+			expectedApplied: true,
+			validate: func(t *testing.T, msa *authv1beta1.ManagedServiceAccount) {
+				assert.Equal(t, time.Hour, msa.Spec.Rotation.Validity.Duration)
+				assert.Equal(t, int64(2), msa.Spec.RevocationGeneration)
+			},
+		},
+		{
+			name:     "not owned",
+			template: template,
+			existing: newRevocationMSA("cluster1", "msa1", func(msa *authv1beta1.ManagedServiceAccount) {
+				msa.Spec.Rotation.Validity = metav1.Duration{Duration: 24 * time.Hour}
+			}),
+			expectedError: "managed serviceaccount cluster1/msa1 exists and is not created from a template",
+			validate: func(t *testing.T, msa *authv1beta1.ManagedServiceAccount) {
+				assert.Equal(t, 24*time.Hour, msa.Spec.Rotation.Validity.Duration)
+			},
+		},
+		{
+			name:     "owned by a set of the same name in another namespace",
+			template: template,
+			existing: newRevocationMSA("cluster1", "msa1", func(msa *authv1beta1.ManagedServiceAccount) {
+				msa.Labels = map[string]string{
+					common.LabelKeyManagedServiceAccountSetNamespace: "other",
+					common.LabelKeyManagedServiceAccountSetName:      "msa1",
+				}
+				msa.Spec.Rotation.Validity = metav1.Duration{Duration: 24 * time.Hour}
+			}),
+			expectedError: "managed serviceaccount cluster1/msa1 exists and is created by ManagedServiceAccountSet other/msa1",
+			validate: func(t *testing.T, msa *authv1beta1.ManagedServiceAccount) {
+				assert.Equal(t, 24*time.Hour, msa.Spec.Rotation.Validity.Duration)
+			},
+		},
+		{
+			name:     "owned by a cluster template of the same name",
+			template: template,
+			existing: newRevocationMSA("cluster1", "msa1", func(msa *authv1beta1.ManagedServiceAccount) {
+				msa.Labels = map[string]string{common.LabelKeyClusterManagedServiceAccountTemplate: "msa1"}
+			}),
+			expectedError: "managed serviceaccount cluster1/msa1 exists and is created by ClusterManagedServiceAccountTemplate msa1",
+		},
+		{
+			name:     "default serviceaccount mode unchanged",
+			template: templateWithServiceAccount,
+			existing: newRevocationMSA("cluster1", "msa1", func(msa *authv1beta1.ManagedServiceAccount) {
+				msa.Labels = ownerLabels
+				msa.Spec.ServiceAccount = &authv1beta1.SpokeServiceAccount{
+					Name: "deployer",
+					Mode: authv1beta1.ServiceAccountModeCreate,
+				}
+			}),
+			expectedApplied: true,
+		},
+		{
+			name:     "serviceaccount changed",
+			template: templateWithServiceAccount,
+			existing: newRevocationMSA("cluster1", "msa1", func(msa *authv1beta1.ManagedServiceAccount) {
+				msa.Labels = ownerLabels
+				msa.Spec.ServiceAccount = &authv1beta1.SpokeServiceAccount{
+					Mode: authv1beta1.ServiceAccountModeAdopt,
+				}
+			}),
+			expectedDeleted: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var objects []client.Object
+			if c.existing != nil {
+				objects = append(objects, c.existing)
+			}
+			hubClient := newSetTestClient(objects)
+
+			msa, err := applyManagedServiceAccountTemplate(context.TODO(), hubClient, hubClient,
+				"cluster1", "msa1", c.template, ownerLabels)
+			if len(c.expectedError) > 0 {
+				assert.EqualError(t, err, c.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, c.expectedApplied, msa != nil)
+
+			actual := &authv1beta1.ManagedServiceAccount{}
+			err = hubClient.Get(context.TODO(), types.NamespacedName{Namespace: "cluster1", Name: "msa1"}, actual)
+			if c.expectedDeleted {
+				assert.True(t, apierrors.IsNotFound(err))
+				return
+			}
+			assert.NoError(t, err)
+			if c.validate != nil {
+				c.validate(t, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,305 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	clusterv1beta1 "open-cluster-management.io/api/cluster/v1beta1"
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+	"open-cluster-management.io/managed-serviceaccount/pkg/common"
+)
+
+// maxNotReadyClusters limits the ManagedClusters listed in the status of the ManagedServiceAccountSet.
+const maxNotReadyClusters = 100
+
+// maxConflicts limits the conflicting ManagedServiceAccounts listed in the Conflicted condition.
+const maxConflicts = 10
+
+var _ reconcile.Reconciler = &ManagedServiceAccountSetReconciler{}
+
+// ManagedServiceAccountSetReconciler creates, updates and deletes the ManagedServiceAccounts of the
+// ManagedServiceAccountSets as the decisions of their Placements change.
+type ManagedServiceAccountSetReconciler struct {
+	cache.Cache
+	HubClient client.Client
+}
+
+func NewManagedServiceAccountSetReconciler(cache cache.Cache, hubClient client.Client) *ManagedServiceAccountSetReconciler {
+	return &ManagedServiceAccountSetReconciler{
+		Cache:     cache,
+		HubClient: hubClient,
+	}
+}
+
+// SetupWithManager sets up the ManagedServiceAccountSetReconciler with the manager.
+func (r *ManagedServiceAccountSetReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// Predicate to filter only ManagedServiceAccounts created by a ManagedServiceAccountSet
+	msaFilter := func(obj client.Object) bool {
+		_, ok := obj.GetLabels()[common.LabelKeyManagedServiceAccountSetName]
+		return ok
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&authv1beta1.ManagedServiceAccountSet{}).
+		Watches(
+			&clusterv1beta1.Placement{},
+			handler.EnqueueRequestsFromMapFunc(r.mapPlacementToManagedServiceAccountSets),
+		).
+		Watches(
+			&clusterv1beta1.PlacementDecision{},
+			handler.EnqueueRequestsFromMapFunc(r.mapPlacementDecisionToManagedServiceAccountSets),
+		).
+		Watches(
+			&authv1beta1.ManagedServiceAccount{},
+			handler.EnqueueRequestsFromMapFunc(r.mapManagedServiceAccountToManagedServiceAccountSet),
+			builder.WithPredicates(predicate.NewPredicateFuncs(msaFilter)),
+		).
+		Complete(r)
+}
+
+// mapPlacementToManagedServiceAccountSets maps the Placement to the ManagedServiceAccountSets
+// referencing it.
+func (r *ManagedServiceAccountSetReconciler) mapPlacementToManagedServiceAccountSets(
+	ctx context.Context, obj client.Object) []reconcile.Request {
+	return r.managedServiceAccountSetsReferencing(ctx, obj.GetNamespace(), obj.GetName())
+}
+
+// mapPlacementDecisionToManagedServiceAccountSets maps the PlacementDecision to the
+// ManagedServiceAccountSets referencing its Placement.
+func (r *ManagedServiceAccountSetReconciler) mapPlacementDecisionToManagedServiceAccountSets(
+	ctx context.Context, obj client.Object) []reconcile.Request {
+	placementName, ok := obj.GetLabels()[clusterv1beta1.PlacementLabel]
+	if !ok {
+		return []reconcile.Request{}
+	}
+	return r.managedServiceAccountSetsReferencing(ctx, obj.GetNamespace(), placementName)
+}
+
+func (r *ManagedServiceAccountSetReconciler) managedServiceAccountSetsReferencing(ctx context.Context,
+	namespace, placementName string) []reconcile.Request {
+	msaSets := &authv1beta1.ManagedServiceAccountSetList{}
+	if err := r.List(ctx, msaSets, client.InNamespace(namespace)); err != nil {
+		logger.Error(err, "failed to list managedserviceaccountsets")
+		return []reconcile.Request{}
+	}
+
+	var requests []reconcile.Request
+	for _, msaSet := range msaSets.Items {
+		for _, ref := range msaSet.Spec.PlacementRefs {
+			if ref.Name == placementName {
+				requests = append(requests, reconcile.Request{
+					NamespacedName: types.NamespacedName{
+						Namespace: msaSet.Namespace,
+						Name:      msaSet.Name,
+					},
+				})
+				break
+			}
+		}
+	}
+	return requests
+}
+
+// mapManagedServiceAccountToManagedServiceAccountSet maps the ManagedServiceAccount to the
+// ManagedServiceAccountSet creating it.
+func (r *ManagedServiceAccountSetReconciler) mapManagedServiceAccountToManagedServiceAccountSet(
+	_ context.Context, obj client.Object) []reconcile.Request {
+	return []reconcile.Request{
+		{
+			NamespacedName: types.NamespacedName{
+				Namespace: obj.GetLabels()[common.LabelKeyManagedServiceAccountSetNamespace],
+				Name:      obj.GetLabels()[common.LabelKeyManagedServiceAccountSetName],
+			},
+		},
+	}
+}
+
+func (r *ManagedServiceAccountSetReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	msaSet := &authv1beta1.ManagedServiceAccountSet{}
+	if err := r.Get(ctx, req.NamespacedName, msaSet); err != nil {
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if !msaSet.DeletionTimestamp.IsZero() {
+		if err := deleteManagedServiceAccounts(ctx, r, r.HubClient, ownerLabelsOfSet(msaSet), sets.New[string]()); err != nil {
+			return reconcile.Result{}, err
+		}
+		if controllerutil.RemoveFinalizer(msaSet, common.FinalizerManagedServiceAccountSetCleanup) {
+			if err := r.HubClient.Update(ctx, msaSet); err != nil {
+				return reconcile.Result{}, errors.Wrapf(err, "failed to remove finalizer")
+			}
+		}
+		return reconcile.Result{}, nil
+	}
+
+	if controllerutil.AddFinalizer(msaSet, common.FinalizerManagedServiceAccountSetCleanup) {
+		if err := r.HubClient.Update(ctx, msaSet); err != nil {
+			return reconcile.Result{}, errors.Wrapf(err, "failed to add finalizer")
+		}
+	}
+
+	msaSetCopy := msaSet.DeepCopy()
+	msaSetCopy.Status.ObservedGeneration = msaSet.Generation
+
+	clusterNames, unresolvedPlacements, err := r.decidedClusters(ctx, msaSet)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if len(unresolvedPlacements) > 0 {
+		meta.SetStatusCondition(&msaSetCopy.Status.Conditions, metav1.Condition{
+			Type:   authv1beta1.ConditionTypePlacementDecided,
+			Status: metav1.ConditionFalse,
+			Reason: "PlacementNotResolved",
+			Message: fmt.Sprintf("Placements %v are not found or not decided yet, no ManagedServiceAccount is deleted",
+				unresolvedPlacements),
+		})
+	} else {
+		meta.SetStatusCondition(&msaSetCopy.Status.Conditions, metav1.Condition{
+			Type:    authv1beta1.ConditionTypePlacementDecided,
+			Status:  metav1.ConditionTrue,
+			Reason:  "PlacementDecided",
+			Message: fmt.Sprintf("%d clusters are decided", len(clusterNames)),
+		})
+	}
+
+	var errs []error
+	summary := authv1beta1.ManagedServiceAccountSetSummary{Clusters: int32(len(clusterNames))}
+	notReady := []string{}
+	var conflicts []string
+	for _, clusterName := range sets.List(clusterNames) {
+		msa, err := applyManagedServiceAccountTemplate(ctx, r, r.HubClient, clusterName, msaSet.Name,
+			&msaSet.Spec.Template, ownerLabelsOfSet(msaSet))
+		var conflictErr *managedServiceAccountConflictError
+		switch {
+		case errors.As(err, &conflictErr):
+			// the conflict is reported in the status instead of retrying until it is resolved
+			conflicts = append(conflicts, conflictErr.Error())
+		case err != nil:
+			errs = append(errs, err)
+		}
+		if msa != nil {
+			summary.Applied++
+		}
+		if msa != nil && meta.IsStatusConditionTrue(msa.Status.Conditions, authv1beta1.ConditionTypeReady) {
+			summary.Ready++
+		} else if len(notReady) < maxNotReadyClusters {
+			notReady = append(notReady, clusterName)
+		}
+	}
+
+	// the clusters of an unresolved placement are unknown, so none is pruned until it's resolved
+	if len(unresolvedPlacements) == 0 {
+		if err := deleteManagedServiceAccounts(ctx, r, r.HubClient, ownerLabelsOfSet(msaSet), clusterNames); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(conflicts) > 0 {
+		message := fmt.Sprintf("%d ManagedServiceAccounts of the same name are not created by the set: %s",
+			len(conflicts), strings.Join(conflicts[:min(len(conflicts), maxConflicts)], "; "))
+		meta.SetStatusCondition(&msaSetCopy.Status.Conditions, metav1.Condition{
+			Type:    authv1beta1.ConditionTypeConflicted,
+			Status:  metav1.ConditionTrue,
+			Reason:  "ManagedServiceAccountConflict",
+			Message: message,
+		})
+	} else {
+		meta.SetStatusCondition(&msaSetCopy.Status.Conditions, metav1.Condition{
+			Type:    authv1beta1.ConditionTypeConflicted,
+			Status:  metav1.ConditionFalse,
+			Reason:  "NoConflict",
+			Message: "All the ManagedServiceAccounts are created by the set",
+		})
+	}
+
+	msaSetCopy.Status.Summary = summary
+	msaSetCopy.Status.NotReadyClusters = notReady
+	if summary.Ready == summary.Clusters {
+		meta.SetStatusCondition(&msaSetCopy.Status.Conditions, metav1.Condition{
+			Type:    authv1beta1.ConditionTypeReady,
+			Status:  metav1.ConditionTrue,
+			Reason:  "Ready",
+			Message: fmt.Sprintf("The ManagedServiceAccounts on %d clusters are ready", summary.Ready),
+		})
+	} else {
+		meta.SetStatusCondition(&msaSetCopy.Status.Conditions, metav1.Condition{
+			Type:   authv1beta1.ConditionTypeReady,
+			Status: metav1.ConditionFalse,
+			Reason: "NotReady",
+			Message: fmt.Sprintf("The ManagedServiceAccounts on %d of %d clusters are not ready",
+				summary.Clusters-summary.Ready, summary.Clusters),
+		})
+	}
+
+	if !equality.Semantic.DeepEqual(msaSet.Status, msaSetCopy.Status) {
+		if err := r.HubClient.Status().Update(ctx, msaSetCopy); err != nil {
+			return reconcile.Result{}, errors.Wrapf(err, "failed to update status")
+		}
+	}
+	return reconcile.Result{}, utilerrors.NewAggregate(errs)
+}
+
+// decidedClusters returns the names of the ManagedClusters decided by the Placements of the
+// ManagedServiceAccountSet, and the names of the Placements which are not found or have no
+// PlacementDecisions yet.
+func (r *ManagedServiceAccountSetReconciler) decidedClusters(ctx context.Context,
+	msaSet *authv1beta1.ManagedServiceAccountSet) (sets.Set[string], []string, error) {
+	clusterNames := sets.New[string]()
+	unresolved := []string{}
+	for _, ref := range msaSet.Spec.PlacementRefs {
+		placement := &clusterv1beta1.Placement{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: msaSet.Namespace, Name: ref.Name}, placement); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return nil, nil, errors.Wrapf(err, "failed to get placement %s", ref.Name)
+			}
+			unresolved = append(unresolved, ref.Name)
+			continue
+		}
+
+		decisions := &clusterv1beta1.PlacementDecisionList{}
+		if err := r.List(ctx, decisions, client.InNamespace(msaSet.Namespace),
+			client.MatchingLabels{clusterv1beta1.PlacementLabel: ref.Name}); err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to list placement decisions of %s", ref.Name)
+		}
+		if len(decisions.Items) == 0 {
+			unresolved = append(unresolved, ref.Name)
+			continue
+		}
+		for _, decision := range decisions.Items {
+			for _, d := range decision.Status.Decisions {
+				if len(d.ClusterName) > 0 {
+					clusterNames.Insert(d.ClusterName)
+				}
+			}
+		}
+	}
+	sort.Strings(unresolved)
+	return clusterNames, unresolved, nil
+}
+
+// ownerLabelsOfSet returns the labels set on the ManagedServiceAccounts of the ManagedServiceAccountSet.
+func ownerLabelsOfSet(msaSet *authv1beta1.ManagedServiceAccountSet) map[string]string {
+	return map[string]string{
+		common.LabelKeyManagedServiceAccountSetNamespace: msaSet.Namespace,
+		common.LabelKeyManagedServiceAccountSetName:      msaSet.Name,
+	}
+}
@@ -0,0 +1,293 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	clusterv1beta1 "open-cluster-management.io/api/cluster/v1beta1"
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+	"open-cluster-management.io/managed-serviceaccount/pkg/common"
+)
+
+func TestManagedServiceAccountSetReconcile(t *testing.T) {
+	cases := []struct {
+		name            string
+		msaSet          *authv1beta1.ManagedServiceAccountSet
+		objects         []client.Object
+		expectedSummary authv1beta1.ManagedServiceAccountSetSummary
+		validateFunc    func(t *testing.T, hubClient client.Client, msaSet *authv1beta1.ManagedServiceAccountSet)
+	}{
+		{
+			name:   "create managed serviceaccounts for the decided clusters",
+			msaSet: newManagedServiceAccountSet(),
+			objects: []client.Object{
+				newPlacement("placement1"),
+				newPlacementDecision("placement1", "cluster1", "cluster2"),
+			},
+			expectedSummary: authv1beta1.ManagedServiceAccountSetSummary{Clusters: 2, Applied: 2},
+			validateFunc: func(t *testing.T, hubClient client.Client, msaSet *authv1beta1.ManagedServiceAccountSet) {
+				assert.Contains(t, msaSet.Finalizers, common.FinalizerManagedServiceAccountSetCleanup)
+				assert.Equal(t, []string{"cluster1", "cluster2"}, msaSet.Status.NotReadyClusters)
+				assert.True(t, meta.IsStatusConditionTrue(msaSet.Status.Conditions,
+					authv1beta1.ConditionTypePlacementDecided))
+				assert.False(t, meta.IsStatusConditionTrue(msaSet.Status.Conditions,
+					authv1beta1.ConditionTypeConflicted))
+				assert.False(t, meta.IsStatusConditionTrue(msaSet.Status.Conditions, authv1beta1.ConditionTypeReady))
+				for _, cluster := range []string{"cluster1", "cluster2"} {
+					msa := getMSA(t, hubClient, cluster, "deployer")
+					assert.Equal(t, "default", msa.Labels[common.LabelKeyManagedServiceAccountSetNamespace])
+					assert.Equal(t, "deployer", msa.Labels[common.LabelKeyManagedServiceAccountSetName])
+					assert.Equal(t, "platform", msa.Labels["team"])
+					assert.Equal(t, 24*time.Hour, msa.Spec.Rotation.Validity.Duration)
+				}
+			},
+		},
+		{
+			name: "update and delete managed serviceaccounts",
+			msaSet: newManagedServiceAccountSet(func(msaSet *authv1beta1.ManagedServiceAccountSet) {
+				msaSet.Finalizers = []string{common.FinalizerManagedServiceAccountSetCleanup}
+			}),
+			objects: []client.Object{
+				newPlacement("placement1"),
+				newPlacementDecision("placement1", "cluster1", "cluster2"),
+				newSetMSA("cluster1", func(msa *authv1beta1.ManagedServiceAccount) {
+					msa.Annotations = map[string]string{common.AnnotationKeyCredentialRevocation: "drill"}
+					msa.Spec.Rotation.Validity = metav1.Duration{Duration: time.Hour}
+					msa.Spec.RevocationGeneration = 2
+					msa.Status.Conditions = []metav1.Condition{
+						{Type: authv1beta1.ConditionTypeReady, Status: metav1.ConditionTrue, Reason: "Ready"},
+					}
+				}),
+				newSetMSA("cluster3"),
+			},
+			expectedSummary: authv1beta1.ManagedServiceAccountSetSummary{Clusters: 2, Applied: 2, Ready: 1},
+			validateFunc: func(t *testing.T, hubClient client.Client, msaSet *authv1beta1.ManagedServiceAccountSet) {
+				assert.Equal(t, []string{"cluster2"}, msaSet.Status.NotReadyClusters)
+
+				msa := getMSA(t, hubClient, "cluster1", "deployer")
+				assert.Equal(t, 24*time.Hour, msa.Spec.Rotation.Validity.Duration)
+				assert.Equal(t, int64(2), msa.Spec.RevocationGeneration)
+				assert.Equal(t, "drill", msa.Annotations[common.AnnotationKeyCredentialRevocation])
+
+				err := hubClient.Get(context.TODO(), types.NamespacedName{Namespace: "cluster3", Name: "deployer"},
+					&authv1beta1.ManagedServiceAccount{})
+				assert.True(t, apierrors.IsNotFound(err))
+			},
+		},
+		{
+			name:   "leave managed serviceaccount not created by the set",
+			msaSet: newManagedServiceAccountSet(),
+			objects: []client.Object{
+				newPlacement("placement1"),
+				newPlacementDecision("placement1", "cluster1"),
+				newRevocationMSA("cluster1", "deployer"),
+			},
+			expectedSummary: authv1beta1.ManagedServiceAccountSetSummary{Clusters: 1},
+			validateFunc: func(t *testing.T, hubClient client.Client, msaSet *authv1beta1.ManagedServiceAccountSet) {
+				assert.Equal(t, []string{"cluster1"}, msaSet.Status.NotReadyClusters)
+				assert.True(t, meta.IsStatusConditionTrue(msaSet.Status.Conditions, authv1beta1.ConditionTypeConflicted))
+				msa := getMSA(t, hubClient, "cluster1", "deployer")
+				assert.Empty(t, msa.Labels)
+			},
+		},
+		{
+			name:   "report managed serviceaccounts of sets of the same name in other namespaces",
+			msaSet: newManagedServiceAccountSet(),
+			objects: []client.Object{
+				newPlacement("placement1"),
+				newPlacementDecision("placement1", "cluster1", "cluster2"),
+				newSetMSA("cluster1", func(msa *authv1beta1.ManagedServiceAccount) {
+					msa.Labels[common.LabelKeyManagedServiceAccountSetNamespace] = "other"
+				}),
+			},
+			expectedSummary: authv1beta1.ManagedServiceAccountSetSummary{Clusters: 2, Applied: 1},
+			validateFunc: func(t *testing.T, hubClient client.Client, msaSet *authv1beta1.ManagedServiceAccountSet) {
+				cond := meta.FindStatusCondition(msaSet.Status.Conditions, authv1beta1.ConditionTypeConflicted)
+				if assert.NotNil(t, cond) {
+					assert.Equal(t, metav1.ConditionTrue, cond.Status)
+					assert.Equal(t, "1 ManagedServiceAccounts of the same name are not created by the set: "+
+						"managed serviceaccount cluster1/deployer exists and is created by ManagedServiceAccountSet other/deployer",
+						cond.Message)
+				}
+				msa := getMSA(t, hubClient, "cluster1", "deployer")
+				assert.Equal(t, "other", msa.Labels[common.LabelKeyManagedServiceAccountSetNamespace])
+				assert.Equal(t, time.Duration(0), msa.Spec.Rotation.Validity.Duration)
+				getMSA(t, hubClient, "cluster2", "deployer")
+			},
+		},
+		{
+			name:   "placement not decided yet",
+			msaSet: newManagedServiceAccountSet(),
+			objects: []client.Object{
+				newPlacement("placement1"),
+				newSetMSA("cluster1"),
+			},
+			expectedSummary: authv1beta1.ManagedServiceAccountSetSummary{},
+			validateFunc: func(t *testing.T, hubClient client.Client, msaSet *authv1beta1.ManagedServiceAccountSet) {
+				cond := meta.FindStatusCondition(msaSet.Status.Conditions, authv1beta1.ConditionTypePlacementDecided)
+				assert.NotNil(t, cond)
+				assert.Equal(t, metav1.ConditionFalse, cond.Status)
+				getMSA(t, hubClient, "cluster1", "deployer")
+			},
+		},
+		{
+			name:   "placement not found",
+			msaSet: newManagedServiceAccountSet(),
+			objects: []client.Object{
+				newSetMSA("cluster1"),
+			},
+			expectedSummary: authv1beta1.ManagedServiceAccountSetSummary{},
+			validateFunc: func(t *testing.T, hubClient client.Client, msaSet *authv1beta1.ManagedServiceAccountSet) {
+				cond := meta.FindStatusCondition(msaSet.Status.Conditions, authv1beta1.ConditionTypePlacementDecided)
+				assert.NotNil(t, cond)
+				assert.Equal(t, "PlacementNotResolved", cond.Reason)
+				// the managed serviceaccounts are kept until the placement is resolved
+				getMSA(t, hubClient, "cluster1", "deployer")
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			hubClient := newSetTestClient(append(c.objects, c.msaSet), c.msaSet)
+			reconciler := NewManagedServiceAccountSetReconciler(&clientCache{Reader: hubClient}, hubClient)
+			_, err := reconciler.Reconcile(context.TODO(), reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: c.msaSet.Namespace, Name: c.msaSet.Name},
+			})
+			assert.NoError(t, err)
+
+			msaSet := &authv1beta1.ManagedServiceAccountSet{}
+			err = hubClient.Get(context.TODO(), types.NamespacedName{Namespace: c.msaSet.Namespace, Name: c.msaSet.Name}, msaSet)
+			assert.NoError(t, err)
+			assert.Equal(t, c.expectedSummary, msaSet.Status.Summary)
+			if c.validateFunc != nil {
+				c.validateFunc(t, hubClient, msaSet)
+			}
+		})
+	}
+}
+
+func TestManagedServiceAccountSetDeletion(t *testing.T) {
+	msaSet := newManagedServiceAccountSet(func(msaSet *authv1beta1.ManagedServiceAccountSet) {
+		msaSet.Finalizers = []string{common.FinalizerManagedServiceAccountSetCleanup}
+		msaSet.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	})
+	hubClient := newSetTestClient([]client.Object{
+		msaSet,
+		newPlacement("placement1"),
+		newPlacementDecision("placement1", "cluster1"),
+		newSetMSA("cluster1"),
+	}, msaSet)
+
+	reconciler := NewManagedServiceAccountSetReconciler(&clientCache{Reader: hubClient}, hubClient)
+	_, err := reconciler.Reconcile(context.TODO(), reconcile.Request{
+		NamespacedName: types.NamespacedName{Namespace: msaSet.Namespace, Name: msaSet.Name},
+	})
+	assert.NoError(t, err)
+
+	err = hubClient.Get(context.TODO(), types.NamespacedName{Namespace: "cluster1", Name: "deployer"},
+		&authv1beta1.ManagedServiceAccount{})
+	assert.True(t, apierrors.IsNotFound(err))
+	err = hubClient.Get(context.TODO(), types.NamespacedName{Namespace: msaSet.Namespace, Name: msaSet.Name},
+		&authv1beta1.ManagedServiceAccountSet{})
+	assert.True(t, apierrors.IsNotFound(err))
+}
+
+func TestMapPlacementDecisionToManagedServiceAccountSets(t *testing.T) {
+	hubClient := newSetTestClient([]client.Object{
+		newManagedServiceAccountSet(),
+		newManagedServiceAccountSet(func(msaSet *authv1beta1.ManagedServiceAccountSet) {
+			msaSet.Name = "viewer"
+			msaSet.Spec.PlacementRefs = []authv1beta1.LocalPlacementReference{{Name: "placement2"}}
+		}),
+	})
+	reconciler := NewManagedServiceAccountSetReconciler(&clientCache{Reader: hubClient}, hubClient)
+
+	requests := reconciler.mapPlacementDecisionToManagedServiceAccountSets(context.TODO(),
+		newPlacementDecision("placement1", "cluster1"))
+	assert.Equal(t, []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Namespace: "default", Name: "deployer"}},
+	}, requests)
+}
+
+func newSetTestClient(objects []client.Object, statusObjects ...client.Object) client.Client {
+	testscheme := runtime.NewScheme()
+	authv1beta1.AddToScheme(testscheme)
+	clusterv1beta1.Install(testscheme)
+	return fake.NewClientBuilder().WithScheme(testscheme).WithObjects(objects...).
+		WithStatusSubresource(statusObjects...).Build()
+}
+
+func newManagedServiceAccountSet(modifiers ...func(*authv1beta1.ManagedServiceAccountSet)) *authv1beta1.ManagedServiceAccountSet {
+	msaSet := &authv1beta1.ManagedServiceAccountSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "deployer",
+		},
+		Spec: authv1beta1.ManagedServiceAccountSetSpec{
+			PlacementRefs: []authv1beta1.LocalPlacementReference{{Name: "placement1"}},
+			Template: authv1beta1.ManagedServiceAccountTemplate{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{"team": "platform"},
+				},
+				Spec: authv1beta1.ManagedServiceAccountSpec{
+					Rotation: authv1beta1.ManagedServiceAccountRotation{
+						Enabled:  true,
+						Validity: metav1.Duration{Duration: 24 * time.Hour},
+					},
+				},
+			},
+		},
+	}
+	for _, modifier := range modifiers {
+		modifier(msaSet)
+	}
+	return msaSet
+}
+
+func newPlacement(name string) *clusterv1beta1.Placement {
+	return &clusterv1beta1.Placement{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      name,
+		},
+	}
+}
+
+func newPlacementDecision(placementName string, clusterNames ...string) *clusterv1beta1.PlacementDecision {
+	decision := &clusterv1beta1.PlacementDecision{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      placementName + "-decision-1",
+			Labels:    map[string]string{clusterv1beta1.PlacementLabel: placementName},
+		},
+	}
+	for _, clusterName := range clusterNames {
+		decision.Status.Decisions = append(decision.Status.Decisions, clusterv1beta1.ClusterDecision{
+			ClusterName: clusterName,
+		})
+	}
+	return decision
+}
+
+func newSetMSA(namespace string, modifiers ...func(*authv1beta1.ManagedServiceAccount)) *authv1beta1.ManagedServiceAccount {
+	return newRevocationMSA(namespace, "deployer", append([]func(*authv1beta1.ManagedServiceAccount){
+		func(msa *authv1beta1.ManagedServiceAccount) {
+			msa.Labels = map[string]string{
+				common.LabelKeyManagedServiceAccountSetNamespace: "default",
+				common.LabelKeyManagedServiceAccountSetName:      "deployer",
+			}
+		},
+	}, modifiers...)...)
+}
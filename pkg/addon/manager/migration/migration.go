@@ -0,0 +1,58 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+	"open-cluster-management.io/managed-serviceaccount/pkg/common"
+)
+
+// MigrateStorageVersion rewrites all the ManagedServiceAccounts in the storage version of the CRD,
+// and then drops the other versions from the stored versions in the status of the CRD, so that the
+// versions no longer stored can be removed from the CRD.
+func MigrateStorageVersion(ctx context.Context, c client.Client) error {
+	crd := &apiextensionsv1.CustomResourceDefinition{}
+	if err := c.Get(ctx, types.NamespacedName{Name: common.ManagedServiceAccountCRDName}, crd); err != nil {
+		return errors.Wrapf(err, "failed to get the ManagedServiceAccount CRD")
+	}
+	storageVersion := ""
+	for _, version := range crd.Spec.Versions {
+		if version.Storage {
+			storageVersion = version.Name
+		}
+	}
+	if storageVersion != authv1beta1.GroupVersion.Version {
+		return fmt.Errorf("unexpected storage version %q of the ManagedServiceAccount CRD", storageVersion)
+	}
+
+	msas := &authv1beta1.ManagedServiceAccountList{}
+	if err := c.List(ctx, msas); err != nil {
+		return errors.Wrapf(err, "failed to list managed serviceaccounts")
+	}
+	for i := range msas.Items {
+		msa := &msas.Items[i]
+		// an update without changes is enough for the apiserver to write the object in the storage
+		// version, a conflict means the object has been written by others in the meantime.
+		if err := c.Update(ctx, msa); err != nil && !apierrors.IsNotFound(err) && !apierrors.IsConflict(err) {
+			return errors.Wrapf(err, "failed to migrate managed serviceaccount %s/%s", msa.Namespace, msa.Name)
+		}
+	}
+	klog.Infof("Migrated %d managed serviceaccounts to %s", len(msas.Items), storageVersion)
+
+	if len(crd.Status.StoredVersions) == 1 && crd.Status.StoredVersions[0] == storageVersion {
+		return nil
+	}
+	crd.Status.StoredVersions = []string{storageVersion}
+	if err := c.Status().Update(ctx, crd); err != nil {
+		return errors.Wrapf(err, "failed to update the stored versions of the ManagedServiceAccount CRD")
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package migration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+	"open-cluster-management.io/managed-serviceaccount/pkg/common"
+)
+
+func newCRD(storageVersion string, storedVersions ...string) *apiextensionsv1.CustomResourceDefinition {
+	return &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: common.ManagedServiceAccountCRDName},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{Name: "v1alpha1", Served: true, Storage: storageVersion == "v1alpha1"},
+				{Name: "v1beta1", Served: true, Storage: storageVersion == "v1beta1"},
+			},
+		},
+		Status: apiextensionsv1.CustomResourceDefinitionStatus{
+			StoredVersions: storedVersions,
+		},
+	}
+}
+
+func newMSA(namespace, name string) *authv1beta1.ManagedServiceAccount {
+	return &authv1beta1.ManagedServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+	}
+}
+
+func TestMigrateStorageVersion(t *testing.T) {
+	cases := []struct {
+		name                   string
+		crd                    *apiextensionsv1.CustomResourceDefinition
+		msas                   []client.Object
+		expectedError          string
+		expectedStoredVersions []string
+	}{
+		{
+			name:          "crd not found",
+			expectedError: `failed to get the ManagedServiceAccount CRD: customresourcedefinitions.apiextensions.k8s.io "managedserviceaccounts.authentication.open-cluster-management.io" not found`,
+		},
+		{
+			name:          "unexpected storage version",
+			crd:           newCRD("v1alpha1", "v1alpha1"),
+			expectedError: `unexpected storage version "v1alpha1" of the ManagedServiceAccount CRD`,
+		},
+		{
+			name: "migrate stored versions",
+			crd:  newCRD("v1beta1", "v1alpha1", "v1beta1"),
+			msas: []client.Object{
+				newMSA("cluster1", "msa1"),
+				newMSA("cluster2", "msa1"),
+			},
+			expectedStoredVersions: []string{"v1beta1"},
+		},
+		{
+			name:                   "already migrated",
+			crd:                    newCRD("v1beta1", "v1beta1"),
+			expectedStoredVersions: []string{"v1beta1"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			assert.NoError(t, apiextensionsv1.AddToScheme(scheme))
+			assert.NoError(t, authv1beta1.AddToScheme(scheme))
+			objs := c.msas
+			if c.crd != nil {
+				objs = append(objs, c.crd)
+			}
+			hubClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(objs...).
+				WithStatusSubresource(&apiextensionsv1.CustomResourceDefinition{}).
+				Build()
+
+			err := MigrateStorageVersion(context.TODO(), hubClient)
+			if len(c.expectedError) > 0 {
+				assert.EqualError(t, err, c.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+
+			crd := &apiextensionsv1.CustomResourceDefinition{}
+			assert.NoError(t, hubClient.Get(context.TODO(), types.NamespacedName{Name: common.ManagedServiceAccountCRDName}, crd))
+			assert.Equal(t, c.expectedStoredVersions, crd.Status.StoredVersions)
+
+			for _, obj := range c.msas {
+				msa := &authv1beta1.ManagedServiceAccount{}
+				assert.NoError(t, hubClient.Get(context.TODO(), client.ObjectKeyFromObject(obj), msa))
+				// the no-op update bumps the resource version
+				assert.Equal(t, "1000", msa.ResourceVersion)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+	"open-cluster-management.io/managed-serviceaccount/pkg/util"
+)
+
+const (
+	// MinTokenValidity is the shortest validity accepted by the TokenRequest API.
+	MinTokenValidity = 10 * time.Minute
+	// MaxTokenValidity is the longest validity accepted by the TokenRequest API.
+	MaxTokenValidity = (1 << 32) * time.Second
+)
+
+// defaulter fills in the fields of the ManagedServiceAccount left empty, in the same way as the
+// defaults in the CRD schema, so that objects converted from v1alpha1 are defaulted consistently.
+type defaulter struct{}
+
+var _ admission.Defaulter[*authv1beta1.ManagedServiceAccount] = &defaulter{}
+
+func (d *defaulter) Default(_ context.Context, msa *authv1beta1.ManagedServiceAccount) error {
+	if sa := msa.Spec.ServiceAccount; sa != nil && len(sa.Mode) == 0 {
+		sa.Mode = authv1beta1.ServiceAccountModeCreate
+	}
+	if projection := msa.Spec.Projection; projection != nil {
+		if len(projection.Type) == 0 {
+			projection.Type = authv1beta1.ProjectionTypeSecret
+		}
+		if projection.Secret != nil && len(projection.Secret.Format) == 0 {
+			projection.Secret.Format = authv1beta1.SecretFormatToken
+		}
+	}
+	return nil
+}
+
+// validator rejects the ManagedServiceAccounts which the agent would fail to issue tokens for.
+type validator struct {
+	ephemeralIdentityEnabled bool
+}
+
+var _ admission.Validator[*authv1beta1.ManagedServiceAccount] = &validator{}
+
+func (v *validator) ValidateCreate(_ context.Context, msa *authv1beta1.ManagedServiceAccount) (admission.Warnings, error) {
+	return warnings(msa), v.validate(msa, nil)
+}
+
+func (v *validator) ValidateUpdate(_ context.Context,
+	oldMSA, newMSA *authv1beta1.ManagedServiceAccount) (admission.Warnings, error) {
+	// do not block the removal of finalizers or the changes of the metadata on the existing objects
+	if equality.Semantic.DeepEqual(oldMSA.Spec, newMSA.Spec) {
+		return nil, nil
+	}
+	return warnings(newMSA), v.validate(newMSA, oldMSA)
+}
+
+func (v *validator) ValidateDelete(_ context.Context, _ *authv1beta1.ManagedServiceAccount) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *validator) validate(msa, oldMSA *authv1beta1.ManagedServiceAccount) error {
+	errs := field.ErrorList{}
+
+	// the objects created on the managed cluster are labeled with a hashed name if it is longer than a
+	// label value allows, but the certificate signing requests are named after the namespace and the name
+	if msa.Spec.CredentialType == authv1beta1.CredentialTypeClientCertificate {
+		maxLength := validation.DNS1123SubdomainMaxLength - len(msa.Namespace) - len("--xxxxx")
+		if len(msa.Name) > maxLength {
+			errs = append(errs, field.TooLong(field.NewPath("metadata", "name"), msa.Name, maxLength))
+		}
+	}
+
+	specPath := field.NewPath("spec")
+	validityPath := specPath.Child("rotation", "validity")
+	validity := msa.Spec.Rotation.Validity.Duration
+	if validity < MinTokenValidity {
+		errs = append(errs, field.Invalid(validityPath, validity.String(),
+			fmt.Sprintf("must be at least %s", MinTokenValidity)))
+	} else if validity > MaxTokenValidity {
+		errs = append(errs, field.Invalid(validityPath, validity.String(),
+			fmt.Sprintf("must be at most %s", MaxTokenValidity)))
+	}
+
+	rotationPath := specPath.Child("rotation")
+	if refreshBefore := msa.Spec.Rotation.RefreshBefore; len(refreshBefore) > 0 {
+		if _, err := util.ParseRefreshBefore(refreshBefore); err != nil {
+			errs = append(errs, field.Invalid(rotationPath.Child("refreshBefore"), refreshBefore, err.Error()))
+		}
+	}
+	if window := msa.Spec.Rotation.Window; window != nil {
+		if _, err := util.ParseSchedule(window.Schedule); err != nil {
+			errs = append(errs, field.Invalid(rotationPath.Child("window", "schedule"), window.Schedule, err.Error()))
+		}
+		if window.Duration.Duration <= 0 {
+			errs = append(errs, field.Invalid(rotationPath.Child("window", "duration"),
+				window.Duration.Duration.String(), "must be positive"))
+		}
+	}
+
+	if gracePeriod := msa.Spec.Rotation.PreviousTokenGracePeriod; gracePeriod != nil && gracePeriod.Duration < 0 {
+		errs = append(errs, field.Invalid(rotationPath.Child("previousTokenGracePeriod"),
+			gracePeriod.Duration.String(), "must not be negative"))
+	}
+
+	saPath := specPath.Child("serviceAccount")
+	saName := msa.Name
+	if sa := msa.Spec.ServiceAccount; sa != nil {
+		if len(sa.Name) > 0 {
+			saName = sa.Name
+		}
+		if len(sa.Namespace) > 0 {
+			for _, msg := range validation.IsDNS1123Label(sa.Namespace) {
+				errs = append(errs, field.Invalid(saPath.Child("namespace"), sa.Namespace, msg))
+			}
+		}
+	}
+	for _, msg := range validation.IsDNS1123Subdomain(saName) {
+		errs = append(errs, field.Invalid(saPath.Child("name"), saName,
+			"invalid name of the service account on the managed cluster: "+msg))
+	}
+
+	ttl := msa.Spec.TTLSecondsAfterCreation
+	if ttl != nil && !v.ephemeralIdentityEnabled &&
+		(oldMSA == nil || !equality.Semantic.DeepEqual(ttl, oldMSA.Spec.TTLSecondsAfterCreation)) {
+		errs = append(errs, field.Forbidden(specPath.Child("ttlSecondsAfterCreation"),
+			"requires the EphemeralIdentity feature gate to be enabled on the manager"))
+	}
+
+	errs = append(errs, validatePermissions(msa.Spec.Permissions, specPath.Child("permissions"))...)
+
+	// the revocation already carried out on the managed cluster cannot be undone
+	if oldMSA != nil && msa.Spec.RevocationGeneration < oldMSA.Spec.RevocationGeneration {
+		errs = append(errs, field.Invalid(specPath.Child("revocationGeneration"), msa.Spec.RevocationGeneration,
+			fmt.Sprintf("must not be decreased from %d", oldMSA.Spec.RevocationGeneration)))
+	}
+	var oldRevocationGeneration int64
+	if oldMSA != nil {
+		oldRevocationGeneration = oldMSA.Spec.RevocationGeneration
+	}
+	if msa.Spec.RevocationGeneration > oldRevocationGeneration {
+		switch {
+		case msa.Spec.ServiceAccount != nil && msa.Spec.ServiceAccount.Mode == authv1beta1.ServiceAccountModeAdopt:
+			errs = append(errs, field.Forbidden(specPath.Child("revocationGeneration"),
+				"the tokens of an adopted service account cannot be revoked"))
+		case msa.Spec.CredentialType == authv1beta1.CredentialTypeClientCertificate:
+			errs = append(errs, field.Forbidden(specPath.Child("revocationGeneration"),
+				"client certificates cannot be revoked"))
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(authv1beta1.GroupVersion.WithKind("ManagedServiceAccount").GroupKind(), msa.Name, errs)
+}
+
+// validatePermissions rejects the permissions which the agent fails to build the RBAC objects for. The
+// bindings are named after the roles and the role refs, and must be unique in their namespaces.
+func validatePermissions(permissions *authv1beta1.ManagedServiceAccountPermissions, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	if permissions == nil {
+		return errs
+	}
+
+	bindings := map[string]bool{}
+	addBinding := func(namespace, bindingName, name string, fieldPath *field.Path) {
+		key := namespace + "/" + bindingName
+		if bindings[key] {
+			errs = append(errs, field.Duplicate(fieldPath, name))
+		}
+		bindings[key] = true
+	}
+
+	for i, role := range permissions.Roles {
+		rolePath := path.Child("roles").Index(i)
+		if len(role.Namespace) == 0 {
+			errs = append(errs, field.Required(rolePath.Child("namespace"), "the namespace of the role is required"))
+		}
+		addBinding(role.Namespace, role.Name, role.Name, rolePath.Child("name"))
+	}
+	for i, cr := range permissions.ClusterRoles {
+		addBinding("", cr.Name, cr.Name, path.Child("clusterRoles").Index(i).Child("name"))
+	}
+	for i, ref := range permissions.RoleRefs {
+		refPath := path.Child("roleRefs").Index(i)
+		switch ref.Kind {
+		case "Role":
+			if len(ref.Namespace) == 0 {
+				errs = append(errs, field.Required(refPath.Child("namespace"),
+					"the namespace of the referenced role is required"))
+			}
+		case "ClusterRole":
+		default:
+			errs = append(errs, field.NotSupported(refPath.Child("kind"), ref.Kind, []string{"Role", "ClusterRole"}))
+		}
+		addBinding(ref.Namespace, strings.ToLower(ref.Kind)+":"+ref.Name, ref.Name, refPath.Child("name"))
+	}
+	return errs
+}
+
+// warnings returns the warnings on the deprecated fields in use.
+func warnings(msa *authv1beta1.ManagedServiceAccount) admission.Warnings {
+	if !msa.Spec.Rotation.Enabled {
+		return admission.Warnings{
+			"spec.rotation.enabled is deprecated and ignored, the token is always rotated before it expires",
+		}
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+package webhook
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+)
+
+func newMSA(name string, validity time.Duration) *authv1beta1.ManagedServiceAccount {
+	return &authv1beta1.ManagedServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "cluster1",
+			Name:      name,
+		},
+		Spec: authv1beta1.ManagedServiceAccountSpec{
+			Rotation: authv1beta1.ManagedServiceAccountRotation{
+				Enabled:  true,
+				Validity: metav1.Duration{Duration: validity},
+			},
+		},
+	}
+}
+
+func TestDefault(t *testing.T) {
+	msa := newMSA("msa1", time.Hour)
+	msa.Spec.ServiceAccount = &authv1beta1.SpokeServiceAccount{Name: "sa1"}
+	msa.Spec.Projection = &authv1beta1.ManagedServiceAccountProjection{
+		Secret: &authv1beta1.SecretProjection{Name: "secret1"},
+	}
+
+	assert.NoError(t, (&defaulter{}).Default(context.TODO(), msa))
+	assert.Equal(t, authv1beta1.ServiceAccountModeCreate, msa.Spec.ServiceAccount.Mode)
+	assert.Equal(t, authv1beta1.ProjectionTypeSecret, msa.Spec.Projection.Type)
+	assert.Equal(t, authv1beta1.SecretFormatToken, msa.Spec.Projection.Secret.Format)
+
+	// the fields set by the user are kept
+	msa.Spec.ServiceAccount.Mode = authv1beta1.ServiceAccountModeAdopt
+	msa.Spec.Projection.Secret.Format = authv1beta1.SecretFormatKubeconfig
+	assert.NoError(t, (&defaulter{}).Default(context.TODO(), msa))
+	assert.Equal(t, authv1beta1.ServiceAccountModeAdopt, msa.Spec.ServiceAccount.Mode)
+	assert.Equal(t, authv1beta1.SecretFormatKubeconfig, msa.Spec.Projection.Secret.Format)
+}
+
+func TestValidateCreate(t *testing.T) {
+	cases := []struct {
+		name                     string
+		msa                      *authv1beta1.ManagedServiceAccount
+		ephemeralIdentityEnabled bool
+		expectedError            string
+		expectedWarnings         int
+	}{
+		{
+			name: "valid",
+			msa:  newMSA("msa1", 8640*time.Hour),
+		},
+		{
+			name:          "zero validity",
+			msa:           newMSA("msa1", 0),
+			expectedError: `ManagedServiceAccount.authentication.open-cluster-management.io "msa1" is invalid: spec.rotation.validity: Invalid value: "0s": must be at least 10m0s`,
+		},
+		{
+			name:          "huge validity",
+			msa:           newMSA("msa1", 2000000*time.Hour),
+			expectedError: `ManagedServiceAccount.authentication.open-cluster-management.io "msa1" is invalid: spec.rotation.validity: Invalid value: "2000000h0m0s": must be at most 1193046h28m16s`,
+		},
+		{
+			name: "long name",
+			msa:  newMSA(strings.Repeat("a", 100), time.Hour),
+		},
+		{
+			name: "name too long for a certificate signing request",
+			msa: func() *authv1beta1.ManagedServiceAccount {
+				msa := newMSA(strings.Repeat("a", 240), time.Hour)
+				msa.Spec.CredentialType = authv1beta1.CredentialTypeClientCertificate
+				return msa
+			}(),
+			expectedError: "metadata.name: Too long: may not be more than 238 bytes",
+		},
+		{
+			name: "invalid service account name",
+			msa: func() *authv1beta1.ManagedServiceAccount {
+				msa := newMSA("msa1", time.Hour)
+				msa.Spec.ServiceAccount = &authv1beta1.SpokeServiceAccount{Namespace: "ns1", Name: "SA_1"}
+				return msa
+			}(),
+			expectedError: "spec.serviceAccount.name: Invalid value: \"SA_1\": invalid name of the service account on the managed cluster",
+		},
+		{
+			name: "ttl without ephemeral identity",
+			msa: func() *authv1beta1.ManagedServiceAccount {
+				msa := newMSA("msa1", time.Hour)
+				msa.Spec.TTLSecondsAfterCreation = ptr.To[int32](3600)
+				return msa
+			}(),
+			expectedError: `ManagedServiceAccount.authentication.open-cluster-management.io "msa1" is invalid: spec.ttlSecondsAfterCreation: Forbidden: requires the EphemeralIdentity feature gate to be enabled on the manager`,
+		},
+		{
+			name: "ttl with ephemeral identity",
+			msa: func() *authv1beta1.ManagedServiceAccount {
+				msa := newMSA("msa1", time.Hour)
+				msa.Spec.TTLSecondsAfterCreation = ptr.To[int32](3600)
+				return msa
+			}(),
+			ephemeralIdentityEnabled: true,
+		},
+		{
+			name: "invalid rotation window",
+			msa: func() *authv1beta1.ManagedServiceAccount {
+				msa := newMSA("msa1", time.Hour)
+				msa.Spec.Rotation.RefreshBefore = "0%"
+				msa.Spec.Rotation.Window = &authv1beta1.RotationWindow{Schedule: "0 2 * *"}
+				return msa
+			}(),
+			expectedError: `[spec.rotation.refreshBefore: Invalid value: "0%": invalid percentage "0%", must be in [1%, 99%], ` +
+				`spec.rotation.window.schedule: Invalid value: "0 2 * *": expected 5 fields in schedule "0 2 * *", found 4, ` +
+				`spec.rotation.window.duration: Invalid value: "0s": must be positive]`,
+		},
+		{
+			name: "valid permissions",
+			msa: func() *authv1beta1.ManagedServiceAccount {
+				msa := newMSA("msa1", time.Hour)
+				msa.Spec.Permissions = &authv1beta1.ManagedServiceAccountPermissions{
+					Roles:        []authv1beta1.ManagedRole{{Name: "reader", Namespace: "ns1"}, {Name: "reader", Namespace: "ns2"}},
+					ClusterRoles: []authv1beta1.ManagedClusterRole{{Name: "reader"}},
+					RoleRefs: []authv1beta1.ManagedRoleRef{
+						{Kind: "ClusterRole", Name: "view"},
+						{Kind: "ClusterRole", Name: "view", Namespace: "ns1"},
+						{Kind: "Role", Name: "view", Namespace: "ns1"},
+					},
+				}
+				return msa
+			}(),
+		},
+		{
+			name: "invalid permissions",
+			msa: func() *authv1beta1.ManagedServiceAccount {
+				msa := newMSA("msa1", time.Hour)
+				msa.Spec.Permissions = &authv1beta1.ManagedServiceAccountPermissions{
+					Roles:        []authv1beta1.ManagedRole{{Name: "reader", Namespace: "ns1"}, {Name: "reader", Namespace: "ns1"}, {Name: "writer"}},
+					ClusterRoles: []authv1beta1.ManagedClusterRole{{Name: "reader"}, {Name: "reader"}},
+					RoleRefs: []authv1beta1.ManagedRoleRef{
+						{Kind: "Role", Name: "admin"},
+						{Kind: "ClusterRole", Name: "view"},
+						{Kind: "ClusterRole", Name: "view"},
+						{Kind: "Group", Name: "admins"},
+					},
+				}
+				return msa
+			}(),
+			expectedError: `[spec.permissions.roles[1].name: Duplicate value: "reader", ` +
+				`spec.permissions.roles[2].namespace: Required value: the namespace of the role is required, ` +
+				`spec.permissions.clusterRoles[1].name: Duplicate value: "reader", ` +
+				`spec.permissions.roleRefs[0].namespace: Required value: the namespace of the referenced role is required, ` +
+				`spec.permissions.roleRefs[2].name: Duplicate value: "view", ` +
+				`spec.permissions.roleRefs[3].kind: Unsupported value: "Group": supported values: "Role", "ClusterRole"]`,
+		},
+		{
+			name: "rotation disabled",
+			msa: func() *authv1beta1.ManagedServiceAccount {
+				msa := newMSA("msa1", time.Hour)
+				msa.Spec.Rotation.Enabled = false
+				return msa
+			}(),
+			expectedWarnings: 1,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			v := &validator{ephemeralIdentityEnabled: c.ephemeralIdentityEnabled}
+			warnings, err := v.ValidateCreate(context.TODO(), c.msa)
+			assert.Len(t, warnings, c.expectedWarnings)
+			if len(c.expectedError) > 0 {
+				assert.ErrorContains(t, err, c.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestValidateUpdate(t *testing.T) {
+	v := &validator{}
+
+	// metadata changes on an existing invalid object are allowed
+	oldMSA := newMSA("msa1", 0)
+	newMSA := oldMSA.DeepCopy()
+	newMSA.Finalizers = nil
+	_, err := v.ValidateUpdate(context.TODO(), oldMSA, newMSA)
+	assert.NoError(t, err)
+
+	// the ttl set before the feature gate is disabled is kept
+	oldMSA = newMSA.DeepCopy()
+	oldMSA.Spec.Rotation.Validity = metav1.Duration{Duration: time.Hour}
+	oldMSA.Spec.TTLSecondsAfterCreation = ptr.To[int32](3600)
+	newMSA = oldMSA.DeepCopy()
+	newMSA.Spec.Rotation.Validity = metav1.Duration{Duration: 2 * time.Hour}
+	_, err = v.ValidateUpdate(context.TODO(), oldMSA, newMSA)
+	assert.NoError(t, err)
+
+	// changing the ttl is rejected
+	newMSA.Spec.TTLSecondsAfterCreation = ptr.To[int32](7200)
+	_, err = v.ValidateUpdate(context.TODO(), oldMSA, newMSA)
+	assert.ErrorContains(t, err, "spec.ttlSecondsAfterCreation: Forbidden")
+
+	// decreasing the revocation generation is rejected
+	oldMSA.Spec.RevocationGeneration = 2
+	newMSA = oldMSA.DeepCopy()
+	newMSA.Spec.RevocationGeneration = 1
+	_, err = v.ValidateUpdate(context.TODO(), oldMSA, newMSA)
+	assert.ErrorContains(t, err, "spec.revocationGeneration: Invalid value: 1: must not be decreased from 2")
+
+	// revoking the tokens of an adopted service account is rejected
+	oldMSA.Spec.TTLSecondsAfterCreation = nil
+	oldMSA.Spec.ServiceAccount = &authv1beta1.SpokeServiceAccount{
+		Name:      "app",
+		Namespace: "default",
+		Mode:      authv1beta1.ServiceAccountModeAdopt,
+	}
+	newMSA = oldMSA.DeepCopy()
+	newMSA.Spec.RevocationGeneration = 3
+	_, err = v.ValidateUpdate(context.TODO(), oldMSA, newMSA)
+	assert.ErrorContains(t, err,
+		"spec.revocationGeneration: Forbidden: the tokens of an adopted service account cannot be revoked")
+
+	// revoking client certificates is rejected
+	oldMSA.Spec.ServiceAccount = nil
+	oldMSA.Spec.CredentialType = authv1beta1.CredentialTypeClientCertificate
+	newMSA = oldMSA.DeepCopy()
+	newMSA.Spec.RevocationGeneration = 3
+	_, err = v.ValidateUpdate(context.TODO(), oldMSA, newMSA)
+	assert.ErrorContains(t, err, "spec.revocationGeneration: Forbidden: client certificates cannot be revoked")
+
+	// the spec of an existing object with a name too long for a label can be updated
+	oldMSA.Name = strings.Repeat("a", 100)
+	oldMSA.Spec.CredentialType = ""
+	newMSA = oldMSA.DeepCopy()
+	newMSA.Spec.RevocationGeneration = 3
+	_, err = v.ValidateUpdate(context.TODO(), oldMSA, newMSA)
+	assert.NoError(t, err)
+}
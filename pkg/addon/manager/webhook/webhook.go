@@ -0,0 +1,81 @@
+package webhook
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+	"open-cluster-management.io/managed-serviceaccount/pkg/common"
+	"open-cluster-management.io/managed-serviceaccount/pkg/features"
+)
+
+const (
+	// ConversionPath is the path the conversion webhook is served at.
+	ConversionPath = "/convert"
+	// CACertName is the name of the CA bundle file in the webhook certificate directory.
+	CACertName = "ca.crt"
+)
+
+// SetupWithManager registers the webhooks of the ManagedServiceAccount to the webhook server of the
+// manager. The v1beta1 ManagedServiceAccount is the hub of the conversion, so all the served versions
+// must be registered in the scheme of the manager.
+func SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr, &authv1beta1.ManagedServiceAccount{}).
+		WithDefaulter(&defaulter{}).
+		WithValidator(&validator{
+			ephemeralIdentityEnabled: features.FeatureGates.Enabled(features.EphemeralIdentity),
+		}).
+		Complete()
+}
+
+// LoadCABundle reads the CA bundle signing the serving certificate of the webhook.
+func LoadCABundle(certDir string) ([]byte, error) {
+	caBundle, err := os.ReadFile(filepath.Join(certDir, CACertName))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read the webhook CA bundle")
+	}
+	return caBundle, nil
+}
+
+// EnsureCRDConversion points the conversion of the ManagedServiceAccount CRD to the webhook served
+// behind the given service.
+func EnsureCRDConversion(ctx context.Context, c client.Client, service types.NamespacedName, caBundle []byte) error {
+	crd := &apiextensionsv1.CustomResourceDefinition{}
+	if err := c.Get(ctx, types.NamespacedName{Name: common.ManagedServiceAccountCRDName}, crd); err != nil {
+		return errors.Wrapf(err, "failed to get the ManagedServiceAccount CRD")
+	}
+
+	path := ConversionPath
+	conversion := &apiextensionsv1.CustomResourceConversion{
+		Strategy: apiextensionsv1.WebhookConverter,
+		Webhook: &apiextensionsv1.WebhookConversion{
+			ClientConfig: &apiextensionsv1.WebhookClientConfig{
+				Service: &apiextensionsv1.ServiceReference{
+					Namespace: service.Namespace,
+					Name:      service.Name,
+					Path:      &path,
+				},
+				CABundle: caBundle,
+			},
+			ConversionReviewVersions: []string{"v1"},
+		},
+	}
+	if equality.Semantic.DeepEqual(crd.Spec.Conversion, conversion) {
+		return nil
+	}
+
+	crdCopy := crd.DeepCopy()
+	crdCopy.Spec.Conversion = conversion
+	if err := c.Patch(ctx, crdCopy, client.MergeFrom(crd)); err != nil {
+		return errors.Wrapf(err, "failed to set the conversion webhook of the ManagedServiceAccount CRD")
+	}
+	return nil
+}
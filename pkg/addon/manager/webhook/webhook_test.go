@@ -0,0 +1,120 @@
+package webhook
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/conversion"
+
+	authv1alpha1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1alpha1"
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+	"open-cluster-management.io/managed-serviceaccount/pkg/common"
+)
+
+func TestIsConvertible(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, authv1alpha1.AddToScheme(scheme))
+	assert.NoError(t, authv1beta1.AddToScheme(scheme))
+
+	ok, err := conversion.IsConvertible(scheme, &authv1beta1.ManagedServiceAccount{})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestLoadCABundle(t *testing.T) {
+	certDir := t.TempDir()
+	_, err := LoadCABundle(certDir)
+	assert.Error(t, err)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(certDir, CACertName), []byte("ca"), 0600))
+	caBundle, err := LoadCABundle(certDir)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("ca"), caBundle)
+}
+
+func TestEnsureCRDConversion(t *testing.T) {
+	service := types.NamespacedName{Namespace: "open-cluster-management-addon", Name: "managed-serviceaccount-webhook"}
+	cases := []struct {
+		name          string
+		crd           *apiextensionsv1.CustomResourceDefinition
+		caBundle      []byte
+		expectedError string
+	}{
+		{
+			name:          "crd not found",
+			caBundle:      []byte("ca"),
+			expectedError: `failed to get the ManagedServiceAccount CRD: customresourcedefinitions.apiextensions.k8s.io "managedserviceaccounts.authentication.open-cluster-management.io" not found`,
+		},
+		{
+			name: "set the conversion webhook",
+			crd: &apiextensionsv1.CustomResourceDefinition{
+				ObjectMeta: metav1.ObjectMeta{Name: common.ManagedServiceAccountCRDName},
+				Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+					Conversion: &apiextensionsv1.CustomResourceConversion{
+						Strategy: apiextensionsv1.NoneConverter,
+					},
+				},
+			},
+			caBundle: []byte("ca"),
+		},
+		{
+			name: "rotate the ca bundle",
+			crd: &apiextensionsv1.CustomResourceDefinition{
+				ObjectMeta: metav1.ObjectMeta{Name: common.ManagedServiceAccountCRDName},
+				Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+					Conversion: &apiextensionsv1.CustomResourceConversion{
+						Strategy: apiextensionsv1.WebhookConverter,
+						Webhook: &apiextensionsv1.WebhookConversion{
+							ClientConfig: &apiextensionsv1.WebhookClientConfig{
+								CABundle: []byte("old"),
+							},
+						},
+					},
+				},
+			},
+			caBundle: []byte("new"),
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			assert.NoError(t, apiextensionsv1.AddToScheme(scheme))
+			builder := fake.NewClientBuilder().WithScheme(scheme)
+			if c.crd != nil {
+				builder = builder.WithObjects(c.crd)
+			}
+			client := builder.Build()
+
+			err := EnsureCRDConversion(context.TODO(), client, service, c.caBundle)
+			if len(c.expectedError) > 0 {
+				assert.EqualError(t, err, c.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+
+			crd := &apiextensionsv1.CustomResourceDefinition{}
+			assert.NoError(t, client.Get(context.TODO(), types.NamespacedName{Name: common.ManagedServiceAccountCRDName}, crd))
+			assert.Equal(t, apiextensionsv1.WebhookConverter, crd.Spec.Conversion.Strategy)
+			clientConfig := crd.Spec.Conversion.Webhook.ClientConfig
+			assert.Equal(t, c.caBundle, clientConfig.CABundle)
+			assert.Equal(t, service.Namespace, clientConfig.Service.Namespace)
+			assert.Equal(t, service.Name, clientConfig.Service.Name)
+			assert.Equal(t, ConversionPath, *clientConfig.Service.Path)
+			assert.Equal(t, []string{"v1"}, crd.Spec.Conversion.Webhook.ConversionReviewVersions)
+
+			// a second call is a no-op
+			resourceVersion := crd.ResourceVersion
+			assert.NoError(t, EnsureCRDConversion(context.TODO(), client, service, c.caBundle))
+			assert.NoError(t, client.Get(context.TODO(), types.NamespacedName{Name: common.ManagedServiceAccountCRDName}, crd))
+			assert.Equal(t, resourceVersion, crd.ResourceVersion)
+		})
+	}
+}
@@ -5,10 +5,137 @@ const (
 	AgentName = "addon-agent"
 
 	HubAddonUserGroup = "system:open-cluster-management:addon:managed-serviceaccount"
+
+	// AgentServiceAccountName is the name of the ServiceAccount the agent runs as on the managed cluster.
+	AgentServiceAccountName = "managed-serviceaccount"
+	// TokenRequesterClusterRoleName is the name of the ClusterRole permitting to request the tokens of
+	// ServiceAccounts, the agent binds it only in the namespaces of the ServiceAccounts it manages.
+	TokenRequesterClusterRoleName = "open-cluster-management:managed-serviceaccount:token-requester"
 )
 
 const (
 	LabelKeyIsManagedServiceAccount        = "authentication.open-cluster-management.io/is-managed-serviceaccount"
 	LabelKeyManagedServiceAccountNamespace = "authentication.open-cluster-management.io/managed-serviceaccount-namespace"
 	LabelKeyManagedServiceAccountName      = "authentication.open-cluster-management.io/managed-serviceaccount-name"
+	// AnnotationKeyManagedServiceAccountName is set along with the LabelKeyManagedServiceAccountName
+	// label to record the full name of the ManagedServiceAccount, the label holds a hashed value if
+	// the name is longer than a label value allows.
+	AnnotationKeyManagedServiceAccountName = "authentication.open-cluster-management.io/managed-serviceaccount-name"
+)
+
+const (
+	// LabelKeyManagedServiceAccountSetNamespace and LabelKeyManagedServiceAccountSetName are set on
+	// the ManagedServiceAccounts created by a ManagedServiceAccountSet.
+	LabelKeyManagedServiceAccountSetNamespace = "authentication.open-cluster-management.io/managed-serviceaccount-set-namespace"
+	LabelKeyManagedServiceAccountSetName      = "authentication.open-cluster-management.io/managed-serviceaccount-set-name"
+	// FinalizerManagedServiceAccountSetCleanup is set on the ManagedServiceAccountSet to delete the
+	// ManagedServiceAccounts it creates in the cluster namespaces.
+	FinalizerManagedServiceAccountSetCleanup = "authentication.open-cluster-management.io/managed-serviceaccount-set-cleanup"
+)
+
+const (
+	// LabelKeyClusterManagedServiceAccountTemplate is set on the ManagedServiceAccounts provisioned by
+	// a ClusterManagedServiceAccountTemplate to record its name.
+	LabelKeyClusterManagedServiceAccountTemplate = "authentication.open-cluster-management.io/cluster-template"
+	// FinalizerClusterManagedServiceAccountTemplateCleanup is set on the
+	// ClusterManagedServiceAccountTemplate to delete the ManagedServiceAccounts it provisions.
+	FinalizerClusterManagedServiceAccountTemplateCleanup = "authentication.open-cluster-management.io/cluster-template-cleanup"
+)
+
+const (
+	// AnnotationKeyTokenSpec is set on the token secret to record the spec.token of the
+	// ManagedServiceAccount that the token is requested with.
+	AnnotationKeyTokenSpec = "authentication.open-cluster-management.io/token-spec"
+	// AnnotationKeyAdoptedBy is set on the existing ServiceAccount adopted by a ManagedServiceAccount
+	// (format: "<namespace>/<name>"), the adopted ServiceAccount is released instead of deleted.
+	AnnotationKeyAdoptedBy = "authentication.open-cluster-management.io/adopted-by"
+	// AnnotationKeyTokenExpiration is set on the token secret in the overlap mode to record the
+	// expiration time (RFC 3339) of the current token.
+	AnnotationKeyTokenExpiration = "authentication.open-cluster-management.io/token-expiration"
+	// AnnotationKeyPreviousTokenExpiration is set on the token secret in the overlap mode to record
+	// the expiration time (RFC 3339) of the previous token while it is kept in the secret.
+	AnnotationKeyPreviousTokenExpiration = "authentication.open-cluster-management.io/previous-token-expiration"
+	// AnnotationKeyCredentialRevocation is set on the ManagedServiceAccount to record the name of the
+	// last CredentialRevocation dispatched to it.
+	AnnotationKeyCredentialRevocation = "authentication.open-cluster-management.io/credential-revocation"
+	// AnnotationKeyCredentialRevocationUID and AnnotationKeyCredentialRevocationGeneration are set
+	// along with AnnotationKeyCredentialRevocation to record the UID and the generation of the
+	// CredentialRevocation, the agent echoes the three of them in status.lastCredentialRevocation once
+	// the token is revoked or re-issued.
+	AnnotationKeyCredentialRevocationUID        = "authentication.open-cluster-management.io/credential-revocation-uid"
+	AnnotationKeyCredentialRevocationGeneration = "authentication.open-cluster-management.io/credential-revocation-generation"
+	// AnnotationKeyReissueAfter is set on the ManagedServiceAccount to request the agent to re-issue
+	// the token if it is issued before the time (RFC 3339).
+	AnnotationKeyReissueAfter = "authentication.open-cluster-management.io/reissue-after"
+)
+
+const (
+	// AdoptionAllowlistConfigMapName is the name of the ConfigMap in the agent namespace on the
+	// managed cluster, listing the ServiceAccounts that ManagedServiceAccounts are allowed to adopt.
+	AdoptionAllowlistConfigMapName = "managed-serviceaccount-adoption-allowlist"
+	// AdoptionAllowlistKey is the key of the allowlist in the ConfigMap, one "<namespace>/<name>"
+	// pattern per line, e.g. "team-a/deployer" or "team-b/*".
+	AdoptionAllowlistKey = "serviceAccounts"
+	// PermissionAllowlistConfigMapName is the name of the ConfigMap in the agent namespace on the
+	// managed cluster, listing the ServiceAccounts that spec.permissions are allowed to grant RBAC to.
+	PermissionAllowlistConfigMapName = "managed-serviceaccount-permission-allowlist"
+	// PermissionAllowlistKey is the key of the allowlist in the ConfigMap, in the same format as
+	// AdoptionAllowlistKey.
+	PermissionAllowlistKey = "serviceAccounts"
+	// PermissionAllowlistClusterRolesKey is the key in the permission allowlist ConfigMap listing the
+	// ClusterRoles that spec.permissions.roleRefs are allowed to bind, one name pattern per line.
+	PermissionAllowlistClusterRolesKey = "clusterRoles"
+	// PermissionAllowlistRolesKey is the key in the permission allowlist ConfigMap listing the Roles
+	// that spec.permissions.roleRefs are allowed to bind, one "<namespace>/<name>" pattern per line.
+	PermissionAllowlistRolesKey = "roles"
+	// PermissionAllowlistRulesKey is the key in the permission allowlist ConfigMap listing the verbs
+	// the inline rules of spec.permissions are allowed to grant, one "<verb>:<resource>.<group>"
+	// pattern per line, e.g. "get:pods", "list:deployments.apps" or "get:/healthz" for a
+	// non-resource URL.
+	PermissionAllowlistRulesKey = "rules"
+	// SinkConfigMapName is the name of the ConfigMap in the agent namespace on the managed cluster
+	// configuring the credential sinks, one sink configuration per key.
+	SinkConfigMapName = "managed-serviceaccount-sinks"
+	// SinkTokenSecretKey is the key of the token in the Secret authenticating the agent to a sink.
+	SinkTokenSecretKey = "token"
+)
+
+const (
+	// SecretKeyServer is the key of the managed cluster URL in the token secret of the Kubeconfig format.
+	SecretKeyServer = "server"
+	// SecretKeyKubeconfig is the key of the kubeconfig in the token secret of the Kubeconfig format.
+	SecretKeyKubeconfig = "kubeconfig"
+	// SecretKeyPreviousToken is the key of the token replaced by the last rotation, kept in the
+	// token secret for a grace period in the overlap mode.
+	SecretKeyPreviousToken = "token.previous"
+)
+
+const (
+	// ManagedServiceAccountCRDName is the name of the ManagedServiceAccount CustomResourceDefinition.
+	ManagedServiceAccountCRDName = "managedserviceaccounts.authentication.open-cluster-management.io"
+)
+
+const (
+	// EventReasonServiceAccountCreated is recorded once the ServiceAccount is created on the managed cluster.
+	EventReasonServiceAccountCreated = "ServiceAccountCreated"
+	// EventReasonTokenIssued is recorded once the first token is issued for the ManagedServiceAccount.
+	EventReasonTokenIssued = "TokenIssued"
+	// EventReasonTokenRotated is recorded once the token in the token secret is replaced by a new one.
+	EventReasonTokenRotated = "TokenRotated"
+	// EventReasonTokenInvalid is recorded if the TokenReview on the managed cluster rejects the token.
+	EventReasonTokenInvalid = "TokenInvalid"
+	// EventReasonSinkDeliveryFailed is recorded if the credential cannot be delivered to the sink.
+	EventReasonSinkDeliveryFailed = "SinkDeliveryFailed"
+	// EventReasonSecretConflict is recorded if the agent refuses to overwrite a secret it does not manage.
+	EventReasonSecretConflict = "SecretConflict"
+	// EventReasonTokensRevoked is recorded once the outstanding tokens are revoked.
+	EventReasonTokensRevoked = "TokensRevoked"
+	// EventReasonCleanedUp is recorded once the resources on the managed cluster are cleaned up
+	// after the ManagedServiceAccount is deleted.
+	EventReasonCleanedUp = "CleanedUp"
+	// EventReasonExpired is recorded once the ManagedServiceAccount is deleted after its TTL.
+	EventReasonExpired = "Expired"
+	// EventReasonCredentialSynced is recorded once the token secret is synced to the namespace of
+	// the ClusterProfile.
+	EventReasonCredentialSynced = "CredentialSynced"
 )
@@ -0,0 +1,33 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// nameHashLength is the length of the hash suffixed to a truncated ManagedServiceAccount name
+const nameHashLength = 16
+
+// ManagedServiceAccountNameLabelValue returns the value of the LabelKeyManagedServiceAccountName
+// label for the ManagedServiceAccount. A name longer than a label value allows is truncated and
+// suffixed with the hash of the full name.
+func ManagedServiceAccountNameLabelValue(name string) string {
+	if len(name) <= validation.LabelValueMaxLength {
+		return name
+	}
+	hash := sha256.Sum256([]byte(name))
+	return name[:validation.LabelValueMaxLength-nameHashLength-1] + "-" + hex.EncodeToString(hash[:])[:nameHashLength]
+}
+
+// ManagedServiceAccountNameOf returns the name of the ManagedServiceAccount that the object is created
+// for, it is read from the AnnotationKeyManagedServiceAccountName annotation, or the
+// LabelKeyManagedServiceAccountName label on the objects created without the annotation.
+func ManagedServiceAccountNameOf(obj metav1.Object) string {
+	if name := obj.GetAnnotations()[AnnotationKeyManagedServiceAccountName]; len(name) > 0 {
+		return name
+	}
+	return obj.GetLabels()[LabelKeyManagedServiceAccountName]
+}
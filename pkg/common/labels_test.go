@@ -0,0 +1,63 @@
+package common
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+func TestManagedServiceAccountNameLabelValue(t *testing.T) {
+	cases := []struct {
+		name          string
+		msaName       string
+		expectedValue string
+	}{
+		{
+			name:          "short name",
+			msaName:       "msa1",
+			expectedValue: "msa1",
+		},
+		{
+			name:          "name of the max length",
+			msaName:       strings.Repeat("a", 63),
+			expectedValue: strings.Repeat("a", 63),
+		},
+		{
+			name:    "long name",
+			msaName: strings.Repeat("a", 100),
+		},
+		{
+			name:    "long name with a dot at the truncation",
+			msaName: strings.Repeat("a", 45) + "." + strings.Repeat("b", 54),
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			value := ManagedServiceAccountNameLabelValue(c.msaName)
+			assert.Empty(t, validation.IsValidLabelValue(value))
+			if len(c.expectedValue) > 0 {
+				assert.Equal(t, c.expectedValue, value)
+			}
+		})
+	}
+
+	assert.NotEqual(t, ManagedServiceAccountNameLabelValue(strings.Repeat("a", 100)),
+		ManagedServiceAccountNameLabelValue(strings.Repeat("a", 99)+"b"))
+}
+
+func TestManagedServiceAccountNameOf(t *testing.T) {
+	msaName := strings.Repeat("a", 100)
+	annotated := &metav1.ObjectMeta{
+		Labels:      map[string]string{LabelKeyManagedServiceAccountName: ManagedServiceAccountNameLabelValue(msaName)},
+		Annotations: map[string]string{AnnotationKeyManagedServiceAccountName: msaName},
+	}
+	assert.Equal(t, msaName, ManagedServiceAccountNameOf(annotated))
+
+	labeled := &metav1.ObjectMeta{
+		Labels: map[string]string{LabelKeyManagedServiceAccountName: "msa1"},
+	}
+	assert.Equal(t, "msa1", ManagedServiceAccountNameOf(labeled))
+}
@@ -0,0 +1,70 @@
+package event
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"open-cluster-management.io/managed-serviceaccount/pkg/common"
+)
+
+var _ handler.TypedEventHandler[client.Object, reconcile.Request] = &permissionEventHandler[client.Object]{}
+
+// NewPermissionEventHandler maps the RBAC objects created for a ManagedServiceAccount on the
+// managed cluster back to the ManagedServiceAccount, so that the drift can be repaired.
+func NewPermissionEventHandler[T client.Object](clusterName string) permissionEventHandler[T] {
+	return permissionEventHandler[T]{
+		clusterName: clusterName,
+	}
+}
+
+type permissionEventHandler[T client.Object] struct {
+	clusterName string
+}
+
+func (p permissionEventHandler[T]) Create(ctx context.Context, event event.TypedCreateEvent[T],
+	q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+	p.process(event.Object, q)
+}
+
+func (p permissionEventHandler[T]) Update(ctx context.Context, event event.TypedUpdateEvent[T],
+	q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+	p.process(event.ObjectNew, q)
+}
+
+func (p permissionEventHandler[T]) Delete(ctx context.Context, event event.TypedDeleteEvent[T],
+	q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+	p.process(event.Object, q)
+}
+
+func (p permissionEventHandler[T]) Generic(ctx context.Context, event event.TypedGenericEvent[T],
+	q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+	p.process(event.Object, q)
+}
+
+func (p permissionEventHandler[T]) process(obj T, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+	labels := obj.GetLabels()
+	if labels[common.LabelKeyIsManagedServiceAccount] != "true" {
+		return
+	}
+	if labels[common.LabelKeyManagedServiceAccountNamespace] != p.clusterName {
+		return
+	}
+
+	name := common.ManagedServiceAccountNameOf(obj)
+	if len(name) == 0 {
+		return
+	}
+
+	q.Add(reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Namespace: p.clusterName,
+			Name:      name,
+		},
+	})
+}
@@ -0,0 +1,104 @@
+package event
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	"open-cluster-management.io/managed-serviceaccount/pkg/common"
+)
+
+func TestPermissionEventHandler(t *testing.T) {
+	role := &rbacv1.Role{}
+	roleWithLabels := &rbacv1.Role{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{
+				common.LabelKeyIsManagedServiceAccount:        "true",
+				common.LabelKeyManagedServiceAccountNamespace: "cluster1",
+				common.LabelKeyManagedServiceAccountName:      "msa1",
+			},
+		},
+	}
+	roleOfOtherCluster := &rbacv1.Role{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{
+				common.LabelKeyIsManagedServiceAccount:        "true",
+				common.LabelKeyManagedServiceAccountNamespace: "cluster2",
+				common.LabelKeyManagedServiceAccountName:      "msa1",
+			},
+		},
+	}
+
+	cases := []struct {
+		name   string
+		event  interface{}
+		queued bool
+	}{
+		{
+			name: "create without label",
+			event: &event.CreateEvent{
+				Object: role,
+			},
+		},
+		{
+			name: "create with label",
+			event: &event.CreateEvent{
+				Object: roleWithLabels,
+			},
+			queued: true,
+		},
+		{
+			name: "create with label of other cluster",
+			event: &event.CreateEvent{
+				Object: roleOfOtherCluster,
+			},
+		},
+		{
+			name: "update without label",
+			event: &event.UpdateEvent{
+				ObjectNew: role,
+			},
+		},
+		{
+			name: "update with label",
+			event: &event.UpdateEvent{
+				ObjectNew: roleWithLabels,
+			},
+			queued: true,
+		},
+		{
+			name: "delete without label",
+			event: &event.DeleteEvent{
+				Object: role,
+			},
+		},
+		{
+			name: "delete with label",
+			event: &event.DeleteEvent{
+				Object: roleWithLabels,
+			},
+			queued: true,
+		},
+		{
+			name: "generic with label",
+			event: &event.GenericEvent{
+				Object: roleWithLabels,
+			},
+			queued: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			q := processEvent(NewPermissionEventHandler[client.Object]("cluster1"), c.event)
+			if c.queued {
+				assert.Equal(t, 1, q.Len(), "expect event queued")
+			} else {
+				assert.Equal(t, 0, q.Len(), "expect event ignored")
+			}
+		})
+	}
+}
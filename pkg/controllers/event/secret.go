@@ -54,10 +54,16 @@ func (s secretEventHandler) process(secret *corev1.Secret, q workqueue.TypedRate
 	if secret.Labels[common.LabelKeyIsManagedServiceAccount] != "true" {
 		return
 	}
+	// the token secret is named after the managed serviceaccount unless the name is
+	// prescribed in the projection
+	name := secret.Name
+	if msaName := common.ManagedServiceAccountNameOf(secret); len(msaName) > 0 {
+		name = msaName
+	}
 	q.Add(reconcile.Request{
 		NamespacedName: types.NamespacedName{
 			Namespace: secret.Namespace,
-			Name:      secret.Name,
+			Name:      name,
 		},
 	})
 }
@@ -96,6 +96,51 @@ func TestSecretEventHandler(t *testing.T) {
 	}
 }
 
+func TestSecretEventHandlerRequest(t *testing.T) {
+	cases := []struct {
+		name         string
+		secret       *corev1.Secret
+		expectedName string
+	}{
+		{
+			name: "secret named after the managed serviceaccount",
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "cluster1",
+					Name:      "msa1",
+					Labels: map[string]string{
+						common.LabelKeyIsManagedServiceAccount: "true",
+					},
+				},
+			},
+			expectedName: "msa1",
+		},
+		{
+			name: "secret with prescribed name",
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "cluster1",
+					Name:      "custom",
+					Labels: map[string]string{
+						common.LabelKeyIsManagedServiceAccount:   "true",
+						common.LabelKeyManagedServiceAccountName: "msa1",
+					},
+				},
+			},
+			expectedName: "msa1",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			q := processEvent(NewSecretEventHandler(), &event.CreateEvent{Object: c.secret})
+			assert.Equal(t, 1, q.Len(), "expect event queued")
+			item, _ := q.Get()
+			assert.Equal(t, "cluster1", item.Namespace)
+			assert.Equal(t, c.expectedName, item.Name)
+		})
+	}
+}
+
 func processEvent(handler handler.TypedEventHandler[client.Object, reconcile.Request], evt interface{}) workqueue.TypedRateLimitingInterface[reconcile.Request] {
 	q := &controllertest.TypedQueue[reconcile.Request]{TypedInterface: workqueue.NewTyped[reconcile.Request]()}
 	switch e := evt.(type) {
@@ -28,7 +28,7 @@ type serviceAccountEventHandler[T client.Object] struct {
 
 func (s serviceAccountEventHandler[T]) Create(ctx context.Context, event event.TypedCreateEvent[T],
 	q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
-	s.process(event.Object.GetLabels(), event.Object.GetName(), q)
+	s.process(event.Object, q)
 }
 
 func (s serviceAccountEventHandler[T]) Update(ctx context.Context, event event.TypedUpdateEvent[T],
@@ -37,18 +37,29 @@ func (s serviceAccountEventHandler[T]) Update(ctx context.Context, event event.T
 
 func (s serviceAccountEventHandler[T]) Delete(ctx context.Context, event event.TypedDeleteEvent[T],
 	q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
-	s.process(event.Object.GetLabels(), event.Object.GetName(), q)
+	s.process(event.Object, q)
 }
 
 func (s serviceAccountEventHandler[T]) Generic(ctx context.Context, event event.TypedGenericEvent[T],
 	q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
-	s.process(event.Object.GetLabels(), event.Object.GetName(), q)
+	s.process(event.Object, q)
 }
 
-func (s serviceAccountEventHandler[T]) process(labels map[string]string, name string, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+func (s serviceAccountEventHandler[T]) process(sa T, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+	labels := sa.GetLabels()
 	if labels[common.LabelKeyIsManagedServiceAccount] != "true" {
 		return
 	}
+
+	// the serviceaccounts created by the former agents are not labeled with the
+	// ManagedServiceAccount, and are named after it
+	if namespace, ok := labels[common.LabelKeyManagedServiceAccountNamespace]; ok && namespace != s.clusterName {
+		return
+	}
+	name := sa.GetName()
+	if msaName := common.ManagedServiceAccountNameOf(sa); len(msaName) > 0 {
+		name = msaName
+	}
 	q.Add(reconcile.Request{
 		NamespacedName: types.NamespacedName{
 			Namespace: s.clusterName,
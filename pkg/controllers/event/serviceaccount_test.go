@@ -21,6 +21,16 @@ func TestServiceAccountEventHandler(t *testing.T) {
 		},
 	}
 
+	saOfOtherCluster := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{
+				common.LabelKeyIsManagedServiceAccount:        "true",
+				common.LabelKeyManagedServiceAccountNamespace: "cluster2",
+				common.LabelKeyManagedServiceAccountName:      "msa1",
+			},
+		},
+	}
+
 	cases := []struct {
 		name   string
 		event  interface{}
@@ -39,6 +49,12 @@ func TestServiceAccountEventHandler(t *testing.T) {
 			},
 			queued: true,
 		},
+		{
+			name: "create with label of other cluster",
+			event: &event.CreateEvent{
+				Object: saOfOtherCluster,
+			},
+		},
 		{
 			name: "update without label",
 			event: &event.UpdateEvent{
@@ -89,3 +105,47 @@ func TestServiceAccountEventHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestServiceAccountEventHandlerRequest(t *testing.T) {
+	cases := []struct {
+		name         string
+		sa           *corev1.ServiceAccount
+		expectedName string
+	}{
+		{
+			name: "legacy serviceaccount named after the managed serviceaccount",
+			sa: &corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "msa1",
+					Labels: map[string]string{
+						common.LabelKeyIsManagedServiceAccount: "true",
+					},
+				},
+			},
+			expectedName: "msa1",
+		},
+		{
+			name: "serviceaccount labeled with the managed serviceaccount",
+			sa: &corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "custom",
+					Labels: map[string]string{
+						common.LabelKeyIsManagedServiceAccount:        "true",
+						common.LabelKeyManagedServiceAccountNamespace: "cluster1",
+						common.LabelKeyManagedServiceAccountName:      "msa1",
+					},
+				},
+			},
+			expectedName: "msa1",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			q := processEvent(NewServiceAccountEventHandler[client.Object]("cluster1"), &event.CreateEvent{Object: c.sa})
+			assert.Equal(t, 1, q.Len(), "expect event queued")
+			item, _ := q.Get()
+			assert.Equal(t, "cluster1", item.Namespace)
+			assert.Equal(t, c.expectedName, item.Name)
+		})
+	}
+}
@@ -0,0 +1,226 @@
+// Package envelope encrypts the credentials in the token secrets with a data key, which is in turn
+// encrypted by a KMS v2 plugin, so that reading the token secrets is not enough to obtain the
+// credentials.
+package envelope
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	kmsservice "k8s.io/kms/pkg/service"
+
+	"open-cluster-management.io/managed-serviceaccount/pkg/common"
+)
+
+const (
+	// SecretKeyEnvelope is the key of the envelope in the encrypted token secret, which records the
+	// data key encrypted by the KMS plugin and the keys encrypted with the data key.
+	SecretKeyEnvelope = "envelope"
+
+	// dataKeySize is the size of the AES-256 data key.
+	dataKeySize = 32
+	// maxCachedDataKeys bounds the data keys kept to decrypt the secrets without calling the KMS plugin.
+	maxCachedDataKeys = 1024
+)
+
+// EncryptedKeys are the keys of the token secret holding the credentials, which are encrypted. The
+// other keys, e.g. "ca.crt" and "server", are kept in plaintext.
+var EncryptedKeys = []string{
+	corev1.ServiceAccountTokenKey,
+	common.SecretKeyPreviousToken,
+	corev1.TLSPrivateKeyKey,
+	common.SecretKeyKubeconfig,
+}
+
+// header is the content of the envelope key.
+type header struct {
+	// KeyID is the ID of the key encryption key of the KMS plugin.
+	KeyID string `json:"keyID"`
+	// EncryptedDataKey is the data key encrypted by the KMS plugin.
+	EncryptedDataKey []byte `json:"encryptedDataKey"`
+	// Annotations are returned by the KMS plugin along with the encrypted data key.
+	Annotations map[string][]byte `json:"annotations,omitempty"`
+	// Keys are the keys of the secret encrypted with the data key.
+	Keys []string `json:"keys"`
+}
+
+// Envelope encrypts and decrypts the token secrets with the data keys wrapped by a KMS plugin.
+type Envelope struct {
+	service kmsservice.Service
+
+	lock     sync.Mutex
+	dataKeys map[string][]byte
+}
+
+// New returns an Envelope wrapping the data keys with the KMS service.
+func New(service kmsservice.Service) *Envelope {
+	return &Envelope{
+		service:  service,
+		dataKeys: map[string][]byte{},
+	}
+}
+
+// Dial returns an Envelope wrapping the data keys with the KMS v2 plugin listening on the endpoint.
+func Dial(endpoint string, timeout time.Duration) (*Envelope, error) {
+	service, err := NewKMSService(endpoint, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return New(service), nil
+}
+
+// IsEncrypted checks whether the credentials in the secret are encrypted.
+func IsEncrypted(secret *corev1.Secret) bool {
+	return secret != nil && len(secret.Data[SecretKeyEnvelope]) > 0
+}
+
+// EncryptSecret encrypts the credential keys of the secret in place with a fresh data key.
+func (e *Envelope) EncryptSecret(ctx context.Context, secret *corev1.Secret) error {
+	if e == nil {
+		return errors.New("envelope encryption is not configured with a KMS plugin")
+	}
+	if IsEncrypted(secret) {
+		return fmt.Errorf("secret %s/%s is encrypted already", secret.Namespace, secret.Name)
+	}
+
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return errors.Wrapf(err, "failed to generate the data key")
+	}
+	resp, err := e.service.Encrypt(ctx, string(uuid.NewUUID()), dataKey)
+	if err != nil {
+		return errors.Wrapf(err, "failed to encrypt the data key with the KMS plugin")
+	}
+	if len(resp.KeyID) == 0 || len(resp.Ciphertext) == 0 {
+		return errors.New("the KMS plugin returned no key ID or ciphertext")
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return err
+	}
+
+	h := header{
+		KeyID:            resp.KeyID,
+		EncryptedDataKey: resp.Ciphertext,
+		Annotations:      resp.Annotations,
+		Keys:             []string{},
+	}
+	data := make(map[string][]byte, len(secret.Data)+1)
+	for key, value := range secret.Data {
+		data[key] = value
+	}
+	for _, key := range EncryptedKeys {
+		value, ok := data[key]
+		if !ok {
+			continue
+		}
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return errors.Wrapf(err, "failed to generate the nonce")
+		}
+		// the key is authenticated, so that the values cannot be swapped between the keys
+		data[key] = aead.Seal(nonce, nonce, value, []byte(key))
+		h.Keys = append(h.Keys, key)
+	}
+	envelope, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	data[SecretKeyEnvelope] = envelope
+	secret.Data = data
+
+	e.cacheDataKey(h.EncryptedDataKey, dataKey)
+	return nil
+}
+
+// DecryptSecret returns a copy of the secret with the credential keys decrypted, or the secret
+// itself if it is not encrypted. The Envelope may be nil if no KMS plugin is configured, in which
+// case only the secrets that are not encrypted can be read.
+func (e *Envelope) DecryptSecret(ctx context.Context, secret *corev1.Secret) (*corev1.Secret, error) {
+	if !IsEncrypted(secret) {
+		return secret, nil
+	}
+	if e == nil {
+		return nil, fmt.Errorf("secret %s/%s is envelope encrypted, a KMS plugin is required to decrypt it",
+			secret.Namespace, secret.Name)
+	}
+
+	h := header{}
+	if err := json.Unmarshal(secret.Data[SecretKeyEnvelope], &h); err != nil {
+		return nil, errors.Wrapf(err, "invalid envelope of secret %s/%s", secret.Namespace, secret.Name)
+	}
+	dataKey, err := e.dataKey(ctx, &h)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decrypt the data key of secret %s/%s", secret.Namespace, secret.Name)
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	decrypted := secret.DeepCopy()
+	delete(decrypted.Data, SecretKeyEnvelope)
+	for _, key := range h.Keys {
+		value := decrypted.Data[key]
+		if len(value) < aead.NonceSize() {
+			return nil, fmt.Errorf("invalid ciphertext of key %q in secret %s/%s", key, secret.Namespace, secret.Name)
+		}
+		plaintext, err := aead.Open(nil, value[:aead.NonceSize()], value[aead.NonceSize():], []byte(key))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decrypt key %q of secret %s/%s", key, secret.Namespace, secret.Name)
+		}
+		decrypted.Data[key] = plaintext
+	}
+	return decrypted, nil
+}
+
+// dataKey returns the data key of the envelope, which is decrypted by the KMS plugin unless it
+// is cached.
+func (e *Envelope) dataKey(ctx context.Context, h *header) ([]byte, error) {
+	e.lock.Lock()
+	dataKey, ok := e.dataKeys[string(h.EncryptedDataKey)]
+	e.lock.Unlock()
+	if ok {
+		return dataKey, nil
+	}
+
+	dataKey, err := e.service.Decrypt(ctx, string(uuid.NewUUID()), &kmsservice.DecryptRequest{
+		Ciphertext:  h.EncryptedDataKey,
+		KeyID:       h.KeyID,
+		Annotations: h.Annotations,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(dataKey) != dataKeySize {
+		return nil, fmt.Errorf("invalid data key size %d", len(dataKey))
+	}
+	e.cacheDataKey(h.EncryptedDataKey, dataKey)
+	return dataKey, nil
+}
+
+func (e *Envelope) cacheDataKey(encrypted, dataKey []byte) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if len(e.dataKeys) >= maxCachedDataKeys {
+		e.dataKeys = map[string][]byte{}
+	}
+	e.dataKeys[string(encrypted)] = dataKey
+}
+
+func newAEAD(dataKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid data key")
+	}
+	return cipher.NewGCM(block)
+}
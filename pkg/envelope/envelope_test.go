@@ -0,0 +1,138 @@
+package envelope
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kmsservice "k8s.io/kms/pkg/service"
+
+	"open-cluster-management.io/managed-serviceaccount/pkg/common"
+)
+
+// fakeKMS stands in for a KMS v2 plugin, which wraps the data keys with a local key encryption key.
+type fakeKMS struct {
+	kek      cipher.AEAD
+	decrypts atomic.Int32
+}
+
+func newFakeKMS(t *testing.T) *fakeKMS {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	assert.NoError(t, err)
+	block, err := aes.NewCipher(key)
+	assert.NoError(t, err)
+	aead, err := cipher.NewGCM(block)
+	assert.NoError(t, err)
+	return &fakeKMS{kek: aead}
+}
+
+func (k *fakeKMS) Encrypt(_ context.Context, _ string, data []byte) (*kmsservice.EncryptResponse, error) {
+	nonce := make([]byte, k.kek.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return &kmsservice.EncryptResponse{
+		Ciphertext:  k.kek.Seal(nonce, nonce, data, nil),
+		KeyID:       "key1",
+		Annotations: map[string][]byte{"kms.example.com/version": []byte("1")},
+	}, nil
+}
+
+func (k *fakeKMS) Decrypt(_ context.Context, _ string, req *kmsservice.DecryptRequest) ([]byte, error) {
+	k.decrypts.Add(1)
+	nonceSize := k.kek.NonceSize()
+	return k.kek.Open(nil, req.Ciphertext[:nonceSize], req.Ciphertext[nonceSize:], nil)
+}
+
+func (k *fakeKMS) Status(_ context.Context) (*kmsservice.StatusResponse, error) {
+	return &kmsservice.StatusResponse{Version: "v2", Healthz: "ok", KeyID: "key1"}, nil
+}
+
+// serveFakeKMS serves the fake KMS plugin on a unix socket and returns its endpoint.
+func serveFakeKMS(t *testing.T, kms *fakeKMS) string {
+	socket := filepath.Join(t.TempDir(), "kms.sock")
+	server := kmsservice.NewGRPCService(socket, 3*time.Second, kms)
+	go func() {
+		_ = server.ListenAndServe()
+	}()
+	t.Cleanup(server.Close)
+	return "unix://" + socket
+}
+
+func newTokenSecret() *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "cluster1", Name: "msa1"},
+		Data: map[string][]byte{
+			corev1.ServiceAccountRootCAKey: []byte("ca"),
+			corev1.ServiceAccountTokenKey:  []byte("token"),
+			common.SecretKeyKubeconfig:     []byte("kubeconfig"),
+		},
+	}
+}
+
+func TestEnvelope(t *testing.T) {
+	kms := newFakeKMS(t)
+	e, err := Dial(serveFakeKMS(t, kms), DefaultKMSTimeout)
+	assert.NoError(t, err)
+	ctx := context.TODO()
+
+	secret := newTokenSecret()
+	assert.NoError(t, e.EncryptSecret(ctx, secret))
+	assert.True(t, IsEncrypted(secret))
+	assert.Equal(t, []byte("ca"), secret.Data[corev1.ServiceAccountRootCAKey])
+	assert.NotContains(t, string(secret.Data[corev1.ServiceAccountTokenKey]), "token")
+	assert.NotContains(t, string(secret.Data[common.SecretKeyKubeconfig]), "kubeconfig")
+	assert.ErrorContains(t, e.EncryptSecret(ctx, secret), "is encrypted already")
+
+	// the data key is cached by the writer
+	decrypted, err := e.DecryptSecret(ctx, secret)
+	assert.NoError(t, err)
+	assert.Equal(t, newTokenSecret(), decrypted)
+	assert.Equal(t, int32(0), kms.decrypts.Load())
+
+	// another reader decrypts the data key with the KMS plugin once
+	reader, err := Dial(serveFakeKMS(t, kms), DefaultKMSTimeout)
+	assert.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		decrypted, err = reader.DecryptSecret(ctx, secret)
+		assert.NoError(t, err)
+		assert.Equal(t, newTokenSecret(), decrypted)
+	}
+	assert.Equal(t, int32(1), kms.decrypts.Load())
+
+	// the values cannot be swapped between the keys
+	swapped := secret.DeepCopy()
+	swapped.Data[corev1.ServiceAccountTokenKey] = secret.Data[common.SecretKeyKubeconfig]
+	_, err = reader.DecryptSecret(ctx, swapped)
+	assert.ErrorContains(t, err, `failed to decrypt key "token" of secret cluster1/msa1`)
+
+	// the data key cannot be decrypted by another KMS plugin
+	other, err := Dial(serveFakeKMS(t, newFakeKMS(t)), DefaultKMSTimeout)
+	assert.NoError(t, err)
+	_, err = other.DecryptSecret(ctx, secret)
+	assert.ErrorContains(t, err, "failed to decrypt the data key of secret cluster1/msa1")
+}
+
+func TestDecryptWithoutKMS(t *testing.T) {
+	var e *Envelope
+
+	plain := newTokenSecret()
+	decrypted, err := e.DecryptSecret(context.TODO(), plain)
+	assert.NoError(t, err)
+	assert.Equal(t, plain, decrypted)
+
+	encrypted := newTokenSecret()
+	encrypted.Data[SecretKeyEnvelope] = []byte("{}")
+	_, err = e.DecryptSecret(context.TODO(), encrypted)
+	assert.EqualError(t, err, "secret cluster1/msa1 is envelope encrypted, a KMS plugin is required to decrypt it")
+	assert.EqualError(t, e.EncryptSecret(context.TODO(), plain), "envelope encryption is not configured with a KMS plugin")
+}
@@ -0,0 +1,93 @@
+package envelope
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	kmsapi "k8s.io/kms/apis/v2"
+	kmsservice "k8s.io/kms/pkg/service"
+	"k8s.io/kms/pkg/util"
+)
+
+// DefaultKMSTimeout is the default timeout of the calls to the KMS plugin.
+const DefaultKMSTimeout = 3 * time.Second
+
+// kmsClient calls a KMS v2 plugin over its unix socket, as the kube-apiserver does.
+type kmsClient struct {
+	client  kmsapi.KeyManagementServiceClient
+	conn    *grpc.ClientConn
+	timeout time.Duration
+}
+
+var _ kmsservice.Service = &kmsClient{}
+
+// NewKMSService connects to the KMS v2 plugin listening on the endpoint, e.g.
+// "unix:///var/run/kmsplugin/socket.sock". The connection is established lazily by the first call.
+func NewKMSService(endpoint string, timeout time.Duration) (kmsservice.Service, error) {
+	addr, err := util.ParseEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := grpc.NewClient("passthrough:///"+addr,
+		grpc.WithAuthority("localhost"),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.WaitForReady(true)),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", addr)
+		}),
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to connect to the KMS plugin %s", endpoint)
+	}
+	return &kmsClient{
+		client:  kmsapi.NewKeyManagementServiceClient(conn),
+		conn:    conn,
+		timeout: timeout,
+	}, nil
+}
+
+func (c *kmsClient) Decrypt(ctx context.Context, uid string, req *kmsservice.DecryptRequest) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	resp, err := c.client.Decrypt(ctx, &kmsapi.DecryptRequest{
+		Ciphertext:  req.Ciphertext,
+		Uid:         uid,
+		KeyId:       req.KeyID,
+		Annotations: req.Annotations,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Plaintext, nil
+}
+
+func (c *kmsClient) Encrypt(ctx context.Context, uid string, data []byte) (*kmsservice.EncryptResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	resp, err := c.client.Encrypt(ctx, &kmsapi.EncryptRequest{
+		Plaintext: data,
+		Uid:       uid,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &kmsservice.EncryptResponse{
+		Ciphertext:  resp.Ciphertext,
+		KeyID:       resp.KeyId,
+		Annotations: resp.Annotations,
+	}, nil
+}
+
+func (c *kmsClient) Status(ctx context.Context) (*kmsservice.StatusResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	resp, err := c.client.Status(ctx, &kmsapi.StatusRequest{})
+	if err != nil {
+		return nil, err
+	}
+	return &kmsservice.StatusResponse{Version: resp.Version, Healthz: resp.Healthz, KeyID: resp.KeyId}, nil
+}
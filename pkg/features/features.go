@@ -25,6 +25,25 @@ const (
 	// ClusterProfile enables the controller that watches ClusterProfile and
 	// ManagedServiceAccount resources, syncing token secrets to ClusterProfile namespaces
 	ClusterProfile featuregate.Feature = "ClusterProfile"
+
+	// alpha: v0.1
+	//
+	// CredentialRevocation enables the controller that dispatches the CredentialRevocation
+	// requests to the ManagedServiceAccounts across the clusters and tracks their progress
+	CredentialRevocation featuregate.Feature = "CredentialRevocation"
+
+	// alpha: v0.1
+	//
+	// ManagedServiceAccountSet enables the controller that fans out the ManagedServiceAccountSets
+	// to the namespaces of the ManagedClusters decided by their Placements
+	ManagedServiceAccountSet featuregate.Feature = "ManagedServiceAccountSet"
+
+	// alpha: v0.1
+	//
+	// ClusterManagedServiceAccountTemplate enables the controller that provisions the
+	// ManagedServiceAccounts of the ClusterManagedServiceAccountTemplates on the matching clusters
+	// once the addon is available
+	ClusterManagedServiceAccountTemplate featuregate.Feature = "ClusterManagedServiceAccountTemplate"
 )
 
 var (
@@ -41,6 +60,9 @@ func init() {
 // feature keys.  To add a new feature, define a key for it above and
 // add it here.
 var DefaultManagedServiceAccountFeatureGates = map[featuregate.Feature]featuregate.FeatureSpec{
-	EphemeralIdentity: {Default: false, PreRelease: featuregate.Alpha},
-	ClusterProfile:    {Default: false, PreRelease: featuregate.Alpha},
+	EphemeralIdentity:                    {Default: false, PreRelease: featuregate.Alpha},
+	ClusterProfile:                       {Default: false, PreRelease: featuregate.Alpha},
+	CredentialRevocation:                 {Default: false, PreRelease: featuregate.Alpha},
+	ManagedServiceAccountSet:             {Default: false, PreRelease: featuregate.Alpha},
+	ClusterManagedServiceAccountTemplate: {Default: false, PreRelease: featuregate.Alpha},
 }
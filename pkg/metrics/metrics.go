@@ -0,0 +1,161 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const namespace = "managed_serviceaccount"
+
+var (
+	// TokenRotations counts the tokens issued for the ManagedServiceAccounts.
+	TokenRotations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "token_rotations_total",
+		Help:      "Number of the tokens issued for the ManagedServiceAccount.",
+	}, []string{"namespace", "name"})
+
+	// TokenReviewFailures counts the TokenReviews on the managed cluster which reject the token
+	// ("rejected") or fail ("error").
+	TokenReviewFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "token_review_failures_total",
+		Help:      "Number of the TokenReviews of the token which are rejected or fail.",
+	}, []string{"namespace", "name", "reason"})
+
+	// SinkDeliveryFailures counts the failures to deliver the credentials to the sinks.
+	SinkDeliveryFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sink_delivery_failures_total",
+		Help:      "Number of the failures to deliver the credential of the ManagedServiceAccount to the sink.",
+	}, []string{"namespace", "name", "sink"})
+
+	// StatusUpdateFailures counts the failures to update the status of the ManagedServiceAccounts.
+	StatusUpdateFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "status_update_failures_total",
+		Help:      "Number of the failures to update the status of the ManagedServiceAccount.",
+	}, []string{"namespace", "name"})
+
+	// TimeToTokenReported observes the time from the creation of the ManagedServiceAccounts to the
+	// first report of their tokens.
+	TimeToTokenReported = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "time_to_token_reported_seconds",
+		Help:      "Time from the creation of the ManagedServiceAccount to the first report of its token.",
+		Buckets:   []float64{1, 5, 10, 30, 60, 120, 300, 600, 1800, 3600},
+	})
+
+	// ClusterProfileSyncedSecrets is the number of the token secrets synced to the namespace of
+	// each ClusterProfile.
+	ClusterProfileSyncedSecrets = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "clusterprofile_synced_secrets",
+		Help:      "Number of the token secrets synced to the namespace of the ClusterProfile.",
+	}, []string{"namespace", "name"})
+
+	// ClusterProfileOrphanedSecrets counts the synced secrets deleted after their
+	// ManagedServiceAccounts are gone.
+	ClusterProfileOrphanedSecrets = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "clusterprofile_orphaned_secrets_total",
+		Help:      "Number of the orphaned synced secrets deleted from the namespace of the ClusterProfile.",
+	}, []string{"namespace", "name"})
+
+	// Tokens reports the expiry and the age of the tokens at the time of the scrape.
+	Tokens = NewTokenCollector()
+)
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(
+		TokenRotations,
+		TokenReviewFailures,
+		SinkDeliveryFailures,
+		StatusUpdateFailures,
+		TimeToTokenReported,
+		ClusterProfileSyncedSecrets,
+		ClusterProfileOrphanedSecrets,
+		Tokens,
+	)
+}
+
+// DeleteManagedServiceAccount removes the series of the deleted ManagedServiceAccount.
+func DeleteManagedServiceAccount(msaNamespace, msaName string) {
+	labels := prometheus.Labels{"namespace": msaNamespace, "name": msaName}
+	TokenRotations.DeletePartialMatch(labels)
+	TokenReviewFailures.DeletePartialMatch(labels)
+	SinkDeliveryFailures.DeletePartialMatch(labels)
+	StatusUpdateFailures.DeletePartialMatch(labels)
+	Tokens.Delete(msaNamespace, msaName)
+}
+
+type token struct {
+	issued   time.Time
+	expiring time.Time
+}
+
+// TokenCollector computes the seconds to the expiry and the age of the tokens when it is
+// scraped, so that the gauges never go stale between the reconciles.
+type TokenCollector struct {
+	now        func() time.Time
+	expiryDesc *prometheus.Desc
+	ageDesc    *prometheus.Desc
+
+	lock   sync.RWMutex
+	tokens map[types.NamespacedName]token
+}
+
+var _ prometheus.Collector = &TokenCollector{}
+
+func NewTokenCollector() *TokenCollector {
+	return &TokenCollector{
+		now: time.Now,
+		expiryDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "token_expiry_seconds"),
+			"Seconds until the current token of the ManagedServiceAccount expires.",
+			[]string{"namespace", "name"}, nil),
+		ageDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "token_age_seconds"),
+			"Seconds since the current token of the ManagedServiceAccount is issued.",
+			[]string{"namespace", "name"}, nil),
+		tokens: map[types.NamespacedName]token{},
+	}
+}
+
+// Set records the current token of the ManagedServiceAccount.
+func (c *TokenCollector) Set(msaNamespace, msaName string, issued, expiring time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.tokens[types.NamespacedName{Namespace: msaNamespace, Name: msaName}] = token{
+		issued:   issued,
+		expiring: expiring,
+	}
+}
+
+// Delete forgets the token of the ManagedServiceAccount.
+func (c *TokenCollector) Delete(msaNamespace, msaName string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.tokens, types.NamespacedName{Namespace: msaNamespace, Name: msaName})
+}
+
+func (c *TokenCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.expiryDesc
+	ch <- c.ageDesc
+}
+
+func (c *TokenCollector) Collect(ch chan<- prometheus.Metric) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	now := c.now()
+	for key, t := range c.tokens {
+		ch <- prometheus.MustNewConstMetric(c.expiryDesc, prometheus.GaugeValue,
+			t.expiring.Sub(now).Seconds(), key.Namespace, key.Name)
+		ch <- prometheus.MustNewConstMetric(c.ageDesc, prometheus.GaugeValue,
+			now.Sub(t.issued).Seconds(), key.Namespace, key.Name)
+	}
+}
@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenCollector(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name     string
+		set      map[string][2]time.Time
+		delete   []string
+		expected map[string]map[string]float64
+	}{
+		{
+			name:     "no token",
+			expected: map[string]map[string]float64{},
+		},
+		{
+			name: "tokens",
+			set: map[string][2]time.Time{
+				"msa1": {now.Add(-time.Hour), now.Add(2 * time.Hour)},
+				"msa2": {now.Add(-3 * time.Hour), now.Add(-time.Minute)},
+			},
+			expected: map[string]map[string]float64{
+				"managed_serviceaccount_token_expiry_seconds": {"msa1": 7200, "msa2": -60},
+				"managed_serviceaccount_token_age_seconds":    {"msa1": 3600, "msa2": 10800},
+			},
+		},
+		{
+			name: "deleted token",
+			set: map[string][2]time.Time{
+				"msa1": {now.Add(-time.Hour), now.Add(2 * time.Hour)},
+				"msa2": {now.Add(-3 * time.Hour), now.Add(-time.Minute)},
+			},
+			delete: []string{"msa2"},
+			expected: map[string]map[string]float64{
+				"managed_serviceaccount_token_expiry_seconds": {"msa1": 7200},
+				"managed_serviceaccount_token_age_seconds":    {"msa1": 3600},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			collector := NewTokenCollector()
+			collector.now = func() time.Time { return now }
+			for name, token := range c.set {
+				collector.Set("cluster1", name, token[0], token[1])
+			}
+			for _, name := range c.delete {
+				collector.Delete("cluster1", name)
+			}
+
+			registry := prometheus.NewPedanticRegistry()
+			assert.NoError(t, registry.Register(collector))
+			families, err := registry.Gather()
+			assert.NoError(t, err)
+
+			actual := map[string]map[string]float64{}
+			for _, family := range families {
+				values := map[string]float64{}
+				for _, metric := range family.GetMetric() {
+					labels := map[string]string{}
+					for _, label := range metric.GetLabel() {
+						labels[label.GetName()] = label.GetValue()
+					}
+					assert.Equal(t, "cluster1", labels["namespace"])
+					values[labels["name"]] = metric.GetGauge().GetValue()
+				}
+				actual[family.GetName()] = values
+			}
+			assert.Equal(t, c.expected, actual)
+		})
+	}
+}
+
+func TestDeleteManagedServiceAccount(t *testing.T) {
+	counters := []*prometheus.CounterVec{TokenRotations, TokenReviewFailures, SinkDeliveryFailures, StatusUpdateFailures}
+	for _, name := range []string{"msa1", "msa2"} {
+		TokenRotations.WithLabelValues("cluster1", name).Inc()
+		TokenReviewFailures.WithLabelValues("cluster1", name, "rejected").Inc()
+		SinkDeliveryFailures.WithLabelValues("cluster1", name, "vault").Inc()
+		StatusUpdateFailures.WithLabelValues("cluster1", name).Inc()
+	}
+
+	DeleteManagedServiceAccount("cluster1", "msa1")
+	for _, counter := range counters {
+		assert.Equal(t, 0, counter.DeletePartialMatch(prometheus.Labels{"namespace": "cluster1", "name": "msa1"}))
+		assert.Equal(t, 1, counter.DeletePartialMatch(prometheus.Labels{"namespace": "cluster1", "name": "msa2"}))
+	}
+}
@@ -0,0 +1,349 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	authnv1 "k8s.io/api/authentication/v1"
+	authzv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+	"open-cluster-management.io/managed-serviceaccount/pkg/common"
+	"open-cluster-management.io/managed-serviceaccount/pkg/envelope"
+)
+
+const (
+	// pathPrefix is followed by "<cluster>/managedserviceaccounts/<name>/" and the path on the
+	// api server of the managed cluster.
+	pathPrefix = "/clusters/"
+	// SubresourceProxy is the subresource of the ManagedServiceAccount the callers are authorized
+	// against, e.g. "get" on "managedserviceaccounts/proxy" for the GET requests.
+	SubresourceProxy = "proxy"
+)
+
+// Handler authenticates the callers on the hub cluster and forwards their requests to the api
+// servers of the managed clusters with the tokens of the ManagedServiceAccounts, so that the
+// callers never see the tokens.
+type Handler struct {
+	// HubClient reads the ManagedServiceAccounts, their token secrets and the ManagedClusters.
+	HubClient client.Reader
+	// HubNativeClient reviews the tokens and the access of the callers.
+	HubNativeClient kubernetes.Interface
+	// Envelope decrypts the token secrets of the envelope encryption, it is nil if no KMS plugin is
+	// configured.
+	Envelope *envelope.Envelope
+
+	lock       sync.Mutex
+	transports map[types.NamespacedName]*transport
+}
+
+type transport struct {
+	caData   []byte
+	certData []byte
+	*http.Transport
+}
+
+func NewHandler(hubClient client.Reader, hubNativeClient kubernetes.Interface) *Handler {
+	return &Handler{
+		HubClient:       hubClient,
+		HubNativeClient: hubNativeClient,
+		transports:      map[types.NamespacedName]*transport{},
+	}
+}
+
+// target is where the request is forwarded to, either the token or the client certificate and
+// key of the managed serviceaccount is set.
+type target struct {
+	server   *url.URL
+	token    string
+	certData []byte
+	keyData  []byte
+	caData   []byte
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	msa, subpath, ok := parsePath(req.URL.Path)
+	if !ok {
+		http.Error(w, "the path should be /clusters/<cluster>/managedserviceaccounts/<name>/...", http.StatusNotFound)
+		return
+	}
+
+	user, err := h.authenticate(req.Context(), req)
+	if err != nil {
+		klog.V(4).InfoS("Failed to authenticate", "err", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := h.authorize(req.Context(), user, verbOf(req.Method), msa); err != nil {
+		klog.V(4).InfoS("Forbidden", "user", user.Username, "managedServiceAccount", msa, "err", err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	t, rt, err := h.targetOf(req.Context(), msa)
+	if err != nil {
+		klog.ErrorS(err, "Failed to resolve the target", "managedServiceAccount", msa)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Director: func(out *http.Request) {
+			out.URL.Scheme = t.server.Scheme
+			out.URL.Host = t.server.Host
+			out.URL.Path = path.Join("/", t.server.Path, subpath)
+			if strings.HasSuffix(subpath, "/") && !strings.HasSuffix(out.URL.Path, "/") {
+				out.URL.Path += "/"
+			}
+			out.URL.RawPath = ""
+			out.Host = t.server.Host
+			// the identity of the caller is never forwarded to the managed cluster
+			for name := range out.Header {
+				if strings.HasPrefix(http.CanonicalHeaderKey(name), "Impersonate-") {
+					out.Header.Del(name)
+				}
+			}
+			// the token of the caller is replaced, or dropped if the client certificate is used
+			out.Header.Del("Authorization")
+			if len(t.token) > 0 {
+				out.Header.Set("Authorization", "Bearer "+t.token)
+			}
+		},
+		Transport: rt,
+		ErrorHandler: func(w http.ResponseWriter, _ *http.Request, err error) {
+			klog.ErrorS(err, "Failed to forward the request", "managedServiceAccount", msa)
+			http.Error(w, "failed to forward the request to the managed cluster", http.StatusBadGateway)
+		},
+	}
+	proxy.ServeHTTP(w, req)
+}
+
+// parsePath returns the ManagedServiceAccount and the path on the api server of the managed cluster.
+func parsePath(urlPath string) (types.NamespacedName, string, bool) {
+	if !strings.HasPrefix(urlPath, pathPrefix) {
+		return types.NamespacedName{}, "", false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(urlPath, pathPrefix), "/", 4)
+	if len(parts) < 3 || parts[1] != "managedserviceaccounts" || len(parts[0]) == 0 || len(parts[2]) == 0 {
+		return types.NamespacedName{}, "", false
+	}
+	subpath := "/"
+	if len(parts) == 4 {
+		subpath += parts[3]
+	}
+	return types.NamespacedName{Namespace: parts[0], Name: parts[2]}, subpath, true
+}
+
+// authenticate reviews the bearer token of the caller on the hub cluster.
+func (h *Handler) authenticate(ctx context.Context, req *http.Request) (*authnv1.UserInfo, error) {
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok || len(token) == 0 {
+		return nil, errors.New("no bearer token")
+	}
+	tr, err := h.HubNativeClient.AuthenticationV1().TokenReviews().Create(ctx, &authnv1.TokenReview{
+		Spec: authnv1.TokenReviewSpec{Token: token},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to review token")
+	}
+	if !tr.Status.Authenticated {
+		return nil, fmt.Errorf("token is not authenticated: %s", tr.Status.Error)
+	}
+	return &tr.Status.User, nil
+}
+
+// authorize checks whether the caller is allowed to proxy through the ManagedServiceAccount.
+func (h *Handler) authorize(ctx context.Context, user *authnv1.UserInfo, verb string, msa types.NamespacedName) error {
+	extra := map[string]authzv1.ExtraValue{}
+	for k, v := range user.Extra {
+		extra[k] = authzv1.ExtraValue(v)
+	}
+	sar, err := h.HubNativeClient.AuthorizationV1().SubjectAccessReviews().Create(ctx, &authzv1.SubjectAccessReview{
+		Spec: authzv1.SubjectAccessReviewSpec{
+			User:   user.Username,
+			Groups: user.Groups,
+			UID:    user.UID,
+			Extra:  extra,
+			ResourceAttributes: &authzv1.ResourceAttributes{
+				Namespace:   msa.Namespace,
+				Verb:        verb,
+				Group:       authv1beta1.GroupVersion.Group,
+				Resource:    "managedserviceaccounts",
+				Subresource: SubresourceProxy,
+				Name:        msa.Name,
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "failed to review access")
+	}
+	if !sar.Status.Allowed {
+		return fmt.Errorf("user %q cannot %s managedserviceaccounts/%s %s in namespace %s",
+			user.Username, verb, SubresourceProxy, msa.Name, msa.Namespace)
+	}
+	return nil
+}
+
+// targetOf returns the target and the transport of the ManagedServiceAccount. The cached transport
+// is evicted once the target can't be resolved, e.g. the ManagedServiceAccount or its token secret
+// is gone.
+func (h *Handler) targetOf(ctx context.Context, msa types.NamespacedName) (*target, http.RoundTripper, error) {
+	t, err := h.resolveTarget(ctx, msa)
+	if err == nil {
+		var rt http.RoundTripper
+		if rt, err = h.transportOf(msa, t); err == nil {
+			return t, rt, nil
+		}
+	}
+	h.evictTransport(msa)
+	return nil, nil, err
+}
+
+// resolveTarget reads the current token or client certificate, the server and the CA of the
+// managed cluster, so that the rotated credentials are picked up by the next request.
+func (h *Handler) resolveTarget(ctx context.Context, key types.NamespacedName) (*target, error) {
+	msa := &authv1beta1.ManagedServiceAccount{}
+	if err := h.HubClient.Get(ctx, key, msa); err != nil {
+		return nil, errors.Wrapf(err, "failed to get managed serviceaccount %s", key)
+	}
+	if msa.Status.TokenSecretRef == nil {
+		return nil, fmt.Errorf("the token of managed serviceaccount %s is not reported yet", key)
+	}
+
+	secret := &corev1.Secret{}
+	if err := h.HubClient.Get(ctx, types.NamespacedName{
+		Namespace: msa.Namespace,
+		Name:      msa.Status.TokenSecretRef.Name,
+	}, secret); err != nil {
+		return nil, errors.Wrapf(err, "failed to get the token secret of managed serviceaccount %s", key)
+	}
+	secret, err := h.Envelope.DecryptSecret(ctx, secret)
+	if err != nil {
+		return nil, err
+	}
+	t := &target{
+		token:    string(secret.Data[corev1.ServiceAccountTokenKey]),
+		certData: secret.Data[corev1.TLSCertKey],
+		keyData:  secret.Data[corev1.TLSPrivateKeyKey],
+	}
+	if len(t.token) == 0 && (len(t.certData) == 0 || len(t.keyData) == 0) {
+		return nil, fmt.Errorf("no token or client certificate found in the token secret of managed serviceaccount %s", key)
+	}
+
+	server, caData, err := h.resolveServer(ctx, msa.Namespace, secret)
+	if err != nil {
+		return nil, err
+	}
+	t.server, err = url.Parse(server)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid server URL of managed cluster %s", msa.Namespace)
+	}
+	t.caData = caData
+	return t, nil
+}
+
+// resolveServer returns the URL and the CA bundle of the api server of the managed cluster, the
+// server in the token secret of the Kubeconfig format takes precedence over the client config of
+// the ManagedCluster.
+func (h *Handler) resolveServer(ctx context.Context, clusterName string, secret *corev1.Secret) (string, []byte, error) {
+	caData := secret.Data[corev1.ServiceAccountRootCAKey]
+	if server := secret.Data[common.SecretKeyServer]; len(server) > 0 {
+		return string(server), caData, nil
+	}
+
+	cluster := &clusterv1.ManagedCluster{}
+	if err := h.HubClient.Get(ctx, types.NamespacedName{Name: clusterName}, cluster); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", nil, fmt.Errorf("managed cluster %s is not found", clusterName)
+		}
+		return "", nil, errors.Wrapf(err, "failed to get managed cluster %s", clusterName)
+	}
+	for _, config := range cluster.Spec.ManagedClusterClientConfigs {
+		if len(config.URL) == 0 {
+			continue
+		}
+		if len(config.CABundle) > 0 {
+			caData = config.CABundle
+		}
+		return config.URL, caData, nil
+	}
+	return "", nil, fmt.Errorf("no server URL found in the client configs of managed cluster %s", clusterName)
+}
+
+// transportOf returns the transport to the managed cluster, it is rebuilt once the CA or the client
+// certificate changes.
+func (h *Handler) transportOf(msa types.NamespacedName, target *target) (http.RoundTripper, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if t, ok := h.transports[msa]; ok && bytes.Equal(t.caData, target.caData) && bytes.Equal(t.certData, target.certData) {
+		return t, nil
+	}
+
+	pool := x509.NewCertPool()
+	if len(target.caData) > 0 && !pool.AppendCertsFromPEM(target.caData) {
+		return nil, fmt.Errorf("invalid CA bundle of managed serviceaccount %s", msa)
+	}
+	tlsConfig := &tls.Config{
+		RootCAs:    pool,
+		MinVersion: tls.VersionTLS12,
+	}
+	if len(target.token) == 0 {
+		cert, err := tls.X509KeyPair(target.certData, target.keyData)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid client certificate of managed serviceaccount %s", msa)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	rt := http.DefaultTransport.(*http.Transport).Clone()
+	rt.TLSClientConfig = tlsConfig
+	if t, ok := h.transports[msa]; ok {
+		t.CloseIdleConnections()
+	}
+	t := &transport{caData: target.caData, certData: target.certData, Transport: rt}
+	h.transports[msa] = t
+	return t, nil
+}
+
+// evictTransport removes the transport of the ManagedServiceAccount and closes its idle connections.
+func (h *Handler) evictTransport(msa types.NamespacedName) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if t, ok := h.transports[msa]; ok {
+		t.CloseIdleConnections()
+		delete(h.transports, msa)
+	}
+}
+
+// verbOf maps the HTTP method to the verb the caller is authorized for.
+func verbOf(method string) string {
+	switch method {
+	case http.MethodPost:
+		return "create"
+	case http.MethodPut:
+		return "update"
+	case http.MethodPatch:
+		return "patch"
+	case http.MethodDelete:
+		return "delete"
+	default:
+		return "get"
+	}
+}
@@ -0,0 +1,306 @@
+package proxy
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	authnv1 "k8s.io/api/authentication/v1"
+	authzv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	authv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
+	"open-cluster-management.io/managed-serviceaccount/pkg/common"
+)
+
+func TestParsePath(t *testing.T) {
+	cases := []struct {
+		name            string
+		path            string
+		expectedMSA     types.NamespacedName
+		expectedSubpath string
+		expectedOK      bool
+	}{
+		{
+			name:            "api path",
+			path:            "/clusters/cluster1/managedserviceaccounts/msa1/api/v1/namespaces/default/pods",
+			expectedMSA:     types.NamespacedName{Namespace: "cluster1", Name: "msa1"},
+			expectedSubpath: "/api/v1/namespaces/default/pods",
+			expectedOK:      true,
+		},
+		{
+			name:            "root path",
+			path:            "/clusters/cluster1/managedserviceaccounts/msa1",
+			expectedMSA:     types.NamespacedName{Namespace: "cluster1", Name: "msa1"},
+			expectedSubpath: "/",
+			expectedOK:      true,
+		},
+		{
+			name: "other resource",
+			path: "/clusters/cluster1/secrets/msa1/api",
+		},
+		{
+			name: "no name",
+			path: "/clusters/cluster1/managedserviceaccounts/",
+		},
+		{
+			name: "other prefix",
+			path: "/api/v1/pods",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			msa, subpath, ok := parsePath(c.path)
+			assert.Equal(t, c.expectedOK, ok)
+			if ok {
+				assert.Equal(t, c.expectedMSA, msa)
+				assert.Equal(t, c.expectedSubpath, subpath)
+			}
+		})
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	var forwarded *http.Request
+	spoke := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		forwarded = req
+		_, _ = io.WriteString(w, "ok")
+	}))
+	spoke.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	spoke.StartTLS()
+	defer spoke.Close()
+	caData := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: spoke.Certificate().Raw})
+	certData, keyData := newClientCertificate(t, "system:serviceaccount:open-cluster-management-managed-serviceaccount:msa1")
+
+	cases := []struct {
+		name           string
+		token          string
+		allowed        bool
+		objects        []client.Object
+		expectedStatus int
+		validateFunc   func(t *testing.T)
+	}{
+		{
+			name:           "unauthenticated",
+			token:          "invalid",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "forbidden",
+			token:          "caller-token",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "token not reported",
+			token:          "caller-token",
+			allowed:        true,
+			objects:        []client.Object{newProxyMSA(false)},
+			expectedStatus: http.StatusBadGateway,
+		},
+		{
+			name:    "forward with the token of the managed serviceaccount",
+			token:   "caller-token",
+			allowed: true,
+			objects: []client.Object{
+				newProxyMSA(true),
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "cluster1", Name: "msa1"},
+					Data: map[string][]byte{
+						corev1.ServiceAccountTokenKey:  []byte("msa-token"),
+						corev1.ServiceAccountRootCAKey: caData,
+					},
+				},
+				&clusterv1.ManagedCluster{
+					ObjectMeta: metav1.ObjectMeta{Name: "cluster1"},
+					Spec: clusterv1.ManagedClusterSpec{
+						ManagedClusterClientConfigs: []clusterv1.ClientConfig{{URL: spoke.URL}},
+					},
+				},
+			},
+			expectedStatus: http.StatusOK,
+			validateFunc: func(t *testing.T) {
+				assert.Equal(t, "/api/v1/namespaces/default/pods", forwarded.URL.Path)
+				assert.Equal(t, "limit=1", forwarded.URL.RawQuery)
+				assert.Equal(t, "Bearer msa-token", forwarded.Header.Get("Authorization"))
+				assert.Empty(t, forwarded.Header.Get("Impersonate-User"))
+				assert.Empty(t, forwarded.TLS.PeerCertificates)
+			},
+		},
+		{
+			name:    "forward with the client certificate of the managed serviceaccount",
+			token:   "caller-token",
+			allowed: true,
+			objects: []client.Object{
+				newProxyMSA(true),
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "cluster1", Name: "msa1"},
+					Data: map[string][]byte{
+						corev1.TLSCertKey:              certData,
+						corev1.TLSPrivateKeyKey:        keyData,
+						corev1.ServiceAccountRootCAKey: caData,
+					},
+				},
+				&clusterv1.ManagedCluster{
+					ObjectMeta: metav1.ObjectMeta{Name: "cluster1"},
+					Spec: clusterv1.ManagedClusterSpec{
+						ManagedClusterClientConfigs: []clusterv1.ClientConfig{{URL: spoke.URL}},
+					},
+				},
+			},
+			expectedStatus: http.StatusOK,
+			validateFunc: func(t *testing.T) {
+				assert.Empty(t, forwarded.Header.Get("Authorization"))
+				if assert.Len(t, forwarded.TLS.PeerCertificates, 1) {
+					assert.Equal(t, "system:serviceaccount:open-cluster-management-managed-serviceaccount:msa1",
+						forwarded.TLS.PeerCertificates[0].Subject.CommonName)
+				}
+			},
+		},
+		{
+			name:    "no credential in the token secret",
+			token:   "caller-token",
+			allowed: true,
+			objects: []client.Object{
+				newProxyMSA(true),
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "cluster1", Name: "msa1"},
+					Data: map[string][]byte{
+						corev1.TLSCertKey:              certData,
+						corev1.ServiceAccountRootCAKey: caData,
+					},
+				},
+			},
+			expectedStatus: http.StatusBadGateway,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			forwarded = nil
+			testscheme := runtime.NewScheme()
+			authv1beta1.AddToScheme(testscheme)
+			clusterv1.AddToScheme(testscheme)
+			corev1.AddToScheme(testscheme)
+			hubClient := fake.NewClientBuilder().WithScheme(testscheme).WithObjects(c.objects...).Build()
+
+			hubNativeClient := kubefake.NewSimpleClientset()
+			hubNativeClient.PrependReactor("create", "tokenreviews",
+				func(action clienttesting.Action) (bool, runtime.Object, error) {
+					tr := action.(clienttesting.CreateAction).GetObject().(*authnv1.TokenReview)
+					if tr.Spec.Token == "caller-token" {
+						tr.Status.Authenticated = true
+						tr.Status.User = authnv1.UserInfo{Username: "system:serviceaccount:default:caller"}
+					}
+					return true, tr, nil
+				})
+			hubNativeClient.PrependReactor("create", "subjectaccessreviews",
+				func(action clienttesting.Action) (bool, runtime.Object, error) {
+					sar := action.(clienttesting.CreateAction).GetObject().(*authzv1.SubjectAccessReview)
+					attrs := sar.Spec.ResourceAttributes
+					assert.Equal(t, "system:serviceaccount:default:caller", sar.Spec.User)
+					assert.Equal(t, "get", attrs.Verb)
+					assert.Equal(t, "managedserviceaccounts", attrs.Resource)
+					assert.Equal(t, SubresourceProxy, attrs.Subresource)
+					assert.Equal(t, "cluster1", attrs.Namespace)
+					assert.Equal(t, "msa1", attrs.Name)
+					sar.Status.Allowed = c.allowed
+					return true, sar, nil
+				})
+
+			req := httptest.NewRequest(http.MethodGet,
+				"/clusters/cluster1/managedserviceaccounts/msa1/api/v1/namespaces/default/pods?limit=1", nil)
+			req.Header.Set("Authorization", "Bearer "+c.token)
+			req.Header.Set("Impersonate-User", "admin")
+			recorder := httptest.NewRecorder()
+			NewHandler(hubClient, hubNativeClient).ServeHTTP(recorder, req)
+
+			assert.Equal(t, c.expectedStatus, recorder.Code)
+			if c.validateFunc != nil {
+				c.validateFunc(t)
+			}
+		})
+	}
+}
+
+func TestTransportEviction(t *testing.T) {
+	testscheme := runtime.NewScheme()
+	authv1beta1.AddToScheme(testscheme)
+	corev1.AddToScheme(testscheme)
+	msa := newProxyMSA(true)
+	hubClient := fake.NewClientBuilder().WithScheme(testscheme).WithObjects(
+		msa,
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "cluster1", Name: "msa1"},
+			Data: map[string][]byte{
+				corev1.ServiceAccountTokenKey: []byte("msa-token"),
+				common.SecretKeyServer:        []byte("https://cluster1:6443"),
+			},
+		},
+	).Build()
+	handler := NewHandler(hubClient, kubefake.NewSimpleClientset())
+	key := types.NamespacedName{Namespace: "cluster1", Name: "msa1"}
+
+	_, rt, err := handler.targetOf(context.TODO(), key)
+	assert.NoError(t, err)
+	assert.Same(t, rt, handler.transports[key])
+	_, cached, err := handler.targetOf(context.TODO(), key)
+	assert.NoError(t, err)
+	assert.Same(t, rt, cached)
+
+	// the transport is evicted once the managed serviceaccount is gone
+	assert.NoError(t, hubClient.Delete(context.TODO(), msa))
+	_, _, err = handler.targetOf(context.TODO(), key)
+	assert.ErrorContains(t, err, "failed to get managed serviceaccount cluster1/msa1")
+	assert.Empty(t, handler.transports)
+}
+
+func newProxyMSA(reported bool) *authv1beta1.ManagedServiceAccount {
+	msa := &authv1beta1.ManagedServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "cluster1", Name: "msa1"},
+	}
+	if reported {
+		msa.Status.TokenSecretRef = &authv1beta1.SecretRef{Name: "msa1"}
+	}
+	return msa
+}
+
+// newClientCertificate returns a self-signed client certificate and its key in PEM.
+func newClientCertificate(t *testing.T, commonName string) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
@@ -0,0 +1,75 @@
+package sink
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// fileExpirationTimestamp is the file of the expiration of the credential in the Directory sink.
+const fileExpirationTimestamp = "expirationTimestamp"
+
+// DirectoryConfig is the configuration of the Directory sink.
+type DirectoryConfig struct {
+	// Path is the directory on the filesystem of the agent, e.g. a mounted volume. The keys of the
+	// credential are written to the files in "<path>/<cluster>/<name>".
+	Path string `json:"path"`
+}
+
+type directorySink struct {
+	path string
+}
+
+func (s *directorySink) Deliver(_ context.Context, credential *Credential) error {
+	dir := filepath.Join(s.path, credential.ClusterName, credential.Name)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return errors.Wrapf(err, "failed to create the credential directory")
+	}
+
+	files := map[string][]byte{
+		fileExpirationTimestamp: []byte(credential.ExpirationTimestamp.UTC().Format(time.RFC3339)),
+	}
+	for key, value := range credential.Data {
+		files[key] = value
+	}
+	for name, data := range files {
+		if err := writeFileAtomically(dir, name, data); err != nil {
+			return errors.Wrapf(err, "failed to write the credential file %s", name)
+		}
+	}
+
+	// remove the keys of the former credential, e.g. "token" after switching to a client certificate
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read the credential directory")
+	}
+	for _, entry := range entries {
+		if _, ok := files[entry.Name()]; !ok && !entry.IsDir() {
+			if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil && !os.IsNotExist(err) {
+				return errors.Wrapf(err, "failed to remove the stale credential file %s", entry.Name())
+			}
+		}
+	}
+	return nil
+}
+
+// writeFileAtomically replaces the file by renaming a temporary file, so that the readers never see
+// a partially written credential.
+func writeFileAtomically(dir, name string, data []byte) error {
+	f, err := os.CreateTemp(dir, "."+name+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(dir, name))
+}
@@ -0,0 +1,127 @@
+package sink
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+// Type is the type of a sink.
+type Type string
+
+const (
+	// TypeVault writes the credentials to a KV secrets engine of HashiCorp Vault.
+	TypeVault Type = "Vault"
+	// TypeDirectory writes the credentials to the files in a local directory of the agent.
+	TypeDirectory Type = "Directory"
+	// TypeWebhook posts the credentials to an HTTPS endpoint.
+	TypeWebhook Type = "Webhook"
+)
+
+// requestTimeout is the timeout of the requests to the remote sinks.
+const requestTimeout = 30 * time.Second
+
+// Credential is an issued or rotated credential of a ManagedServiceAccount.
+type Credential struct {
+	// ClusterName is the name of the managed cluster, which is the namespace of the ManagedServiceAccount.
+	ClusterName string `json:"clusterName"`
+	// Name is the name of the ManagedServiceAccount.
+	Name string `json:"name"`
+	// ExpirationTimestamp is the time the credential expires.
+	ExpirationTimestamp time.Time `json:"expirationTimestamp"`
+	// Data are the keys of the token secret, e.g. "ca.crt" along with "token", or "tls.crt" and "tls.key".
+	Data map[string][]byte `json:"data"`
+}
+
+// Sink receives every credential issued or rotated for the ManagedServiceAccounts selecting it.
+type Sink interface {
+	// Deliver stores the credential in the sink, replacing the former credential of the same
+	// ManagedServiceAccount.
+	Deliver(ctx context.Context, credential *Credential) error
+}
+
+// Config is the configuration of a sink.
+type Config struct {
+	// Type is the type of the sink.
+	Type Type `json:"type"`
+	// TokenSecretName is the name of the Secret in the namespace of the agent holding the token
+	// which authenticates the agent to the Vault or the Webhook sink in the "token" key.
+	TokenSecretName string `json:"tokenSecretName,omitempty"`
+
+	Vault     *VaultConfig     `json:"vault,omitempty"`
+	Directory *DirectoryConfig `json:"directory,omitempty"`
+	Webhook   *WebhookConfig   `json:"webhook,omitempty"`
+}
+
+// Parse parses the YAML configuration of a sink.
+func Parse(data string) (*Config, error) {
+	config := &Config{}
+	if err := yaml.UnmarshalStrict([]byte(data), config); err != nil {
+		return nil, errors.Wrapf(err, "invalid sink configuration")
+	}
+	var err error
+	switch config.Type {
+	case TypeVault:
+		if config.Vault == nil || len(config.Vault.Address) == 0 {
+			err = errors.New("vault.address is required")
+		}
+	case TypeDirectory:
+		if config.Directory == nil || len(config.Directory.Path) == 0 {
+			err = errors.New("directory.path is required")
+		}
+	case TypeWebhook:
+		if config.Webhook == nil || len(config.Webhook.URL) == 0 {
+			err = errors.New("webhook.url is required")
+		}
+	default:
+		err = fmt.Errorf("unknown sink type %q", config.Type)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid sink configuration")
+	}
+	return config, nil
+}
+
+// New builds the sink of the configuration, the token authenticates the agent to the remote sinks.
+func New(config *Config, token string) (Sink, error) {
+	switch config.Type {
+	case TypeVault:
+		return newVaultSink(config.Vault, token)
+	case TypeDirectory:
+		return &directorySink{path: config.Directory.Path}, nil
+	case TypeWebhook:
+		return newWebhookSink(config.Webhook, token)
+	}
+	return nil, fmt.Errorf("unknown sink type %q", config.Type)
+}
+
+// newHTTPClient builds the client of a remote sink, the server is verified with the CA bundle if
+// it is set, or with the system roots otherwise.
+func newHTTPClient(caBundle string) (*http.Client, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if len(caBundle) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(caBundle)) {
+			return nil, errors.New("no certificate found in the CA bundle")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return &http.Client{
+		Timeout:   requestTimeout,
+		Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig},
+	}, nil
+}
+
+// checkResponse returns an error if the response of a remote sink is not successful.
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	return fmt.Errorf("unexpected response %s", resp.Status)
+}
@@ -0,0 +1,237 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newCredential() *Credential {
+	return &Credential{
+		ClusterName:         "cluster1",
+		Name:                "msa1",
+		ExpirationTimestamp: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		Data: map[string][]byte{
+			"ca.crt": []byte("ca"),
+			"token":  []byte("token"),
+		},
+	}
+}
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		name        string
+		data        string
+		expected    *Config
+		expectedErr string
+	}{
+		{
+			name: "vault",
+			data: `
+type: Vault
+tokenSecretName: vault-token
+vault:
+  address: https://vault:8200
+  kvVersion: 1
+`,
+			expected: &Config{
+				Type:            TypeVault,
+				TokenSecretName: "vault-token",
+				Vault:           &VaultConfig{Address: "https://vault:8200", KVVersion: 1},
+			},
+		},
+		{
+			name: "directory",
+			data: `{"type": "Directory", "directory": {"path": "/var/run/msa"}}`,
+			expected: &Config{
+				Type:      TypeDirectory,
+				Directory: &DirectoryConfig{Path: "/var/run/msa"},
+			},
+		},
+		{
+			name:        "missing webhook url",
+			data:        `type: Webhook`,
+			expectedErr: "invalid sink configuration: webhook.url is required",
+		},
+		{
+			name:        "unknown type",
+			data:        `type: S3`,
+			expectedErr: `invalid sink configuration: unknown sink type "S3"`,
+		},
+		{
+			name:        "unknown field",
+			data:        "type: Directory\ndirectory:\n  dir: /tmp",
+			expectedErr: `unknown field "dir"`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			config, err := Parse(c.data)
+			if len(c.expectedErr) > 0 {
+				assert.ErrorContains(t, err, c.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, c.expected, config)
+		})
+	}
+}
+
+func TestVaultSink(t *testing.T) {
+	cases := []struct {
+		name         string
+		config       VaultConfig
+		status       int
+		expectedPath string
+		expectedBody string
+		expectedErr  string
+	}{
+		{
+			name:         "kv v2",
+			config:       VaultConfig{Namespace: "team-a"},
+			status:       http.StatusNoContent,
+			expectedPath: "/v1/secret/data/managed-serviceaccounts/cluster1/msa1",
+			expectedBody: `{"data":{"ca.crt":"ca","expirationTimestamp":"2026-01-01T00:00:00Z","token":"token"}}`,
+		},
+		{
+			name:         "kv v1",
+			config:       VaultConfig{Mount: "/kv/", PathPrefix: "ocm", KVVersion: 1},
+			status:       http.StatusNoContent,
+			expectedPath: "/v1/kv/ocm/cluster1/msa1",
+			expectedBody: `{"ca.crt":"ca","expirationTimestamp":"2026-01-01T00:00:00Z","token":"token"}`,
+		},
+		{
+			name:         "permission denied",
+			status:       http.StatusForbidden,
+			expectedPath: "/v1/secret/data/managed-serviceaccounts/cluster1/msa1",
+			expectedBody: `{"data":{"ca.crt":"ca","expirationTimestamp":"2026-01-01T00:00:00Z","token":"token"}}`,
+			expectedErr:  "unexpected response 403 Forbidden",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, http.MethodPut, r.Method)
+				assert.Equal(t, c.expectedPath, r.URL.Path)
+				assert.Equal(t, "vault-token", r.Header.Get("X-Vault-Token"))
+				assert.Equal(t, c.config.Namespace, r.Header.Get("X-Vault-Namespace"))
+				body, err := io.ReadAll(r.Body)
+				assert.NoError(t, err)
+				assert.JSONEq(t, c.expectedBody, string(body))
+				w.WriteHeader(c.status)
+			}))
+			defer server.Close()
+
+			config := c.config
+			config.Address = server.URL
+			config.CABundle = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+			s, err := New(&Config{Type: TypeVault, Vault: &config}, "vault-token")
+			assert.NoError(t, err)
+			err = s.Deliver(context.TODO(), newCredential())
+			if len(c.expectedErr) > 0 {
+				assert.ErrorContains(t, err, c.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+
+	_, err := New(&Config{Type: TypeVault, Vault: &VaultConfig{Address: "https://vault:8200"}}, "")
+	assert.EqualError(t, err, "the Vault sink requires a token")
+	_, err = New(&Config{Type: TypeVault, Vault: &VaultConfig{Address: "http://vault:8200"}}, "vault-token")
+	assert.EqualError(t, err, `vault address "http://vault:8200" is not https`)
+}
+
+func TestDirectorySink(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(&Config{Type: TypeDirectory, Directory: &DirectoryConfig{Path: dir}}, "")
+	assert.NoError(t, err)
+	assert.NoError(t, s.Deliver(context.TODO(), newCredential()))
+
+	credentialDir := filepath.Join(dir, "cluster1", "msa1")
+	token, err := os.ReadFile(filepath.Join(credentialDir, "token"))
+	assert.NoError(t, err)
+	assert.Equal(t, "token", string(token))
+	info, err := os.Stat(filepath.Join(credentialDir, "token"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	// the keys of the former credential are removed
+	credential := newCredential()
+	credential.Data = map[string][]byte{"ca.crt": []byte("ca"), "tls.crt": []byte("cert"), "tls.key": []byte("key")}
+	assert.NoError(t, s.Deliver(context.TODO(), credential))
+	entries, err := os.ReadDir(credentialDir)
+	assert.NoError(t, err)
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.Equal(t, []string{"ca.crt", "expirationTimestamp", "tls.crt", "tls.key"}, names)
+}
+
+func TestWebhookSink(t *testing.T) {
+	var received *Credential
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer webhook-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		received = &Credential{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(received))
+	}))
+	defer server.Close()
+	caBundle := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+
+	cases := []struct {
+		name        string
+		config      WebhookConfig
+		token       string
+		expectedErr string
+	}{
+		{
+			name:   "delivered",
+			config: WebhookConfig{URL: server.URL, CABundle: caBundle},
+			token:  "webhook-token",
+		},
+		{
+			name:        "unauthorized",
+			config:      WebhookConfig{URL: server.URL, CABundle: caBundle},
+			expectedErr: "unexpected response 401 Unauthorized",
+		},
+		{
+			name:        "untrusted server",
+			config:      WebhookConfig{URL: server.URL},
+			token:       "webhook-token",
+			expectedErr: "failed to post the credential to the webhook",
+		},
+		{
+			name:        "plaintext",
+			config:      WebhookConfig{URL: "http://example.com"},
+			expectedErr: `webhook url "http://example.com" is not https`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			received = nil
+			s, err := New(&Config{Type: TypeWebhook, Webhook: &c.config}, c.token)
+			if err == nil {
+				err = s.Deliver(context.TODO(), newCredential())
+			}
+			if len(c.expectedErr) > 0 {
+				assert.ErrorContains(t, err, c.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, newCredential(), received)
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultVaultMount      = "secret"
+	defaultVaultPathPrefix = "managed-serviceaccounts"
+	// vaultKeyExpirationTimestamp is the key of the expiration of the credential in the Vault secret.
+	vaultKeyExpirationTimestamp = "expirationTimestamp"
+)
+
+// VaultConfig is the configuration of the Vault sink.
+type VaultConfig struct {
+	// Address is the https URL of the Vault server, e.g. "https://vault.example.com:8200".
+	Address string `json:"address"`
+	// Namespace is the Vault Enterprise namespace of the KV secrets engine.
+	Namespace string `json:"namespace,omitempty"`
+	// Mount is the path the KV secrets engine is mounted at, it defaults to "secret".
+	Mount string `json:"mount,omitempty"`
+	// PathPrefix is the prefix of the secret paths, the credential is written to
+	// "<pathPrefix>/<cluster>/<name>". It defaults to "managed-serviceaccounts".
+	PathPrefix string `json:"pathPrefix,omitempty"`
+	// KVVersion is the version of the KV secrets engine, either 1 or 2. It defaults to 2.
+	KVVersion int `json:"kvVersion,omitempty"`
+	// CABundle is the PEM encoded CA bundle to verify the Vault server.
+	CABundle string `json:"caBundle,omitempty"`
+}
+
+type vaultSink struct {
+	config *VaultConfig
+	token  string
+	client *http.Client
+}
+
+func newVaultSink(config *VaultConfig, token string) (*vaultSink, error) {
+	if len(token) == 0 {
+		return nil, errors.New("the Vault sink requires a token")
+	}
+	u, err := url.Parse(config.Address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid Vault address")
+	}
+	// the credentials are never sent in plaintext
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf("vault address %q is not https", config.Address)
+	}
+	if config.KVVersion != 0 && config.KVVersion != 1 && config.KVVersion != 2 {
+		return nil, fmt.Errorf("unsupported KV version %d", config.KVVersion)
+	}
+	client, err := newHTTPClient(config.CABundle)
+	if err != nil {
+		return nil, err
+	}
+	return &vaultSink{config: config, token: token, client: client}, nil
+}
+
+// secretURL returns the URL of the API writing the secret of the credential.
+func (s *vaultSink) secretURL(credential *Credential) (string, error) {
+	mount, prefix := s.config.Mount, s.config.PathPrefix
+	if len(mount) == 0 {
+		mount = defaultVaultMount
+	}
+	if len(prefix) == 0 {
+		prefix = defaultVaultPathPrefix
+	}
+	secretPath := path.Join(prefix, credential.ClusterName, credential.Name)
+	if s.config.KVVersion != 1 {
+		secretPath = path.Join("data", secretPath)
+	}
+	return url.JoinPath(s.config.Address, "v1", strings.Trim(mount, "/"), secretPath)
+}
+
+func (s *vaultSink) Deliver(ctx context.Context, credential *Credential) error {
+	secretURL, err := s.secretURL(credential)
+	if err != nil {
+		return errors.Wrapf(err, "invalid Vault address")
+	}
+
+	data := map[string]string{
+		vaultKeyExpirationTimestamp: credential.ExpirationTimestamp.UTC().Format(time.RFC3339),
+	}
+	for key, value := range credential.Data {
+		data[key] = string(value)
+	}
+	var body any = data
+	if s.config.KVVersion != 1 {
+		body = map[string]any{"data": data}
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, secretURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Vault-Token", s.token)
+	if len(s.config.Namespace) > 0 {
+		req.Header.Set("X-Vault-Namespace", s.config.Namespace)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "failed to write the credential to Vault")
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp); err != nil {
+		return errors.Wrapf(err, "failed to write the credential to Vault at %s", secretURL)
+	}
+	return nil
+}
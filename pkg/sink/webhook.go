@@ -0,0 +1,67 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+// WebhookConfig is the configuration of the Webhook sink.
+type WebhookConfig struct {
+	// URL is the HTTPS endpoint the credentials are posted to, the body is the JSON serialized
+	// Credential, in which the data are base64 encoded.
+	URL string `json:"url"`
+	// CABundle is the PEM encoded CA bundle to verify the endpoint.
+	CABundle string `json:"caBundle,omitempty"`
+}
+
+type webhookSink struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func newWebhookSink(config *WebhookConfig, token string) (*webhookSink, error) {
+	u, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid webhook url")
+	}
+	// the credentials are never sent in plaintext
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf("webhook url %q is not https", config.URL)
+	}
+	client, err := newHTTPClient(config.CABundle)
+	if err != nil {
+		return nil, err
+	}
+	return &webhookSink{url: config.URL, token: token, client: client}, nil
+}
+
+func (s *webhookSink) Deliver(ctx context.Context, credential *Credential) error {
+	payload, err := json.Marshal(credential)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(s.token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "failed to post the credential to the webhook")
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp); err != nil {
+		return errors.Wrapf(err, "failed to post the credential to the webhook %s", s.url)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultRefreshBefore rotates the token when 20% of its lifetime remains.
+const DefaultRefreshBefore = "20%"
+
+// RefreshBefore is how long before the expiration a token is rotated, either a duration or a
+// percentage of the lifetime of the token.
+type RefreshBefore struct {
+	Duration time.Duration
+	Percent  int
+}
+
+// ParseRefreshBefore parses a duration, e.g. "2h", or a percentage in [1, 99], e.g. "20%". An
+// empty string stands for DefaultRefreshBefore.
+func ParseRefreshBefore(s string) (RefreshBefore, error) {
+	if len(s) == 0 {
+		s = DefaultRefreshBefore
+	}
+	if value, ok := strings.CutSuffix(s, "%"); ok {
+		percent, err := strconv.Atoi(value)
+		if err != nil || percent < 1 || percent > 99 {
+			return RefreshBefore{}, fmt.Errorf("invalid percentage %q, must be in [1%%, 99%%]", s)
+		}
+		return RefreshBefore{Percent: percent}, nil
+	}
+	duration, err := time.ParseDuration(s)
+	if err != nil || duration <= 0 {
+		return RefreshBefore{}, fmt.Errorf("invalid duration %q, must be a positive duration or a percentage", s)
+	}
+	return RefreshBefore{Duration: duration}, nil
+}
+
+// Threshold returns the time to rotate the token issued at issued and expiring at expiring. A
+// duration not shorter than the lifetime of the token falls back to DefaultRefreshBefore, e.g.
+// when the managed cluster shortens the lifetime of the token.
+func (r RefreshBefore) Threshold(issued, expiring time.Time) time.Time {
+	lifetime := expiring.Sub(issued)
+	if r.Percent > 0 {
+		return expiring.Add(-lifetime * time.Duration(r.Percent) / 100)
+	}
+	if r.Duration < lifetime {
+		return expiring.Add(-r.Duration)
+	}
+	return expiring.Add(-lifetime / 5)
+}
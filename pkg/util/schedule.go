@@ -0,0 +1,130 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a standard cron schedule of five fields: minute, hour, day of month, month and day
+// of week. A field is "*", a value, a range "a-b", a list "a,b" or a step "*/n" or "a-b/n". The
+// day of week is 0-7 where both 0 and 7 are Sunday. As in cron, when both the day of month and
+// the day of week are restricted, a day matching either of them matches.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+}
+
+type scheduleField struct {
+	name     string
+	min, max int
+}
+
+var scheduleFields = []scheduleField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12},
+	{name: "day of week", min: 0, max: 7},
+}
+
+// ParseSchedule parses the cron schedule.
+func ParseSchedule(spec string) (*Schedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != len(scheduleFields) {
+		return nil, fmt.Errorf("expected %d fields in schedule %q, found %d", len(scheduleFields), spec, len(fields))
+	}
+
+	bits := make([]uint64, len(fields))
+	for i, field := range fields {
+		var err error
+		if bits[i], err = parseScheduleField(field, scheduleFields[i]); err != nil {
+			return nil, err
+		}
+	}
+	// Sunday is either 0 or 7
+	if bits[4]&(1<<7) > 0 {
+		bits[4] |= 1
+	}
+	return &Schedule{
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: fields[2] == "*",
+		dowStar: fields[4] == "*",
+	}, nil
+}
+
+func parseScheduleField(field string, bounds scheduleField) (uint64, error) {
+	var bits uint64
+	for _, expr := range strings.Split(field, ",") {
+		rangeExpr, step := expr, 1
+		if i := strings.Index(expr, "/"); i >= 0 {
+			var err error
+			rangeExpr = expr[:i]
+			if step, err = strconv.Atoi(expr[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %s %q", bounds.name, expr)
+			}
+		}
+
+		start, end := bounds.min, bounds.max
+		if rangeExpr != "*" {
+			var err error
+			lower, upper, isRange := strings.Cut(rangeExpr, "-")
+			if start, err = strconv.Atoi(lower); err != nil {
+				return 0, fmt.Errorf("invalid %s %q", bounds.name, expr)
+			}
+			end = start
+			if isRange {
+				if end, err = strconv.Atoi(upper); err != nil {
+					return 0, fmt.Errorf("invalid %s %q", bounds.name, expr)
+				}
+			} else if step > 1 {
+				// "a/n" stands for "a-max/n"
+				end = bounds.max
+			}
+		}
+		if start < bounds.min || end > bounds.max || start > end {
+			return 0, fmt.Errorf("%s %q out of range [%d, %d]", bounds.name, expr, bounds.min, bounds.max)
+		}
+
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// Next returns the first time matching the schedule strictly after t, or the zero time if no time
+// matches within five years, e.g. "0 0 30 2 *".
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Add(time.Minute).Truncate(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) matchDay(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) > 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) > 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
@@ -0,0 +1,142 @@
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduleNext(t *testing.T) {
+	// 2024-01-01 is a Monday
+	from := time.Date(2024, 1, 1, 10, 30, 20, 0, time.UTC)
+	cases := []struct {
+		name          string
+		schedule      string
+		expected      time.Time
+		expectedError string
+	}{
+		{
+			name:     "every minute",
+			schedule: "* * * * *",
+			expected: time.Date(2024, 1, 1, 10, 31, 0, 0, time.UTC),
+		},
+		{
+			name:     "daily",
+			schedule: "0 2 * * *",
+			expected: time.Date(2024, 1, 2, 2, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "weekly on saturday",
+			schedule: "0 2 * * 6",
+			expected: time.Date(2024, 1, 6, 2, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "sunday as 7",
+			schedule: "0 0 * * 7",
+			expected: time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "steps and ranges",
+			schedule: "*/15 9-17 * * 1-5",
+			expected: time.Date(2024, 1, 1, 10, 45, 0, 0, time.UTC),
+		},
+		{
+			name:     "lists",
+			schedule: "0 8,20 * * *",
+			expected: time.Date(2024, 1, 1, 20, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "day of month or day of week",
+			schedule: "0 0 15 * 3",
+			expected: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "monthly",
+			schedule: "0 0 1 */3 *",
+			expected: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "never",
+			schedule: "0 0 30 2 *",
+		},
+		{
+			name:          "wrong number of fields",
+			schedule:      "0 2 * *",
+			expectedError: `expected 5 fields in schedule "0 2 * *", found 4`,
+		},
+		{
+			name:          "out of range",
+			schedule:      "0 24 * * *",
+			expectedError: `hour "24" out of range [0, 23]`,
+		},
+		{
+			name:          "invalid step",
+			schedule:      "*/0 * * * *",
+			expectedError: `invalid step in minute "*/0"`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			schedule, err := ParseSchedule(c.schedule)
+			if len(c.expectedError) > 0 {
+				assert.EqualError(t, err, c.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, c.expected, schedule.Next(from))
+		})
+	}
+}
+
+func TestRefreshBeforeThreshold(t *testing.T) {
+	issued := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	expiring := issued.Add(10 * time.Hour)
+	cases := []struct {
+		name          string
+		refreshBefore string
+		expected      time.Time
+		expectedError string
+	}{
+		{
+			name:     "default",
+			expected: issued.Add(8 * time.Hour),
+		},
+		{
+			name:          "percentage",
+			refreshBefore: "50%",
+			expected:      issued.Add(5 * time.Hour),
+		},
+		{
+			name:          "duration",
+			refreshBefore: "90m",
+			expected:      issued.Add(8*time.Hour + 30*time.Minute),
+		},
+		{
+			name:          "duration longer than the lifetime",
+			refreshBefore: "10h",
+			expected:      issued.Add(8 * time.Hour),
+		},
+		{
+			name:          "invalid percentage",
+			refreshBefore: "100%",
+			expectedError: `invalid percentage "100%", must be in [1%, 99%]`,
+		},
+		{
+			name:          "invalid duration",
+			refreshBefore: "1d",
+			expectedError: `invalid duration "1d", must be a positive duration or a percentage`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			refreshBefore, err := ParseRefreshBefore(c.refreshBefore)
+			if len(c.expectedError) > 0 {
+				assert.EqualError(t, err, c.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, c.expected, refreshBefore.Threshold(issued, expiring))
+		})
+	}
+}